@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 发射录音 (off-air log)：记录本机实际发出的节目，每小时一个 WAV 文件，
+// 节目源时间线以 cue/labl 标记嵌入文件，Audacity 等编辑器可直接显示。
+
+const (
+	// /dirs 中发射录音目录的前缀，例如 "airlog/2025-10-14"
+	airlogDirPrefix     = "airlog/"
+	airlogFlushInterval = 10 * time.Second
+	// 发射中断超过该时长后重新开始发射时补一个时间标记
+	airlogGapMarker = 2 * time.Second
+)
+
+// airlogMarker 是发射录音时间线上的一个标记
+type airlogMarker struct {
+	Offset float64 `json:"offset"` // 距文件开头的秒数
+	Label  string  `json:"label"`
+}
+
+type airlogCue struct {
+	sample uint32
+	label  string
+}
+
+// airlogRecorder 只由 recivePCM 调用，不需要加锁
+type airlogRecorder struct {
+	file      *os.File
+	hour      time.Time
+	samples   uint32
+	cues      []airlogCue
+	label     string
+	lastWrite time.Time
+	lastFlush time.Time
+}
+
+var airlog airlogRecorder
+
+// airlogTitles 保存各节目源当前播放的内容（曲目名、电台名等），用于时间线标签
+var airlogTitles = struct {
+	sync.Mutex
+	titles map[string]string
+}{titles: make(map[string]string)}
+
+func setAirlogTitle(source, title string) {
+	airlogTitles.Lock()
+	airlogTitles.titles[source] = title
+	airlogTitles.Unlock()
+}
+
+func airlogLabel(sources []string) string {
+	airlogTitles.Lock()
+	defer airlogTitles.Unlock()
+	parts := make([]string, len(sources))
+	for i, source := range sources {
+		parts[i] = source
+		if title := airlogTitles.titles[source]; title != "" {
+			parts[i] = source + ": " + title
+		}
+	}
+	return strings.Join(parts, " + ")
+}
+
+func airlogHour(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
+}
+
+// Process 记录一帧最终混音。pcm 为 nil 表示本帧没有发射，只做整点切换和落盘。
+// wideband 表示 pcm 为 16 kHz（Opus 模式），录音统一保存为 8 kHz。
+func (a *airlogRecorder) Process(pcm []int, wideband bool, sources []string, now time.Time) {
+	if conf.System.AirlogFilePath == "" {
+		return
+	}
+	if a.file != nil && !airlogHour(now).Equal(a.hour) {
+		a.close()
+	}
+	if pcm == nil {
+		if a.file != nil && now.Sub(a.lastFlush) >= airlogFlushInterval {
+			a.flush(now)
+		}
+		return
+	}
+
+	if a.file == nil {
+		if err := a.open(now); err != nil {
+			log.Printf("创建发射录音文件失败: %v", err)
+			return
+		}
+	}
+
+	label := airlogLabel(sources)
+	if label != a.label || now.Sub(a.lastWrite) > airlogGapMarker {
+		a.cues = append(a.cues, airlogCue{sample: a.samples, label: now.Format("15:04:05") + " " + label})
+		a.label = label
+	}
+
+	if wideband {
+		pcm = downsample16To8Int(pcm)
+	}
+	data := make([]byte, len(pcm)*2)
+	for i, sample := range pcm {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(int16(AdjustVolumeInt(sample, conf.System.Volume))))
+	}
+	if _, err := a.file.Write(data); err != nil {
+		log.Printf("写入发射录音失败: %v", err)
+		a.close()
+		return
+	}
+	a.samples += uint32(len(pcm))
+	a.lastWrite = now
+
+	if now.Sub(a.lastFlush) >= airlogFlushInterval {
+		a.flush(now)
+	}
+}
+
+func (a *airlogRecorder) open(now time.Time) error {
+	dir := filepath.Join(conf.System.AirlogFilePath, now.Format("2006-01-02"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("TX_%s.wav", now.Format("2006-01-02_150405")))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(file, binary.LittleEndian, createWAVHeader(0)); err != nil {
+		file.Close()
+		return err
+	}
+	*a = airlogRecorder{file: file, hour: airlogHour(now), lastFlush: now}
+	log.Printf("📼 开始发射录音: %s", path)
+	return nil
+}
+
+// flush 更新 WAV 头中的长度，程序异常退出时已写入的部分仍可播放
+func (a *airlogRecorder) flush(now time.Time) {
+	a.lastFlush = now
+	if err := a.writeHeader(0); err != nil {
+		log.Printf("更新发射录音文件头失败: %v", err)
+	}
+}
+
+func (a *airlogRecorder) writeHeader(extra uint32) error {
+	header := createWAVHeader(a.samples * 2)
+	header.FileSize += extra
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	_, err := a.file.WriteAt(buf.Bytes(), 0)
+	return err
+}
+
+// close 在数据之后追加时间线标记并关闭文件
+func (a *airlogRecorder) close() {
+	if a.file == nil {
+		return
+	}
+	path := a.file.Name()
+	if a.samples == 0 {
+		a.file.Close()
+		os.Remove(path)
+		*a = airlogRecorder{}
+		return
+	}
+
+	timeline := encodeAirlogCues(a.cues)
+	if _, err := a.file.Write(timeline); err != nil {
+		log.Printf("写入发射录音时间线失败: %v", err)
+	} else if err := a.writeHeader(uint32(len(timeline))); err != nil {
+		log.Printf("更新发射录音文件头失败: %v", err)
+	}
+	if err := a.file.Close(); err != nil {
+		log.Printf("关闭发射录音失败: %v", err)
+	}
+	log.Printf("📼 发射录音完成: %s (%d 秒, %d 个标记)", path, a.samples/sampleRate, len(a.cues))
+	*a = airlogRecorder{}
+}
+
+// encodeAirlogCues 生成 "cue " 和 "LIST"/"adtl" 两个 RIFF 块
+func encodeAirlogCues(cues []airlogCue) []byte {
+	if len(cues) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+
+	buf.WriteString("cue ")
+	binary.Write(&buf, le, uint32(4+24*len(cues)))
+	binary.Write(&buf, le, uint32(len(cues)))
+	for i, cue := range cues {
+		binary.Write(&buf, le, uint32(i+1)) // cue ID
+		binary.Write(&buf, le, cue.sample)  // position
+		buf.WriteString("data")
+		binary.Write(&buf, le, uint32(0)) // chunk start
+		binary.Write(&buf, le, uint32(0)) // block start
+		binary.Write(&buf, le, cue.sample)
+	}
+
+	var labels bytes.Buffer
+	labels.WriteString("adtl")
+	for i, cue := range cues {
+		text := append([]byte(cue.label), 0)
+		labels.WriteString("labl")
+		binary.Write(&labels, le, uint32(4+len(text)))
+		binary.Write(&labels, le, uint32(i+1))
+		labels.Write(text)
+		if len(text)%2 == 1 {
+			labels.WriteByte(0)
+		}
+	}
+	buf.WriteString("LIST")
+	binary.Write(&buf, le, uint32(labels.Len()))
+	buf.Write(labels.Bytes())
+	return buf.Bytes()
+}
+
+// readAirlogTimeline 读取发射录音中嵌入的时间线标记
+func readAirlogTimeline(path string) ([]airlogMarker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(file, riff); err != nil {
+		return nil, err
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+
+	rate := uint32(sampleRate) // 网络电台录音为 16 kHz，以 fmt 块为准
+	positions := make(map[uint32]uint32)
+	labels := make(map[uint32]string)
+	var order []uint32
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(file, header); err != nil {
+			break
+		}
+		id := string(header[:4])
+		size := binary.LittleEndian.Uint32(header[4:])
+		switch id {
+		case "fmt ", "cue ", "LIST":
+			if size > 1<<20 {
+				return nil, fmt.Errorf("%q chunk too large", id)
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(file, body); err != nil {
+				return nil, err
+			}
+			if id == "fmt " {
+				if len(body) >= 8 && binary.LittleEndian.Uint32(body[4:]) > 0 {
+					rate = binary.LittleEndian.Uint32(body[4:])
+				}
+			} else if id == "cue " {
+				for i := 4; i+24 <= len(body); i += 24 {
+					cueID := binary.LittleEndian.Uint32(body[i:])
+					positions[cueID] = binary.LittleEndian.Uint32(body[i+20:])
+					order = append(order, cueID)
+				}
+			} else if len(body) >= 4 && string(body[:4]) == "adtl" {
+				for i := 4; i+12 <= len(body); {
+					subSize := int(binary.LittleEndian.Uint32(body[i+4:]))
+					end := min(i+8+subSize, len(body))
+					if string(body[i:i+4]) == "labl" && subSize >= 4 {
+						text := body[i+12 : end]
+						labels[binary.LittleEndian.Uint32(body[i+8:])] = string(bytes.TrimRight(text, "\x00"))
+					}
+					i = end + end%2
+				}
+			}
+		default:
+			if _, err := file.Seek(int64(size), io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+		if size%2 == 1 {
+			file.Seek(1, io.SeekCurrent)
+		}
+	}
+
+	markers := make([]airlogMarker, 0, len(order))
+	for _, cueID := range order {
+		markers = append(markers, airlogMarker{
+			Offset: float64(positions[cueID]) / float64(rate),
+			Label:  labels[cueID],
+		})
+	}
+	return markers, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAirlogRecorderWritesHourlyFilesWithTimeline(t *testing.T) {
+	originalPath, originalVolume := conf.System.AirlogFilePath, conf.System.Volume
+	t.Cleanup(func() {
+		conf.System.AirlogFilePath, conf.System.Volume = originalPath, originalVolume
+	})
+	conf.System.AirlogFilePath = t.TempDir()
+	conf.System.Volume = 1
+	setAirlogTitle("music", "song-0001.mp3")
+
+	frame := make([]int, 160)
+	for i := range frame {
+		frame[i] = 1000
+	}
+	start := time.Date(2026, 10, 19, 9, 59, 58, 0, time.Local)
+	now := start
+	var a airlogRecorder
+	for i := 0; i < 50; i++ { // 1 s music
+		a.Process(frame, false, []string{"music"}, now)
+		now = now.Add(20 * time.Millisecond)
+	}
+	for i := 0; i < 25; i++ { // 0.5 s music + beacon
+		a.Process(frame, false, []string{"beacon", "music"}, now)
+		now = now.Add(20 * time.Millisecond)
+	}
+	// The next hour closes the 09:00 file and starts a new one.
+	now = start.Add(5 * time.Second)
+	a.Process(make([]int, opusFrameSamples), true, []string{"mic"}, now)
+	a.close()
+
+	dir := filepath.Join(conf.System.AirlogFilePath, "2026-10-19")
+	first := filepath.Join(dir, "TX_2026-10-19_095958.wav")
+	markers, err := readAirlogTimeline(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []airlogMarker{
+		{Offset: 0, Label: "09:59:58 music: song-0001.mp3"},
+		{Offset: 1, Label: "09:59:59 beacon + music: song-0001.mp3"},
+	}
+	if len(markers) != len(want) {
+		t.Fatalf("markers = %+v, want %+v", markers, want)
+	}
+	for i := range want {
+		if markers[i] != want[i] {
+			t.Fatalf("marker %d = %+v, want %+v", i, markers[i], want[i])
+		}
+	}
+
+	pcm, err := decodeAudioFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1.5 s of 8 kHz audio resampled to 16 kHz by the decoder.
+	if len(pcm) != 24000 {
+		t.Fatalf("decoded samples = %d, want 24000", len(pcm))
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "TX_2026-10-19_100003.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 16 kHz Opus-mode frame is stored as 160 samples at 8 kHz.
+	if info.Size() < 44+320 {
+		t.Fatalf("second file size = %d", info.Size())
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultAnnounceTemplate = "现在时间 {hour} 点 {minute} 分"
+	// A short pause between phrase clips keeps concatenated words from
+	// running into each other when the clips are trimmed tightly.
+	announceClipGapSamples = playbackSampleRate * 50 / 1000
+)
+
+var announcePlaceholderRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+// announceMu keeps cron, API and AT triggers from speaking over each other.
+var announceMu sync.Mutex
+
+// phraseLibrary maps a lower-case clip name ("7", "hours", "b") to the
+// audio file that speaks it.
+type phraseLibrary map[string]string
+
+func loadPhraseLibrary(dir string) (phraseLibrary, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("announcement clip path is not configured")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read announcement clips %s: %w", dir, err)
+	}
+	library := make(phraseLibrary)
+	for _, entry := range entries {
+		if entry.IsDir() || !isSupportedAudioFile(entry.Name()) {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		library[strings.ToLower(name)] = filepath.Join(dir, entry.Name())
+	}
+	return library, nil
+}
+
+func (l phraseLibrary) has(name string) bool {
+	_, ok := l[strings.ToLower(name)]
+	return ok
+}
+
+// numberClips spells n with the clips the library provides. A clip for the
+// whole number wins; otherwise tens and ones are combined either as "20" +
+// "5" or, for Chinese style libraries, "2" + "10" + "5". Digits are the last
+// resort so a library with only 0-9 still works.
+func (l phraseLibrary) numberClips(n int) []string {
+	key := strconv.Itoa(n)
+	if l.has(key) {
+		return []string{key}
+	}
+	if n >= 10 && n < 100 {
+		tens, ones := n/10, n%10
+		var clips []string
+		if l.has(strconv.Itoa(tens * 10)) {
+			clips = []string{strconv.Itoa(tens * 10)}
+		} else if l.has("10") {
+			if tens > 1 {
+				clips = append(clips, l.numberClips(tens)...)
+			}
+			clips = append(clips, "10")
+		}
+		if clips != nil {
+			if ones > 0 {
+				clips = append(clips, l.numberClips(ones)...)
+			}
+			return clips
+		}
+	}
+	clips := make([]string, 0, len(key))
+	for _, digit := range key {
+		clips = append(clips, string(digit))
+	}
+	return clips
+}
+
+// expandAnnounceTemplate turns a template such as "现在时间 {hour} 点 {minute} 分"
+// into the ordered clip names that speak it at the given time.
+func expandAnnounceTemplate(template string, library phraseLibrary, now time.Time) ([]string, error) {
+	var clips []string
+	for _, field := range strings.Fields(template) {
+		last := 0
+		for _, match := range announcePlaceholderRegex.FindAllStringSubmatchIndex(field, -1) {
+			if literal := field[last:match[0]]; literal != "" {
+				clips = append(clips, literal)
+			}
+			placeholder := field[match[2]:match[3]]
+			switch strings.ToLower(placeholder) {
+			case "year":
+				clips = append(clips, library.numberClips(now.Year())...)
+			case "month":
+				clips = append(clips, library.numberClips(int(now.Month()))...)
+			case "day":
+				clips = append(clips, library.numberClips(now.Day())...)
+			case "hour":
+				clips = append(clips, library.numberClips(now.Hour())...)
+			case "hour12":
+				hour := now.Hour() % 12
+				if hour == 0 {
+					hour = 12
+				}
+				clips = append(clips, library.numberClips(hour)...)
+			case "minute":
+				clips = append(clips, library.numberClips(now.Minute())...)
+			case "callsign":
+				for _, char := range conf.System.Callsign {
+					clips = append(clips, string(char))
+				}
+			case "ssid":
+				clips = append(clips, library.numberClips(int(conf.System.SSID))...)
+			default:
+				return nil, fmt.Errorf("unknown announcement placeholder {%s}", placeholder)
+			}
+			last = match[1]
+		}
+		if literal := field[last:]; literal != "" {
+			clips = append(clips, literal)
+		}
+	}
+	if len(clips) == 0 {
+		return nil, fmt.Errorf("announcement template is empty")
+	}
+	var missing []string
+	for _, clip := range clips {
+		if !library.has(clip) {
+			missing = append(missing, clip)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("announcement clips not found: %s", strings.Join(missing, ", "))
+	}
+	return clips, nil
+}
+
+// composeAnnouncement concatenates the phrase clips for template into one
+// 16 kHz PCM buffer.
+func composeAnnouncement(template string, now time.Time) ([]int, error) {
+	if strings.TrimSpace(template) == "" {
+		template = conf.System.AnnounceTemplate
+	}
+	library, err := loadPhraseLibrary(conf.System.AnnounceClipPath)
+	if err != nil {
+		return nil, err
+	}
+	clips, err := expandAnnounceTemplate(template, library, now)
+	if err != nil {
+		return nil, err
+	}
+	decoded := make(map[string][]int, len(clips))
+	var pcm []int
+	for i, clip := range clips {
+		key := strings.ToLower(clip)
+		samples, ok := decoded[key]
+		if !ok {
+			samples, err = decodeAudioFile(library[key])
+			if err != nil {
+				return nil, fmt.Errorf("decode announcement clip %q: %w", clip, err)
+			}
+			decoded[key] = samples
+		}
+		if i > 0 {
+			pcm = append(pcm, make([]int, announceClipGapSamples)...)
+		}
+		pcm = append(pcm, samples...)
+	}
+	return pcm, nil
+}
+
+// playAnnouncement composes template for the current time and queues it on
+// the announcement mixer input. An empty template uses AnnounceTemplate.
+func playAnnouncement(template string) error {
+	if !announceMu.TryLock() {
+		return fmt.Errorf("an announcement is already playing")
+	}
+	pcm, err := composeAnnouncement(template, time.Now())
+	if err != nil {
+		announceMu.Unlock()
+		return err
+	}
+	go func() {
+		defer announceMu.Unlock()
+		log.Printf("🗣️ 播放语音报时 (%.1f 秒)", float64(len(pcm))/playbackSampleRate)
+		const shown = "Announcement Playing..."
+		text, percent, playing := playStatus()
+		updatePlayStatus(shown, 0, true)
+		defer restorePlayStatus(shown, text, percent, playing)
+		onAir := beginAsrun("announce", template, "")
+		for i := 0; i < len(pcm); i += opusFrameSamples {
+			end := min(i+opusFrameSamples, len(pcm))
+			chunk := make([]int, opusFrameSamples)
+			copy(chunk, pcm[i:end])
+			announcePCM <- [][]int{chunk}
+		}
+		onAir.finish(false)
+	}()
+	return nil
+}
+
+func startAnnounceCron() {
+	if conf.System.AnnounceCron == "" || conf.System.AnnounceClipPath == "" {
+		log.Println("未启动自动语音报时功能，因为没有配置短语素材目录或者调度字符串没有配置")
+		return
+	}
+
+	c := cron.New()
+	if _, err := c.AddFunc(conf.System.AnnounceCron, func() {
+		if err := playAnnouncement(""); err != nil {
+			log.Printf("语音报时失败: %v", err)
+		}
+	}); err != nil {
+		log.Println("add announce cron err", err)
+		return
+	}
+	c.Start()
+	log.Println("自动语音报时功能启动", conf.System.AnnounceCron)
+}
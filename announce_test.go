@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writePhraseClip(t *testing.T, dir, name string, samples int) {
+	t.Helper()
+	var wav bytes.Buffer
+	if err := binary.Write(&wav, binary.LittleEndian, createWAVHeader(uint32(samples*2))); err != nil {
+		t.Fatal(err)
+	}
+	for i := range samples {
+		binary.Write(&wav, binary.LittleEndian, int16(1000+i%100))
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), wav.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPhraseLibraryNumberClips(t *testing.T) {
+	chinese := phraseLibrary{"2": "", "5": "", "10": ""}
+	western := phraseLibrary{"20": "", "5": "", "15": ""}
+	digits := phraseLibrary{"1": "", "2": "", "3": ""}
+	for _, test := range []struct {
+		library phraseLibrary
+		n       int
+		want    []string
+	}{
+		{chinese, 25, []string{"2", "10", "5"}},
+		{chinese, 15, []string{"10", "5"}},
+		{chinese, 20, []string{"2", "10"}},
+		{western, 25, []string{"20", "5"}},
+		{western, 15, []string{"15"}},
+		{digits, 123, []string{"1", "2", "3"}},
+	} {
+		if got := test.library.numberClips(test.n); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("numberClips(%d) = %v, want %v", test.n, got, test.want)
+		}
+	}
+}
+
+func TestExpandAnnounceTemplate(t *testing.T) {
+	library := phraseLibrary{"现在时间": "", "点": "", "分": "", "9": "", "10": "", "3": "", "5": ""}
+	now := time.Date(2026, 10, 19, 9, 35, 0, 0, time.Local)
+	got, err := expandAnnounceTemplate("现在时间 {hour}点 {minute} 分", library, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"现在时间", "9", "点", "3", "10", "5", "分"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("clips = %v, want %v", got, want)
+	}
+
+	if _, err := expandAnnounceTemplate("{weather}", library, now); err == nil {
+		t.Fatal("unknown placeholder was accepted")
+	}
+	if _, err := expandAnnounceTemplate("hello {hour}", library, now); err == nil {
+		t.Fatal("missing clip was accepted")
+	}
+}
+
+func TestComposeAnnouncementConcatenatesClips(t *testing.T) {
+	original := conf.System.AnnounceClipPath
+	t.Cleanup(func() { conf.System.AnnounceClipPath = original })
+
+	dir := t.TempDir()
+	conf.System.AnnounceClipPath = dir
+	writePhraseClip(t, dir, "time.wav", 800)
+	writePhraseClip(t, dir, "1.wav", 400)
+	writePhraseClip(t, dir, "2.WAV", 400)
+
+	pcm, err := composeAnnouncement("time {hour}", time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8 kHz clips are resampled to 16 kHz and separated by the clip gap.
+	want := 1600 + 800 + 800 + 2*announceClipGapSamples
+	if len(pcm) != want {
+		t.Fatalf("announcement samples = %d, want %d", len(pcm), want)
+	}
+}
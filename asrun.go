@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 播出日志 (as-run log)：记录每一个实际发出的节目（音乐、信标、定时音频、语音报时、
+// 紧急告警、网络电台、麦克风），每天一个 JSON Lines 文件，可通过 /api/asrun 查询。
+
+const (
+	asrunFilePrefix = "asrun-"
+	asrunFileSuffix = ".jsonl"
+	// 麦克风超过该时长没有声音进入混音即认为本次通话结束
+	asrunMicGap       = 2 * time.Second
+	maxAsrunQueryDays = 366
+)
+
+// asrunEntry 是播出日志中的一条记录
+type asrunEntry struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Source      string    `json:"source"`          // music/beacon/scheduled/announce/emergency/radio/mic
+	Title       string    `json:"title,omitempty"` // 曲目名、电台名等
+	Item        string    `json:"item,omitempty"`  // 文件路径或电台地址
+	Duration    float64   `json:"duration"`        // 秒
+	Interrupted bool      `json:"interrupted"`     // 被手动切换、停止或出错打断
+	Active      bool      `json:"active,omitempty"`
+}
+
+// asrunItem 是正在播出的节目，结束时调用 finish 写入日志
+type asrunItem struct {
+	entry asrunEntry
+}
+
+// asrunLog.items 的值为 true 表示节目仍在播出，false 表示已结束、等待写入文件。
+// finish 可能在混音循环里调用，只登记结束并交给写入协程，不做磁盘读写。
+var asrunLog = struct {
+	sync.Mutex
+	items map[*asrunItem]bool
+}{items: make(map[*asrunItem]bool)}
+
+// asrunWriter 由写入协程在写文件时持有，queryAsrun 持有它以免同一条记录
+// 既在文件里又在 asrunLog.items 里
+var asrunWriter struct {
+	sync.Mutex
+	lastPrune string
+}
+
+var (
+	asrunQueue      = make(chan *asrunItem, 256)
+	asrunWriterOnce sync.Once
+)
+
+func asrunDir() string {
+	confMu.Lock()
+	defer confMu.Unlock()
+	return conf.System.AsrunFilePath
+}
+
+func asrunFileName(day time.Time) string {
+	return asrunFilePrefix + day.Format("2006-01-02") + asrunFileSuffix
+}
+
+// beginAsrun 记录一个节目开始播出，未配置 AsrunFilePath 时返回 nil
+func beginAsrun(source, title, item string) *asrunItem {
+	if asrunDir() == "" {
+		return nil
+	}
+	a := &asrunItem{entry: asrunEntry{Start: time.Now(), Source: source, Title: title, Item: item}}
+	asrunLog.Lock()
+	asrunLog.items[a] = true
+	asrunLog.Unlock()
+	return a
+}
+
+// finish 记录节目现在结束，可以对 nil 或已结束的节目调用
+func (a *asrunItem) finish(interrupted bool) {
+	a.finishAt(time.Now(), interrupted)
+}
+
+// finishAt 记录节目在 end 结束，由写入协程追加到当天的日志文件
+func (a *asrunItem) finishAt(end time.Time, interrupted bool) {
+	if a == nil {
+		return
+	}
+	asrunWriterOnce.Do(func() { go runAsrunWriter() })
+	asrunLog.Lock()
+	defer asrunLog.Unlock()
+	if !asrunLog.items[a] {
+		return
+	}
+	a.entry.End = end
+	a.entry.Duration = end.Sub(a.entry.Start).Round(time.Millisecond).Seconds()
+	a.entry.Interrupted = interrupted
+	select {
+	case asrunQueue <- a:
+		asrunLog.items[a] = false
+	default:
+		delete(asrunLog.items, a)
+		log.Printf("⚠️ 播出日志写入队列已满，丢弃记录: %s %s", a.entry.Source, a.entry.Title)
+	}
+}
+
+// runAsrunWriter 把结束的节目依次写入日志文件
+func runAsrunWriter() {
+	for a := range asrunQueue {
+		asrunWriter.Lock()
+		if err := appendAsrun(asrunDir(), a.entry); err != nil {
+			log.Printf("⚠️ 写入播出日志失败: %v", err)
+		}
+		asrunLog.Lock()
+		delete(asrunLog.items, a)
+		asrunLog.Unlock()
+		asrunWriter.Unlock()
+	}
+}
+
+// appendAsrun 把一条记录追加到开始日期对应的文件，调用方需持有 asrunWriter
+func appendAsrun(dir string, entry asrunEntry) error {
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, asrunFileName(entry.Start)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if today := entry.Start.Format("2006-01-02"); today != asrunWriter.lastPrune {
+		asrunWriter.lastPrune = today
+		pruneAsrun(dir, entry.Start)
+	}
+	return nil
+}
+
+// pruneAsrun 删除超过 AsrunKeepDays 天的日志文件，0 表示永久保存
+func pruneAsrun(dir string, now time.Time) {
+	confMu.Lock()
+	keep := conf.System.AsrunKeepDays
+	confMu.Unlock()
+	if keep <= 0 {
+		return
+	}
+	cutoff := asrunFileName(now.AddDate(0, 0, -keep))
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, asrunFilePrefix) && strings.HasSuffix(name, asrunFileSuffix) && name < cutoff {
+			if err := os.Remove(filepath.Join(dir, name)); err == nil {
+				log.Printf("🗑️ 删除过期播出日志: %s", name)
+			}
+		}
+	}
+}
+
+// asrunMicTracker 根据混音中是否有麦克风声音记录麦克风通话，只由 recivePCM 调用
+type asrunMicTracker struct {
+	item *asrunItem
+	last time.Time
+}
+
+func (t *asrunMicTracker) Process(onAir bool, now time.Time) {
+	if onAir {
+		if t.item == nil {
+			t.item = beginAsrun("mic", "", "")
+		}
+		t.last = now
+		return
+	}
+	if t.item != nil && now.Sub(t.last) > asrunMicGap {
+		// 通话在最后一帧麦克风声音时结束，而不是判定结束的此刻
+		t.item.finishAt(t.last, false)
+		t.item = nil
+	}
+}
+
+// asrunSummary 是某一天某个节目源的播出统计
+type asrunSummary struct {
+	Date        string  `json:"date"`
+	Source      string  `json:"source"`
+	Items       int     `json:"items"`
+	Seconds     float64 `json:"seconds"`
+	Interrupted int     `json:"interrupted"`
+}
+
+// queryAsrun 返回与 [from, to) 有交集的记录（含正在播出和尚未写入文件的节目），sources 为空表示全部
+func queryAsrun(from, to time.Time, sources []string) ([]asrunEntry, error) {
+	dir := asrunDir()
+	if dir == "" {
+		return nil, fmt.Errorf("as-run log is disabled (AsrunFilePath is empty)")
+	}
+	match := func(entry asrunEntry) bool {
+		return entry.Start.Before(to) && !entry.End.Before(from) &&
+			(len(sources) == 0 || slices.Contains(sources, entry.Source))
+	}
+
+	// 写入协程不能在读文件和读 asrunLog.items 之间写入
+	asrunWriter.Lock()
+	defer asrunWriter.Unlock()
+	entries := []asrunEntry{}
+	// 前一天开始、跨过零点的节目记在前一天的文件里
+	first := time.Date(from.Year(), from.Month(), from.Day()-1, 0, 0, 0, 0, from.Location())
+	for day := first; day.Before(to); day = day.AddDate(0, 0, 1) {
+		f, err := os.Open(filepath.Join(dir, asrunFileName(day)))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry asrunEntry
+			if json.Unmarshal(scanner.Bytes(), &entry) == nil && match(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	asrunLog.Lock()
+	for item, playing := range asrunLog.items {
+		entry := item.entry
+		if playing {
+			entry.End, entry.Active = now, true
+			entry.Duration = now.Sub(entry.Start).Round(time.Millisecond).Seconds()
+		}
+		if match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	asrunLog.Unlock()
+
+	slices.SortStableFunc(entries, func(a, b asrunEntry) int { return a.Start.Compare(b.Start) })
+	return entries, nil
+}
+
+// summarizeAsrun 按开始日期和节目源统计条数、播出时长和被打断的次数
+func summarizeAsrun(entries []asrunEntry) []asrunSummary {
+	summaries := []asrunSummary{}
+	index := make(map[[2]string]int)
+	for _, entry := range entries {
+		key := [2]string{entry.Start.Format("2006-01-02"), entry.Source}
+		i, ok := index[key]
+		if !ok {
+			i = len(summaries)
+			index[key] = i
+			summaries = append(summaries, asrunSummary{Date: key[0], Source: key[1]})
+		}
+		summaries[i].Items++
+		summaries[i].Seconds += entry.Duration
+		if entry.Interrupted {
+			summaries[i].Interrupted++
+		}
+	}
+	slices.SortFunc(summaries, func(a, b asrunSummary) int {
+		if c := strings.Compare(a.Date, b.Date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Source, b.Source)
+	})
+	return summaries
+}
+
+// parseAsrunTime 解析 "2006-01-02"、"2006-01-02 15:04"、"2006-01-02T15:04:05" 或 RFC3339。
+// 只有日期时，endOfDay 为 true 返回次日零点，便于 to=当天 包含整天。
+func parseAsrunTime(text string, endOfDay bool) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", text, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", text)
+}
+
+// asrunRange 解析查询范围，默认从今天零点到现在
+func asrunRange(fromText, toText string, now time.Time) (from, to time.Time, err error) {
+	from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	to = now
+	if fromText != "" {
+		if from, err = parseAsrunTime(fromText, false); err != nil {
+			return
+		}
+	}
+	if toText != "" {
+		if to, err = parseAsrunTime(toText, true); err != nil {
+			return
+		}
+	}
+	if !from.Before(to) {
+		err = fmt.Errorf("from must be before to")
+	} else if to.Sub(from) > maxAsrunQueryDays*24*time.Hour {
+		err = fmt.Errorf("query range must not exceed %d days", maxAsrunQueryDays)
+	}
+	return
+}
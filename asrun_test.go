@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTempAsrunDir 把播出日志写到临时目录，测试结束时等写入协程写完再恢复
+func useTempAsrunDir(t *testing.T) string {
+	dir := t.TempDir()
+	confMu.Lock()
+	oldDir := conf.System.AsrunFilePath
+	conf.System.AsrunFilePath = dir
+	confMu.Unlock()
+	t.Cleanup(func() {
+		waitAsrunWritten(t)
+		confMu.Lock()
+		conf.System.AsrunFilePath = oldDir
+		confMu.Unlock()
+	})
+	return dir
+}
+
+// waitAsrunWritten 等待已结束的节目都写入文件
+func waitAsrunWritten(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		asrunLog.Lock()
+		pending := false
+		for _, playing := range asrunLog.items {
+			pending = pending || !playing
+		}
+		asrunLog.Unlock()
+		if !pending {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("as-run entries not written")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitAsrunEntries 等待某个节目源有 n 条已结束的记录并返回
+func waitAsrunEntries(t *testing.T, source string, n int) []asrunEntry {
+	t.Helper()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		from, to, _ := asrunRange("", "", time.Now().Add(time.Second))
+		entries, err := queryAsrun(from, to, []string{source})
+		if err != nil {
+			t.Fatal(err)
+		}
+		finished := len(entries) == n
+		for _, entry := range entries {
+			finished = finished && !entry.Active
+		}
+		if finished {
+			return entries
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("%s entries = %+v, want %d finished", source, entries, n)
+		}
+	}
+}
+
+// readAsrunFile 读取某一天日志文件里的记录
+func readAsrunFile(t *testing.T, dir string, day time.Time) []asrunEntry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, asrunFileName(day)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []asrunEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry asrunEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAsrunLogAndQuery(t *testing.T) {
+	dir := useTempAsrunDir(t)
+
+	music := beginAsrun("music", "Artist - Song", "music/song-0001.mp3")
+	beacon := beginAsrun("beacon", "beacon.wav", "beacon.wav")
+	beacon.finish(false)
+	beacon.finish(true) // 重复结束不会再写一条
+	music.finish(true)
+	radio := beginAsrun("radio", "News FM", "http://example.com/live.mp3")
+	defer radio.finish(false)
+
+	from, to, err := asrunRange("", "", time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := queryAsrun(from, to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entries = %+v, want 3", entries)
+	}
+	if entries[0].Source != "music" || !entries[0].Interrupted || entries[1].Interrupted || !entries[2].Active {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	entries, err = queryAsrun(from, to, []string{"beacon"})
+	if err != nil || len(entries) != 1 || entries[0].Title != "beacon.wav" {
+		t.Fatalf("beacon query = %+v, %v", entries, err)
+	}
+	if summary := summarizeAsrun(entries); len(summary) != 1 || summary[0].Items != 1 || summary[0].Interrupted != 0 {
+		t.Fatalf("summary = %+v", summary)
+	}
+
+	if entries, _ := queryAsrun(from.AddDate(0, 0, -2), from.AddDate(0, 0, -1), nil); len(entries) != 0 {
+		t.Fatalf("entries from two days ago = %+v", entries)
+	}
+
+	// 结束的节目由写入协程写入文件
+	waitAsrunWritten(t)
+	if written := readAsrunFile(t, dir, time.Now()); len(written) != 2 || written[0].Source != "beacon" || written[1].Source != "music" {
+		t.Fatalf("written entries = %+v", written)
+	}
+}
+
+func TestAsrunMicTracker(t *testing.T) {
+	dir := useTempAsrunDir(t)
+	var tracker asrunMicTracker
+	start := time.Now()
+	last := start.Add(500 * time.Millisecond)
+	tracker.Process(true, start)
+	tracker.Process(true, last)
+	tracker.Process(false, last.Add(asrunMicGap))
+	if tracker.item == nil {
+		t.Fatal("mic entry ended before the gap passed")
+	}
+	tracker.Process(false, last.Add(asrunMicGap+20*time.Millisecond))
+	if tracker.item != nil {
+		t.Fatal("mic entry not ended after the gap")
+	}
+	waitAsrunWritten(t)
+	// 通话结束时间是最后一帧麦克风声音，不含判定结束的等待时间
+	if entries := readAsrunFile(t, dir, start); len(entries) != 1 || entries[0].Source != "mic" || !entries[0].End.Equal(last) || entries[0].Duration > 0.5 {
+		t.Fatalf("mic entries = %+v", entries)
+	}
+}
+
+func TestAsrunRange(t *testing.T) {
+	now := time.Date(2026, 3, 8, 14, 30, 0, 0, time.Local)
+	from, to, err := asrunRange("2026-03-01", "2026-03-07", now)
+	if err != nil || !from.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) || !to.Equal(time.Date(2026, 3, 8, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("range = %v - %v, %v", from, to, err)
+	}
+	if from, to, err := asrunRange("", "", now); err != nil || from.Hour() != 0 || !to.Equal(now) {
+		t.Fatalf("default range = %v - %v, %v", from, to, err)
+	}
+	for _, bad := range [][2]string{{"yesterday", ""}, {"2026-03-08", "2026-03-01"}, {"2024-01-01", "2026-01-01"}} {
+		if _, _, err := asrunRange(bad[0], bad[1], now); err == nil {
+			t.Errorf("asrunRange(%q, %q) succeeded", bad[0], bad[1])
+		}
+	}
+}
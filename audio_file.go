@@ -8,11 +8,14 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/go-audio/wav"
 	"github.com/hajimehoshi/go-mp3"
 	"github.com/mewkiz/flac"
+	flacframe "github.com/mewkiz/flac/frame"
 
 	waxaudio "github.com/colespringer/waxflow/audio"
 	waxcodec "github.com/colespringer/waxflow/codec"
@@ -26,7 +29,7 @@ const playbackSampleRate = 16000
 
 func isSupportedAudioFile(path string) bool {
 	switch strings.ToLower(filepath.Ext(path)) {
-	case ".wav", ".mp3", ".flac", ".aac", ".adts", ".m4a", ".mp4":
+	case ".wav", ".mp3", ".flac", ".aac", ".adts", ".m4a", ".mp4", ".ogg", ".oga", ".opus":
 		return true
 	default:
 		return false
@@ -35,240 +38,571 @@ func isSupportedAudioFile(path string) bool {
 
 // decodeAudioFile converts supported media to mono 16-bit PCM at 16 kHz.
 // Keeping one internal format means Opus can use the source directly while
-// G711 only needs one final 16 kHz -> 8 kHz conversion.
+// G711 only needs one final 16 kHz -> 8 kHz conversion. It suits short
+// clips; long music is played frame by frame through openAudioStream.
 func decodeAudioFile(path string) ([]int, error) {
+	stream, err := openAudioStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	// Preallocation is only an optimization. Cap it so an untrusted header
+	// cannot force a huge allocation before samples are decoded.
+	capacity := int(min(stream.Length(), playbackSampleRate*60))
+	pcm := make([]int, 0, capacity)
+	frame := make([]int, opusFrameSamples)
+	for {
+		n, err := stream.Read(frame)
+		pcm = append(pcm, frame[:n]...)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(pcm) == 0 {
+		return nil, fmt.Errorf("audio file contains no samples: %s", path)
+	}
+	return pcm, nil
+}
+
+// audioSource decodes one file format block by block as mono 16-bit PCM at
+// the file's own sample rate.
+type audioSource interface {
+	// ReadBlock returns the next decoded block, or io.EOF after the last one.
+	ReadBlock() ([]int, error)
+	SampleRate() int
+	// Length is the total number of samples, or 0 when the container does
+	// not record it.
+	Length() int64
+	// SeekSample positions the source so the next block starts exactly at
+	// the given sample.
+	SeekSample(sample int64) error
+	Close() error
+}
+
+// audioStream produces 16 kHz mono PCM on demand, so memory use does not
+// grow with the length of the file.
+type audioStream struct {
+	path      string
+	source    audioSource
+	resampler *pcmResampler
+	pending   []int
+	position  int64 // 16 kHz samples returned by Read
+	eof       bool
+}
+
+func openAudioStream(path string) (*audioStream, error) {
 	var (
-		pcm        []int
-		sampleRate int
-		err        error
+		source audioSource
+		err    error
 	)
-
 	switch strings.ToLower(filepath.Ext(path)) {
 	case ".wav":
-		pcm, sampleRate, err = decodeWAVFile(path)
+		source, err = openWAVSource(path)
 	case ".mp3":
-		pcm, sampleRate, err = decodeMP3File(path)
+		source, err = openMP3Source(path)
 	case ".flac":
-		pcm, sampleRate, err = decodeFLACFile(path)
+		source, err = openFLACSource(path)
 	case ".aac", ".adts":
-		pcm, sampleRate, err = decodeADTSFile(path)
+		source, err = openAACSource(path, false)
 	case ".m4a", ".mp4":
-		pcm, sampleRate, err = decodeMP4AACFile(path)
+		source, err = openAACSource(path, true)
+	case ".ogg", ".oga", ".opus":
+		source, err = openOggSource(path)
 	default:
 		return nil, fmt.Errorf("unsupported audio format %q", filepath.Ext(path))
 	}
 	if err != nil {
 		return nil, err
 	}
-	if len(pcm) == 0 {
-		return nil, fmt.Errorf("audio file contains no samples: %s", path)
+	if source.SampleRate() <= 0 {
+		source.Close()
+		return nil, fmt.Errorf("invalid sample rate %d: %s", source.SampleRate(), path)
+	}
+	return &audioStream{
+		path:      path,
+		source:    source,
+		resampler: newPCMResampler(source.SampleRate(), playbackSampleRate),
+	}, nil
+}
+
+// Read fills frame with the next samples and returns how many were written.
+// It returns io.EOF once the file is exhausted.
+func (s *audioStream) Read(frame []int) (int, error) {
+	for len(s.pending) < len(frame) && !s.eof {
+		block, err := s.source.ReadBlock()
+		if errors.Is(err, io.EOF) {
+			s.pending = s.resampler.Flush(s.pending)
+			s.eof = true
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.pending = s.resampler.Process(block, s.pending)
 	}
-	return resamplePCM(pcm, sampleRate, playbackSampleRate), nil
+	n := copy(frame, s.pending)
+	s.pending = append(s.pending[:0], s.pending[n:]...)
+	s.position += int64(n)
+	if n == 0 && s.eof {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Seek moves playback to offset from the start of the file.
+func (s *audioStream) Seek(offset time.Duration) error {
+	if offset < 0 {
+		offset = 0
+	}
+	rate := int64(s.source.SampleRate())
+	sample := int64(offset.Seconds() * float64(rate))
+	if length := s.source.Length(); length > 0 && sample >= length {
+		return fmt.Errorf("seek position %s is beyond the end of %s", offset, filepath.Base(s.path))
+	}
+	if err := s.source.SeekSample(sample); err != nil {
+		return fmt.Errorf("seek %s: %w", filepath.Base(s.path), err)
+	}
+	s.resampler = newPCMResampler(int(rate), playbackSampleRate)
+	s.pending = s.pending[:0]
+	s.position = sample * playbackSampleRate / rate
+	s.eof = false
+	return nil
+}
+
+// Position and Length are in 16 kHz samples; Length is 0 when unknown.
+func (s *audioStream) Position() int64 {
+	return s.position
+}
+
+func (s *audioStream) Length() int64 {
+	return s.source.Length() * playbackSampleRate / int64(s.source.SampleRate())
+}
+
+func (s *audioStream) Close() error {
+	return s.source.Close()
+}
+
+type wavSource struct {
+	f          *os.File
+	dataStart  int64
+	frames     int64
+	channels   int
+	bits       int
+	sampleRate int
+	read       int64
+	raw        []byte
+	samples    []int
 }
 
-func decodeWAVFile(path string) ([]int, int, error) {
+func openWAVSource(path string) (*wavSource, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	defer f.Close()
-
 	decoder := wav.NewDecoder(f)
 	if !decoder.IsValidFile() {
-		return nil, 0, fmt.Errorf("invalid WAV file: %s", path)
+		f.Close()
+		return nil, fmt.Errorf("invalid WAV file: %s", path)
 	}
-	buf, err := decoder.FullPCMBuffer()
-	if err != nil {
-		return nil, 0, fmt.Errorf("decode WAV %s: %w", path, err)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
 	}
-	if buf == nil || buf.Format == nil {
-		return nil, 0, fmt.Errorf("decode WAV %s: missing PCM format", path)
+	decoder = wav.NewDecoder(f)
+	if err := decoder.FwdToPCM(); err != nil || decoder.PCMChunk == nil {
+		f.Close()
+		return nil, fmt.Errorf("decode WAV %s: missing PCM data", path)
 	}
-	channels := buf.Format.NumChannels
-	if channels < 1 || decoder.SampleRate < 1 || decoder.BitDepth < 1 {
-		return nil, 0, fmt.Errorf("invalid WAV format: %s", path)
+	// The RIFF parser reads the file unbuffered, so the file offset is now
+	// the start of the data chunk.
+	dataStart, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	channels, bits := int(decoder.NumChans), int(decoder.BitDepth)
+	if channels < 1 || decoder.SampleRate < 1 || bits < 8 || bits > 32 || bits%8 != 0 {
+		f.Close()
+		return nil, fmt.Errorf("invalid WAV format: %s", path)
+	}
+	return &wavSource{
+		f:          f,
+		dataStart:  dataStart,
+		frames:     int64(decoder.PCMSize) / int64(channels*bits/8),
+		channels:   channels,
+		bits:       bits,
+		sampleRate: int(decoder.SampleRate),
+	}, nil
+}
+
+func (w *wavSource) ReadBlock() ([]int, error) {
+	const blockFrames = 4096
+	frames := min(blockFrames, w.frames-w.read)
+	if frames <= 0 {
+		return nil, io.EOF
+	}
+	bytesPerSample := w.bits / 8
+	w.raw = slices.Grow(w.raw[:0], int(frames)*w.channels*bytesPerSample)[:int(frames)*w.channels*bytesPerSample]
+	n, err := io.ReadFull(w.f, w.raw)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// Truncated data chunk: play what is there.
+		w.frames = w.read
+	} else if err != nil {
+		return nil, err
 	}
-	if decoder.BitDepth == 8 {
-		// WAV stores 8-bit PCM unsigned; all wider PCM sample sizes are signed.
-		for i := range buf.Data {
-			buf.Data[i] -= 128
+	count := n / bytesPerSample
+	count -= count % w.channels
+	if count == 0 {
+		return nil, io.EOF
+	}
+	w.read += int64(count / w.channels)
+	w.samples = slices.Grow(w.samples[:0], count)[:count]
+	for i := range count {
+		b := w.raw[i*bytesPerSample:]
+		switch bytesPerSample {
+		case 1:
+			// WAV stores 8-bit PCM unsigned; all wider PCM sample sizes are signed.
+			w.samples[i] = int(b[0]) - 128
+		case 2:
+			w.samples[i] = int(int16(binary.LittleEndian.Uint16(b)))
+		case 3:
+			w.samples[i] = int(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8)
+		case 4:
+			w.samples[i] = int(int32(binary.LittleEndian.Uint32(b)))
 		}
 	}
-	return downmixInterleaved(buf.Data, channels, int(decoder.BitDepth)), int(decoder.SampleRate), nil
+	return downmixInterleaved(w.samples, w.channels, w.bits), nil
 }
 
-func decodeMP3File(path string) ([]int, int, error) {
+func (w *wavSource) SampleRate() int { return w.sampleRate }
+func (w *wavSource) Length() int64   { return w.frames }
+func (w *wavSource) Close() error    { return w.f.Close() }
+
+func (w *wavSource) SeekSample(sample int64) error {
+	sample = max(0, min(sample, w.frames))
+	if _, err := w.f.Seek(w.dataStart+sample*int64(w.channels*w.bits/8), io.SeekStart); err != nil {
+		return err
+	}
+	w.read = sample
+	return nil
+}
+
+type mp3Source struct {
+	f       *os.File
+	decoder *mp3.Decoder
+	buf     []byte
+}
+
+func openMP3Source(path string) (*mp3Source, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	defer f.Close()
-
 	decoder, err := mp3.NewDecoder(f)
 	if err != nil {
-		return nil, 0, fmt.Errorf("decode MP3 %s: %w", path, err)
+		f.Close()
+		return nil, fmt.Errorf("decode MP3 %s: %w", path, err)
 	}
-	data, err := io.ReadAll(decoder)
-	if err != nil {
-		return nil, 0, fmt.Errorf("read MP3 %s: %w", path, err)
+	return &mp3Source{f: f, decoder: decoder, buf: make([]byte, 1152*4)}, nil
+}
+
+func (m *mp3Source) ReadBlock() ([]int, error) {
+	n, err := io.ReadFull(m.decoder, m.buf)
+	if n == 0 {
+		if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("read MP3: %w", err)
 	}
 	// go-mp3 always produces signed 16-bit little-endian stereo PCM.
-	frames := len(data) / 4
+	frames := n / 4
 	mono := make([]int, frames)
 	for i := range frames {
-		left := int(int16(binary.LittleEndian.Uint16(data[i*4:])))
-		right := int(int16(binary.LittleEndian.Uint16(data[i*4+2:])))
+		left := int(int16(binary.LittleEndian.Uint16(m.buf[i*4:])))
+		right := int(int16(binary.LittleEndian.Uint16(m.buf[i*4+2:])))
 		mono[i] = (left + right) / 2
 	}
-	return mono, decoder.SampleRate(), nil
+	return mono, nil
 }
 
-func decodeFLACFile(path string) ([]int, int, error) {
-	stream, err := flac.ParseFile(path)
+func (m *mp3Source) SampleRate() int { return m.decoder.SampleRate() }
+func (m *mp3Source) Length() int64   { return max(m.decoder.Length()/4, 0) }
+func (m *mp3Source) Close() error    { return m.f.Close() }
+
+func (m *mp3Source) SeekSample(sample int64) error {
+	_, err := m.decoder.Seek(sample*4, io.SeekStart)
+	return err
+}
+
+type flacSource struct {
+	f      *os.File
+	stream *flac.Stream
+	skip   int64 // samples to drop after seeking into the middle of a frame
+}
+
+func openFLACSource(path string) (*flacSource, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, 0, fmt.Errorf("decode FLAC %s: %w", path, err)
+		return nil, err
+	}
+	stream, err := flac.NewSeek(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("decode FLAC %s: %w", path, err)
 	}
-	defer stream.Close()
-
 	info := stream.Info
 	if info == nil || info.SampleRate == 0 || info.NChannels == 0 || info.BitsPerSample == 0 {
-		return nil, 0, fmt.Errorf("invalid FLAC format: %s", path)
-	}
-	estimatedSamples := info.NSamples
-	if oneMinute := uint64(info.SampleRate) * 60; estimatedSamples > oneMinute {
-		estimatedSamples = oneMinute
+		f.Close()
+		return nil, fmt.Errorf("invalid FLAC format: %s", path)
 	}
-	capacity := int(estimatedSamples)
-	mono := make([]int, 0, capacity)
+	return &flacSource{f: f, stream: stream}, nil
+}
+
+func (s *flacSource) ReadBlock() ([]int, error) {
 	for {
-		frame, err := stream.ParseNext()
-		if err == io.EOF {
-			break
-		}
+		frame, err := s.stream.ParseNext()
 		if err != nil {
-			return nil, 0, fmt.Errorf("decode FLAC frame %s: %w", path, err)
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("decode FLAC frame: %w", err)
 		}
-		if len(frame.Subframes) == 0 {
-			continue
+		mono := downmixFLACFrame(frame, int(s.stream.Info.BitsPerSample))
+		if s.skip > 0 {
+			drop := min(s.skip, int64(len(mono)))
+			mono = mono[drop:]
+			s.skip -= drop
 		}
-		count := len(frame.Subframes[0].Samples)
-		for i := 0; i < count; i++ {
-			var sum int64
-			for _, subframe := range frame.Subframes {
-				if i < len(subframe.Samples) {
-					sum += int64(subframe.Samples[i])
-				}
-			}
-			value := sum / int64(len(frame.Subframes))
-			mono = append(mono, pcmTo16Bit(value, int(info.BitsPerSample)))
+		if len(mono) > 0 {
+			return mono, nil
 		}
 	}
-	return mono, int(info.SampleRate), nil
 }
 
-func decodeADTSFile(path string) ([]int, int, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, 0, err
+// downmixFLACFrame averages the channels of a decoded FLAC frame into
+// 16-bit mono samples.
+func downmixFLACFrame(frame *flacframe.Frame, bitsPerSample int) []int {
+	if len(frame.Subframes) == 0 {
+		return nil
 	}
-	defer f.Close()
-	source, err := waxcontainer.FileSource(f)
-	if err != nil {
-		return nil, 0, fmt.Errorf("open AAC %s: %w", path, err)
+	count := len(frame.Subframes[0].Samples)
+	mono := make([]int, count)
+	for i := range count {
+		var sum int64
+		for _, subframe := range frame.Subframes {
+			if i < len(subframe.Samples) {
+				sum += int64(subframe.Samples[i])
+			}
+		}
+		mono[i] = pcmTo16Bit(sum/int64(len(frame.Subframes)), bitsPerSample)
 	}
-	demuxer, err := adts.NewDemuxer(source, nil)
+	return mono
+}
+
+func (s *flacSource) SampleRate() int { return int(s.stream.Info.SampleRate) }
+func (s *flacSource) Length() int64   { return int64(s.stream.Info.NSamples) }
+func (s *flacSource) Close() error    { return s.f.Close() }
+
+func (s *flacSource) SeekSample(sample int64) error {
+	start, err := s.stream.Seek(uint64(max(sample, 0)))
 	if err != nil {
-		return nil, 0, fmt.Errorf("parse AAC/ADTS %s: %w", path, err)
+		return err
 	}
-	return decodeAACPackets(demuxer, path)
+	s.skip = max(sample-int64(start), 0)
+	return nil
 }
 
-func decodeMP4AACFile(path string) ([]int, int, error) {
-	f, err := os.Open(path)
+// aacFrameSamples is the number of samples in one AAC-LC access unit.
+const aacFrameSamples = 1024
+
+type aacSource struct {
+	path    string
+	mp4     bool
+	f       *os.File
+	demuxer waxcontainer.Demuxer
+	decoder *waxaac.Decoder
+	track   waxcontainer.Track
+	rate    int
+	packet  waxcontainer.Packet
+	decoded int64 // samples decoded since the start of the track
+	emitted int64 // samples returned after removing the encoder delay
+	skip    int64 // extra samples to drop after a seek
+	tail    []int // end padding held back until the last packet
+	blocks  []int
+}
+
+func openAACSource(path string, isMP4 bool) (*aacSource, error) {
+	s := &aacSource{path: path, mp4: isMP4}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *aacSource) open() error {
+	f, err := os.Open(s.path)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
-	defer f.Close()
 	source, err := waxcontainer.FileSource(f)
 	if err != nil {
-		return nil, 0, fmt.Errorf("open M4A/MP4 %s: %w", path, err)
+		f.Close()
+		return fmt.Errorf("open AAC %s: %w", s.path, err)
 	}
-	demuxer, err := mp4.NewDemuxer(source, nil)
-	if err != nil {
-		return nil, 0, fmt.Errorf("parse M4A/MP4 %s: %w", path, err)
+	var demuxer waxcontainer.Demuxer
+	if s.mp4 {
+		demuxer, err = mp4.NewDemuxer(source, nil)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("parse M4A/MP4 %s: %w", s.path, err)
+		}
+	} else {
+		demuxer, err = adts.NewDemuxer(source, nil)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("parse AAC/ADTS %s: %w", s.path, err)
+		}
 	}
-	return decodeAACPackets(demuxer, path)
-}
-
-func decodeAACPackets(demuxer waxcontainer.Demuxer, path string) ([]int, int, error) {
 	tracks := demuxer.Tracks()
 	if len(tracks) != 1 || tracks[0].Codec != waxcodec.AACLC {
-		return nil, 0, fmt.Errorf("M4A/MP4 file does not contain a supported AAC-LC audio track: %s", path)
+		f.Close()
+		return fmt.Errorf("M4A/MP4 file does not contain a supported AAC-LC audio track: %s", s.path)
 	}
 	track := tracks[0]
 	cfg, err := waxaac.ParseASC(track.CodecConfig)
 	if err != nil {
-		return nil, 0, fmt.Errorf("parse AAC configuration %s: %w", path, err)
+		f.Close()
+		return fmt.Errorf("parse AAC configuration %s: %w", s.path, err)
 	}
 	format, err := cfg.Format()
 	if err != nil {
-		return nil, 0, fmt.Errorf("read AAC format %s: %w", path, err)
+		f.Close()
+		return fmt.Errorf("read AAC format %s: %w", s.path, err)
 	}
 	decoder, err := waxaac.NewDecoder(cfg, format)
 	if err != nil {
-		return nil, 0, fmt.Errorf("initialize embedded AAC decoder %s: %w", path, err)
+		f.Close()
+		return fmt.Errorf("initialize embedded AAC decoder %s: %w", s.path, err)
 	}
-	defer decoder.Release()
+	s.f, s.demuxer, s.decoder, s.track, s.rate = f, demuxer, decoder, track, format.Rate
+	s.decoded, s.emitted, s.skip, s.tail = 0, 0, 0, s.tail[:0]
+	return nil
+}
 
-	capacity := 0
-	if track.Samples > 0 {
-		// Preallocation is only an optimization. Cap it so an untrusted MP4
-		// duration cannot force a huge allocation before packets are parsed.
-		estimated := track.Samples
-		if oneMinute := int64(format.Rate) * 60; estimated > oneMinute {
-			estimated = oneMinute
-		}
-		capacity = int(estimated)
+func (s *aacSource) ReadBlock() ([]int, error) {
+	// M4A edit lists carry encoder delay and end padding. ADTS has no such
+	// signaling, so both values remain zero for raw .aac files.
+	delay := max(s.track.Delay, 0)
+	padding := max(s.track.Padding, 0)
+	limit := int64(-1)
+	if s.track.SamplesExact && s.track.Samples >= 0 {
+		limit = s.track.Samples
+	}
+
+	if s.demuxer == nil {
+		return nil, os.ErrClosed
 	}
-	mono := make([]int, 0, capacity)
-	var packet waxcontainer.Packet
 	for {
-		err := demuxer.ReadPacket(&packet)
+		if limit >= 0 && s.emitted >= limit {
+			return nil, io.EOF
+		}
+		err := s.demuxer.ReadPacket(&s.packet)
 		if errors.Is(err, io.EOF) {
-			break
+			// Whatever is left in tail is the end padding.
+			return nil, io.EOF
 		}
 		if err != nil {
-			return nil, 0, fmt.Errorf("read AAC packet %s: %w", path, err)
+			return nil, fmt.Errorf("read AAC packet %s: %w", s.path, err)
 		}
-		if err := decoder.Decode(packet.Data, func(pcm *waxaudio.Buffer) error {
-			mono = append(mono, downmixFloatPCM(pcm)...)
+		s.blocks = s.blocks[:0]
+		if err := s.decoder.Decode(s.packet.Data, func(pcm *waxaudio.Buffer) error {
+			s.blocks = append(s.blocks, downmixFloatPCM(pcm)...)
 			return nil
 		}); err != nil {
-			return nil, 0, fmt.Errorf("decode AAC packet %s: %w", path, err)
+			return nil, fmt.Errorf("decode AAC packet %s: %w", s.path, err)
 		}
-	}
 
-	// M4A edit lists carry encoder delay and end padding. ADTS has no such
-	// signaling, so both values remain zero for raw .aac files.
-	start := track.Delay
-	if start < 0 {
-		start = 0
-	}
-	if start > int64(len(mono)) {
-		start = int64(len(mono))
+		mono := s.blocks
+		if start := delay - s.decoded; start > 0 {
+			mono = mono[min(start, int64(len(mono))):]
+		}
+		s.decoded += int64(len(s.blocks))
+		if padding > 0 {
+			s.tail = append(s.tail, mono...)
+			keep := min(padding, int64(len(s.tail)))
+			mono = append([]int(nil), s.tail[:int64(len(s.tail))-keep]...)
+			s.tail = append(s.tail[:0], s.tail[int64(len(s.tail))-keep:]...)
+		}
+		if s.skip > 0 {
+			drop := min(s.skip, int64(len(mono)))
+			mono = mono[drop:]
+			s.skip -= drop
+			s.emitted += drop
+		}
+		if limit >= 0 && s.emitted+int64(len(mono)) > limit {
+			mono = mono[:limit-s.emitted]
+		}
+		s.emitted += int64(len(mono))
+		if len(mono) > 0 {
+			return append([]int(nil), mono...), nil
+		}
 	}
-	padding := track.Padding
-	if padding < 0 {
-		padding = 0
+}
+
+func (s *aacSource) SampleRate() int { return s.rate }
+
+func (s *aacSource) Length() int64 {
+	if s.track.Samples > 0 {
+		return s.track.Samples
 	}
-	if padding > int64(len(mono))-start {
-		padding = int64(len(mono)) - start
+	return 0
+}
+
+// Close releases the decoder and file; it is safe to call again, e.g. after
+// a failed seek already closed them.
+func (s *aacSource) Close() error {
+	if s.decoder != nil {
+		s.decoder.Release()
+		s.decoder = nil
+	}
+	s.demuxer = nil
+	if s.f == nil {
+		return nil
 	}
-	end := int64(len(mono)) - padding
-	if track.SamplesExact && track.Samples >= 0 && start+track.Samples < end {
-		end = start + track.Samples
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// SeekSample reopens the track and skips whole packets without decoding,
+// then decodes two packets ahead of the target so the decoder's overlap is
+// primed before the first returned sample.
+func (s *aacSource) SeekSample(sample int64) error {
+	s.Close()
+	if err := s.open(); err != nil {
+		return err
+	}
+	target := max(s.track.Delay, 0) + max(sample, 0)
+	skipPackets := max(target/aacFrameSamples-2, 0)
+	for range skipPackets {
+		if err := s.demuxer.ReadPacket(&s.packet); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		s.decoded += aacFrameSamples
 	}
-	return mono[start:end], format.Rate, nil
+	s.emitted = max(s.decoded-max(s.track.Delay, 0), 0)
+	s.skip = max(sample-s.emitted, 0)
+	return nil
 }
 
 func downmixFloatPCM(pcm *waxaudio.Buffer) []int {
@@ -324,57 +658,114 @@ func resamplePCM(input []int, sourceRate, targetRate int) []int {
 	if len(input) == 0 || sourceRate <= 0 || targetRate <= 0 {
 		return nil
 	}
+	resampler := newPCMResampler(sourceRate, targetRate)
+	output := make([]int, 0, int(math.Round(float64(len(input))*float64(targetRate)/float64(sourceRate))))
+	output = resampler.Process(input, output)
+	return resampler.Flush(output)
+}
+
+const resampleRadius = 16
+
+// pcmResampler is the streaming form of resamplePCM. It keeps an absolute
+// output phase and the filter overlap between blocks, so decoder frame
+// boundaries produce neither clicks nor timing drift, and only
+// 2*resampleRadius input samples stay buffered.
+type pcmResampler struct {
+	sourceStep int64
+	phases     int64
+	kernels    [][resampleRadius * 2]float64
+	buffer     []int
+	base       int64 // absolute index of buffer[0]
+	inputLen   int64
+	produced   int64
+}
+
+func newPCMResampler(sourceRate, targetRate int) *pcmResampler {
+	common := greatestCommonDivisor(sourceRate, targetRate)
+	r := &pcmResampler{
+		sourceStep: int64(sourceRate / common),
+		phases:     int64(targetRate / common),
+	}
 	if sourceRate == targetRate {
-		return append([]int(nil), input...)
+		return r
 	}
 
-	outputLen := int(math.Round(float64(len(input)) * float64(targetRate) / float64(sourceRate)))
-	output := make([]int, outputLen)
-	const radius = 16
-	const taps = radius * 2
 	cutoff := 0.47
 	if targetRate < sourceRate {
 		cutoff *= float64(targetRate) / float64(sourceRate)
 	}
-
-	common := greatestCommonDivisor(sourceRate, targetRate)
-	sourceStep := sourceRate / common
-	phases := targetRate / common
-	kernels := make([][taps]float64, phases)
-	for phase := range phases {
-		fraction := float64(phase) / float64(phases)
-		for tap := range taps {
-			distance := float64(tap-radius+1) - fraction
+	r.kernels = make([][resampleRadius * 2]float64, r.phases)
+	for phase := range r.phases {
+		fraction := float64(phase) / float64(r.phases)
+		for tap := range resampleRadius * 2 {
+			distance := float64(tap-resampleRadius+1) - fraction
 			x := 2 * cutoff * distance
 			sinc := 1.0
 			if x != 0 {
 				sinc = math.Sin(math.Pi*x) / (math.Pi * x)
 			}
-			window := 0.5 * (1 + math.Cos(math.Pi*distance/float64(radius)))
-			kernels[phase][tap] = 2 * cutoff * sinc * window
+			window := 0.5 * (1 + math.Cos(math.Pi*distance/resampleRadius))
+			r.kernels[phase][tap] = 2 * cutoff * sinc * window
 		}
 	}
+	return r
+}
 
-	for outIndex := range output {
-		positionNumerator := outIndex * sourceStep
-		center := positionNumerator / phases
-		kernel := kernels[positionNumerator%phases]
-		var weighted, weightSum float64
-		for tap, weight := range kernel {
-			sampleIndex := center + tap - radius + 1
-			if sampleIndex < 0 || sampleIndex >= len(input) {
-				continue
-			}
-			weighted += float64(input[sampleIndex]) * weight
-			weightSum += weight
-		}
-		if weightSum != 0 {
-			output[outIndex] = clampPCM(int(math.Round(weighted / weightSum)))
+// Process appends every output sample whose filter window is complete.
+func (r *pcmResampler) Process(input, output []int) []int {
+	r.inputLen += int64(len(input))
+	if r.kernels == nil {
+		r.produced += int64(len(input))
+		return append(output, input...)
+	}
+	r.buffer = append(r.buffer, input...)
+	for {
+		center := r.produced * r.sourceStep / r.phases
+		if center+resampleRadius >= r.inputLen {
+			break
 		}
+		output = append(output, r.sample(center))
+	}
+
+	keepFrom := r.produced*r.sourceStep/r.phases - resampleRadius
+	if drop := keepFrom - r.base; drop > 0 {
+		r.buffer = append(r.buffer[:0], r.buffer[drop:]...)
+		r.base = keepFrom
+	}
+	return output
+}
+
+// Flush appends the remaining output for the end of the input, so the total
+// length matches round(input * targetRate / sourceRate).
+func (r *pcmResampler) Flush(output []int) []int {
+	if r.kernels == nil {
+		return output
+	}
+	total := int64(math.Round(float64(r.inputLen) * float64(r.phases) / float64(r.sourceStep)))
+	for r.produced < total {
+		output = append(output, r.sample(r.produced*r.sourceStep/r.phases))
 	}
 	return output
 }
 
+func (r *pcmResampler) sample(center int64) int {
+	kernel := r.kernels[r.produced*r.sourceStep%r.phases]
+	r.produced++
+	var weighted, weightSum float64
+	for tap, weight := range kernel {
+		index := center + int64(tap) - resampleRadius + 1
+		if index < r.base || index >= r.inputLen {
+			continue
+		}
+		weighted += float64(r.buffer[index-r.base]) * weight
+		weightSum += weight
+	}
+	if weightSum == 0 {
+		return 0
+	}
+	return clampPCM(int(math.Round(weighted / weightSum)))
+}
+
 func greatestCommonDivisor(a, b int) int {
 	for b != 0 {
 		a, b = b, a%b
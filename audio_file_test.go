@@ -3,10 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"math"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	waxaudio "github.com/colespringer/waxflow/audio"
 	waxcodec "github.com/colespringer/waxflow/codec"
@@ -17,12 +19,12 @@ import (
 )
 
 func TestSupportedAudioFiles(t *testing.T) {
-	for _, name := range []string{"voice.wav", "music.MP3", "archive.FlAc", "radio.AAC", "raw.adts", "song.m4a", "video.MP4"} {
+	for _, name := range []string{"voice.wav", "music.MP3", "archive.FlAc", "radio.AAC", "raw.adts", "song.m4a", "video.MP4", "voice.ogg", "talk.OPUS", "clip.oga"} {
 		if !isSupportedAudioFile(name) {
 			t.Errorf("isSupportedAudioFile(%q) = false", name)
 		}
 	}
-	for _, name := range []string{"voice.ogg", "notes.txt", "wav"} {
+	for _, name := range []string{"voice.wma", "notes.txt", "wav"} {
 		if isSupportedAudioFile(name) {
 			t.Errorf("isSupportedAudioFile(%q) = true", name)
 		}
@@ -159,13 +161,11 @@ func TestResamplePCMTo16K(t *testing.T) {
 	}
 }
 
-func TestDecodeStereo48KWAV(t *testing.T) {
-	const frames = 480
-	data := make([]byte, frames*2*2)
-	for i := range frames {
-		left := int16(math.Sin(2*math.Pi*1000*float64(i)/48000) * 12000)
-		binary.LittleEndian.PutUint16(data[i*4:], uint16(left))
-		binary.LittleEndian.PutUint16(data[i*4+2:], 0)
+func writeTestWAV(t *testing.T, rate, channels int, samples []int16) string {
+	t.Helper()
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
 	}
 
 	var wav bytes.Buffer
@@ -174,20 +174,29 @@ func TestDecodeStereo48KWAV(t *testing.T) {
 	wav.WriteString("WAVEfmt ")
 	binary.Write(&wav, binary.LittleEndian, uint32(16))
 	binary.Write(&wav, binary.LittleEndian, uint16(1))
-	binary.Write(&wav, binary.LittleEndian, uint16(2))
-	binary.Write(&wav, binary.LittleEndian, uint32(48000))
-	binary.Write(&wav, binary.LittleEndian, uint32(48000*4))
-	binary.Write(&wav, binary.LittleEndian, uint16(4))
+	binary.Write(&wav, binary.LittleEndian, uint16(channels))
+	binary.Write(&wav, binary.LittleEndian, uint32(rate))
+	binary.Write(&wav, binary.LittleEndian, uint32(rate*channels*2))
+	binary.Write(&wav, binary.LittleEndian, uint16(channels*2))
 	binary.Write(&wav, binary.LittleEndian, uint16(16))
 	wav.WriteString("data")
 	binary.Write(&wav, binary.LittleEndian, uint32(len(data)))
 	wav.Write(data)
 
-	path := filepath.Join(t.TempDir(), "stereo.wav")
+	path := filepath.Join(t.TempDir(), "test.wav")
 	if err := os.WriteFile(path, wav.Bytes(), 0600); err != nil {
 		t.Fatal(err)
 	}
-	pcm, err := decodeAudioFile(path)
+	return path
+}
+
+func TestDecodeStereo48KWAV(t *testing.T) {
+	const frames = 480
+	samples := make([]int16, frames*2)
+	for i := range frames {
+		samples[i*2] = int16(math.Sin(2*math.Pi*1000*float64(i)/48000) * 12000)
+	}
+	pcm, err := decodeAudioFile(writeTestWAV(t, 48000, 2, samples))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -196,6 +205,61 @@ func TestDecodeStereo48KWAV(t *testing.T) {
 	}
 }
 
+func TestAudioStreamMatchesWholeFileAndSeeks(t *testing.T) {
+	const rate = 44100
+	source := make([]int16, rate*3)
+	whole := make([]int, len(source))
+	for i := range source {
+		source[i] = int16(math.Sin(2*math.Pi*440*float64(i)/rate) * 10000)
+		whole[i] = int(source[i])
+	}
+	want := resamplePCM(whole, rate, playbackSampleRate)
+	path := writeTestWAV(t, rate, 1, source)
+
+	stream, err := openAudioStream(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if stream.Length() != 3*playbackSampleRate {
+		t.Fatalf("length = %d, want %d", stream.Length(), 3*playbackSampleRate)
+	}
+	var got []int
+	frame := make([]int, opusFrameSamples)
+	for {
+		n, err := stream.Read(frame)
+		got = append(got, frame[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("streamed samples = %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d = %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	if err := stream.Seek(2 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if stream.Position() != 2*playbackSampleRate {
+		t.Fatalf("position after seek = %d", stream.Position())
+	}
+	n, _ := stream.Read(frame)
+	// The first samples after a seek lack the left half of the filter window.
+	for i := resampleRadius; i < n; i++ {
+		if diff := frame[i] - want[2*playbackSampleRate+i]; diff < -2 || diff > 2 {
+			t.Fatalf("sample %d after seek = %d, want %d", i, frame[i], want[2*playbackSampleRate+i])
+		}
+	}
+	if err := stream.Seek(4 * time.Second); err == nil {
+		t.Fatal("seek past the end succeeded")
+	}
+}
+
 // These environment variables let release/packaging jobs validate real media
 // fixtures without checking copyrighted audio into this repository.
 func TestDecodeCompressedAudioFixtures(t *testing.T) {
@@ -234,3 +298,17 @@ func BenchmarkResample48KTo16K(b *testing.B) {
 		resamplePCM(input, 48000, playbackSampleRate)
 	}
 }
+
+func TestAACSourceCloseAfterFailedSeek(t *testing.T) {
+	s := &aacSource{path: filepath.Join(t.TempDir(), "gone.m4a"), mp4: true}
+	if err := s.SeekSample(16000); err == nil {
+		t.Fatal("seek reopened a missing file")
+	}
+	// 跳转失败后流仍会被关闭，不能重复释放解码器和文件
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadBlock(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("ReadBlock after close = %v", err)
+	}
+}
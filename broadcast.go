@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"sync"
@@ -13,6 +14,8 @@ const (
 	MsgTypeAudio      byte = 0x01
 	MsgTypeVoiceStart byte = 0x02
 	MsgTypeVoiceEnd   byte = 0x03
+	MsgTypeEmergency  byte = 0x04 // payload: JSON emergencyAlert, inactive when cleared
+	MsgTypeRadio      byte = 0x05 // payload: JSON {station, title, alert}, empty station when stopped
 )
 
 // liveClient wraps a websocket.Conn with a buffered send channel.
@@ -57,6 +60,9 @@ type LiveBroadcastHub struct {
 	activeCallSign string
 	activeSSID     byte
 	isVoiceActive  bool
+
+	emergencyFrame []byte
+	radioFrame     []byte
 }
 
 var liveHub *LiveBroadcastHub
@@ -79,6 +85,8 @@ func (h *LiveBroadcastHub) AddClient(c *liveClient) {
 	active := h.isVoiceActive
 	cs := h.activeCallSign
 	ssid := h.activeSSID
+	emergency := h.emergencyFrame
+	radio := h.radioFrame
 	h.mu.Unlock()
 
 	if active {
@@ -88,6 +96,18 @@ func (h *LiveBroadcastHub) AddClient(c *liveClient) {
 		default:
 		}
 	}
+	if emergency != nil {
+		select {
+		case c.send <- emergency:
+		default:
+		}
+	}
+	if radio != nil {
+		select {
+		case c.send <- radio:
+		default:
+		}
+	}
 
 	h.mu.RLock()
 	total := len(h.clients)
@@ -155,6 +175,38 @@ func (h *LiveBroadcastHub) NotifyVoiceEnd(callsign string, ssid byte) {
 	h.broadcast(frame)
 }
 
+// NotifyEmergency pushes an emergency trigger or clear to every client and
+// remembers an active alert so late joiners see it too.
+func (h *LiveBroadcastHub) NotifyEmergency(alert emergencyAlert) {
+	frame := buildFrame(MsgTypeEmergency, conf.System.Callsign, conf.System.SSID, emergencyFrameData(alert))
+	h.mu.Lock()
+	if alert.Active {
+		h.emergencyFrame = frame
+	} else {
+		h.emergencyFrame = nil
+	}
+	h.mu.Unlock()
+
+	h.broadcast(frame)
+}
+
+// NotifyRadio pushes the playing network radio station, its current song
+// title and any watchdog alert to every client; late joiners get the last
+// one.
+func (h *LiveBroadcastHub) NotifyRadio(station, title, alert string) {
+	data, _ := json.Marshal(map[string]string{"station": station, "title": title, "alert": alert})
+	frame := buildFrame(MsgTypeRadio, conf.System.Callsign, conf.System.SSID, data)
+	h.mu.Lock()
+	if station != "" || alert != "" {
+		h.radioFrame = frame
+	} else {
+		h.radioFrame = nil
+	}
+	h.mu.Unlock()
+
+	h.broadcast(frame)
+}
+
 func (h *LiveBroadcastHub) broadcast(frame []byte) {
 	h.mu.RLock()
 	clients := make([]*liveClient, 0, len(h.clients))
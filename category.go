@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// MusicFolder 是 MusicFilePath 下一个子目录（分类）的轮播设置。
+// 没有配置的分类默认参与轮播，权重为 1。
+type MusicFolder struct {
+	Folder   string `yaml:"Folder" json:"folder"`     // 相对 MusicFilePath 的子目录，"" 为根目录
+	Disabled bool   `yaml:"Disabled" json:"disabled"` // 不参与轮播
+	Weight   int    `yaml:"Weight" json:"weight"`     // 轮播权重 1-100
+}
+
+const maxCategoryWeight = 100
+
+// musicCategoryOf 返回曲目所在的分类，即相对 MusicFilePath 的目录（使用 /）
+func musicCategoryOf(path string) string {
+	rel, err := filepath.Rel(conf.System.MusicFilePath, filepath.Dir(path))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func categorySettings() map[string]MusicFolder {
+	confMu.Lock()
+	defer confMu.Unlock()
+	settings := make(map[string]MusicFolder, len(conf.System.MusicCategories))
+	for _, category := range conf.System.MusicCategories {
+		settings[category.Folder] = category
+	}
+	return settings
+}
+
+func (c MusicFolder) weight() int {
+	if c.Weight <= 0 {
+		return 1
+	}
+	return min(c.Weight, maxCategoryWeight)
+}
+
+// setMusicCategory 启用/停用分类或修改权重，nil 表示不修改
+func setMusicCategory(folder string, enabled *bool, weight *int) error {
+	folder = strings.Trim(filepath.ToSlash(strings.TrimSpace(folder)), "/")
+	if weight != nil && (*weight < 1 || *weight > maxCategoryWeight) {
+		return fmt.Errorf("category weight must be between 1 and %d", maxCategoryWeight)
+	}
+	musicstateMu.RLock()
+	known := slices.ContainsFunc(folderMusicFiles, func(file MusicFileInfo) bool { return file.Category == folder })
+	musicstateMu.RUnlock()
+	if !known {
+		return fmt.Errorf("category %q not found", folder)
+	}
+
+	confMu.Lock()
+	index := slices.IndexFunc(conf.System.MusicCategories, func(c MusicFolder) bool { return c.Folder == folder })
+	if index < 0 {
+		conf.System.MusicCategories = append(conf.System.MusicCategories, MusicFolder{Folder: folder, Weight: 1})
+		index = len(conf.System.MusicCategories) - 1
+	}
+	category := &conf.System.MusicCategories[index]
+	if enabled != nil {
+		category.Disabled = !*enabled
+	}
+	if weight != nil {
+		category.Weight = *weight
+	}
+	confMu.Unlock()
+
+	applyActivePlaylist()
+	return nil
+}
+
+// musicCategorySummaries 列出 folder 列表中的所有分类及其设置
+func musicCategorySummaries() []map[string]any {
+	counts := make(map[string]int)
+	musicstateMu.RLock()
+	for _, file := range folderMusicFiles {
+		counts[file.Category]++
+	}
+	musicstateMu.RUnlock()
+
+	settings := categorySettings()
+	summaries := make([]map[string]any, 0, len(counts))
+	for _, folder := range slices.Sorted(maps.Keys(counts)) {
+		category := settings[folder]
+		summaries = append(summaries, map[string]any{
+			"folder":  folder,
+			"enabled": !category.Disabled,
+			"weight":  category.weight(),
+			"count":   counts[folder],
+		})
+	}
+	return summaries
+}
+
+// enabledCategoryFiles 去掉停用分类中的曲目
+func enabledCategoryFiles(files []MusicFileInfo) []MusicFileInfo {
+	settings := categorySettings()
+	enabled := make([]MusicFileInfo, 0, len(files))
+	for _, file := range files {
+		if !settings[file.Category].Disabled {
+			enabled = append(enabled, file)
+		}
+	}
+	return enabled
+}
+
+// categoryWeights 返回队列中各分类的轮播权重。只有 folder 列表包含多个分类且权重
+// 不全相同时才按权重轮播，否则返回 nil，沿用按编号的播放顺序。调用方需持有 musicstateMu。
+func categoryWeights(queue []MusicFileInfo) map[string]int {
+	if activePlaylistName() != "" {
+		return nil
+	}
+	settings := categorySettings()
+	weights := make(map[string]int)
+	for _, file := range queue {
+		weights[file.Category] = settings[file.Category].weight()
+	}
+	if len(weights) < 2 {
+		return nil
+	}
+	for _, weight := range weights {
+		if weight != weights[queue[0].Category] {
+			return weights
+		}
+	}
+	return nil
+}
+
+// pickCategory 平滑加权轮询：每次给所有分类加上权重，选出累计值最大的分类后减去总权重。
+// 权重 3:1 时按 A A B A 的节奏轮流。
+func pickCategory(weights map[string]int, credits map[string]int) string {
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	total, best := 0, names[0]
+	for _, name := range names {
+		credits[name] += weights[name]
+		total += weights[name]
+		if credits[name] > credits[best] {
+			best = name
+		}
+	}
+	credits[best] -= total
+	return best
+}
+
+// categoryMusicIndex 按权重选出下一个分类，再取该分类中上次播放之后的下一首（按编号循环）。
+// commit 为 false 时只预测结果，不改变轮询状态。调用方需持有 musicstateMu。
+func categoryMusicIndex(queue []MusicFileInfo, weights map[string]int, commit bool) int {
+	q := &currentQueue
+	credits := q.credits
+	if !commit {
+		credits = maps.Clone(q.credits)
+	}
+	category := pickCategory(weights, credits)
+	last, ok := q.lastInCategory[category]
+	if !ok {
+		last = -1
+	}
+	index, first := -1, -1
+	for i, file := range queue {
+		if file.Category != category {
+			continue
+		}
+		if first == -1 || file.ID < queue[first].ID {
+			first = i
+		}
+		if file.ID > last && (index == -1 || file.ID < queue[index].ID) {
+			index = i
+		}
+	}
+	if index == -1 {
+		index = first
+	}
+	return index
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWeightedCategories(t *testing.T) {
+	oldCategories, oldActive := conf.System.MusicCategories, conf.System.ActivePlaylist
+	t.Cleanup(func() { conf.System.MusicCategories, conf.System.ActivePlaylist = oldCategories, oldActive })
+	conf.System.ActivePlaylist = ""
+	conf.System.MusicCategories = []MusicFolder{{Folder: "a", Weight: 2}}
+
+	queue := withPlayMode(t, playModeSequential, 1, 2, 3, 10, 11)
+	for i := range queue {
+		queue[i].Category = "a"
+		if queue[i].ID >= 10 {
+			queue[i].Category = "b"
+		}
+	}
+
+	var played []int
+	for range 6 {
+		peeked := queue[peekNextMusic(queue)].ID
+		id, _ := playNext(queue, false, false)
+		if id != peeked {
+			t.Fatalf("played %d after peeking %d", id, peeked)
+		}
+		played = append(played, id)
+	}
+	// 权重 2:1，分类内部仍按编号顺序循环
+	if want := []int{1, 10, 2, 3, 11, 1}; !slices.Equal(played, want) {
+		t.Fatalf("played %v, want %v", played, want)
+	}
+
+	conf.System.MusicCategories = []MusicFolder{{Folder: "b", Disabled: true}}
+	if files := enabledCategoryFiles(queue); len(files) != 3 {
+		t.Fatalf("enabled files = %d, want 3", len(files))
+	}
+	if weights := categoryWeights(queue); weights != nil {
+		t.Fatalf("equal weights = %v, want nil", weights)
+	}
+}
+
+func TestPathsUnder(t *testing.T) {
+	root := filepath.Join("music", "news")
+	paths := map[string]bool{
+		filepath.Join(root, "a-0001.mp3"):             true,
+		filepath.Join(root, "sub", "b-0002.mp3"):      true,
+		filepath.Join("music", "newsletter-0003.mp3"): true,
+	}
+	if got := pathsUnder(paths, root); len(got) != 2 {
+		t.Fatalf("pathsUnder = %v, want 2 paths", got)
+	}
+}
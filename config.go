@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	yaml "gopkg.in/yaml.v3"
@@ -31,8 +32,24 @@ type config struct {
 		AudioFile         string         `yaml:"AudioFile" json:"audio_file"`
 		AudioFilePath     string         `yaml:"AudioFilePath" json:"audio_file_Path"`
 		MusicFilePath     string         `yaml:"MusicFilePath" json:"music_file_Path"`
+		UploadMaxMB       int            `yaml:"UploadMaxMB" json:"upload_max_mb"` // 网页上传音频大小上限(MB)，默认 200
+		PCMCacheMB        int            `yaml:"PCMCacheMB" json:"pcm_cache_mb"`   // 信标和定时音频解码缓存上限(MB)，默认 64，-1 关闭
 		RecoderFilePath   string         `yaml:"RecoderFilePath" json:"Path"`
+		AirlogFilePath    string         `yaml:"AirlogFilePath" json:"airlog_file_path"` // 发射录音保存路径，为空则不记录
+		AsrunFilePath     string         `yaml:"AsrunFilePath" json:"asrun_file_path"`   // 播出日志保存路径，为空则不记录
+		AsrunKeepDays     int            `yaml:"AsrunKeepDays" json:"asrun_keep_days"`   // 播出日志保留天数，0 为永久保存
 		CronString        string         `yaml:"CronString" json:"cronString"`
+		AnnounceClipPath  string         `yaml:"AnnounceClipPath" json:"announce_clip_path"`   // 语音报时短语素材目录
+		AnnounceTemplate  string         `yaml:"AnnounceTemplate" json:"announce_template"`    // 语音报时模板
+		AnnounceCron      string         `yaml:"AnnounceCron" json:"announce_cron"`            // 语音报时周期，linux cron格式
+		EmergencyAudio    string         `yaml:"EmergencyAudio" json:"emergency_audio"`        // 紧急告警音频，为空则播放告警音
+		EmergencyRepeat   int            `yaml:"EmergencyRepeat" json:"emergency_repeat"`      // 紧急告警默认重复次数
+		EmergencyPIN      string         `yaml:"EmergencyPIN" json:"-"`                        // AT+EMERGENCY 指令PIN，为空则禁用
+		EmergencyDropPath string         `yaml:"EmergencyDropPath" json:"emergency_drop_path"` // 紧急告警投放目录
+		MonitorEnabled    bool           `yaml:"MonitorEnabled" json:"monitor_enabled"`        // 是否启用本地监听输出
+		MonitorDevice     string         `yaml:"MonitorDevice" json:"monitor_device"`          // 本地监听输出设备ID，为空使用系统默认设备
+		MonitorSource     string         `yaml:"MonitorSource" json:"monitor_source"`          // 监听内容: rx 收到的语音, tx 发出的混音, both 两者
+		MonitorVolume     float64        `yaml:"MonitorVolume" json:"monitor_volume"`          // 本地监听音量，与发射音量独立
 		WebPort           string         `yaml:"WebPort" json:"web_port"`
 		EnableControlPage bool           `yaml:"EnableControlPage" json:"enable_control_page"`
 		ControlUsername   string         `yaml:"ControlUsername" json:"-"`
@@ -42,6 +59,19 @@ type config struct {
 		RadioStations     []RadioStation `yaml:"RadioStations" json:"radio_stations"`
 		RadioActiveID     string         `yaml:"RadioActiveID" json:"radio_active_id"`
 		RadioPlaying      bool           `yaml:"RadioPlaying" json:"radio_playing"`
+		Playlists         []Playlist     `yaml:"Playlists" json:"playlists"`
+		ActivePlaylist    string         `yaml:"ActivePlaylist" json:"active_playlist"`
+		MusicPlayMode     string         `yaml:"MusicPlayMode" json:"music_play_mode"`    // sequential/shuffle/repeat_one/once
+		MusicCrossfade    float64        `yaml:"MusicCrossfade" json:"music_crossfade"`   // 曲目间交叉淡化秒数，0 为无缝衔接
+		MusicCategories   []MusicFolder  `yaml:"MusicCategories" json:"music_categories"` // 子目录分类的启用状态和轮播权重
+		StateFile         string         `yaml:"StateFile" json:"state_file"`             // 播放进度状态文件，为空时放在配置文件旁边
+
+		RadioSilenceTimeout int    `yaml:"RadioSilenceTimeout" json:"radio_silence_timeout"` // 电台持续无声多少秒后重连，默认 60，-1 关闭
+		RadioStallTimeout   int    `yaml:"RadioStallTimeout" json:"radio_stall_timeout"`     // 电台没有音频数据多少秒后重连，默认 20，-1 关闭（同时关闭吞吐量检测）
+		RadioMaxFailures    int    `yaml:"RadioMaxFailures" json:"radio_max_failures"`       // 连续失败多少次后切换备用电台或本地音乐，默认 5，-1 一直重连
+		RadioFallbackID     string `yaml:"RadioFallbackID" json:"radio_fallback_id"`         // 备用电台 ID，为空时切回本地音乐
+
+		RadioSchedule []RadioProgram `yaml:"RadioSchedule" json:"radio_schedule"` // 定时转播的电台节目
 	} `yaml:"System" json:"system"`
 }
 
@@ -75,6 +105,7 @@ func (c *config) init() {
 	conf.System.MusicPlaying = true
 	conf.System.RecordVoice = true
 	conf.System.EnableControlPage = true
+	conf.System.MonitorVolume = 1
 
 	yamlFile, err := os.ReadFile(confpath)
 
@@ -104,6 +135,21 @@ func (c *config) init() {
 		conf.System.WebPort = "8080"
 	}
 
+	if conf.System.AnnounceTemplate == "" {
+		conf.System.AnnounceTemplate = defaultAnnounceTemplate
+	}
+
+	if !validMonitorSource(conf.System.MonitorSource) {
+		conf.System.MonitorSource = monitorSourceRX
+	}
+	if conf.System.MonitorVolume < 0 || conf.System.MonitorVolume > 2 {
+		conf.System.MonitorVolume = 1
+	}
+	conf.System.MusicPlayMode = strings.ToLower(conf.System.MusicPlayMode)
+	if !validPlayMode(conf.System.MusicPlayMode) {
+		conf.System.MusicPlayMode = playModeSequential
+	}
+
 }
 
 func saveConfig() {
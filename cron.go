@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -13,11 +17,15 @@ type sendvoice struct {
 
 func startcron() {
 
-	if conf.System.AudioFile == "" || conf.System.CronString == "" {
-		log.Println("未启动自动发送信标语音功能，因为没有配置音频文件路径或者调度字符串没有配置")
+	// 信标音频可以稍后在网页上传，这里只要求配置了调度字符串
+	if conf.System.CronString == "" {
+		log.Println("未启动自动发送信标语音功能，因为调度字符串没有配置")
 		return
 	}
 
+	// 预先解码信标，整点触发时直接发送
+	warmPCMCache(beaconFile())
+
 	c := cron.New()
 
 	//AddFunc
@@ -71,22 +79,39 @@ func (o sendvoice) Run() {
 		return
 	}
 
-	log.Printf("\n读取信标文件，准备播放信标...%s\n", conf.System.AudioFile)
+	audioFile := beaconFile()
+	if audioFile == "" {
+		log.Println("未配置信标音频文件，跳过本次信标")
+		return
+	}
+
+	log.Printf("\n读取信标文件，准备播放信标...%s\n", audioFile)
 	updatePlayStatus("Beacon Playing...", 0, true)
 
-	pcm, err := decodeAudioFile(conf.System.AudioFile)
+	setAirlogTitle("beacon", filepath.Base(audioFile))
+	stream, err := openCachedAudio(audioFile)
 	if err != nil {
 		log.Printf("读取信标音频失败: %v", err)
 		updatePlayStatus("Beacon decode failed", 0, false)
 		return
 	}
-	for i := 0; i < len(pcm); i += opusFrameSamples {
+	defer stream.Close()
+	onAir := beginAsrun("beacon", filepath.Base(audioFile), audioFile)
+	for {
 		if !isCronEnabled() {
+			onAir.finish(true)
 			return
 		}
-		end := min(i+opusFrameSamples, len(pcm))
 		chunk := make([]int, opusFrameSamples)
-		copy(chunk, pcm[i:end])
+		n, err := stream.Read(chunk)
+		if n == 0 {
+			failed := err != nil && !errors.Is(err, io.EOF)
+			if failed {
+				log.Printf("读取信标音频失败: %v", err)
+			}
+			onAir.finish(failed)
+			return
+		}
 		cronPCM <- [][]int{chunk}
 	}
 }
@@ -102,6 +127,8 @@ func recivePCM() {
 	lastOpusMode := false
 	pcm8 := make([]int, 160)
 	pcm16 := make([]int, opusFrameSamples)
+	var sources []string
+	var micOnAir asrunMicTracker
 
 	for range ticket.C {
 		sendOpus := isSendOpusEnabled()
@@ -112,52 +139,86 @@ func recivePCM() {
 		clear(pcmbuf)
 
 		hasBeaconActivity = false
+		sources = sources[:0]
 
-		// 2. 混音: cronPCM (信标)
-		select {
-		case wav := <-cronPCM:
-			hasBeaconActivity = true
-			mix16KSource(pcmbuf, wav[0], 1, sendOpus)
-		default:
-		}
+		// 1. 紧急告警优先：独占发射，音乐/电台/信标/定时/报时均暂停，
+		// 不参与闪避。实时源（电台、麦克风）直接丢弃，文件源保持在原位等待。
+		if isEmergencyActive() {
+			select {
+			case wav := <-emergencyPCM:
+				sources = append(sources, "emergency")
+				meterFeed("emergency", wav[0], 1)
+				mix16KSource(pcmbuf, wav[0], 1, sendOpus)
+			default:
+			}
+			discardLivePCM()
+		} else {
+			// 2. 混音: cronPCM (信标)
+			select {
+			case wav := <-cronPCM:
+				hasBeaconActivity = true
+				sources = append(sources, "beacon")
+				meterFeed("beacon", wav[0], 1)
+				mix16KSource(pcmbuf, wav[0], 1, sendOpus)
+			default:
+			}
 
-		// 3. 混音: timePCM
-		select {
-		case wav := <-timePCM:
-			hasBeaconActivity = true
-			mix16KSource(pcmbuf, wav[0], 1, sendOpus)
-		default:
-		}
+			// 3. 混音: timePCM
+			select {
+			case wav := <-timePCM:
+				hasBeaconActivity = true
+				sources = append(sources, "scheduled")
+				meterFeed("scheduled", wav[0], 1)
+				mix16KSource(pcmbuf, wav[0], 1, sendOpus)
+			default:
+			}
 
-		// 4. 混音: 本地音乐或网络电台（网络电台优先，两个节目不会同时发送）
-		musicSource := musicPCM
-		if isRadioPlaying() {
-			musicSource = radioPCM
-		}
-		select {
-		case wav := <-musicSource:
-			// 计算音乐音量缩放因子
-			// 如果有麦克风或信标活动，降低音乐音量
-			volumeScale = 1.0
-			if hasBeaconActivity && conf.System.DuckMusicPCM {
-				volumeScale = conf.System.DuckScale // 降低一个维度
+			// 3.1 混音: announcePCM (语音报时)
+			select {
+			case wav := <-announcePCM:
+				hasBeaconActivity = true
+				sources = append(sources, "announce")
+				meterFeed("announce", wav[0], 1)
+				mix16KSource(pcmbuf, wav[0], 1, sendOpus)
+			default:
 			}
 
-			mix16KSource(pcmbuf, wav[0], volumeScale, sendOpus)
-		default:
-		}
+			// 4. 混音: 本地音乐或网络电台（网络电台优先，两个节目不会同时发送）
+			musicSource, musicName := musicPCM, "music"
+			if isRadioPlaying() {
+				musicSource, musicName = radioPCM, "radio"
+			}
+			select {
+			case wav := <-musicSource:
+				sources = append(sources, musicName)
+				// 计算音乐音量缩放因子
+				// 如果有麦克风或信标活动，降低音乐音量
+				volumeScale = 1.0
+				if hasBeaconActivity && conf.System.DuckMusicPCM {
+					volumeScale = conf.System.DuckScale // 降低一个维度
+				}
+				meterFeed(musicName, wav[0], volumeScale)
+				mix16KSource(pcmbuf, wav[0], volumeScale, sendOpus)
+			default:
+			}
 
-		// 5. 混音: micPCM
-		select {
-		case wav := <-micPCM:
-			volumeScale = 1.0
-			if hasBeaconActivity && conf.System.DuckMicPCM {
-				volumeScale = conf.System.DuckScale // 降低一个维度
+			// 5. 混音: micPCM
+			select {
+			case wav := <-micPCM:
+				sources = append(sources, "mic")
+				volumeScale = 1.0
+				if hasBeaconActivity && conf.System.DuckMicPCM {
+					volumeScale = conf.System.DuckScale // 降低一个维度
+				}
+				meterFeed("mic", wav[0], volumeScale)
+				mix16KSource(pcmbuf, wav[0], volumeScale, sendOpus)
+			default:
 			}
-			mix16KSource(pcmbuf, wav[0], volumeScale, sendOpus)
-		default:
 		}
 
+		meterFeed("tx", pcmbuf, conf.System.Volume)
+		micOnAir.Process(slices.Contains(sources, "mic"), time.Now())
+
 		// 6. 静音检测
 		isSilence := true
 		for _, v := range pcmbuf {
@@ -168,10 +229,13 @@ func recivePCM() {
 		}
 
 		if !isSilence {
+			monitorTX(pcmbuf, sendOpus)
 			if dev == nil || dev.udpSocket == nil {
 				wasSending = false
+				airlog.Process(nil, sendOpus, nil, time.Now())
 				continue
 			}
+			airlog.Process(pcmbuf, sendOpus, sources, time.Now())
 			var packet []byte
 			if sendOpus {
 				opusData, err := encodeOpusVoice(intsToInt16WithVolume(pcmbuf, conf.System.Volume), !wasSending || !lastOpusMode)
@@ -191,11 +255,23 @@ func recivePCM() {
 			lastOpusMode = sendOpus
 		} else {
 			wasSending = false
+			airlog.Process(nil, sendOpus, nil, time.Now())
 		}
 
 	}
 }
 
+// discardLivePCM drops frames from real-time inputs while they are muted so
+// they resume live instead of replaying a backlog.
+func discardLivePCM() {
+	for _, source := range []chan [][]int{radioPCM, micPCM} {
+		select {
+		case <-source:
+		default:
+		}
+	}
+}
+
 func mix16KSource(dst, source []int, scale float64, targetOpus bool) {
 	if targetOpus {
 		mixPCMSource(dst, source, scale)
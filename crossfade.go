@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+)
+
+// 曲目之间的无缝衔接和交叉淡化：当前曲目接近结尾时预先打开下一首，
+// 结尾不足一帧的部分直接用下一首补齐；设置了 MusicCrossfade 时，
+// 在最后几秒把两首按等功率曲线混合。
+
+const (
+	maxMusicCrossfade = 12.0                   // 交叉淡化最长秒数
+	musicPreloadLead  = 5 * playbackSampleRate // 在交叉淡化开始前 5 秒预加载下一首
+	defaultSkipFade   = playbackSampleRate / 2 // 手动切歌的淡出长度（无交叉淡化时）
+	maxSkipFade       = 2 * playbackSampleRate // 手动切歌最长淡出 2 秒
+)
+
+// musicTrack 是已经打开、等待接替当前曲目的下一首
+type musicTrack struct {
+	file   MusicFileInfo
+	stream *audioStream
+}
+
+func (t *musicTrack) Close() {
+	if t != nil {
+		t.stream.Close()
+	}
+}
+
+// audible 表示下一首已经开始淡入
+func (t *musicTrack) audible() bool {
+	return t != nil && t.stream.Position() > 0
+}
+
+func validMusicCrossfade(seconds float64) bool {
+	return !math.IsNaN(seconds) && seconds >= 0 && seconds <= maxMusicCrossfade
+}
+
+func setMusicCrossfade(seconds float64) error {
+	if !validMusicCrossfade(seconds) {
+		return fmt.Errorf("crossfade must be between 0 and %g seconds", maxMusicCrossfade)
+	}
+	confMu.Lock()
+	conf.System.MusicCrossfade = seconds
+	confMu.Unlock()
+	return nil
+}
+
+func musicCrossfade() float64 {
+	confMu.Lock()
+	defer confMu.Unlock()
+	if !validMusicCrossfade(conf.System.MusicCrossfade) {
+		return 0
+	}
+	return conf.System.MusicCrossfade
+}
+
+// crossfadeSamples 返回 length 长的曲目实际使用的交叉淡化样本数，最长为曲目的一半
+func crossfadeSamples(length int64) int64 {
+	fade := int64(musicCrossfade() * playbackSampleRate)
+	if length <= 0 {
+		return 0
+	}
+	return min(fade, length/2)
+}
+
+// skipFadeSamples 返回手动切歌时的淡出长度：与交叉淡化相同（最长 2 秒），未设置时 0.5 秒
+func skipFadeSamples() int64 {
+	fade := int64(musicCrossfade() * playbackSampleRate)
+	if fade <= 0 {
+		return defaultSkipFade
+	}
+	return min(fade, maxSkipFade)
+}
+
+// preloadNextMusic 打开自然播放顺序中的下一首，没有下一首或打开失败时返回 nil
+func preloadNextMusic() *musicTrack {
+	musicstateMu.Lock()
+	queue := currentQueue.files
+	index := peekNextMusic(queue)
+	musicstateMu.Unlock()
+	if index < 0 {
+		return nil
+	}
+	file := queue[index]
+	stream, err := openAudioStream(file.Path)
+	if err != nil {
+		log.Printf("⚠️ 预加载下一首失败 %s: %v", file.Path, err)
+		return nil
+	}
+	return &musicTrack{file: file, stream: stream}
+}
+
+// mixTrackTail 把下一首混入当前帧。chunk 的前 n 个样本来自当前曲目，
+// 对应曲目内位置 [start, start+n)，length 为曲目长度（0 表示未知），fade 为交叉淡化样本数。
+// 交叉淡化区间内按等功率曲线混合；当前曲目已结束的部分（n < len(chunk)）直接用下一首补齐。
+func mixTrackTail(chunk []int, n int, start, length, fade int64, next *audioStream) error {
+	from := n
+	fadeStart := length - fade
+	if fade > 0 && length > 0 {
+		from = int(min(max(fadeStart-start, 0), int64(n)))
+	}
+	if from == len(chunk) {
+		return nil
+	}
+	incoming := make([]int, len(chunk)-from)
+	if _, err := next.Read(incoming); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	for i := from; i < len(chunk); i++ {
+		in := incoming[i-from]
+		if i >= n {
+			chunk[i] = in
+			continue
+		}
+		t := min(max(float64(start+int64(i)-fadeStart)/float64(fade), 0), 1)
+		angle := t * math.Pi / 2
+		chunk[i] = int(math.Round(float64(chunk[i])*math.Cos(angle) + float64(in)*math.Sin(angle)))
+	}
+	return nil
+}
+
+// fadeOutFrame 对一帧做线性淡出，left 为淡出剩余样本数，total 为淡出总长
+func fadeOutFrame(chunk []int, left, total int64) {
+	for i := range chunk {
+		gain := float64(max(left-int64(i), 0)) / float64(total)
+		chunk[i] = int(math.Round(float64(chunk[i]) * gain))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMixTrackTail(t *testing.T) {
+	samples := make([]int16, 100)
+	for i := range samples {
+		samples[i] = 1000
+	}
+	path := writeTestWAV(t, playbackSampleRate, 1, samples)
+	open := func() *audioStream {
+		stream, err := openAudioStream(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { stream.Close() })
+		return stream
+	}
+
+	// 无缝衔接：当前曲目只剩 4 个样本，其余用下一首补齐
+	next := open()
+	chunk := []int{500, 500, 500, 500, 0, 0, 0, 0}
+	if err := mixTrackTail(chunk, 4, 96, 100, 0, next); err != nil {
+		t.Fatal(err)
+	}
+	if chunk[3] != 500 || chunk[4] != 1000 || chunk[7] != 1000 || next.Position() != 4 {
+		t.Fatalf("gapless fill = %v, next at %d", chunk, next.Position())
+	}
+
+	// 交叉淡化：从第 90 个样本开始，共 10 个样本
+	next = open()
+	chunk = []int{800, 800, 800, 800, 800, 800, 800, 800}
+	if err := mixTrackTail(chunk, 8, 86, 100, 10, next); err != nil {
+		t.Fatal(err)
+	}
+	if chunk[3] != 800 || chunk[4] != 800 || next.Position() != 4 {
+		t.Fatalf("fade should start at sample 90: %v, next at %d", chunk, next.Position())
+	}
+	for i := 5; i < 8; i++ {
+		angle := float64(i-4) / 10 * math.Pi / 2
+		if want := int(math.Round(800*math.Cos(angle) + 1000*math.Sin(angle))); chunk[i] != want {
+			t.Fatalf("chunk[%d] = %d, want %d", i, chunk[i], want)
+		}
+	}
+
+	frame := []int{1000, 1000, 1000, 1000}
+	fadeOutFrame(frame, 2, 4)
+	if frame[0] != 500 || frame[1] != 250 || frame[2] != 0 {
+		t.Fatalf("fadeOutFrame = %v", frame)
+	}
+}
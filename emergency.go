@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultEmergencyRepeat = 3
+	maxEmergencyRepeat     = 20
+	emergencyToneSeconds   = 8
+	// One second of silence between repeats makes each alert distinct.
+	emergencyRepeatGap = playbackSampleRate
+	// emergencyFailedDir keeps drop files that could not be played.
+	emergencyFailedDir = "failed"
+)
+
+// emergencyAlert describes the alert currently holding the transmitter.
+type emergencyAlert struct {
+	Active  bool      `json:"active"`
+	Source  string    `json:"source"`
+	File    string    `json:"file,omitempty"`
+	Tones   bool      `json:"tones"`
+	Repeat  int       `json:"repeat"`
+	Message string    `json:"message,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+var emergencyActive uint32 = 0
+
+var emergencyState = struct {
+	sync.Mutex
+	ctx    context.Context // playback of the current alert, nil when idle
+	cancel context.CancelFunc
+	alert  emergencyAlert
+}{}
+
+// isEmergencyActive reports whether an alert currently preempts every other
+// mixer input.
+func isEmergencyActive() bool {
+	return atomic.LoadUint32(&emergencyActive) == 1
+}
+
+func emergencySnapshot() emergencyAlert {
+	emergencyState.Lock()
+	defer emergencyState.Unlock()
+	return emergencyState.alert
+}
+
+// triggerEmergency takes the air with file (or generated attention tones
+// when tones is set or file is empty) repeated repeat times. A new alert
+// replaces one that is still playing.
+func triggerEmergency(source, file string, tones bool, repeat int, message string) error {
+	if repeat <= 0 {
+		repeat = conf.System.EmergencyRepeat
+	}
+	if repeat <= 0 {
+		repeat = defaultEmergencyRepeat
+	}
+	if repeat > maxEmergencyRepeat {
+		return fmt.Errorf("emergency repeat must be between 1 and %d", maxEmergencyRepeat)
+	}
+	if !tones && file == "" {
+		file = conf.System.EmergencyAudio
+	}
+	tones = tones || file == ""
+
+	var pcm []int
+	if tones {
+		file = ""
+		pcm = emergencyTones(emergencyToneSeconds)
+	} else {
+		var err error
+		pcm, err = decodeAudioFile(file)
+		if err != nil {
+			return fmt.Errorf("decode emergency alert: %w", err)
+		}
+	}
+
+	alert := emergencyAlert{
+		Active:  true,
+		Source:  source,
+		File:    file,
+		Tones:   tones,
+		Repeat:  repeat,
+		Message: strings.TrimSpace(message),
+		Started: time.Now(),
+	}
+
+	emergencyState.Lock()
+	if emergencyState.cancel != nil {
+		emergencyState.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	emergencyState.ctx, emergencyState.cancel = ctx, cancel
+	emergencyState.alert = alert
+	atomic.StoreUint32(&emergencyActive, 1)
+	drainEmergencyPCM()
+	emergencyState.Unlock()
+
+	what := "attention tones"
+	if !tones {
+		what = filepath.Base(file)
+	}
+	log.Printf("🚨 紧急告警触发 (source=%s, %s x%d) %s", source, what, repeat, alert.Message)
+	updatePlayStatus(fmt.Sprintf("EMERGENCY: %s x%d", what, repeat), 0, true)
+	liveHub.NotifyEmergency(alert)
+	setAirlogTitle("emergency", what)
+
+	go runEmergency(ctx, pcm, repeat, beginAsrun("emergency", what, file))
+	return nil
+}
+
+// clearEmergency releases the transmitter back to the normal mix.
+func clearEmergency(reason string) {
+	endEmergency(nil, reason)
+}
+
+// endEmergency clears the alert. With owner set it only clears while the
+// alert started with that context still holds the air, so a finishing alert
+// cannot clear the one that replaced it.
+func endEmergency(owner context.Context, reason string) {
+	emergencyState.Lock()
+	if owner != nil && emergencyState.ctx != owner {
+		emergencyState.Unlock()
+		return
+	}
+	if emergencyState.cancel != nil {
+		emergencyState.cancel()
+	}
+	emergencyState.ctx, emergencyState.cancel = nil, nil
+	wasActive := emergencyState.alert.Active
+	emergencyState.alert = emergencyAlert{}
+	atomic.StoreUint32(&emergencyActive, 0)
+	drainEmergencyPCM()
+	emergencyState.Unlock()
+
+	if wasActive {
+		log.Printf("✅ 紧急告警解除 (%s)", reason)
+		updatePlayStatus("Emergency cleared", 0, conf.System.MusicPlaying)
+		liveHub.NotifyEmergency(emergencyAlert{})
+	}
+}
+
+func runEmergency(ctx context.Context, pcm []int, repeat int, onAir *asrunItem) {
+	// Log the alert as interrupted unless it played every repeat; a new
+	// alert that replaces it or a manual clear returns early.
+	completed := false
+	defer func() { onAir.finish(!completed) }()
+	for n := 0; n < repeat; n++ {
+		samples := pcm
+		if n > 0 {
+			samples = append(make([]int, emergencyRepeatGap), pcm...)
+		}
+		for i := 0; i < len(samples); i += opusFrameSamples {
+			end := min(i+opusFrameSamples, len(samples))
+			chunk := make([]int, opusFrameSamples)
+			copy(chunk, samples[i:end])
+			select {
+			case emergencyPCM <- [][]int{chunk}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	// Let the mixer send the queued frames before the normal mix returns.
+	for len(emergencyPCM) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	// endEmergency cancels ctx, so decide before calling it.
+	completed = ctx.Err() == nil
+	endEmergency(ctx, "completed")
+}
+
+func drainEmergencyPCM() {
+	for {
+		select {
+		case <-emergencyPCM:
+		default:
+			return
+		}
+	}
+}
+
+// emergencyTones generates the 853 Hz + 960 Hz two-tone attention signal
+// used by broadcast emergency alerting.
+func emergencyTones(seconds int) []int {
+	pcm := make([]int, seconds*playbackSampleRate)
+	for i := range pcm {
+		t := float64(i) / playbackSampleRate
+		sample := 0.35*math.Sin(2*math.Pi*853*t) + 0.35*math.Sin(2*math.Pi*960*t)
+		pcm[i] = clampPCM(int(sample * 32767))
+	}
+	return pcm
+}
+
+func emergencyPINValid(pin string) bool {
+	expected := conf.System.EmergencyPIN
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(pin), []byte(expected)) == 1
+}
+
+// handleEmergencyAT processes "<PIN>,ON|TONE|OFF[,<repeat>]".
+func handleEmergencyAT(value string) error {
+	parts := strings.Split(value, ",")
+	if len(parts) < 2 {
+		return fmt.Errorf("expects PIN,ON|TONE|OFF[,repeat]")
+	}
+	if !emergencyPINValid(strings.TrimSpace(parts[0])) {
+		return fmt.Errorf("invalid PIN")
+	}
+	repeat := 0
+	if len(parts) > 2 {
+		var err error
+		repeat, err = strconv.Atoi(strings.TrimSpace(parts[2]))
+		if err != nil || repeat < 0 {
+			return fmt.Errorf("invalid repeat %q", parts[2])
+		}
+	}
+	switch strings.ToUpper(strings.TrimSpace(parts[1])) {
+	case "ON":
+		return triggerEmergency("at", "", false, repeat, "")
+	case "TONE":
+		return triggerEmergency("at", "", true, repeat, "")
+	case "OFF":
+		clearEmergency("at")
+		return nil
+	default:
+		return fmt.Errorf("unsupported action %q", parts[1])
+	}
+}
+
+// watchEmergencyDropFolder plays any audio file written into
+// EmergencyDropPath as an emergency alert and then removes it.
+func watchEmergencyDropFolder() {
+	dir := conf.System.EmergencyDropPath
+	if dir == "" {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("紧急告警投放目录 %s 创建失败: %v", dir, err)
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("❌ 无法创建紧急告警 watcher: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(dir); err != nil {
+		log.Printf("❌ 无法监听紧急告警目录 %s: %v", dir, err)
+		return
+	}
+	log.Printf("👀 开始监听紧急告警投放目录: %s", dir)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Create) || !isSupportedAudioFile(event.Name) {
+				continue
+			}
+			go handleEmergencyDrop(event.Name)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("⚠️ 紧急告警目录监听错误:", err)
+		}
+	}
+}
+
+func handleEmergencyDrop(path string) {
+	waitForStableFile(path)
+	log.Printf("🚨 紧急告警投放文件: %s", path)
+	if err := triggerEmergency("drop", path, false, 0, filepath.Base(path)); err != nil {
+		log.Printf("紧急告警投放文件播放失败 %s: %v", path, err)
+		// Keep the file for inspection in the failed/ subfolder, where the
+		// watcher does not pick it up again.
+		failedDir := filepath.Join(filepath.Dir(path), emergencyFailedDir)
+		if err := os.MkdirAll(failedDir, 0755); err != nil {
+			log.Printf("紧急告警失败目录 %s 创建失败: %v", failedDir, err)
+			return
+		}
+		if err := os.Rename(path, filepath.Join(failedDir, filepath.Base(path))); err != nil {
+			log.Printf("移动紧急告警投放文件失败 %s: %v", path, err)
+		}
+		return
+	}
+	// The alert is already decoded, so the drop file is consumed.
+	if err := os.Remove(path); err != nil {
+		log.Printf("删除紧急告警投放文件失败 %s: %v", path, err)
+	}
+}
+
+// waitForStableFile waits until a file copied into a watched folder has
+// stopped growing, so a half-written file is not decoded.
+func waitForStableFile(path string) {
+	var lastSize int64 = -1
+	for range 50 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		if info.Size() == lastSize {
+			return
+		}
+		lastSize = info.Size()
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func emergencyFrameData(alert emergencyAlert) []byte {
+	data, _ := json.Marshal(alert)
+	return data
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEmergencyReplaceAndClear(t *testing.T) {
+	t.Cleanup(func() { clearEmergency("test") })
+	if err := triggerEmergency("api", "", true, 1, "first"); err != nil {
+		t.Fatal(err)
+	}
+	emergencyState.Lock()
+	first := emergencyState.ctx
+	emergencyState.Unlock()
+
+	if err := triggerEmergency("api", "", true, 2, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if first.Err() == nil {
+		t.Fatal("replaced alert was not cancelled")
+	}
+	// 被替换的告警结束时不能解除新的告警
+	endEmergency(first, "completed")
+	if alert := emergencySnapshot(); !isEmergencyActive() || alert.Message != "second" || alert.Repeat != 2 {
+		t.Fatalf("after the replaced alert finished: active=%v alert=%+v", isEmergencyActive(), alert)
+	}
+
+	clearEmergency("test")
+	if isEmergencyActive() || emergencySnapshot().Active {
+		t.Fatal("alert still active after clear")
+	}
+	if err := triggerEmergency("api", "", true, maxEmergencyRepeat+1, ""); err == nil {
+		t.Fatal("repeat above the limit accepted")
+	}
+}
+
+func TestEmergencyCompletes(t *testing.T) {
+	t.Cleanup(func() { clearEmergency("test") })
+	if err := triggerEmergency("api", "", true, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟混音器取走告警音频，播完后自动解除
+	deadline := time.After(5 * time.Second)
+	for isEmergencyActive() {
+		select {
+		case <-emergencyPCM:
+		case <-deadline:
+			t.Fatal("alert did not clear after playing")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestEmergencyAsrun(t *testing.T) {
+	useTempAsrunDir(t)
+	t.Cleanup(func() { clearEmergency("test") })
+
+	// 完整播完的告警不算打断
+	if err := triggerEmergency("api", "", true, 1, "complete"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(5 * time.Second)
+	for isEmergencyActive() {
+		select {
+		case <-emergencyPCM:
+		case <-deadline:
+			t.Fatal("alert did not clear after playing")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// 被替换和手动解除的告警记为打断
+	if err := triggerEmergency("api", "", true, 1, "replaced"); err != nil {
+		t.Fatal(err)
+	}
+	if err := triggerEmergency("api", "", true, 1, "cleared"); err != nil {
+		t.Fatal(err)
+	}
+	clearEmergency("test")
+
+	entries := waitAsrunEntries(t, "emergency", 3)
+	if entries[0].Interrupted || !entries[1].Interrupted || !entries[2].Interrupted {
+		t.Fatalf("interrupted flags = %v %v %v, want false true true", entries[0].Interrupted, entries[1].Interrupted, entries[2].Interrupted)
+	}
+}
+
+func TestHandleEmergencyAT(t *testing.T) {
+	confMu.Lock()
+	saved := conf.System.EmergencyPIN
+	conf.System.EmergencyPIN = "1234"
+	confMu.Unlock()
+	t.Cleanup(func() {
+		clearEmergency("test")
+		confMu.Lock()
+		conf.System.EmergencyPIN = saved
+		confMu.Unlock()
+	})
+
+	for _, value := range []string{"1234", "0000,ON", "1234,ON,x", "1234,ON,-1", "1234,ON,2x", "1234,FOO"} {
+		if err := handleEmergencyAT(value); err == nil {
+			t.Errorf("AT+EMERGENCY=%s accepted", value)
+		}
+	}
+	if isEmergencyActive() {
+		t.Fatal("rejected command started an alert")
+	}
+	if err := handleEmergencyAT(" 1234 , tone , 2 "); err != nil {
+		t.Fatal(err)
+	}
+	if alert := emergencySnapshot(); !alert.Active || !alert.Tones || alert.Repeat != 2 || alert.Source != "at" {
+		t.Fatalf("alert = %+v", alert)
+	}
+	if err := handleEmergencyAT("1234,OFF"); err != nil {
+		t.Fatal(err)
+	}
+	if isEmergencyActive() {
+		t.Fatal("alert still active after OFF")
+	}
+}
+
+func TestEmergencyDropKeepsFailedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "alert.wav")
+	if err := os.WriteFile(path, []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handleEmergencyDrop(path)
+	if isEmergencyActive() {
+		t.Fatal("undecodable drop file started an alert")
+	}
+	if _, err := os.Stat(filepath.Join(dir, emergencyFailedDir, "alert.wav")); err != nil {
+		t.Fatalf("failed drop file not kept: %v", err)
+	}
+}
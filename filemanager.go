@@ -0,0 +1,559 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// 网页上传和管理音乐、定时播放、信标音频文件。
+// 新增、改名、删除都只操作目录里的文件，播放队列和定时任务由各目录已有的
+// fsnotify 监听（handleMusicFileAdded / handleFileAdded 等）负责更新。
+
+const (
+	fileKindMusic    = "music"
+	fileKindSchedule = "schedule"
+	fileKindBeacon   = "beacon"
+
+	defaultUploadMaxMB = 200
+	maxFileTitleRunes  = 100
+)
+
+var (
+	fileManageMu    sync.Mutex // 串行化上传落盘和改名，避免两个请求分到同一个编号
+	fileTitleSuffix = regexp.MustCompile(`-\d{4}$`)
+)
+
+// managedFile 是文件管理列表中的一项
+type managedFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	ID     int    `json:"id"`               // 音乐编号，-1 表示文件名不含 -NNNN
+	Time   string `json:"time,omitempty"`   // 定时播放时间 HH:MM
+	Active bool   `json:"active,omitempty"` // 当前使用的信标文件
+}
+
+// uploadMaxBytes 返回上传大小上限，UploadMaxMB 未配置时使用默认值
+func uploadMaxBytes() int64 {
+	confMu.Lock()
+	mb := conf.System.UploadMaxMB
+	confMu.Unlock()
+	if mb <= 0 {
+		mb = defaultUploadMaxMB
+	}
+	return int64(mb) << 20
+}
+
+// beaconFile 返回当前信标音频路径
+func beaconFile() string {
+	confMu.Lock()
+	defer confMu.Unlock()
+	return conf.System.AudioFile
+}
+
+// managedDir 返回某类文件所在目录。信标文件放在 AudioFile 所在目录，
+// 未配置 AudioFile 时放在配置文件所在目录。
+func managedDir(kind string) (string, error) {
+	var dir string
+	switch kind {
+	case fileKindMusic:
+		dir = conf.System.MusicFilePath
+	case fileKindSchedule:
+		dir = conf.System.AudioFilePath
+	case fileKindBeacon:
+		if file := beaconFile(); file != "" {
+			dir = filepath.Dir(file)
+		} else if confPath != "" {
+			dir = filepath.Dir(confPath)
+		}
+	default:
+		return "", fmt.Errorf("unsupported file kind %q", kind)
+	}
+	if dir == "" {
+		return "", fmt.Errorf("%s directory is not configured", kind)
+	}
+	return dir, nil
+}
+
+// managedPath 校验客户端传来的文件名并返回完整路径，只允许目录下已存在的音频文件
+func managedPath(dir, name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	if !isSupportedAudioFile(name) {
+		return "", fmt.Errorf("unsupported audio file %q", name)
+	}
+	path := filepath.Join(dir, name)
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", fmt.Errorf("file %q not found", name)
+	}
+	return path, nil
+}
+
+// listManagedFiles 列出目录下的音频文件，音乐按编号排序，定时文件按时间排序
+func listManagedFiles(kind string) ([]managedFile, error) {
+	dir, err := managedDir(kind)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	beacon := filepath.Clean(beaconFile())
+	files := make([]managedFile, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || !isSupportedAudioFile(name) {
+			continue
+		}
+		file := managedFile{Name: name, ID: musicFileID(name)}
+		if info, err := entry.Info(); err == nil {
+			file.Size = info.Size()
+		}
+		switch kind {
+		case fileKindSchedule:
+			if m := filenameRegex.FindStringSubmatch(name); m != nil {
+				file.Time = m[1] + ":" + m[2]
+			}
+		case fileKindBeacon:
+			file.Active = filepath.Join(dir, name) == beacon
+		}
+		files = append(files, file)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		switch {
+		case kind == fileKindMusic && a.ID != b.ID:
+			return a.ID < b.ID
+		case kind == fileKindSchedule && a.Time != b.Time:
+			return a.Time < b.Time
+		}
+		return a.Name < b.Name
+	})
+	return files, nil
+}
+
+// musicFileID 返回文件名中的 -NNNN 编号，不符合命名规则时返回 -1
+func musicFileID(name string) int {
+	m := MusicfilenameRegex.FindStringSubmatch(name)
+	if m == nil {
+		return -1
+	}
+	return mustParseInt(m[1])
+}
+
+// nextMusicID 返回下一个可用编号：优先使用最大编号+1，编号用满 9999 后再找空位
+func nextMusicID(used map[int]bool) (int, error) {
+	highest := 0
+	for id := range used {
+		highest = max(highest, id)
+	}
+	if highest < 9999 {
+		return highest + 1, nil
+	}
+	for id := 1; id <= 9999; id++ {
+		if !used[id] {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no free music ID left")
+}
+
+// usedMusicIDs 扫描音乐目录（含子目录分类）中已占用的编号。
+// subfolders 为 false 时只统计根目录。
+func usedMusicIDs(dir string, subfolders bool) map[int]bool {
+	used := make(map[int]bool)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && (!subfolders || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if id := musicFileID(d.Name()); id >= 0 {
+			used[id] = true
+		}
+		return nil
+	})
+	return used
+}
+
+// fileTitle 从文件名中取出标题：去掉目录、扩展名，再按 cleanFileTitle 清理
+func fileTitle(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	return cleanFileTitle(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// cleanFileTitle 去掉 -NNNN / -HHMM 后缀，替换路径分隔符、控制字符和 Windows 保留字符，
+// 并去掉开头的点，避免生成隐藏文件。
+func cleanFileTitle(name string) string {
+	name = fileTitleSuffix.ReplaceAllString(strings.TrimSpace(name), "")
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxFileTitleRunes {
+		name = string(runes[:maxFileTitleRunes])
+	}
+	name = strings.Trim(name, " .")
+	if name == "" {
+		name = "audio"
+	}
+	return name
+}
+
+// parseScheduleTime 把 "8:30"、"08:30" 或 "0830" 转为文件名后缀 "0830"
+func parseScheduleTime(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	var hour, minute int
+	var err error
+	if strings.Contains(text, ":") {
+		_, err = fmt.Sscanf(text, "%d:%d", &hour, &minute)
+	} else if len(text) == 4 {
+		_, err = fmt.Sscanf(text, "%2d%2d", &hour, &minute)
+	} else {
+		err = fmt.Errorf("bad format")
+	}
+	if err != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return "", fmt.Errorf("invalid schedule time %q, want HH:MM", text)
+	}
+	return fmt.Sprintf("%02d%02d", hour, minute), nil
+}
+
+// managedFileName 按文件类型拼出规范文件名
+func managedFileName(kind, title, suffix, ext string) (string, error) {
+	ext = strings.ToLower(ext)
+	var name string
+	switch kind {
+	case fileKindMusic, fileKindSchedule:
+		name = title + "-" + suffix + ext
+	default:
+		name = title + ext
+	}
+	if kind == fileKindSchedule && !filenameRegex.MatchString(name) {
+		return "", fmt.Errorf("scheduled audio must be wav, mp3, flac, ogg, oga or opus")
+	}
+	if !isSupportedAudioFile(name) {
+		return "", fmt.Errorf("unsupported audio format %q", ext)
+	}
+	return name, nil
+}
+
+// saveUploadedAudio 保存上传的音频：先写入目录内的临时文件并用 countAudioSamples
+// 完整解码校验，再改名为规范文件名，让 fsnotify 的 Create 事件在内容写完后才触发。
+// scheduleTime 仅用于定时文件。返回最终文件名。
+func saveUploadedAudio(kind, filename, scheduleTime string, src io.Reader) (string, error) {
+	dir, err := managedDir(kind)
+	if err != nil {
+		return "", err
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	title := fileTitle(filename)
+	suffix := ""
+	if kind == fileKindSchedule {
+		if suffix, err = parseScheduleTime(scheduleTime); err != nil {
+			return "", err
+		}
+	}
+	// 先用占位编号检查格式，真正的编号在落盘前分配
+	if _, err := managedFileName(kind, title, "0000", ext); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*.part"+ext)
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	samples, err := countAudioSamples(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("not a playable audio file: %v", err)
+	}
+	if samples == 0 {
+		return "", fmt.Errorf("audio file contains no samples")
+	}
+
+	fileManageMu.Lock()
+	defer fileManageMu.Unlock()
+	if kind == fileKindMusic {
+		id, err := nextMusicID(usedMusicIDs(dir, true))
+		if err != nil {
+			return "", err
+		}
+		suffix = fmt.Sprintf("%04d", id)
+	}
+	name, err := managedFileName(kind, title, suffix, ext)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Lstat(path); err == nil {
+		return "", fmt.Errorf("file %q already exists", name)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", err
+	}
+	log.Printf("📤 已上传%s文件: %s", fileKindLabel(kind), path)
+	if kind == fileKindBeacon {
+		setBeaconFile(path)
+	}
+	return name, nil
+}
+
+// countAudioSamples 逐帧解码整个文件并返回样本数。样本读出即丢弃，
+// 上传的长音乐不会像 decodeAudioFile 那样整首放进内存。
+func countAudioSamples(path string) (int64, error) {
+	stream, err := openAudioStream(path)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	frame := make([]int, opusFrameSamples)
+	var samples int64
+	for {
+		n, err := stream.Read(frame)
+		samples += int64(n)
+		if errors.Is(err, io.EOF) {
+			return samples, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// renameManagedFile 改名或重新编号/改时间。title、id、scheduleTime 为空值时保留原值。
+func renameManagedFile(kind, name, title string, id int, scheduleTime string) (string, error) {
+	dir, err := managedDir(kind)
+	if err != nil {
+		return "", err
+	}
+	fileManageMu.Lock()
+	defer fileManageMu.Unlock()
+
+	oldPath, err := managedPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(title) != "" {
+		title = cleanFileTitle(title)
+	} else {
+		title = fileTitle(name)
+	}
+	var suffix string
+	switch kind {
+	case fileKindMusic:
+		if id == 0 {
+			id = musicFileID(name)
+		}
+		if id < 1 || id > 9999 {
+			return "", fmt.Errorf("music ID must be between 1 and 9999")
+		}
+		suffix = fmt.Sprintf("%04d", id)
+	case fileKindSchedule:
+		if scheduleTime == "" {
+			if m := filenameRegex.FindStringSubmatch(name); m != nil {
+				scheduleTime = m[1] + m[2]
+			}
+		}
+		if suffix, err = parseScheduleTime(scheduleTime); err != nil {
+			return "", err
+		}
+	}
+	newName, err := managedFileName(kind, title, suffix, filepath.Ext(name))
+	if err != nil {
+		return "", err
+	}
+	if newName == name {
+		return name, nil
+	}
+	newPath := filepath.Join(dir, newName)
+	if _, err := os.Lstat(newPath); err == nil {
+		return "", fmt.Errorf("file %q already exists", newName)
+	}
+	if kind == fileKindMusic {
+		if other := usedMusicIDs(dir, true); other[id] && musicFileID(name) != id {
+			return "", fmt.Errorf("music ID %04d is already used", id)
+		}
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return "", err
+	}
+	log.Printf("✏️ %s文件改名: %s -> %s", fileKindLabel(kind), name, newName)
+	afterManagedRename(kind, map[string]string{filepath.Clean(oldPath): filepath.Clean(newPath)})
+	return newName, nil
+}
+
+// renumberMusicFiles 按当前编号顺序把根目录的音乐文件重新编号为 1..N，跳过子目录分类已占用的编号。
+// 先全部改成临时名再改成目标名，避免新旧编号互相覆盖。
+func renumberMusicFiles() (int, error) {
+	dir, err := managedDir(fileKindMusic)
+	if err != nil {
+		return 0, err
+	}
+	fileManageMu.Lock()
+	defer fileManageMu.Unlock()
+
+	files, err := listManagedFiles(fileKindMusic)
+	if err != nil {
+		return 0, err
+	}
+	inSubfolders := usedMusicIDs(dir, true)
+	for id := range usedMusicIDs(dir, false) {
+		delete(inSubfolders, id)
+	}
+	type move struct{ from, tmp, to string }
+	var moves []move
+	id := 0
+	for _, file := range files {
+		if file.ID < 0 {
+			continue
+		}
+		for id++; inSubfolders[id]; id++ {
+		}
+		if file.ID == id {
+			continue
+		}
+		ext := filepath.Ext(file.Name)
+		to, err := managedFileName(fileKindMusic, fileTitle(file.Name), fmt.Sprintf("%04d", id), ext)
+		if err != nil {
+			return 0, err
+		}
+		moves = append(moves, move{
+			from: filepath.Join(dir, file.Name),
+			tmp:  filepath.Join(dir, fmt.Sprintf(".renumber-%d.part%s", id, ext)),
+			to:   filepath.Join(dir, to),
+		})
+	}
+
+	renamed := make(map[string]string, len(moves))
+	for i, m := range moves {
+		if err := os.Rename(m.from, m.tmp); err != nil {
+			// 撤销已经改成临时名的文件
+			for _, done := range moves[:i] {
+				os.Rename(done.tmp, done.from)
+			}
+			return 0, err
+		}
+	}
+	var firstErr error
+	for _, m := range moves {
+		target := m.to
+		if err := os.Rename(m.tmp, m.to); err != nil {
+			log.Printf("❌ 重新编号失败 %s: %v", m.from, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			if os.Rename(m.tmp, m.from) != nil {
+				continue
+			}
+			target = m.from
+		}
+		if target != m.from {
+			renamed[filepath.Clean(m.from)] = filepath.Clean(target)
+		}
+	}
+	log.Printf("🔢 音乐文件已重新编号，改名 %d 个文件", len(renamed))
+	afterManagedRename(fileKindMusic, renamed)
+	return len(renamed), firstErr
+}
+
+// deleteManagedFile 删除文件，正在使用的信标文件不能删除
+func deleteManagedFile(kind, name string) error {
+	dir, err := managedDir(kind)
+	if err != nil {
+		return err
+	}
+	fileManageMu.Lock()
+	defer fileManageMu.Unlock()
+
+	path, err := managedPath(dir, name)
+	if err != nil {
+		return err
+	}
+	if kind == fileKindBeacon && filepath.Clean(path) == filepath.Clean(beaconFile()) {
+		return fmt.Errorf("cannot delete the active beacon file")
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	log.Printf("🗑️ 已删除%s文件: %s", fileKindLabel(kind), path)
+	return nil
+}
+
+// activateBeaconFile 把目录中的某个文件设为信标音频
+func activateBeaconFile(name string) error {
+	dir, err := managedDir(fileKindBeacon)
+	if err != nil {
+		return err
+	}
+	path, err := managedPath(dir, name)
+	if err != nil {
+		return err
+	}
+	setBeaconFile(path)
+	return nil
+}
+
+func setBeaconFile(path string) {
+	confMu.Lock()
+	conf.System.AudioFile = path
+	confMu.Unlock()
+	saveConfig()
+	warmPCMCache(path)
+	log.Printf("📻 信标音频已切换为: %s", path)
+}
+
+// afterManagedRename 同步引用了旧路径的配置：信标文件和命名播放列表
+func afterManagedRename(kind string, renamed map[string]string) {
+	if len(renamed) == 0 {
+		return
+	}
+	switch kind {
+	case fileKindBeacon:
+		if target, ok := renamed[filepath.Clean(beaconFile())]; ok {
+			setBeaconFile(target)
+		}
+	case fileKindMusic:
+		renamePlaylistEntries(renamed)
+	}
+}
+
+func fileKindLabel(kind string) string {
+	switch kind {
+	case fileKindMusic:
+		return "音乐"
+	case fileKindSchedule:
+		return "定时播放"
+	default:
+		return "信标"
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManagedFileNaming(t *testing.T) {
+	if id, err := nextMusicID(map[int]bool{1: true, 2: true, 7: true}); err != nil || id != 8 {
+		t.Fatalf("nextMusicID = %d, %v; want 8", id, err)
+	}
+	if id, err := nextMusicID(map[int]bool{1: true, 9999: true}); err != nil || id != 2 {
+		t.Fatalf("nextMusicID with 9999 used = %d, %v; want 2", id, err)
+	}
+	for name, want := range map[string]string{
+		`C:\Users\me\歌曲-0003.MP3`: "歌曲",
+		"../../etc/passwd.wav":    "passwd",
+		".hidden.mp3":             "hidden",
+		"a:b?c.flac":              "a_b_c",
+		".mp3":                    "audio",
+	} {
+		if got := fileTitle(name); got != want {
+			t.Errorf("fileTitle(%q) = %q, want %q", name, got, want)
+		}
+	}
+	for text, want := range map[string]string{"8:30": "0830", "23:59": "2359", "0705": "0705"} {
+		if got, err := parseScheduleTime(text); err != nil || got != want {
+			t.Errorf("parseScheduleTime(%q) = %q, %v; want %q", text, got, err, want)
+		}
+	}
+	for _, text := range []string{"", "24:00", "12:60", "830", "ab:cd"} {
+		if _, err := parseScheduleTime(text); err == nil {
+			t.Errorf("parseScheduleTime(%q) succeeded", text)
+		}
+	}
+	if _, err := managedFileName(fileKindSchedule, "news", "0800", ".m4a"); err == nil {
+		t.Error("scheduled m4a accepted")
+	}
+}
+
+func TestUploadAndRenumberMusic(t *testing.T) {
+	dir := t.TempDir()
+	oldDir, oldPlaylists := conf.System.MusicFilePath, conf.System.Playlists
+	conf.System.MusicFilePath = dir
+	t.Cleanup(func() { conf.System.MusicFilePath, conf.System.Playlists = oldDir, oldPlaylists })
+
+	wav, err := os.ReadFile(writeTestWAV(t, 16000, 1, make([]int16, 1600)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a-0003.wav", "b-0010.wav"} {
+		if err := os.WriteFile(filepath.Join(dir, name), wav, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf.System.Playlists = []Playlist{{Name: "mix", Files: []string{filepath.Join(dir, "b-0010.wav")}}}
+
+	name, err := saveUploadedAudio(fileKindMusic, "New Song.wav", "", strings.NewReader(string(wav)))
+	if err != nil || name != "New Song-0011.wav" {
+		t.Fatalf("upload = %q, %v", name, err)
+	}
+	if _, err := saveUploadedAudio(fileKindMusic, "bad.wav", "", strings.NewReader("not audio")); err == nil {
+		t.Fatal("undecodable upload accepted")
+	}
+
+	if n, err := renumberMusicFiles(); err != nil || n != 3 {
+		t.Fatalf("renumber = %d, %v", n, err)
+	}
+	files, err := listManagedFiles(fileKindMusic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	if got := strings.Join(names, ","); got != "a-0001.wav,b-0002.wav,New Song-0003.wav" {
+		t.Fatalf("files after renumber = %s", got)
+	}
+	if got := conf.System.Playlists[0].Files[0]; got != filepath.Join(dir, "b-0002.wav") {
+		t.Fatalf("playlist entry = %s", got)
+	}
+}
+
+func TestUploadRejectsCorruptAudio(t *testing.T) {
+	dir := t.TempDir()
+	confMu.Lock()
+	oldDir := conf.System.MusicFilePath
+	conf.System.MusicFilePath = dir
+	confMu.Unlock()
+	t.Cleanup(func() {
+		confMu.Lock()
+		conf.System.MusicFilePath = oldDir
+		confMu.Unlock()
+	})
+
+	wav, err := os.ReadFile(writeTestWAV(t, 16000, 1, make([]int16, 1600)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ogg, err := os.ReadFile(filepath.Join("testdata", "stereo.ogg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 截断在头部或第一个音频包之前的文件，以及损坏的文件都不接受
+	for name, data := range map[string][]byte{
+		"header only.wav":   wav[:44],
+		"cut header.ogg":    ogg[:4000],
+		"no audio.ogg":      ogg[:6000],
+		"not audio.mp3":     []byte(strings.Repeat("not audio ", 100)),
+		"garbage flac.flac": append([]byte("fLaC"), make([]byte, 200)...),
+	} {
+		if _, err := saveUploadedAudio(fileKindMusic, name, "", bytes.NewReader(data)); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("rejected upload left %s behind", entry.Name())
+	}
+}
@@ -4,23 +4,29 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 //go:embed control.html play.html live.html live_mult.html login.html i18n.js
 var webAssets embed.FS
 
 type AudioFile struct {
-	Name      string `json:"name"`
-	Timestamp string `json:"timestamp"`
-	URL       string `json:"url"`
+	Name      string         `json:"name"`
+	Timestamp string         `json:"timestamp"`
+	URL       string         `json:"url"`
+	Timeline  []airlogMarker `json:"timeline,omitempty"` // 发射录音的节目时间线
 }
 
 // 从文件名提取时间
@@ -50,12 +56,24 @@ func play() {
 	http.HandleFunc("/dirs", listDirs)       // 获取所有日期目录
 	http.HandleFunc("/dir/", listFilesInDir) // 获取某目录下文件
 	http.Handle("/recordings/", http.StripPrefix("/recordings/", http.FileServer(http.Dir(conf.System.RecoderFilePath))))
+	if conf.System.AirlogFilePath != "" {
+		http.Handle("/airlog/", http.StripPrefix("/airlog/", http.FileServer(http.Dir(conf.System.AirlogFilePath))))
+	}
 
 	// Web API
 	http.HandleFunc("/api/status", apiStatus)
 	http.HandleFunc("/api/music", controlPageOnly(apiMusic))
+	http.HandleFunc("/api/music/cover", controlPageOnly(apiMusicCover))
 	http.HandleFunc("/api/radio", controlPageOnly(apiRadio))
 	http.HandleFunc("/api/control", controlPageOnly(apiControl))
+	http.HandleFunc("/api/announce", controlPageOnly(apiAnnounce))
+	http.HandleFunc("/api/emergency", controlPageOnly(apiEmergency))
+	http.HandleFunc("/api/monitor", controlPageOnly(apiMonitor))
+	http.HandleFunc("/api/files", controlPageOnly(apiFiles))
+	http.HandleFunc("/api/files/upload", controlPageOnly(apiFilesUpload))
+	http.HandleFunc("/api/asrun", controlPageOnly(apiAsrun))
+	http.HandleFunc("/ws/meters", controlPageOnly(handleMeterWS))    // 电平表 WebSocket，仅登录后可用
+	http.HandleFunc("/ws/control", controlPageOnly(handleControlWS)) // 控制指令 WebSocket，与 /api/control 相同
 	http.HandleFunc("/api/live-config", apiLiveConfig)
 	http.HandleFunc("/api/live-mult-config", apiLiveMultConfig)
 	http.HandleFunc("/api/ping", func(w http.ResponseWriter, r *http.Request) {
@@ -209,6 +227,7 @@ func apiStatus(w http.ResponseWriter, r *http.Request) {
 	s := statusState
 	c := cronState
 	p := progressState
+	elapsed, duration := elapsedState, durationState
 
 	displayMu.Unlock()
 
@@ -223,6 +242,8 @@ func apiStatus(w http.ResponseWriter, r *http.Request) {
 		"status":          s,
 		"cron":            c,
 		"progress":        p,
+		"elapsed":         elapsed,
+		"duration":        duration,
 		"playing":         conf.System.MusicPlaying,
 		"duck_scale":      int(conf.System.DuckScale * 100),
 		"duck_mic_pcm":    conf.System.DuckMicPCM,
@@ -232,28 +253,182 @@ func apiStatus(w http.ResponseWriter, r *http.Request) {
 		"send_opus":       isSendOpusEnabled(),
 		"cron_enabled":    isCronEnabled(),
 		"time_enabled":    isTimeEnabled(),
+		"emergency":       emergencySnapshot(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
 
 func apiMusic(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		apiMusicAction(w, r)
+		return
+	}
+	if name := r.URL.Query().Get("export"); name != "" {
+		exportPlaylist(w, name, r.URL.Query().Get("format"))
+		return
+	}
+
 	musicstateMu.Lock()
 	files := currentQueue.files
 	playingID := currentPlayingID
 	musicstateMu.Unlock()
 
+	if query := r.URL.Query().Get("q"); query != "" {
+		matched := make([]MusicFileInfo, 0, len(files))
+		for _, file := range files {
+			if matchesTrack(file, query) {
+				matched = append(matched, file)
+			}
+		}
+		files = matched
+	}
+
+	active := activePlaylistName()
+	if active == "" {
+		active = folderPlaylistName
+	}
 	data := map[string]any{
-		"files":     files,
-		"playingID": playingID,
+		"files":      files,
+		"playingID":  playingID,
+		"playlist":   active,
+		"playlists":  playlistSummaries(),
+		"mode":       musicPlayMode(),
+		"crossfade":  musicCrossfade(),
+		"categories": musicCategorySummaries(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
 
+// apiMusicCover 返回当前播放列表中某首曲目的内嵌封面
+func apiMusicCover(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	musicstateMu.Lock()
+	index := indexOfMusicID(currentQueue.files, id)
+	var path string
+	if index >= 0 {
+		path = currentQueue.files[index].Path
+	}
+	musicstateMu.Unlock()
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	cover, err := readTrackCover(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// 按实际内容判断类型，只返回位图，避免内嵌的 SVG/HTML 在本站执行
+	contentType := http.DetectContentType(cover)
+	if !strings.HasPrefix(contentType, "image/") || contentType == "image/svg+xml" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(cover)
+}
+
+func apiMusicAction(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action    string   `json:"action"`
+		Mode      string   `json:"mode"`
+		Crossfade float64  `json:"crossfade"`
+		Folder    string   `json:"folder"`
+		Enabled   *bool    `json:"enabled"`
+		Weight    *int     `json:"weight"`
+		Name      string   `json:"name"`
+		Files     []string `json:"files"`
+		Format    string   `json:"format"`
+		Content   string   `json:"content"`
+		Base      string   `json:"base"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*1024*1024)).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch req.Action {
+	case "activate":
+		switchToLocalMusic(errRadioStopped)
+		err = setActivePlaylist(req.Name)
+	case "save":
+		_, err = savePlaylist(req.Name, req.Files)
+	case "import":
+		base := req.Base
+		if base == "" {
+			base = conf.System.MusicFilePath
+		}
+		var files []string
+		files, err = parsePlaylist([]byte(req.Content), req.Format, base)
+		if err == nil {
+			_, err = savePlaylist(req.Name, files)
+		}
+	case "delete":
+		err = deletePlaylist(req.Name)
+	case "mode":
+		err = setMusicPlayMode(req.Mode)
+	case "crossfade":
+		err = setMusicCrossfade(req.Crossfade)
+	case "category":
+		err = setMusicCategory(req.Folder, req.Enabled, req.Weight)
+	default:
+		err = fmt.Errorf("unsupported music action")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	saveConfig()
+	w.WriteHeader(http.StatusOK)
+}
+
+func exportPlaylist(w http.ResponseWriter, name, format string) {
+	var playlist Playlist
+	if strings.EqualFold(name, folderPlaylistName) {
+		musicstateMu.Lock()
+		playlist.Name = folderPlaylistName
+		for _, file := range folderMusicFiles {
+			playlist.Files = append(playlist.Files, file.Path)
+		}
+		musicstateMu.Unlock()
+	} else {
+		var ok bool
+		if playlist, ok = findPlaylist(name); !ok {
+			http.Error(w, "playlist not found", http.StatusNotFound)
+			return
+		}
+	}
+	data, contentType, err := encodePlaylist(playlist, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ext := strings.ToLower(format)
+	if ext == "" {
+		ext = "m3u8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": playlist.Name + "." + ext}))
+	w.Write(data)
+}
+
 func apiRadio(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		writeRadioState(w)
+		if format := r.URL.Query().Get("export"); format != "" {
+			exportRadioStations(w, format)
+			return
+		}
+		writeRadioState(w, nil)
 		return
 	}
 	if r.Method != http.MethodPost {
@@ -262,22 +437,47 @@ func apiRadio(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Action string `json:"action"`
-		ID     string `json:"id"`
-		Name   string `json:"name"`
-		URL    string `json:"url"`
+		Action  string           `json:"action"`
+		ID      string           `json:"id"`
+		Name    string           `json:"name"`
+		URL     string           `json:"url"`
+		HLS     *RadioHLSOptions `json:"hls"`     // 省略时保留原有的 HLS 选项
+		Program RadioProgram     `json:"program"` // schedule_save 的节目，id 为空时新增
+		Minutes int              `json:"minutes"` // record_start 的录音时长，0 为手动停止
+		File    string           `json:"file"`    // replay 的录音，如 radio/2025-10-19/RADIO_....wav
+		At      string           `json:"at"`      // replay 的播出时间 HH:MM 或 RFC3339，为空立即播出
+		Format  string           `json:"format"`  // import 的格式 json/m3u/opml，为空自动识别
+		Content string           `json:"content"` // import 的电台列表内容
+		Seconds float64          `json:"seconds"` // probe 的探测时长，0 为默认 6 秒
 	}
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024)).Decode(&req); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*1024*1024)).Decode(&req); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
+	if req.Action == "probe" {
+		// 探测不上线播出，直接返回探测结果；不填 url 时探测 id 对应的电台
+		probeURL := req.URL
+		if probeURL == "" {
+			probeURL = findRadioStation(req.ID).URL
+		}
+		if probeURL == "" {
+			http.Error(w, "radio URL is required", http.StatusBadRequest)
+			return
+		}
+		report := probeRadioURL(probeURL, time.Duration(req.Seconds*float64(time.Second)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
 	var err error
+	imported, skipped := 0, 0
 	switch req.Action {
 	case "add":
-		_, err = saveRadioStation("", req.Name, req.URL)
+		_, err = saveRadioStation("", req.Name, req.URL, req.HLS)
 	case "update":
-		_, err = saveRadioStation(req.ID, req.Name, req.URL)
+		_, err = saveRadioStation(req.ID, req.Name, req.URL, req.HLS)
 		if err == nil {
 			_, activeID, playing, _ := radioSnapshot()
 			if playing && activeID == req.ID {
@@ -289,7 +489,37 @@ func apiRadio(w http.ResponseWriter, r *http.Request) {
 	case "play":
 		err = startRadio(req.ID)
 	case "stop":
-		stopRadio()
+		stopRadio(errRadioStopped)
+	case "schedule_save":
+		_, err = saveRadioProgram(req.Program)
+	case "schedule_delete":
+		err = deleteRadioProgram(req.ID)
+	case "record_start":
+		var until time.Time
+		if req.Minutes < 0 || req.Minutes > int(radioRecordMaxDuration/time.Minute) {
+			err = fmt.Errorf("radio recording length must be between 0 and %d minutes", int(radioRecordMaxDuration/time.Minute))
+			break
+		}
+		if req.Minutes > 0 {
+			until = time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		}
+		_, err = startRadioRecording(until)
+	case "record_stop":
+		stopRadioRecording()
+	case "replay":
+		var at time.Time
+		if at, err = parseReplayTime(req.At, time.Now()); err == nil {
+			_, err = scheduleRadioReplay(req.File, at)
+		}
+	case "replay_cancel":
+		err = cancelRadioReplay(req.ID)
+	case "import":
+		var stations, added []RadioStation
+		if stations, err = parseRadioStations([]byte(req.Content), req.Format); err == nil {
+			added, skipped = importRadioStations(stations)
+			imported = len(added)
+			log.Printf("📻 imported %d network radio station(s), skipped %d", imported, skipped)
+		}
 	default:
 		err = fmt.Errorf("unsupported radio action")
 	}
@@ -297,21 +527,67 @@ func apiRadio(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if req.Action == "add" || req.Action == "update" || req.Action == "delete" {
+	if req.Action == "add" || req.Action == "update" || req.Action == "delete" ||
+		req.Action == "schedule_save" || req.Action == "schedule_delete" || req.Action == "import" {
 		saveConfig()
 	}
-	writeRadioState(w)
+	if req.Action == "import" {
+		writeRadioState(w, map[string]any{"imported": imported, "skipped": skipped})
+		return
+	}
+	writeRadioState(w, nil)
+}
+
+func exportRadioStations(w http.ResponseWriter, format string) {
+	stations, _, _, _ := radioSnapshot()
+	data, contentType, ext, err := encodeRadioStations(stations, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "radio-stations." + ext}))
+	w.Write(data)
 }
 
-func writeRadioState(w http.ResponseWriter) {
+// writeRadioState 返回电台状态，extra 中的字段一并返回
+func writeRadioState(w http.ResponseWriter, extra map[string]any) {
 	stations, activeID, playing, status := radioSnapshot()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
+	state := map[string]any{
 		"stations":  stations,
 		"active_id": activeID,
 		"playing":   playing,
 		"status":    status,
-	})
+		"title":     radioTitle(),
+		"variant":   radioVariant(),
+		"schedule":  radioSchedulePrograms(),
+	}
+	if program, end, ok := currentRadioProgram(); ok {
+		state["program"] = map[string]any{"id": program.ID, "name": radioProgramLabel(program), "end": end.Format(time.RFC3339)}
+	}
+	if path, started, until, ok := radioRecording(); ok {
+		recording := map[string]any{"file": filepath.Base(path), "started": started.Format(time.RFC3339)}
+		if !until.IsZero() {
+			recording["until"] = until.Format(time.RFC3339)
+		}
+		state["recording"] = recording
+	}
+	state["replays"] = pendingRadioReplays()
+	for key, value := range extra {
+		state[key] = value
+	}
+	if alert, at := radioAlert(); alert != "" {
+		state["alert"], state["alert_time"] = alert, at.Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// controlRequest 是 /api/control 和 /ws/control 共用的控制指令
+type controlRequest struct {
+	Action string  `json:"action"`
+	Value  float64 `json:"value"`
+	ID     int     `json:"id"`
 }
 
 func apiControl(w http.ResponseWriter, r *http.Request) {
@@ -320,23 +596,58 @@ func apiControl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Action string  `json:"action"`
-		Value  float64 `json:"value"`
-		ID     int     `json:"id"`
-	}
+	var req controlRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
+	if err := applyControl(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+var controlUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// handleControlWS 接收与 /api/control 相同的 JSON 指令，逐条回复处理结果
+func handleControlWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := controlUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Control WS upgrade error from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(4096)
+
+	for {
+		var req controlRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		reply := map[string]any{"action": req.Action, "ok": true}
+		if err := applyControl(req); err != nil {
+			reply["ok"] = false
+			reply["error"] = err.Error()
+		}
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
 
+func applyControl(req controlRequest) error {
 	switch req.Action {
 	case "play_id":
-		switchToLocalMusic()
+		switchToLocalMusic(errRadioStopped)
 		PlayMusicByID(req.ID)
 	case "pause":
 		if isRadioPlaying() {
-			stopRadio()
+			stopRadio(errRadioStopped)
 			break
 		}
 		select {
@@ -346,13 +657,13 @@ func apiControl(w http.ResponseWriter, r *http.Request) {
 		conf.System.MusicPlaying = !conf.System.MusicPlaying
 		saveConfig()
 	case "next":
-		switchToLocalMusic()
+		switchToLocalMusic(errRadioStopped)
 		select {
 		case nextmusic <- true:
 		default:
 		}
 	case "prev":
-		switchToLocalMusic()
+		switchToLocalMusic(errRadioStopped)
 		select {
 		case lastmusic <- true:
 		default:
@@ -416,11 +727,103 @@ func apiControl(w http.ResponseWriter, r *http.Request) {
 		setTimeEnabled(conf.System.EnableTimePlay)
 		log.Printf("Time play enabled updated to: %v", conf.System.EnableTimePlay)
 		saveConfig()
+	case "seek":
+		return requestMusicSeek(musicSeek{value: req.Value})
+	case "seek_percent":
+		return requestMusicSeek(musicSeek{value: req.Value, percent: true})
+	}
+	return nil
+}
+
+func apiAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
+	var req struct {
+		Template string `json:"template"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*1024)).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err := playAnnouncement(req.Template); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// apiAsrun 查询播出日志：?from=&to=&source=music,radio，summary=1 时只返回按天统计
+func apiAsrun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	from, to, err := asrunRange(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var sources []string
+	for _, source := range strings.Split(query.Get("source"), ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	entries, err := queryAsrun(from, to, sources)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data := map[string]any{
+		"from":    from,
+		"to":      to,
+		"summary": summarizeAsrun(entries),
+	}
+	if query.Get("summary") == "" {
+		data["entries"] = entries
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+func apiEmergency(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var req struct {
+			Action  string `json:"action"`
+			Repeat  int    `json:"repeat"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*1024)).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		var err error
+		switch req.Action {
+		case "trigger":
+			err = triggerEmergency("api", "", false, req.Repeat, req.Message)
+		case "tones":
+			err = triggerEmergency("api", "", true, req.Repeat, req.Message)
+		case "clear":
+			clearEmergency("api")
+		default:
+			err = fmt.Errorf("unsupported emergency action")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(emergencySnapshot())
+}
+
 func apiLiveConfig(w http.ResponseWriter, r *http.Request) {
 	title := strings.TrimSpace(conf.System.LiveTitle)
 	subtitle := strings.TrimSpace(conf.System.LiveSubtitle)
@@ -464,44 +867,74 @@ func apiLiveMultConfig(w http.ResponseWriter, r *http.Request) {
 
 // 列出所有日期目录（如 2025-10-13）
 func listDirs(w http.ResponseWriter, r *http.Request) {
-	var dirs []string
+	dirs, err := dateDirs(conf.System.RecoderFilePath, "")
+	if err != nil {
+		http.Error(w, "扫描目录失败", http.StatusInternalServerError)
+		return
+	}
+	// 网络电台录音目录可能尚未创建
+	if radioDirs, err := dateDirs(filepath.Join(conf.System.RecoderFilePath, strings.TrimSuffix(radioRecordDirPrefix, "/")), radioRecordDirPrefix); err == nil {
+		dirs = append(dirs, radioDirs...)
+	}
+	if conf.System.AirlogFilePath != "" {
+		// 发射录音目录可能尚未创建
+		airlogDirs, err := dateDirs(conf.System.AirlogFilePath, airlogDirPrefix)
+		if err == nil {
+			dirs = append(dirs, airlogDirs...)
+		}
+	}
+
+	// 按日期排序（降序：最新日期在前），同一天通话录音在前
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := dirs[i][len(dirs[i])-10:], dirs[j][len(dirs[j])-10:]
+		if di != dj {
+			return di > dj
+		}
+		return len(dirs[i]) < len(dirs[j])
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dirs)
+}
 
-	err := filepath.WalkDir(conf.System.RecoderFilePath, func(path string, d fs.DirEntry, err error) error {
+// dateDirs 返回 root 下所有 YYYY-MM-DD 格式的子目录，并加上 prefix
+func dateDirs(root, prefix string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if !d.IsDir() {
 			return nil
 		}
-		rel, err := filepath.Rel(conf.System.RecoderFilePath, path)
+		rel, err := filepath.Rel(root, path)
 		if err != nil || rel == "." {
 			return nil
 		}
 		// 简单判断是否为 YYYY-MM-DD 格式
 		if len(rel) == 10 && rel[4] == '-' && rel[7] == '-' {
-			dirs = append(dirs, rel)
+			dirs = append(dirs, prefix+rel)
 		}
 		return nil
 	})
-
-	if err != nil {
-		http.Error(w, "扫描目录失败", http.StatusInternalServerError)
-		return
-	}
-
-	// 按日期排序（升序）
-	//sort.Strings(dirs)
-
-	// 按日期排序（降序：最新日期在前）
-	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(dirs)
+	return dirs, err
 }
 
 func listFilesInDir(w http.ResponseWriter, r *http.Request) {
 	dirName := strings.TrimPrefix(r.URL.Path, "/dir/")
-	dirPath := filepath.Join(conf.System.RecoderFilePath, dirName)
+	root, urlPrefix := conf.System.RecoderFilePath, "/recordings/"
+	airlogDir := strings.HasPrefix(dirName, airlogDirPrefix)
+	// 网络电台录音在通话录音目录下的 radio 子目录，同样带歌名时间线
+	radioDir := strings.HasPrefix(dirName, radioRecordDirPrefix)
+	if airlogDir {
+		dirName = strings.TrimPrefix(dirName, airlogDirPrefix)
+		root, urlPrefix = conf.System.AirlogFilePath, "/airlog/"
+		if root == "" {
+			http.Error(w, "目录不存在", http.StatusNotFound)
+			return
+		}
+	}
+	dirPath := filepath.Join(root, dirName)
 
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
 		http.Error(w, "目录不存在", http.StatusNotFound)
@@ -524,13 +957,17 @@ func listFilesInDir(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// ✅ 正确构造 URL：/recordings/2025-10-14/filename.wav
-		urlPath := "/recordings/" + dirName + "/" + info.Name()
+		urlPath := urlPrefix + dirName + "/" + info.Name()
 
-		files = append(files, AudioFile{
+		file := AudioFile{
 			Name:      info.Name(),
 			Timestamp: tm.Format("2006-01-02 15:04:05"),
 			URL:       urlPath, // ✅ 使用正确路径
-		})
+		}
+		if airlogDir || radioDir {
+			file.Timeline, _ = readAirlogTimeline(path)
+		}
+		files = append(files, file)
 		return nil
 	})
 
@@ -549,3 +986,151 @@ func listFilesInDir(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(files)
 }
+
+func apiMonitor(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var req struct {
+			Enabled *bool    `json:"enabled"`
+			Device  *string  `json:"device"`
+			Source  *string  `json:"source"`
+			Volume  *float64 `json:"volume"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*1024)).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		// 读改写都在 confMu 内完成，避免与其他设置同时修改配置
+		confMu.Lock()
+		device, source, volume := conf.System.MonitorDevice, conf.System.MonitorSource, conf.System.MonitorVolume
+		if req.Device != nil {
+			device = *req.Device
+		}
+		if req.Source != nil {
+			source = *req.Source
+		}
+		if req.Volume != nil {
+			volume = *req.Volume
+		}
+		if err := configureMonitor(device, source, volume); err != nil {
+			confMu.Unlock()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if source == "" {
+			source = monitorSourceRX
+		}
+		conf.System.MonitorDevice, conf.System.MonitorSource, conf.System.MonitorVolume = device, source, volume
+		if req.Enabled != nil {
+			conf.System.MonitorEnabled = *req.Enabled
+			setMonitorEnabled(conf.System.MonitorEnabled)
+		}
+		enabled := conf.System.MonitorEnabled
+		confMu.Unlock()
+		log.Printf("Local monitor updated: enabled=%v source=%s volume=%.2f device=%q",
+			enabled, source, volume, device)
+		saveConfig()
+	} else if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	devices, err := listMonitorDevices()
+	confMu.Lock()
+	state := map[string]any{
+		"enabled":    conf.System.MonitorEnabled,
+		"device":     conf.System.MonitorDevice,
+		"source":     conf.System.MonitorSource,
+		"volume":     conf.System.MonitorVolume,
+		"devices":    devices,
+		"selectable": monitorDeviceSelectable,
+	}
+	confMu.Unlock()
+	if err != nil {
+		state["error"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// apiFiles 列出、改名、删除和重新编号音乐/定时/信标文件，kind 为 music、schedule 或 beacon
+func apiFiles(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if r.Method == http.MethodPost {
+		var req struct {
+			Action string `json:"action"`
+			Kind   string `json:"kind"`
+			Name   string `json:"name"`
+			Title  string `json:"title"`
+			ID     int    `json:"id"`
+			Time   string `json:"time"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*1024)).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		kind = req.Kind
+		var err error
+		switch {
+		case req.Action == "rename":
+			_, err = renameManagedFile(req.Kind, req.Name, req.Title, req.ID, req.Time)
+		case req.Action == "delete":
+			err = deleteManagedFile(req.Kind, req.Name)
+		case req.Action == "renumber" && req.Kind == fileKindMusic:
+			_, err = renumberMusicFiles()
+		case req.Action == "activate" && req.Kind == fileKindBeacon:
+			err = activateBeaconFile(req.Name)
+		default:
+			err = fmt.Errorf("unsupported file action")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeManagedFiles(w, kind)
+}
+
+// apiFilesUpload 接收 multipart 上传（字段 kind、time、file），校验解码后保存
+func apiFilesUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := uploadMaxBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, fmt.Sprintf("upload rejected (limit %d MB): %v", limit>>20, err), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	kind := r.FormValue("kind")
+	if _, err := saveUploadedAudio(kind, header.Filename, r.FormValue("time"), file); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeManagedFiles(w, kind)
+}
+
+func writeManagedFiles(w http.ResponseWriter, kind string) {
+	files, err := listManagedFiles(kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"kind":      kind,
+		"files":     files,
+		"max_bytes": uploadMaxBytes(),
+	})
+}
@@ -13,16 +13,30 @@
       mute: '静音', unmute: '取消静音', broadcastTopic: '直播主题', liveBroadcast: '实时直播', standby: '待机',
       commLog: '通话记录', waitingTransmissions: '等待通话…', startListening: '开始监听', tapResumeAudio: '点击恢复音频',
       browserTitle: '录音文件浏览器', loading: '加载中…', loadingDirs: '加载日期列表…', noDirs: '暂无录音目录',
-      selectDate: '选择日期目录', loadDirsFailed: '加载目录失败', loadingFiles: '加载录音文件…', backDates: '← 返回日期列表',
+      selectDate: '选择日期目录', loadDirsFailed: '加载目录失败', loadingFiles: '加载录音文件…', backDates: '← 返回日期列表', airlogDir: '发射录音', radioRecordingDir: '网络电台录音',
       directory: '目录', audioUnsupported: '您的浏览器不支持 audio 标签。', loadFilesFailed: '加载文件失败',
       multiMonitor: '多房间监听', multiTitle: '多房间实时直播', multiIntro: '点击房间卡片开始监听；再次点击即可取消。支持同时订阅多个房间。',
       rooms: '房间', activeCalls: '通话中', listening: '监听中', searchRooms: '搜索房间名称或编号…', volume: '音量',
       loadingRooms: '正在获取房间列表…', recentCalls: '最近 20 次通话', noCalls: '暂无通话记录', noMatchingRooms: '没有匹配的房间',
       noRooms: '暂无可用房间', unnamedRoom: '未命名房间', idle: '空闲', clickListen: '○ 点击监听', nowListening: '● 正在监听',
       wsNotConnected: 'WebSocket 尚未连接', audioUnsupportedShort: '当前浏览器不支持音频播放', configFailed: '配置加载失败', configLoadFailed: '无法加载直播配置：{error}',
-      localMusic: '本地音乐', networkRadio: '网络电台', radioName: '电台名称', radioURL: 'MP3 / M3U8 网络地址', radioSave: '收藏电台', radioUpdate: '保存修改', radioCancel: '取消',
+      localMusic: '本地音乐', networkRadio: '网络电台', radioName: '电台名称', radioURL: '电台流、HLS 或 PLS/M3U/ASX 地址', radioHLSOptions: 'HLS 选项', radioMaxBandwidth: '最高码率 kbps（0 不限）', radioRendition: '音轨语言或名称', radioDownshift: '反复卡顿时自动降低码率', radioFallbackAlert: '电台已自动切换', radioRecord: '录制电台', radioRecording: '录音中', radioSave: '收藏电台', radioUpdate: '保存修改', radioCancel: '取消',
       radioPlay: '播放', radioStop: '停止电台', radioEdit: '编辑', radioDelete: '删除', radioEmpty: '还没有收藏网络电台', radioDeleteConfirm: '确定删除这个电台吗？',
       radioStopped: '已停止', radioConnecting: '正在连接', radioPlaying: '正在转发', radioReconnecting: '正在重连', radioRequestFailed: '网络电台操作失败',
+      radioProbe: '探测地址', radioProbeShort: '探测', radioProbing: '正在探测…', radioProbeOK: '✅ {seconds} 秒内解码正常', radioImport: '导入 JSON/M3U/OPML', radioImported: '已导入 {imported} 个电台，跳过 {skipped} 个重复或无效的条目',
+      radioExportJSON: '导出 JSON', radioExportM3U: '导出 M3U', radioExportOPML: '导出 OPML',
+      emergencyAlert: '紧急告警', emergencyTrigger: '播放告警', emergencyTones: '告警音', emergencyClear: '解除',
+      emergencyActive: '告警中', emergencyIdle: '正常', emergencyConfirm: '确定立即发送紧急告警？这会中断所有其他节目。', emergencyFailed: '紧急告警操作失败',
+      audioFiles: '音频文件', filesMusic: '音乐', filesSchedule: '定时播放', filesBeacon: '信标', filesUpload: '上传', filesRenumber: '重新编号', filesUse: '设为信标', filesRename: '改名',
+      filesEmpty: '目录中没有音频文件', filesFailed: '文件操作失败', filesRenumberConfirm: '按当前顺序把音乐重新编号为 0001、0002…？', filesDeleteConfirm: '确定删除这个文件吗？',
+      filesNewName: '新文件名（不含编号和扩展名）', filesNewID: '音乐编号 (1-9999)', filesNewTime: '播放时间 (HH:MM)', filesTooLarge: '文件超过 {size} 上限',
+      asrunLog: '播出日志', asrunAll: '全部', asrunEmpty: '当天没有播出记录', asrunOnAir: '播出中', asrunInterrupted: '被打断',
+      localMonitor: '本地监听', monitorRx: '收到的语音', monitorTx: '发出的混音', monitorBoth: '两者', monitorVolume: '监听音量', monitorDefaultDevice: '系统默认设备', monitorFailed: '本地监听设置失败',
+      folderPlaylist: '目录编号 (默认)', playlistImport: '导入 M3U/PLS', playlistExportM3U: '导出 M3U8', playlistExportPLS: '导出 PLS',
+      playlistName: '播放列表名称', playlistDeleteConfirm: '确定删除这个播放列表吗？', playlistFailed: '播放列表操作失败',
+      modeSequential: '顺序播放', modeShuffle: '随机播放', modeRepeatOne: '单曲循环', modeOnce: '播放一遍', songSearch: '搜索标题、艺术家、专辑', seek: '跳转', crossfade: '交叉淡化（秒，0 为无缝衔接）', categoryRoot: '根目录', categoryWeight: '轮播权重 (1-100)',
+      levelMeters: '电平', meterLive: '实时', meterOffline: '未连接', meter_beacon: '信标', meter_scheduled: '定时播放', meter_announce: '语音报时',
+      meter_music: '本地音乐', meter_radio: '网络电台', meter_mic: '麦克风', meter_emergency: '紧急告警', meter_tx: '发射混音', meter_rx: '收到语音',
       deviceIdentity: '当前保姆：呼号-SSID',
       serverIdentity: '当前连接的 NRL 服务器',
       login: '登录', controlLogin: '控制台登录', username: '用户名', password: '密码',
@@ -42,16 +56,30 @@
       mute: 'MUTE', unmute: 'UNMUTE', broadcastTopic: 'BROADCAST TOPIC', liveBroadcast: 'Live Broadcast', standby: 'STANDBY',
       commLog: 'Comm Log', waitingTransmissions: 'Waiting for transmissions…', startListening: 'START LISTENING', tapResumeAudio: 'TAP TO RESUME AUDIO',
       browserTitle: 'Recordings Browser', loading: 'Loading…', loadingDirs: 'Loading date directories…', noDirs: 'No recording directories',
-      selectDate: 'Select a date directory', loadDirsFailed: 'Failed to load directories', loadingFiles: 'Loading recordings…', backDates: '← Back to date directories',
+      selectDate: 'Select a date directory', loadDirsFailed: 'Failed to load directories', loadingFiles: 'Loading recordings…', backDates: '← Back to date directories', airlogDir: 'Off-air log', radioRecordingDir: 'Radio recordings',
       directory: 'Directory', audioUnsupported: 'Your browser does not support the audio element.', loadFilesFailed: 'Failed to load files',
       multiMonitor: 'MULTI-ROOM MONITOR', multiTitle: 'Multi-room live monitor', multiIntro: 'Click a room to listen; click it again to stop. You can subscribe to multiple rooms at once.',
       rooms: 'Rooms', activeCalls: 'Active calls', listening: 'Listening', searchRooms: 'Search room name or number…', volume: 'Volume',
       loadingRooms: 'Loading room list…', recentCalls: 'Last 20 calls', noCalls: 'No call records', noMatchingRooms: 'No matching rooms',
       noRooms: 'No rooms available', unnamedRoom: 'Unnamed room', idle: 'Idle', clickListen: '○ CLICK TO LISTEN', nowListening: '● LISTENING',
       wsNotConnected: 'WebSocket is not connected', audioUnsupportedShort: 'Your browser does not support audio playback', configFailed: 'Configuration failed', configLoadFailed: 'Could not load live configuration: {error}',
-      localMusic: 'Local Music', networkRadio: 'Internet Radio', radioName: 'Station name', radioURL: 'MP3 / M3U8 stream URL', radioSave: 'Save station', radioUpdate: 'Save changes', radioCancel: 'Cancel',
+      localMusic: 'Local Music', networkRadio: 'Internet Radio', radioName: 'Station name', radioURL: 'Stream, HLS or PLS/M3U/ASX URL', radioHLSOptions: 'HLS options', radioMaxBandwidth: 'Max bitrate kbps (0 = no limit)', radioRendition: 'Audio language or name', radioDownshift: 'Lower bitrate after repeated stalls', radioFallbackAlert: 'Radio switched automatically', radioRecord: 'Record radio', radioRecording: 'Recording', radioSave: 'Save station', radioUpdate: 'Save changes', radioCancel: 'Cancel',
       radioPlay: 'Play', radioStop: 'Stop radio', radioEdit: 'Edit', radioDelete: 'Delete', radioEmpty: 'No saved internet radio stations', radioDeleteConfirm: 'Delete this station?',
       radioStopped: 'Stopped', radioConnecting: 'Connecting', radioPlaying: 'Forwarding', radioReconnecting: 'Reconnecting', radioRequestFailed: 'Internet radio request failed',
+      radioProbe: 'Probe URL', radioProbeShort: 'Probe', radioProbing: 'Probing…', radioProbeOK: '✅ Decoded {seconds} s of audio', radioImport: 'Import JSON/M3U/OPML', radioImported: 'Imported {imported} station(s), skipped {skipped} duplicate or invalid entries',
+      radioExportJSON: 'Export JSON', radioExportM3U: 'Export M3U', radioExportOPML: 'Export OPML',
+      emergencyAlert: 'Emergency Alert', emergencyTrigger: 'Play alert', emergencyTones: 'Alert tones', emergencyClear: 'Clear',
+      emergencyActive: 'ALERT ON AIR', emergencyIdle: 'Normal', emergencyConfirm: 'Send an emergency alert now? This interrupts every other program.', emergencyFailed: 'Emergency alert request failed',
+      audioFiles: 'Audio Files', filesMusic: 'Music', filesSchedule: 'Scheduled', filesBeacon: 'Beacon', filesUpload: 'Upload', filesRenumber: 'Renumber', filesUse: 'Use as beacon', filesRename: 'Rename',
+      filesEmpty: 'No audio files in this folder', filesFailed: 'File request failed', filesRenumberConfirm: 'Renumber music as 0001, 0002… in the current order?', filesDeleteConfirm: 'Delete this file?',
+      filesNewName: 'New name (without ID or extension)', filesNewID: 'Music ID (1-9999)', filesNewTime: 'Play time (HH:MM)', filesTooLarge: 'File exceeds the {size} limit',
+      asrunLog: 'As-run Log', asrunAll: 'All', asrunEmpty: 'Nothing went on air that day', asrunOnAir: 'on air', asrunInterrupted: 'interrupted',
+      localMonitor: 'Local Monitor', monitorRx: 'Received audio', monitorTx: 'Transmitted mix', monitorBoth: 'Both', monitorVolume: 'Monitor volume', monitorDefaultDevice: 'System default', monitorFailed: 'Local monitor update failed',
+      folderPlaylist: 'Folder (default)', playlistImport: 'Import M3U/PLS', playlistExportM3U: 'Export M3U8', playlistExportPLS: 'Export PLS',
+      playlistName: 'Playlist name', playlistDeleteConfirm: 'Delete this playlist?', playlistFailed: 'Playlist request failed',
+      modeSequential: 'Sequential', modeShuffle: 'Shuffle', modeRepeatOne: 'Repeat one', modeOnce: 'Play once', songSearch: 'Search title, artist, album', seek: 'Seek', crossfade: 'Crossfade (seconds, 0 = gapless)', categoryRoot: 'Root folder', categoryWeight: 'Rotation weight (1-100)',
+      levelMeters: 'Levels', meterLive: 'LIVE', meterOffline: 'Offline', meter_beacon: 'Beacon', meter_scheduled: 'Scheduled', meter_announce: 'Announce',
+      meter_music: 'Music', meter_radio: 'Radio', meter_mic: 'Mic', meter_emergency: 'Emergency', meter_tx: 'TX mix', meter_rx: 'Received',
       deviceIdentity: 'Current nanny: callsign-SSID',
       serverIdentity: 'Connected NRL server',
       login: 'Login', controlLogin: 'Control panel login', username: 'Username', password: 'Password',
@@ -16,12 +16,15 @@ var timePCM = make(chan [][]int, 3)
 var musicPCM = make(chan [][]int, 3)
 var radioPCM = make(chan [][]int, 3)
 var micPCM = make(chan [][]int, 3)
+var announcePCM = make(chan [][]int, 3)
+var emergencyPCM = make(chan [][]int, 3)
 
 var nextmusic = make(chan bool, 1)
 var lastmusic = make(chan bool, 1)
 var pausemusic = make(chan bool, 1)
 var stopmusic = make(chan bool, 1)
 var startmusic = make(chan bool, 1)
+var seekmusic = make(chan musicSeek, 1)
 
 func main() {
 
@@ -37,12 +40,20 @@ func main() {
 
 	go StartRecoder()
 
-	// go newplay() // 本地监听已通过浏览器实现，不再需要本地音频输出
+	configureMonitor(conf.System.MonitorDevice, conf.System.MonitorSource, conf.System.MonitorVolume)
+	setMonitorEnabled(conf.System.MonitorEnabled)
+	go runMonitor()
+
+	go runMeters()
 
 	time.Sleep(time.Second * 1)
 
 	go startcron()
 
+	go startAnnounceCron()
+
+	go watchEmergencyDropFolder()
+
 	go play()
 
 	go playAudio()
@@ -0,0 +1,744 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/go-audio/wav"
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
+)
+
+// 曲目元数据：从 MP3 (ID3v2/ID3v1)、FLAC 和 Ogg (Vorbis comment)、M4A/MP4 (ilst)
+// 和 WAV (LIST/INFO) 中读取标题、艺术家、专辑、时长和封面。
+// 结果按 路径+修改时间+大小 缓存，全量重扫时不必重新解析未变化的文件。
+
+// TrackMeta 嵌入 MusicFileInfo，随 /api/music 一起返回
+type TrackMeta struct {
+	Title    string  `json:"title,omitempty"`
+	Artist   string  `json:"artist,omitempty"`
+	Album    string  `json:"album,omitempty"`
+	Duration float64 `json:"duration,omitempty"` // 秒
+	HasCover bool    `json:"cover,omitempty"`
+}
+
+type trackMetaEntry struct {
+	modTime time.Time
+	size    int64
+	meta    TrackMeta
+}
+
+const (
+	maxID3TagSize   = 32 * 1024 * 1024
+	maxMP4MoovSize  = 64 * 1024 * 1024
+	maxTagTextBytes = 1024
+)
+
+var trackMetaCache = struct {
+	sync.Mutex
+	entries map[string]trackMetaEntry
+}{entries: make(map[string]trackMetaEntry)}
+
+// cachedTrackMeta 返回文件的元数据，文件未变化时直接使用缓存。
+// 读取失败时返回空元数据，界面回退为显示文件名。
+func cachedTrackMeta(path string) TrackMeta {
+	info, err := os.Stat(path)
+	if err != nil {
+		return TrackMeta{}
+	}
+	trackMetaCache.Lock()
+	entry, ok := trackMetaCache.entries[path]
+	trackMetaCache.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.meta
+	}
+
+	trackMeta, _, err := readTrackMeta(path, false)
+	if err != nil {
+		trackMeta = TrackMeta{}
+	}
+	trackMetaCache.Lock()
+	trackMetaCache.entries[path] = trackMetaEntry{modTime: info.ModTime(), size: info.Size(), meta: trackMeta}
+	trackMetaCache.Unlock()
+	return trackMeta
+}
+
+func forgetTrackMeta(path string) {
+	trackMetaCache.Lock()
+	delete(trackMetaCache.entries, path)
+	trackMetaCache.Unlock()
+}
+
+// readTrackCover 读取内嵌封面，封面数据较大，不进入缓存
+func readTrackCover(path string) ([]byte, error) {
+	_, cover, err := readTrackMeta(path, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(cover) == 0 {
+		return nil, fmt.Errorf("no cover art in %s", filepath.Base(path))
+	}
+	return cover, nil
+}
+
+// trackDisplayName 用于状态文字和发射录音时间线，没有标题时使用文件名
+func trackDisplayName(file MusicFileInfo) string {
+	if file.Title == "" {
+		return filepath.Base(file.Path)
+	}
+	if file.Artist == "" {
+		return file.Title
+	}
+	return file.Artist + " - " + file.Title
+}
+
+// matchesTrack 判断曲目的文件名或元数据是否包含 query（不区分大小写）
+func matchesTrack(file MusicFileInfo, query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return true
+	}
+	for _, field := range []string{filepath.Base(file.Path), file.Title, file.Artist, file.Album} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func readTrackMeta(path string, wantCover bool) (TrackMeta, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return TrackMeta{}, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return TrackMeta{}, nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		return readMP3Meta(f, info.Size(), wantCover)
+	case ".aac", ".adts":
+		trackMeta, cover, _, err := readID3v2(f, wantCover)
+		return trackMeta, cover, err
+	case ".flac":
+		return readFLACMeta(f, wantCover)
+	case ".m4a", ".mp4":
+		return readMP4Meta(f, info.Size(), wantCover)
+	case ".wav":
+		trackMeta, err := readWAVMeta(f)
+		return trackMeta, nil, err
+	case ".ogg", ".oga", ".opus":
+		return readOggMeta(f, wantCover)
+	default:
+		return TrackMeta{}, nil, fmt.Errorf("unsupported audio format %q", filepath.Ext(path))
+	}
+}
+
+func readMP3Meta(f *os.File, size int64, wantCover bool) (TrackMeta, []byte, error) {
+	trackMeta, cover, tagSize, err := readID3v2(f, wantCover)
+	if err != nil {
+		return TrackMeta{}, nil, err
+	}
+	audioEnd := size
+	if v1, ok := readID3v1(f, size); ok {
+		audioEnd -= 128
+		if trackMeta.Title == "" {
+			trackMeta.Title = v1.Title
+		}
+		if trackMeta.Artist == "" {
+			trackMeta.Artist = v1.Artist
+		}
+		if trackMeta.Album == "" {
+			trackMeta.Album = v1.Album
+		}
+	}
+	if trackMeta.Duration == 0 {
+		trackMeta.Duration = mp3Duration(f, tagSize, audioEnd)
+	}
+	return trackMeta, cover, nil
+}
+
+// readID3v2 解析文件开头的 ID3v2.2/2.3/2.4 标签，返回标签总长度（无标签为 0）
+func readID3v2(r io.ReadSeeker, wantCover bool) (TrackMeta, []byte, int64, error) {
+	var trackMeta TrackMeta
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return trackMeta, nil, 0, err
+	}
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:3]) != "ID3" {
+		return trackMeta, nil, 0, nil
+	}
+	version, flags := header[3], header[5]
+	size := int64(syncsafeInt(header[6:10]))
+	tagSize := 10 + size
+	if flags&0x10 != 0 {
+		tagSize += 10 // footer
+	}
+	if version < 2 || version > 4 || size > maxID3TagSize {
+		return trackMeta, nil, tagSize, nil
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return trackMeta, nil, tagSize, nil
+	}
+	if flags&0x80 != 0 && version < 4 {
+		body = removeUnsynchronisation(body)
+	}
+	if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+		// 跳过扩展头
+		extSize := int(binary.BigEndian.Uint32(body))
+		if version == 3 {
+			extSize += 4
+		} else {
+			extSize = syncsafeInt(body[:4])
+		}
+		if extSize < 0 || extSize > len(body) {
+			return trackMeta, nil, tagSize, nil
+		}
+		body = body[extSize:]
+	}
+
+	var cover []byte
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	for len(body) >= headerSize && body[0] != 0 {
+		id := string(body[:idSize])
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(body[4:8]))
+		default:
+			frameSize = syncsafeInt(body[4:8])
+		}
+		if frameSize < 0 || frameSize > len(body)-headerSize {
+			break
+		}
+		frame := body[headerSize : headerSize+frameSize]
+		if version == 4 && len(frame) > 0 {
+			formatFlags := body[9]
+			if formatFlags&0x01 != 0 && len(frame) >= 4 {
+				frame = frame[4:] // 数据长度指示
+			}
+			if formatFlags&0x02 != 0 {
+				frame = removeUnsynchronisation(frame)
+			}
+		}
+		body = body[headerSize+frameSize:]
+		if len(frame) == 0 {
+			continue
+		}
+
+		switch id {
+		case "TIT2", "TT2":
+			trackMeta.Title = id3Text(frame)
+		case "TPE1", "TP1":
+			trackMeta.Artist = id3Text(frame)
+		case "TALB", "TAL":
+			trackMeta.Album = id3Text(frame)
+		case "TLEN", "TLE":
+			if ms, err := strconv.Atoi(id3Text(frame)); err == nil && ms > 0 {
+				trackMeta.Duration = float64(ms) / 1000
+			}
+		case "APIC", "PIC":
+			pictureType, picture := parseID3Picture(frame, id == "PIC")
+			if picture == nil {
+				continue
+			}
+			trackMeta.HasCover = true
+			// 优先使用封面 (type 3)
+			if wantCover && (cover == nil || pictureType == 3) {
+				cover = picture
+			}
+		}
+	}
+	return trackMeta, cover, tagSize, nil
+}
+
+func syncsafeInt(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func removeUnsynchronisation(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xff, 0x00}, []byte{0xff})
+}
+
+// id3Text 解码文本帧，多值（v2.4 以 NUL 分隔）只取第一个
+func id3Text(frame []byte) string {
+	text := decodeID3String(frame[0], frame[1:])
+	if i := strings.IndexByte(text, 0); i >= 0 {
+		text = text[:i]
+	}
+	return cleanTagText(text)
+}
+
+func decodeID3String(encoding byte, b []byte) string {
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(b) >= 2 {
+			if b[0] == 0xff && b[1] == 0xfe {
+				bigEndian, b = false, b[2:]
+			} else if b[0] == 0xfe && b[1] == 0xff {
+				bigEndian, b = true, b[2:]
+			}
+		}
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(b[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(b[i:]))
+			}
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		return string(b)
+	default:
+		return latin1String(b)
+	}
+}
+
+func latin1String(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// splitID3Terminated 按编码的结束符切分出一个字符串，返回剩余数据
+func splitID3Terminated(encoding byte, b []byte) ([]byte, bool) {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[i+2:], true
+			}
+		}
+		return nil, false
+	}
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return nil, false
+	}
+	return b[i+1:], true
+}
+
+// parseID3Picture 解析 APIC (v2.3/2.4) 或 PIC (v2.2) 帧，返回图片类型和数据；
+// 图片格式由 HTTP 层按内容判断，这里不使用帧中的 MIME
+func parseID3Picture(frame []byte, v22 bool) (byte, []byte) {
+	encoding, rest := frame[0], frame[1:]
+	var mime string
+	if v22 {
+		if len(rest) < 3 {
+			return 0, nil
+		}
+		mime, rest = string(rest[:3]), rest[3:]
+	} else {
+		i := bytes.IndexByte(rest, 0)
+		if i < 0 {
+			return 0, nil
+		}
+		mime, rest = string(rest[:i]), rest[i+1:]
+	}
+	if len(rest) < 1 || mime == "-->" {
+		return 0, nil
+	}
+	pictureType := rest[0]
+	rest, ok := splitID3Terminated(encoding, rest[1:])
+	if !ok || len(rest) == 0 {
+		return 0, nil
+	}
+	return pictureType, rest
+}
+
+// readID3v1 读取文件末尾 128 字节的 ID3v1 标签；只接受合法 UTF-8，
+// 避免把 GBK 等本地编码显示成乱码
+func readID3v1(r io.ReaderAt, size int64) (TrackMeta, bool) {
+	if size < 128 {
+		return TrackMeta{}, false
+	}
+	tag := make([]byte, 128)
+	if _, err := r.ReadAt(tag, size-128); err != nil || string(tag[:3]) != "TAG" {
+		return TrackMeta{}, false
+	}
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		if !utf8.Valid(b) {
+			return ""
+		}
+		return cleanTagText(string(b))
+	}
+	return TrackMeta{Title: field(tag[3:33]), Artist: field(tag[33:63]), Album: field(tag[63:93])}, true
+}
+
+func cleanTagText(text string) string {
+	text = strings.TrimSpace(strings.ToValidUTF8(text, ""))
+	text = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, text)
+	if len(text) > maxTagTextBytes {
+		text = strings.ToValidUTF8(text[:maxTagTextBytes], "")
+	}
+	return text
+}
+
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}, // MPEG-1 Layer III
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},     // MPEG-2/2.5 Layer III
+	}
+	mp3SampleRates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG-2.5
+		{},                    // reserved
+		{22050, 24000, 16000}, // MPEG-2
+		{44100, 48000, 32000}, // MPEG-1
+	}
+)
+
+// mp3Duration 根据第一帧的 Xing/Info/VBRI 头得到时长，没有时按 CBR 估算，
+// 不需要解码或扫描整个文件
+func mp3Duration(r io.ReaderAt, start, end int64) float64 {
+	buf := make([]byte, 4096)
+	n, _ := r.ReadAt(buf, start)
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xff || buf[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		versionBits := buf[i+1] >> 3 & 0x03
+		layer := buf[i+1] >> 1 & 0x03
+		bitrateIndex := buf[i+2] >> 4
+		rateIndex := buf[i+2] >> 2 & 0x03
+		if versionBits == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			continue // 只处理 Layer III
+		}
+		mpeg1 := versionBits == 3
+		sampleRate := mp3SampleRates[versionBits][rateIndex]
+		bitrate := mp3Bitrates[1][bitrateIndex]
+		samplesPerFrame := 576
+		if mpeg1 {
+			bitrate = mp3Bitrates[0][bitrateIndex]
+			samplesPerFrame = 1152
+		}
+		mono := buf[i+3]>>6 == 3
+
+		sideInfo := 32
+		switch {
+		case mpeg1 && mono, !mpeg1 && !mono:
+			sideInfo = 17
+		case !mpeg1 && mono:
+			sideInfo = 9
+		}
+		frame := buf[i:]
+		for _, offset := range []int{4 + sideInfo, 36} {
+			if len(frame) < offset+16 {
+				continue
+			}
+			switch string(frame[offset : offset+4]) {
+			case "Xing", "Info":
+				if binary.BigEndian.Uint32(frame[offset+4:])&0x01 != 0 {
+					frames := binary.BigEndian.Uint32(frame[offset+8:])
+					return float64(frames) * float64(samplesPerFrame) / float64(sampleRate)
+				}
+			case "VBRI":
+				if len(frame) >= offset+18 {
+					frames := binary.BigEndian.Uint32(frame[offset+14:])
+					return float64(frames) * float64(samplesPerFrame) / float64(sampleRate)
+				}
+			}
+		}
+		audioBytes := end - start - int64(i)
+		if audioBytes <= 0 {
+			return 0
+		}
+		return float64(audioBytes) * 8 / float64(bitrate*1000)
+	}
+	return 0
+}
+
+func readFLACMeta(f *os.File, wantCover bool) (TrackMeta, []byte, error) {
+	stream, err := flac.Parse(f)
+	if err != nil {
+		return TrackMeta{}, nil, err
+	}
+	var trackMeta TrackMeta
+	if info := stream.Info; info != nil && info.SampleRate > 0 {
+		trackMeta.Duration = float64(info.NSamples) / float64(info.SampleRate)
+	}
+	var cover []byte
+	for _, block := range stream.Blocks {
+		switch body := block.Body.(type) {
+		case *meta.VorbisComment:
+			for _, tag := range body.Tags {
+				value := cleanTagText(tag[1])
+				switch strings.ToUpper(tag[0]) {
+				case "TITLE":
+					trackMeta.Title = firstNonEmpty(trackMeta.Title, value)
+				case "ARTIST":
+					trackMeta.Artist = firstNonEmpty(trackMeta.Artist, value)
+				case "ALBUM":
+					trackMeta.Album = firstNonEmpty(trackMeta.Album, value)
+				}
+			}
+		case *meta.Picture:
+			if len(body.Data) == 0 || body.MIME == "-->" {
+				continue
+			}
+			trackMeta.HasCover = true
+			if wantCover && (cover == nil || body.Type == 3) {
+				cover = body.Data
+			}
+		}
+	}
+	return trackMeta, cover, nil
+}
+
+// readOggMeta 读取 Ogg Vorbis/Opus 的注释头，封面在 METADATA_BLOCK_PICTURE 中
+func readOggMeta(f *os.File, wantCover bool) (TrackMeta, []byte, error) {
+	info, err := readOggInfo(f)
+	if err != nil {
+		return TrackMeta{}, nil, err
+	}
+	trackMeta := TrackMeta{Duration: info.Duration}
+	var cover []byte
+	for _, comment := range info.Comments {
+		value := cleanTagText(comment[1])
+		switch strings.ToUpper(comment[0]) {
+		case "TITLE":
+			trackMeta.Title = firstNonEmpty(trackMeta.Title, value)
+		case "ARTIST":
+			trackMeta.Artist = firstNonEmpty(trackMeta.Artist, value)
+		case "ALBUM":
+			trackMeta.Album = firstNonEmpty(trackMeta.Album, value)
+		case "METADATA_BLOCK_PICTURE":
+			pictureType, data := parseFLACPicture(comment[1])
+			if len(data) == 0 {
+				continue
+			}
+			trackMeta.HasCover = true
+			if wantCover && (cover == nil || pictureType == 3) {
+				cover = data
+			}
+		}
+	}
+	return trackMeta, cover, nil
+}
+
+// parseFLACPicture 解码 base64 的 FLAC PICTURE 块，返回图片类型和图片数据
+func parseFLACPicture(text string) (uint32, []byte) {
+	block, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(block) < 4 {
+		return 0, nil
+	}
+	pictureType := binary.BigEndian.Uint32(block)
+	block = block[4:]
+	// 跳过 MIME 类型和描述，之后是宽、高、色深、颜色数各 4 字节，再是图片长度和数据
+	for range 2 {
+		if len(block) < 4 {
+			return 0, nil
+		}
+		length := binary.BigEndian.Uint32(block)
+		if uint64(length) > uint64(len(block)-4) {
+			return 0, nil
+		}
+		block = block[4+length:]
+	}
+	if len(block) < 20 {
+		return 0, nil
+	}
+	length := binary.BigEndian.Uint32(block[16:])
+	if uint64(length) > uint64(len(block)-20) {
+		return 0, nil
+	}
+	return pictureType, block[20 : 20+length]
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func readWAVMeta(f *os.File) (TrackMeta, error) {
+	decoder := wav.NewDecoder(f)
+	if !decoder.IsValidFile() {
+		return TrackMeta{}, fmt.Errorf("invalid WAV file")
+	}
+	var trackMeta TrackMeta
+	if duration, err := decoder.Duration(); err == nil {
+		trackMeta.Duration = duration.Seconds()
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return trackMeta, nil
+	}
+	decoder = wav.NewDecoder(f)
+	decoder.ReadMetadata()
+	if decoder.Err() == nil && decoder.Metadata != nil {
+		trackMeta.Title = cleanTagText(decoder.Metadata.Title)
+		trackMeta.Artist = cleanTagText(decoder.Metadata.Artist)
+		trackMeta.Album = cleanTagText(decoder.Metadata.Product)
+	}
+	return trackMeta, nil
+}
+
+// readMP4Meta 读取 moov/mvhd 的时长和 moov/udta/meta/ilst 中的 iTunes 标签
+func readMP4Meta(f *os.File, size int64, wantCover bool) (TrackMeta, []byte, error) {
+	var trackMeta TrackMeta
+	moov, err := findMP4Box(f, size, "moov")
+	if err != nil {
+		return trackMeta, nil, err
+	}
+	if mvhd, ok := mp4Child(moov, "mvhd"); ok && len(mvhd) >= 20 {
+		var timescale, duration uint64
+		if mvhd[0] == 1 && len(mvhd) >= 32 {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[20:]))
+			duration = binary.BigEndian.Uint64(mvhd[24:])
+		} else {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[12:]))
+			duration = uint64(binary.BigEndian.Uint32(mvhd[16:]))
+		}
+		if timescale > 0 {
+			trackMeta.Duration = float64(duration) / float64(timescale)
+		}
+	}
+
+	udta, ok := mp4Child(moov, "udta")
+	if !ok {
+		return trackMeta, nil, nil
+	}
+	metaBox, ok := mp4Child(udta, "meta")
+	if !ok {
+		return trackMeta, nil, nil
+	}
+	// meta 通常是 full box（4 字节版本/标志），QuickTime 写入的可能没有
+	if len(metaBox) >= 8 && string(metaBox[4:8]) != "hdlr" {
+		metaBox = metaBox[4:]
+	}
+	ilst, ok := mp4Child(metaBox, "ilst")
+	if !ok {
+		return trackMeta, nil, nil
+	}
+
+	var cover []byte
+	walkMP4Boxes(ilst, func(kind string, item []byte) {
+		data, ok := mp4Child(item, "data")
+		if !ok || len(data) < 8 {
+			return
+		}
+		value := data[8:]
+		switch kind {
+		case "\xa9nam":
+			trackMeta.Title = cleanTagText(string(value))
+		case "\xa9ART":
+			trackMeta.Artist = cleanTagText(string(value))
+		case "aART":
+			if trackMeta.Artist == "" {
+				trackMeta.Artist = cleanTagText(string(value))
+			}
+		case "\xa9alb":
+			trackMeta.Album = cleanTagText(string(value))
+		case "covr":
+			if len(value) == 0 {
+				return
+			}
+			trackMeta.HasCover = true
+			if wantCover && cover == nil {
+				cover = value
+			}
+		}
+	})
+	return trackMeta, cover, nil
+}
+
+// findMP4Box 在顶层查找 box 并读入其内容
+func findMP4Box(f *os.File, size int64, want string) ([]byte, error) {
+	header := make([]byte, 16)
+	for offset := int64(0); offset+8 <= size; {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if boxSize < headerSize || offset+boxSize > size {
+			return nil, errors.New("invalid MP4 box size")
+		}
+		if string(header[4:8]) == want {
+			if boxSize-headerSize > maxMP4MoovSize {
+				return nil, fmt.Errorf("MP4 %s box is too large", want)
+			}
+			body := make([]byte, boxSize-headerSize)
+			if _, err := f.ReadAt(body, offset+headerSize); err != nil {
+				return nil, err
+			}
+			return body, nil
+		}
+		offset += boxSize
+	}
+	return nil, fmt.Errorf("MP4 %s box not found", want)
+}
+
+func walkMP4Boxes(data []byte, fn func(kind string, body []byte)) {
+	for len(data) >= 8 {
+		boxSize := int(binary.BigEndian.Uint32(data))
+		headerSize := 8
+		if boxSize == 1 && len(data) >= 16 {
+			boxSize = int(binary.BigEndian.Uint64(data[8:]))
+			headerSize = 16
+		} else if boxSize == 0 {
+			boxSize = len(data)
+		}
+		if boxSize < headerSize || boxSize > len(data) {
+			return
+		}
+		fn(string(data[4:8]), data[headerSize:boxSize])
+		data = data[boxSize:]
+	}
+}
+
+func mp4Child(data []byte, want string) ([]byte, bool) {
+	var found []byte
+	ok := false
+	walkMP4Boxes(data, func(kind string, body []byte) {
+		if !ok && kind == want {
+			found, ok = body, true
+		}
+	})
+	return found, ok
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func id3Frame(id string, body []byte) []byte {
+	frame := make([]byte, 10, 10+len(body))
+	copy(frame, id)
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(body)))
+	return append(frame, body...)
+}
+
+func mp4Box(kind string, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	box := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(box, uint32(8+len(data)))
+	copy(box[4:], kind)
+	return append(box, data...)
+}
+
+func TestReadMP3Metadata(t *testing.T) {
+	cover := []byte("\x89PNG\r\n\x1a\ncover")
+	var frames []byte
+	// UTF-16 with BOM
+	frames = append(frames, id3Frame("TIT2", []byte{1, 0xff, 0xfe, 'H', 0, 'i', 0, 0, 0})...)
+	frames = append(frames, id3Frame("TPE1", append([]byte{3}, "歌手"...))...)
+	frames = append(frames, id3Frame("APIC", append([]byte("\x00image/png\x00\x03desc\x00"), cover...))...)
+	tag := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frames))}
+
+	// MPEG-1 Layer III 128 kbps 44.1 kHz stereo frame with a Xing header of 100 frames
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	copy(frame[36:], "Xing\x00\x00\x00\x01\x00\x00\x00\x64")
+	id3v1 := make([]byte, 128)
+	copy(id3v1, "TAG")
+	copy(id3v1[63:], "Album")
+
+	path := filepath.Join(t.TempDir(), "song-0001.mp3")
+	if err := os.WriteFile(path, bytes.Join([][]byte{tag, frames, frame, id3v1}, nil), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := cachedTrackMeta(path)
+	want := TrackMeta{Title: "Hi", Artist: "歌手", Album: "Album", Duration: 100 * 1152.0 / 44100, HasCover: true}
+	if got != want {
+		t.Fatalf("meta = %+v, want %+v", got, want)
+	}
+	if data, err := readTrackCover(path); err != nil || !bytes.Equal(data, cover) {
+		t.Fatalf("cover = %q, %v", data, err)
+	}
+	if name := trackDisplayName(MusicFileInfo{Path: path, TrackMeta: got}); name != "歌手 - Hi" {
+		t.Fatalf("display name = %q", name)
+	}
+}
+
+func TestReadMP4Metadata(t *testing.T) {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 61500)
+	data := func(typ byte, value string) []byte {
+		return mp4Box("data", []byte{0, 0, 0, typ, 0, 0, 0, 0}, []byte(value))
+	}
+	ilst := mp4Box("ilst",
+		mp4Box("\xa9nam", data(1, "Title")),
+		mp4Box("\xa9ART", data(1, "Artist")),
+		mp4Box("\xa9alb", data(1, "Album")),
+		mp4Box("covr", data(13, "\xff\xd8\xffjpeg")),
+	)
+	moov := mp4Box("moov",
+		mp4Box("mvhd", mvhd),
+		mp4Box("udta", mp4Box("meta", []byte{0, 0, 0, 0}, mp4Box("hdlr", make([]byte, 25)), ilst)),
+	)
+	path := filepath.Join(t.TempDir(), "song.m4a")
+	if err := os.WriteFile(path, append(mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")), moov...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, cover, err := readTrackMeta(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TrackMeta{Title: "Title", Artist: "Artist", Album: "Album", Duration: 61.5, HasCover: true}
+	if got != want || string(cover) != "\xff\xd8\xffjpeg" {
+		t.Fatalf("meta = %+v cover %q, want %+v", got, cover, want)
+	}
+}
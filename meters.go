@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 电平表：统计每路混音输入、最终发射混音和收到语音的峰值/RMS，
+// 通过 /ws/meters 约每 100ms 推送给已登录的控制台。
+
+const (
+	meterInterval = 100 * time.Millisecond
+	// 低于该电平按静音显示，同时避免 JSON 无法表示 -Inf
+	meterFloorDB = -90.0
+)
+
+// 显示顺序即推送顺序
+var meterSources = []string{"beacon", "scheduled", "announce", "music", "radio", "mic", "emergency", "tx", "rx"}
+
+type meterAccumulator struct {
+	peak       float64
+	sumSquares float64
+	samples    int
+	clipped    bool
+}
+
+// meterLevel 是一个统计窗口内的电平，单位 dBFS
+type meterLevel struct {
+	Source string  `json:"source"`
+	Peak   float64 `json:"peak"`
+	RMS    float64 `json:"rms"`
+	Active bool    `json:"active"` // 窗口内收到过音频帧（即使是静音帧）
+	Clip   bool    `json:"clip"`
+}
+
+var meters = struct {
+	sync.Mutex
+	levels  map[string]*meterAccumulator
+	clients map[chan []byte]struct{}
+}{
+	levels:  make(map[string]*meterAccumulator),
+	clients: make(map[chan []byte]struct{}),
+}
+
+// 电平表只对本站开放，拒绝跨站页面发起的 WebSocket
+var meterUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// meterFeed 统计一帧音频，scale 为该路实际进入发射的增益
+func meterFeed(source string, pcm []int, scale float64) {
+	meters.Lock()
+	defer meters.Unlock()
+	acc := meters.levels[source]
+	if acc == nil {
+		acc = &meterAccumulator{}
+		meters.levels[source] = acc
+	}
+	for _, sample := range pcm {
+		value := math.Abs(float64(sample) * scale)
+		if value >= 32767 {
+			acc.clipped = true
+			value = 32767
+		}
+		acc.peak = max(acc.peak, value)
+		acc.sumSquares += value * value
+	}
+	acc.samples += len(pcm)
+}
+
+func meterFeedInt16(source string, pcm []int16) {
+	samples := make([]int, len(pcm))
+	for i, sample := range pcm {
+		samples[i] = int(sample)
+	}
+	meterFeed(source, samples, 1)
+}
+
+func meterDB(value float64) float64 {
+	if value <= 0 {
+		return meterFloorDB
+	}
+	db := 20 * math.Log10(value/32768)
+	return math.Round(max(db, meterFloorDB)*10) / 10
+}
+
+// takeMeterLevels 读取并清零当前统计窗口
+func takeMeterLevels() []meterLevel {
+	meters.Lock()
+	defer meters.Unlock()
+	levels := make([]meterLevel, 0, len(meterSources))
+	for _, source := range meterSources {
+		level := meterLevel{Source: source, Peak: meterFloorDB, RMS: meterFloorDB}
+		if acc := meters.levels[source]; acc != nil && acc.samples > 0 {
+			level.Peak = meterDB(acc.peak)
+			level.RMS = meterDB(math.Sqrt(acc.sumSquares / float64(acc.samples)))
+			level.Active = true
+			level.Clip = acc.clipped
+			*acc = meterAccumulator{}
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+func runMeters() {
+	ticker := time.NewTicker(meterInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		levels := takeMeterLevels()
+
+		meters.Lock()
+		clients := make([]chan []byte, 0, len(meters.clients))
+		for client := range meters.clients {
+			clients = append(clients, client)
+		}
+		meters.Unlock()
+		if len(clients) == 0 {
+			continue
+		}
+
+		data, err := json.Marshal(levels)
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			select {
+			case client <- data:
+			default:
+				// 客户端太慢，丢弃本次电平
+			}
+		}
+	}
+}
+
+func handleMeterWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := meterUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Meter WS upgrade error from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+
+	send := make(chan []byte, 4)
+	meters.Lock()
+	meters.clients[send] = struct{}{}
+	meters.Unlock()
+	defer func() {
+		meters.Lock()
+		delete(meters.clients, send)
+		meters.Unlock()
+	}()
+
+	// 读循环只用于发现连接断开
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case data := <-send:
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestMeterLevels(t *testing.T) {
+	takeMeterLevels() // 清掉其他测试留下的统计
+
+	// 半幅正弦：峰值 -6 dBFS，RMS 再低 3 dB
+	sine := make([]int, 160)
+	for i := range sine {
+		sine[i] = int(math.Round(16384 * math.Sin(2*math.Pi*float64(i)/16)))
+	}
+	meterFeed("music", sine, 1)
+	dc := make([]int, 160)
+	for i := range dc {
+		dc[i] = 16384
+	}
+	meterFeed("beacon", dc, 0.5) // 按增益后的电平统计
+	meterFeed("mic", make([]int, 160), 1)
+	full := make([]int, 160)
+	for i := range full {
+		full[i] = 30000
+	}
+	meterFeed("tx", full, 1.5)
+	meterFeedInt16("rx", []int16{-32768, 0, 100})
+
+	levels := takeMeterLevels()
+	byName := make(map[string]meterLevel)
+	for _, level := range levels {
+		byName[level.Source] = level
+	}
+	check := func(source string, peak, rms float64, active, clip bool) {
+		t.Helper()
+		level := byName[source]
+		if level.Peak != peak || level.RMS != rms || level.Active != active || level.Clip != clip {
+			t.Errorf("%s = %+v, want peak %v rms %v active %v clip %v", source, level, peak, rms, active, clip)
+		}
+	}
+	check("music", -6, -9, true, false)
+	check("beacon", -12, -12, true, false)
+	check("mic", meterFloorDB, meterFloorDB, true, false)
+	check("tx", 0, 0, true, true)
+	check("rx", 0, -4.8, true, true)
+	check("radio", meterFloorDB, meterFloorDB, false, false)
+
+	// 推送的 JSON 按 meterSources 的顺序包含全部节目源
+	data, err := json.Marshal(levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload []meterLevel
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, level := range payload {
+		sources = append(sources, level.Source)
+	}
+	if !slices.Equal(sources, meterSources) || !slices.Contains(sources, "tx") || !slices.Contains(sources, "rx") {
+		t.Fatalf("payload sources = %v, want %v", sources, meterSources)
+	}
+
+	// 读取后统计窗口清零
+	for _, level := range takeMeterLevels() {
+		if level.Active || level.Clip || level.Peak != meterFloorDB || level.RMS != meterFloorDB {
+			t.Errorf("%s not reset: %+v", level.Source, level)
+		}
+	}
+}
+
+func TestMeterDB(t *testing.T) {
+	for _, c := range [][2]float64{{0, meterFloorDB}, {-1, meterFloorDB}, {0.5, meterFloorDB}, {32768, 0}, {16384, -6}, {3277, -20}} {
+		if got := meterDB(c[0]); got != c[1] {
+			t.Errorf("meterDB(%v) = %v, want %v", c[0], got, c[1])
+		}
+	}
+}
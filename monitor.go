@@ -1,131 +1,169 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"io"
-	"log"
 	"sync"
-	"time"
-
-	"github.com/ebitengine/oto/v3"
+	"sync/atomic"
 )
 
-var streamReader *PCMStreamReader
+// 本地监听输出：把收到的组内语音和/或本机发出的混音送到本地声卡。
+// 平台相关的输出设备实现在 monitorPlay_linux.go / monitorPlay_windows.go。
 
-func newplay() {
-	op := &oto.NewContextOptions{}
-	op.SampleRate = 8000
-	op.ChannelCount = 1
-	op.Format = oto.FormatSignedInt16LE
+const (
+	// 收到的语音都是 8 kHz，监听统一按 8 kHz 单声道输出
+	monitorSampleRate = 8000
+	// 每路最多缓冲 0.5 秒，超出时丢弃最旧的数据以保持低延迟
+	monitorMaxBuffered = monitorSampleRate / 2
 
-	otoCtx, ready, err := oto.NewContext(op)
-	if err != nil {
-		log.Fatal("创建录音失败:", err)
-	}
-	<-ready
+	monitorSourceRX   = "rx"
+	monitorSourceTX   = "tx"
+	monitorSourceBoth = "both"
+)
 
-	streamReader = NewPCMStreamReader()
+// monitorDevice 是可选的本地输出设备，ID 为空表示系统默认设备
+type monitorDevice struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+}
+
+var monitorEnabled uint32 = 0
+var monitorToggleChan = make(chan struct{}, 1)
 
-	player := otoCtx.NewPlayer(streamReader)
-	defer player.Close()
+var monitorBus = struct {
+	sync.Mutex
+	device string
+	source string
+	volume float64
+	rx     []int16
+	tx     []int16
+}{source: monitorSourceRX, volume: 1}
 
-	log.Println("开始录音和监听...")
-	player.Play()
+func isMonitorEnabled() bool {
+	return atomic.LoadUint32(&monitorEnabled) == 1
+}
 
-	for player.IsPlaying() {
-		time.Sleep(time.Millisecond * 100)
+func setMonitorEnabled(enabled bool) {
+	if enabled {
+		atomic.StoreUint32(&monitorEnabled, 1)
+	} else {
+		atomic.StoreUint32(&monitorEnabled, 0)
+		monitorBus.Lock()
+		monitorBus.rx, monitorBus.tx = nil, nil
+		monitorBus.Unlock()
 	}
-	log.Println("监听完毕...")
+	signalMonitorToggle()
 }
 
-// PCMStreamReader 实现 io.Reader，用于实时播放 []int16 流
-type PCMStreamReader struct {
-	mu            sync.Mutex
-	cond          *sync.Cond    // 用于等待新数据
-	buffer        *bytes.Buffer // 存储所有待播放的字节
-	closed        bool          // 标记流是否已关闭
-	maxBufferSize int           // 限制缓冲区的最大大小
+func signalMonitorToggle() {
+	select {
+	case monitorToggleChan <- struct{}{}:
+	default:
+	}
 }
 
-// NewPCMStreamReader 创建一个新的流式 Reader
-func NewPCMStreamReader() *PCMStreamReader {
-	reader := &PCMStreamReader{
-		buffer:        bytes.NewBuffer(nil),
-		maxBufferSize: 8000 * 2 * 300, // 假设 8000 采样率，2 字节/采样，缓冲 300 秒的数据
+func validMonitorSource(source string) bool {
+	switch source {
+	case monitorSourceRX, monitorSourceTX, monitorSourceBoth:
+		return true
 	}
-	reader.cond = sync.NewCond(&reader.mu)
-	return reader
+	return false
 }
 
-// WriteChunk 从网络接收数据时调用（外部输入）
-func (r *PCMStreamReader) WriteChunk(chunk []byte) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// configureMonitor 应用监听设置，设备变化时通知输出线程重新打开设备
+func configureMonitor(device, source string, volume float64) error {
+	if source == "" {
+		source = monitorSourceRX
+	}
+	if !validMonitorSource(source) {
+		return fmt.Errorf("monitor source must be rx, tx or both")
+	}
+	if volume < 0 || volume > 2 {
+		return fmt.Errorf("monitor volume must be between 0 and 2")
+	}
 
-	if r.closed {
-		return io.ErrClosedPipe
+	monitorBus.Lock()
+	deviceChanged := monitorBus.device != device
+	monitorBus.device = device
+	monitorBus.source = source
+	monitorBus.volume = volume
+	if source == monitorSourceRX {
+		monitorBus.tx = nil
+	} else if source == monitorSourceTX {
+		monitorBus.rx = nil
 	}
+	monitorBus.Unlock()
 
-	// 检查缓冲区是否已达到最大容量
-	if r.buffer.Len()+len(chunk) > r.maxBufferSize {
-		// 缓冲区满，这里可以选择：
-		// 1. 丢弃当前 chunk (如果允许丢帧，且希望保持低延迟)
-		fmt.Println()
-		log.Printf("缓冲区满 (%.2fMB / %.2fMB)，清空缓存，缓冲区大小: %d\n",
-			float64(r.buffer.Len())/(1024*1024), float64(r.maxBufferSize)/(1024*1024), r.buffer.Len())
-		// return nil // 直接返回，丢弃当前帧
+	if deviceChanged {
+		signalMonitorToggle()
+	}
+	return nil
+}
 
-		r.buffer.Reset()
+func monitorDeviceID() string {
+	monitorBus.Lock()
+	defer monitorBus.Unlock()
+	return monitorBus.device
+}
 
-		// 2. 阻塞直到有空间 (如果不能丢帧，且发送方可以阻塞)
-		// 等待 Read 消耗一些数据
-		// for r.buffer.Len()+len(chunk) > r.maxBufferSize && !r.closed {
-		// 	log.Println("缓冲区满，WriteChunk 阻塞等待 Read 消费...")
-		// 	r.cond.Wait()
-		// }
-		// if r.closed { // 再次检查是否在等待期间关闭
-		// 	return io.ErrClosedPipe
-		// }
+func appendMonitorQueue(queue []int16, pcm []int16) []int16 {
+	queue = append(queue, pcm...)
+	if len(queue) > monitorMaxBuffered {
+		queue = append([]int16(nil), queue[len(queue)-monitorMaxBuffered:]...)
 	}
+	return queue
+}
 
-	r.buffer.Write(chunk)
-	r.cond.Broadcast() // 唤醒所有等待的 Read
-
-	return nil
+// monitorRX 送入收到的组内语音 (8 kHz)
+func monitorRX(pcm []int16) {
+	if !isMonitorEnabled() {
+		return
+	}
+	monitorBus.Lock()
+	defer monitorBus.Unlock()
+	if monitorBus.source == monitorSourceTX {
+		return
+	}
+	monitorBus.rx = appendMonitorQueue(monitorBus.rx, pcm)
 }
 
-// Close 关闭流，通知播放结束
-func (r *PCMStreamReader) Close() {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if !r.closed {
-		r.closed = true
-		r.cond.Broadcast() // 唤醒所有等待的 Read
+// monitorTX 送入本机最终发出的混音帧，Opus 模式下为 16 kHz，需先降到 8 kHz
+func monitorTX(pcm []int, wideband bool) {
+	if !isMonitorEnabled() {
+		return
+	}
+	if wideband {
+		pcm = downsample16To8Int(pcm)
+	}
+	frame := make([]int16, len(pcm))
+	for i, sample := range pcm {
+		frame[i] = int16(clampPCM(sample))
 	}
+	monitorBus.Lock()
+	defer monitorBus.Unlock()
+	if monitorBus.source == monitorSourceRX {
+		return
+	}
+	monitorBus.tx = appendMonitorQueue(monitorBus.tx, frame)
 }
 
-// Read 实现 io.Reader，被 oto 调用
-func (r *PCMStreamReader) Read(p []byte) (n int, err error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	for {
-		// 如果 buffer 中有数据，先返回
-		if r.buffer.Len() > 0 {
-			n, _ := r.buffer.Read(p)
-			if n > 0 {
-				r.cond.Broadcast() // 读出数据后，通知 WriteChunk 可能有空间了
-			}
-			return n, nil
+// readMonitor 由声卡回调调用，混合两路缓冲并按监听音量输出，
+// 数据不足时补静音，不会阻塞声卡线程。
+func readMonitor(out []int16) {
+	monitorBus.Lock()
+	defer monitorBus.Unlock()
+
+	rx, tx := monitorBus.rx, monitorBus.tx
+	for i := range out {
+		sample := 0
+		if i < len(rx) {
+			sample += int(rx[i])
 		}
-
-		// 如果流已关闭，且无数据，返回 EOF
-		if r.closed {
-			return 0, io.EOF
+		if i < len(tx) {
+			sample += int(tx[i])
 		}
-
-		// 没有数据，阻塞等待新数据
-		r.cond.Wait()
+		out[i] = int16(clampPCM(int(float64(sample) * monitorBus.volume)))
 	}
+	monitorBus.rx = rx[min(len(out), len(rx)):]
+	monitorBus.tx = tx[min(len(out), len(tx)):]
 }
@@ -0,0 +1,142 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+
+	"github.com/gen2brain/malgo"
+)
+
+const monitorDeviceSelectable = true
+
+func initMonitorContext() (*malgo.AllocatedContext, error) {
+	return malgo.InitContext(nil, malgo.ContextConfig{}, func(message string) {
+		log.Printf("MONITOR AUDIO LOG: %v", message)
+	})
+}
+
+func freeMonitorContext(ctx *malgo.AllocatedContext) {
+	_ = ctx.Uninit()
+	ctx.Free()
+}
+
+// listMonitorDevices 枚举本机可用的播放设备
+func listMonitorDevices() ([]monitorDevice, error) {
+	ctx, err := initMonitorContext()
+	if err != nil {
+		return nil, err
+	}
+	defer freeMonitorContext(ctx)
+
+	infos, err := ctx.Devices(malgo.Playback)
+	if err != nil {
+		return nil, err
+	}
+	devices := []monitorDevice{{ID: "", Name: "System default"}}
+	for _, info := range infos {
+		devices = append(devices, monitorDevice{
+			ID:      info.ID.String(),
+			Name:    info.Name(),
+			Default: info.IsDefault != 0,
+		})
+	}
+	return devices, nil
+}
+
+// runMonitor 按监听开关和所选设备打开/关闭本地播放设备 (Malgo/Miniaudio)
+func runMonitor() {
+	ctx, err := initMonitorContext()
+	if err != nil {
+		log.Printf("❌ 监听音频上下文初始化失败: %v", err)
+		return
+	}
+	defer freeMonitorContext(ctx)
+
+	var device *malgo.Device
+	current := ""
+	closeDevice := func() {
+		if device == nil {
+			return
+		}
+		_ = device.Stop()
+		device.Uninit()
+		device = nil
+		log.Println("🛑 本地监听已停止")
+	}
+
+	applyMonitorState := func() {
+		enabled := isMonitorEnabled()
+		id := monitorDeviceID()
+		if device != nil && (!enabled || id != current) {
+			closeDevice()
+		}
+		if !enabled || device != nil {
+			return
+		}
+		opened, err := openMonitorDevice(ctx, id)
+		if err != nil {
+			log.Printf("❌ 本地监听设备打开失败: %v", err)
+			return
+		}
+		device, current = opened, id
+		log.Printf("✅ 本地监听已启动 (Malgo/Miniaudio, %dHz, S16, Mono, device=%q)", monitorSampleRate, id)
+	}
+
+	applyMonitorState()
+	for range monitorToggleChan {
+		applyMonitorState()
+	}
+}
+
+func openMonitorDevice(ctx *malgo.AllocatedContext, id string) (*malgo.Device, error) {
+	deviceConfig := malgo.DefaultDeviceConfig(malgo.Playback)
+	deviceConfig.Playback.Format = malgo.FormatS16
+	deviceConfig.Playback.Channels = 1
+	deviceConfig.SampleRate = monitorSampleRate
+	deviceConfig.Alsa.NoMMap = 1
+
+	if id != "" {
+		infos, err := ctx.Devices(malgo.Playback)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, info := range infos {
+			if info.ID.String() == id {
+				deviceConfig.Playback.DeviceID = info.ID.Pointer()
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("playback device %q not found", id)
+		}
+	}
+
+	var samples []int16
+	onSendFrames := func(pOutputSample, pInputSamples []byte, framecount uint32) {
+		if cap(samples) < int(framecount) {
+			samples = make([]int16, framecount)
+		}
+		samples = samples[:framecount]
+		readMonitor(samples)
+		for i, sample := range samples {
+			binary.LittleEndian.PutUint16(pOutputSample[i*2:], uint16(sample))
+		}
+	}
+
+	device, err := malgo.InitDevice(ctx.Context, deviceConfig, malgo.DeviceCallbacks{
+		Data: onSendFrames,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := device.Start(); err != nil {
+		device.Uninit()
+		return nil, err
+	}
+	return device, nil
+}
@@ -0,0 +1,85 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"time"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+// oto 只能输出到系统默认播放设备，Windows 下不支持选择监听设备
+const monitorDeviceSelectable = false
+
+const monitorBufferDuration = 100 * time.Millisecond
+
+func listMonitorDevices() ([]monitorDevice, error) {
+	return []monitorDevice{{ID: "", Name: "System default", Default: true}}, nil
+}
+
+// monitorReader 实现 io.Reader，供 oto 拉取监听数据，无数据时返回静音
+type monitorReader struct {
+	samples []int16
+}
+
+func (r *monitorReader) Read(p []byte) (int, error) {
+	n := len(p) / 2
+	if cap(r.samples) < n {
+		r.samples = make([]int16, n)
+	}
+	r.samples = r.samples[:n]
+	readMonitor(r.samples)
+	for i, sample := range r.samples {
+		binary.LittleEndian.PutUint16(p[i*2:], uint16(sample))
+	}
+	return n * 2, nil
+}
+
+// runMonitor 按监听开关启动/暂停本地播放 (oto, 系统默认设备)
+func runMonitor() {
+	var otoCtx *oto.Context
+	var player *oto.Player
+
+	applyMonitorState := func() {
+		if !isMonitorEnabled() {
+			if player != nil {
+				player.Close()
+				player = nil
+				log.Println("🛑 本地监听已停止")
+			}
+			return
+		}
+		if player != nil {
+			return
+		}
+		if otoCtx == nil {
+			op := &oto.NewContextOptions{}
+			op.SampleRate = monitorSampleRate
+			op.ChannelCount = 1
+			op.Format = oto.FormatSignedInt16LE
+			op.BufferSize = monitorBufferDuration
+
+			ctx, ready, err := oto.NewContext(op)
+			if err != nil {
+				log.Printf("❌ 本地监听设备打开失败: %v", err)
+				return
+			}
+			<-ready
+			otoCtx = ctx
+		}
+		if monitorDeviceID() != "" {
+			log.Println("⚠️ Windows 下本地监听仅支持系统默认设备，已忽略 MonitorDevice")
+		}
+		player = otoCtx.NewPlayer(&monitorReader{})
+		player.SetBufferSize(monitorSampleRate * 2 * int(monitorBufferDuration/time.Millisecond) / 1000)
+		player.Play()
+		log.Printf("✅ 本地监听已启动 (oto, %dHz, S16, Mono, 系统默认设备)", monitorSampleRate)
+	}
+
+	applyMonitorState()
+	for range monitorToggleChan {
+		applyMonitorState()
+	}
+}
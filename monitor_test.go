@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAPIMonitor(t *testing.T) {
+	confMu.Lock()
+	saved := conf.System
+	conf.System.MonitorEnabled, conf.System.MonitorDevice = false, ""
+	conf.System.MonitorSource, conf.System.MonitorVolume = monitorSourceRX, 1
+	confMu.Unlock()
+	t.Cleanup(func() {
+		confMu.Lock()
+		conf.System = saved
+		confMu.Unlock()
+		configureMonitor("", monitorSourceRX, 1)
+		setMonitorEnabled(false)
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		apiMonitor(response, httptest.NewRequest(http.MethodPost, "/api/monitor", strings.NewReader(body)))
+		return response
+	}
+
+	// 省略的字段保持原值
+	if response := post(`{"source":"both","volume":0.5}`); response.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", response.Code, response.Body)
+	}
+	for _, body := range []string{`{"source":"air"}`, `{"volume":3}`, `{"volume":-1}`, `not json`} {
+		if response := post(body); response.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", body, response.Code)
+		}
+	}
+
+	response := httptest.NewRecorder()
+	apiMonitor(response, httptest.NewRequest(http.MethodGet, "/api/monitor", nil))
+	var state struct {
+		Enabled bool    `json:"enabled"`
+		Source  string  `json:"source"`
+		Volume  float64 `json:"volume"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Enabled || state.Source != monitorSourceBoth || state.Volume != 0.5 {
+		t.Fatalf("GET state = %+v", state)
+	}
+	monitorBus.Lock()
+	source, volume := monitorBus.source, monitorBus.volume
+	monitorBus.Unlock()
+	if source != monitorSourceBoth || volume != 0.5 {
+		t.Fatalf("monitor bus source=%s volume=%v", source, volume)
+	}
+}
+
+func TestMonitorConfigRoundTrip(t *testing.T) {
+	var saved config
+	saved.System.MonitorEnabled = true
+	saved.System.MonitorDevice = "hw:1,0"
+	saved.System.MonitorSource = monitorSourceTX
+	saved.System.MonitorVolume = 1.5
+	data, err := yaml.Marshal(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"MonitorEnabled: true", "MonitorDevice: hw:1,0", "MonitorSource: tx", "MonitorVolume: 1.5"} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("saved config lacks %q", key)
+		}
+	}
+	var loaded config
+	if err := yaml.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.System.MonitorEnabled != saved.System.MonitorEnabled || loaded.System.MonitorDevice != saved.System.MonitorDevice ||
+		loaded.System.MonitorSource != saved.System.MonitorSource || loaded.System.MonitorVolume != saved.System.MonitorVolume {
+		t.Fatalf("loaded monitor config = %+v", loaded.System)
+	}
+}
@@ -1,31 +1,42 @@
 package main
 
 import (
-	"fmt"
+	"errors"
+	"io"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"sync"
 	"time"
-
-	"github.com/fsnotify/fsnotify"
 )
 
 var (
-	MusicfilenameRegex = regexp.MustCompile(`(?i)-(\d{4})\.(wav|mp3|flac|aac|adts|m4a|mp4)$`)
+	MusicfilenameRegex = regexp.MustCompile(`(?i)-(\d{4})\.(wav|mp3|flac|aac|adts|m4a|mp4|ogg|oga|opus)$`)
 )
 
 // 全局状态
 type MusicQueue struct {
 	files []MusicFileInfo
 	rnd   *rand.Rand
+
+	// 随机播放状态：history 为已播放的曲目ID，historyPos 指向当前曲目，
+	// bag 为本轮尚未播放的曲目ID
+	history    []int
+	historyPos int
+	bag        []int
+
+	// 分类加权轮播状态：credits 为平滑加权轮询的累计值，lastInCategory 为各分类上次播放的曲目ID
+	credits        map[string]int
+	lastInCategory map[string]int
 }
 
 var (
 	trackedMusicFiles = make(map[string]MusicFileInfo) // 跟踪所有支持的音频文件
+	folderMusicFiles  []MusicFileInfo                  // 默认 folder 播放列表（按ID排序）
 	musicstateMu      sync.RWMutex                     // 读写锁
 	currentQueue      MusicQueue
 	currentPlayingID  int = -1
@@ -50,11 +61,14 @@ func init() {
 	// Initialize random seed
 	seed := rand.NewSource(time.Now().UnixNano())
 	currentQueue.rnd = rand.New(seed)
+	resetShuffle()
 }
 
 type MusicFileInfo struct {
-	Path string `json:"path"`
-	ID   int    `json:"id"`
+	Path     string `json:"path"`
+	ID       int    `json:"id"`
+	Category string `json:"category"` // 所在子目录，"" 为 MusicFilePath 根目录
+	TrackMeta
 }
 
 // playAudio 启动调度器
@@ -72,8 +86,10 @@ func playMusic() {
 		}
 	}
 
-	// 1. 首次全量扫描
+	// 1. 首次全量扫描，并恢复上次的播放位置
 	fullRescanMusic(dir)
+	restoreMusicResume()
+	go runMusicResumeSaver()
 
 	// 2. 启动每日零点全量重载
 	go startDailyFullRescanMusic(dir)
@@ -112,8 +128,10 @@ func fullRescanMusic(dir string) {
 		}
 
 		fileInfo := MusicFileInfo{
-			Path: path,
-			ID:   id,
+			Path:      path,
+			ID:        id,
+			Category:  musicCategoryOf(path),
+			TrackMeta: cachedTrackMeta(path),
 		}
 		newTracked[path] = fileInfo
 		files = append(files, fileInfo)
@@ -123,6 +141,9 @@ func fullRescanMusic(dir string) {
 		log.Printf("❌ 扫描音乐错误: %v", err)
 	}
 
+	// 命名播放列表的曲目信息在锁外读取
+	named, ok := namedPlaylistQueue()
+
 	// 加锁操作状态
 	musicstateMu.Lock()
 
@@ -130,7 +151,7 @@ func fullRescanMusic(dir string) {
 	trackedMusicFiles = newTracked
 
 	// 构建播放队列
-	buildMusicQueue(files)
+	buildMusicQueue(files, named, ok)
 	musicstateMu.Unlock()
 
 	// Update web state (outside lock)
@@ -138,17 +159,80 @@ func fullRescanMusic(dir string) {
 	log.Printf("✅ 音乐文件全量扫描完成. 跟踪 %d 个文件.", len(newTracked))
 }
 
-func buildMusicQueue(files []MusicFileInfo) {
+func buildMusicQueue(files, named []MusicFileInfo, ok bool) {
 	// 排序文件
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].ID < files[j].ID
 	})
 
 	// 构建当前队列
-	currentQueue.files = files
+	folderMusicFiles = files
+	currentQueue.files = activeMusicQueue(named, ok)
+	currentPlayingID = -1
+	resetShuffle()
+
+	log.Printf("✅ 音乐播放队列已更新 (文件数: %d)", len(currentQueue.files))
+}
+
+// namedPlaylistQueue 返回当前命名播放列表的队列，ok 为 false 表示使用 folder 列表。
+// 命名播放列表按顺序编号为 1..N，沿用 folder 列表按 ID 切歌的逻辑。
+// 会逐个读取文件标签，不能在持有 musicstateMu 时调用。
+func namedPlaylistQueue() ([]MusicFileInfo, bool) {
+	name := activePlaylistName()
+	if name == "" {
+		return nil, false
+	}
+	playlist, ok := findPlaylist(name)
+	if !ok {
+		return nil, false
+	}
+	files := make([]MusicFileInfo, len(playlist.Files))
+	for i, path := range playlist.Files {
+		files[i] = MusicFileInfo{Path: path, ID: i + 1, TrackMeta: cachedTrackMeta(path)}
+	}
+	return files, true
+}
+
+// activeMusicQueue 返回当前播放列表的队列，调用方需持有 musicstateMu。
+// named 和 ok 是在锁外由 namedPlaylistQueue 准备好的命名播放列表。
+func activeMusicQueue(named []MusicFileInfo, ok bool) []MusicFileInfo {
+	if ok {
+		return named
+	}
+	return enabledCategoryFiles(folderMusicFiles)
+}
+
+// applyActivePlaylist 切换播放列表后重建播放队列
+func applyActivePlaylist() {
+	named, ok := namedPlaylistQueue()
+	musicstateMu.Lock()
+	currentQueue.files = activeMusicQueue(named, ok)
 	currentPlayingID = -1
+	resetShuffle()
+	files := currentQueue.files
+	musicstateMu.Unlock()
+
+	updateMusicList(files, -1)
+	name := activePlaylistName()
+	if name == "" {
+		name = folderPlaylistName
+	}
+	log.Printf("🎵 当前播放列表: %s (文件数: %d)", name, len(files))
 
-	log.Printf("✅ 音乐播放队列已更新 (文件数: %d)", len(files))
+	select {
+	case musicUpdateChan <- struct{}{}:
+	default:
+	}
+}
+
+// stopMusicAfterOnce 在 once 模式播完列表后停止音乐。
+// 会写配置文件，不能在持有 musicstateMu 时调用。
+func stopMusicAfterOnce() {
+	confMu.Lock()
+	conf.System.MusicPlaying = false
+	confMu.Unlock()
+	saveConfig()
+	log.Println("⏹ 播放列表已播放完毕 (once 模式)")
 }
 
 // 播放下一个音乐
@@ -163,6 +247,8 @@ func playNextMusic() {
 	// 我们改为在 playMusic 中显式调用。
 
 	forcePrevious := false
+	skipped := false
+	var preloaded *musicTrack // 预加载的下一首，自然播完或选中同一首时直接接着播放
 
 	for {
 		musicstateMu.Lock()
@@ -175,7 +261,10 @@ func playNextMusic() {
 				log.Println("🎵 没有可播放的音乐文件，等待中...")
 			}
 
+			preloaded.Close()
+			preloaded = nil
 			updatePlayStatus("Idle", 0, conf.System.MusicPlaying)
+			updatePlayPosition(0, 0)
 			// 等待新文件通知或超时
 			select {
 			case <-musicUpdateChan:
@@ -187,86 +276,14 @@ func playNextMusic() {
 		}
 
 		// 找到下一个要播放的文件
-		var nextIndex int = -1
-		var minID int = -1
-		var foundNext bool = false
-
-		// 0. Check for manual override
-		if manualNextID != -1 {
-			for i, file := range queue {
-				if file.ID == manualNextID {
-					nextIndex = i
-					minID = file.ID // Not used but keeps consistency
-					foundNext = true
-					break
-				}
-			}
-			// Reset manual override
-			manualNextID = -1
-		}
-
-		// 1. 尝试找到比当前 ID 大的最小 ID (Only if manual not found/set)
-		if !foundNext {
-			if forcePrevious {
-				// Try to find Max ID < currentPlayingID
-				var maxID int = -1
-				for i, file := range queue {
-					if currentPlayingID == -1 || file.ID < currentPlayingID {
-						// Candidate
-						if !foundNext || file.ID > maxID {
-							maxID = file.ID
-							nextIndex = i
-							foundNext = true
-						}
-					}
-				}
-				// Reset
-				forcePrevious = false
-			} else {
-				// Determine Next (Min ID > Current)
-				for i, file := range queue {
-					if currentPlayingID == -1 || file.ID > currentPlayingID {
-						// 这是一个候选
-						if !foundNext || file.ID < minID {
-							minID = file.ID
-							nextIndex = i
-							foundNext = true
-						}
-					}
-				}
-			}
-		}
-
-		// 2. 如果没找到（说明当前 ID 已经是最大(Next)或最小(Prev)，或者刚开始）
-		// Find wrap around
-		if !foundNext {
-			minID = -1  // Reuse for Next logic
-			maxID := -1 // Use for Prev logic
-
-			if forcePrevious {
-				// Find absolute Max ID (Wrap to end)
-				for i, file := range queue {
-					if !foundNext || file.ID > maxID {
-						maxID = file.ID
-						nextIndex = i
-						foundNext = true
-					}
-				}
-				forcePrevious = false
-			} else {
-				// Find absolute Min ID (Wrap to start)
-				for i, file := range queue {
-					if nextIndex == -1 || file.ID < minID {
-						minID = file.ID
-						nextIndex = i
-					}
-				}
-			}
-		}
-
+		nextIndex, stop := selectNextMusic(queue, forcePrevious, skipped)
+		forcePrevious, skipped = false, false
 		if nextIndex == -1 {
 			// 理论上不应该发生，除非队列为空（前面已检查）
 			musicstateMu.Unlock()
+			if stop {
+				stopMusicAfterOnce()
+			}
 			time.Sleep(5 * time.Second)
 			continue
 		}
@@ -274,46 +291,129 @@ func playNextMusic() {
 		// 更新当前播放ID
 		fileToPlay := queue[nextIndex]
 		currentPlayingID = fileToPlay.ID
+		setAirlogTitle("music", trackDisplayName(fileToPlay))
 
 		// 解锁以执行播放操作
 		musicstateMu.Unlock()
+		if stop {
+			// 单次播放模式：列表播放完毕，停在列表开头等待重新开始
+			stopMusicAfterOnce()
+		}
 
 		// Update current playing highlight state
 		updateMusicList(queue, currentPlayingID)
 
-		pcm, err := decodeAudioFile(fileToPlay.Path)
-		if err != nil {
-			log.Printf("❌ 无法解码音乐文件 %s: %v", fileToPlay.Path, err)
-			handleMusicFileRemoved(fileToPlay.Path)
-			continue
+		// 边解码边播放，长文件也不会整首读入内存
+		var stream *audioStream
+		if preloaded != nil && preloaded.file.Path == fileToPlay.Path {
+			stream = preloaded.stream
+		} else {
+			preloaded.Close()
+		}
+		preloaded = nil
+		if stream == nil {
+			var err error
+			if stream, err = openAudioStream(fileToPlay.Path); err != nil {
+				log.Printf("❌ 无法解码音乐文件 %s: %v", fileToPlay.Path, err)
+				handleMusicFileRemoved(fileToPlay.Path)
+				continue
+			}
+		}
+
+		// 丢弃上一首结束后才到达的跳转请求
+		select {
+		case <-seekmusic:
+		default:
+		}
+		// 重启后接着上次的位置播放
+		if offset, ok := takeResumeSeek(fileToPlay.Path); ok {
+			if err := stream.Seek(offset); err != nil {
+				log.Printf("⚠️ 恢复播放位置失败 %s: %v", fileToPlay.Path, err)
+			}
 		}
 
 		playstatus := conf.System.MusicPlaying
 		processedSamples := 0
-		percent := 0
+		preloadTried := false
+		finished := false             // 自然播完，而不是被切歌或停止打断
+		var onAir *asrunItem          // 播出日志，暂停时结束，恢复播放时另起一条
+		var fadeLeft, fadeTotal int64 // 手动切歌的淡出进度
+		seekTo := func(seek musicSeek) bool {
+			offset, err := seek.offset(stream.Length())
+			if err == nil {
+				err = stream.Seek(offset)
+			}
+			if err != nil {
+				log.Printf("⚠️ 跳转失败 %s: %v", fileToPlay.Path, err)
+				return false
+			}
+			// 跳转后重新判断何时预加载，已经开始淡入的下一首不能再用
+			if preloaded.audible() {
+				preloaded.Close()
+				preloaded = nil
+			}
+			preloadTried = preloaded != nil
+			log.Printf("⏩ 跳转到 %s: %s", formatPlayTime(stream.Position()), trackDisplayName(fileToPlay))
+			reportMusicPosition(map[bool]string{true: "Playing", false: "Paused"}[playstatus], fileToPlay, stream, conf.System.MusicPlaying)
+			return true
+		}
+		// beginSkip 手动切歌：播放中先淡出再切换；暂停中或下一首已经在淡入时直接切换
+		beginSkip := func() bool {
+			if !playstatus || preloaded.audible() {
+				return false
+			}
+			fadeTotal = skipFadeSamples()
+			fadeLeft = fadeTotal
+			return true
+		}
+		reportMusicPosition(map[bool]string{true: "Playing", false: "Paused"}[playstatus], fileToPlay, stream, conf.System.MusicPlaying)
 
 	tag:
-		for i := 0; i < len(pcm); i += opusFrameSamples {
-			percent = processedSamples * 100 / len(pcm)
-			if percent > 100 {
-				percent = 100
+		for {
+			chunk := make([]int, opusFrameSamples)
+			start := stream.Position()
+			n, err := stream.Read(chunk)
+			if n == 0 {
+				if err != nil && !errors.Is(err, io.EOF) {
+					log.Printf("❌ 解码音乐文件出错 %s: %v", fileToPlay.Path, err)
+				} else {
+					finished = true
+				}
+				break
+			}
+
+			if fadeTotal > 0 {
+				fadeOutFrame(chunk, fadeLeft, fadeTotal)
+				musicPCM <- [][]int{chunk}
+				if fadeLeft -= int64(n); fadeLeft <= 0 {
+					break tag
+				}
+				continue
 			}
 
 			// Handle controls
 			select {
 			case <-nextmusic:
-				break tag
+				skipped = true
+				if !beginSkip() {
+					break tag
+				}
 			case <-pausemusic:
 				playstatus = !playstatus
 				conf.System.MusicPlaying = playstatus
 				saveConfig()
 				// Report state change immediately
-				updatePlayStatus(fmt.Sprintf("%s: %s (ID: %04d) [%d%%]",
-					map[bool]string{true: "Playing", false: "Paused"}[playstatus],
-					filepath.Base(fileToPlay.Path), fileToPlay.ID, percent), percent, conf.System.MusicPlaying)
+				reportMusicPosition(map[bool]string{true: "Playing", false: "Paused"}[playstatus], fileToPlay, stream, conf.System.MusicPlaying)
 			case <-lastmusic:
 				forcePrevious = true
-				break tag
+				if !beginSkip() {
+					break tag
+				}
+			case seek := <-seekmusic:
+				// 丢弃已读出的旧位置数据，从新位置重新读取
+				if seekTo(seek) {
+					continue tag
+				}
 			case <-stopmusic:
 				playstatus = false
 				conf.System.MusicPlaying = false
@@ -326,23 +426,28 @@ func playNextMusic() {
 			}
 
 			if !playstatus {
+				onAir.finish(true)
+				onAir = nil
 				time.Sleep(time.Millisecond * 100)
 				// Keep this chunk pending until playback resumes.
 				for !playstatus {
 					select {
 					case <-nextmusic:
+						skipped = true
 						break tag
 					case <-pausemusic:
 						playstatus = !playstatus
 						conf.System.MusicPlaying = playstatus
 						saveConfig()
 						// Report state change immediately
-						updatePlayStatus(fmt.Sprintf("%s: %s (ID: %04d) [%d%%]",
-							map[bool]string{true: "Playing", false: "Paused"}[playstatus],
-							filepath.Base(fileToPlay.Path), fileToPlay.ID, percent), percent, conf.System.MusicPlaying)
+						reportMusicPosition(map[bool]string{true: "Playing", false: "Paused"}[playstatus], fileToPlay, stream, conf.System.MusicPlaying)
 					case <-lastmusic:
 						forcePrevious = true
 						break tag
+					case seek := <-seekmusic:
+						if seekTo(seek) {
+							continue tag
+						}
 					case <-stopmusic:
 						playstatus = false
 						conf.System.MusicPlaying = false
@@ -357,70 +462,50 @@ func playNextMusic() {
 				}
 			}
 
-			end := min(i+opusFrameSamples, len(pcm))
-			chunk := make([]int, opusFrameSamples)
-			copy(chunk, pcm[i:end])
+			// 接近结尾时预加载下一首：交叉淡化区间内两首混合，最后不足一帧的部分用下一首补齐
+			length := stream.Length()
+			fade := crossfadeSamples(length)
+			if preloaded == nil && !preloadTried && (n < len(chunk) || length > 0 && length-stream.Position() <= fade+musicPreloadLead) {
+				preloadTried = true
+				preloaded = preloadNextMusic()
+			}
+			if preloaded != nil {
+				if err := mixTrackTail(chunk, n, start, length, fade, preloaded.stream); err != nil {
+					log.Printf("⚠️ 解码下一首出错 %s: %v", preloaded.file.Path, err)
+					preloaded.Close()
+					preloaded = nil
+				}
+			}
+
+			if onAir == nil {
+				onAir = beginAsrun("music", trackDisplayName(fileToPlay), fileToPlay.Path)
+			}
 			musicPCM <- [][]int{chunk}
 
-			processedSamples += end - i
+			processedSamples += n
 
 			// Throttle status updates
 			if processedSamples%playbackSampleRate == 0 { // Every ~1 second
-				statusText := fmt.Sprintf("Playing: %s (ID: %04d) [%d%%]", filepath.Base(fileToPlay.Path), fileToPlay.ID, percent)
-				updatePlayStatus(statusText, percent, conf.System.MusicPlaying)
+				reportMusicPosition("Playing", fileToPlay, stream, conf.System.MusicPlaying)
 			}
 			// Check for next track or exit
 			select {
 			default:
 			}
 		}
-		// 稍微暂停一下，避免连续播放太紧凑
-		time.Sleep(1 * time.Second)
+		stream.Close()
+		onAir.finish(!finished)
+		updatePlayPosition(0, 0)
+		// 曲目之间不再停顿；一帧都没有播放（例如文件损坏）时稍作等待，避免空转
+		if processedSamples == 0 {
+			time.Sleep(1 * time.Second)
+		}
 	}
 }
 
-// watchFilesIncremental 增量监听文件变化
+// watchMusicFilesIncremental 增量监听音乐目录及其子目录的变化
 func watchMusicFilesIncremental(dir string) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal("❌ 无法创建 watcher:", err)
-	}
-	defer watcher.Close()
-
-	if err := watcher.Add(dir); err != nil {
-		log.Printf("❌ 无法监听目录 %s: %v", dir, err)
-		return
-	}
-
-	log.Printf("👀 开始增量监听目录: %s", dir)
-
-	for {
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
-			}
-
-			path := event.Name
-			if !isSupportedAudioFile(path) {
-				continue
-			}
-
-			switch {
-
-			case event.Has(fsnotify.Create):
-				handleMusicFileAdded(path)
-			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
-				handleMusicFileRemoved(path)
-			}
-
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Println("⚠️ 音乐文件监听错误:", err)
-		}
-	}
+	watchTree(dir, handleMusicFileAdded, handleMusicFileRemoved, handleMusicDirRemoved)
 }
 
 // handleFileAdded 处理新增文件
@@ -439,8 +524,10 @@ func handleMusicFileAdded(path string) {
 	}
 
 	fileInfo := MusicFileInfo{
-		Path: path,
-		ID:   id,
+		Path:      path,
+		ID:        id,
+		Category:  musicCategoryOf(path),
+		TrackMeta: cachedTrackMeta(path),
 	}
 
 	musicstateMu.Lock()
@@ -448,11 +535,16 @@ func handleMusicFileAdded(path string) {
 	// 更新跟踪列表
 	trackedMusicFiles[path] = fileInfo
 
-	// 添加到队列并重新排序
-	currentQueue.files = append(currentQueue.files, fileInfo)
-	sort.Slice(currentQueue.files, func(i, j int) bool {
-		return currentQueue.files[i].ID < currentQueue.files[j].ID
+	// 添加到 folder 列表并重新排序（同一文件可能被目录补扫和监听事件各报一次）
+	folderMusicFiles = append(slices.DeleteFunc(folderMusicFiles, func(file MusicFileInfo) bool {
+		return file.Path == path
+	}), fileInfo)
+	sort.Slice(folderMusicFiles, func(i, j int) bool {
+		return folderMusicFiles[i].ID < folderMusicFiles[j].ID
 	})
+	if activePlaylistName() == "" {
+		currentQueue.files = activeMusicQueue(nil, false)
+	}
 
 	files := currentQueue.files
 	playingID := currentPlayingID
@@ -470,13 +562,22 @@ func handleMusicFileAdded(path string) {
 // handleFileRemoved 处理文件删除
 func handleMusicFileRemoved(path string) {
 	log.Printf("🔴 文件删除: %s", path)
+	forgetTrackMeta(path)
 
 	musicstateMu.Lock()
 
 	// 从 tracked 中移除
 	delete(trackedMusicFiles, path)
 
-	// 从队列中移除
+	// 从 folder 列表和当前队列中移除
+	folder := make([]MusicFileInfo, 0, len(folderMusicFiles))
+	for _, file := range folderMusicFiles {
+		if file.Path != path {
+			folder = append(folder, file)
+		}
+	}
+	folderMusicFiles = folder
+
 	newQueue := make([]MusicFileInfo, 0, len(currentQueue.files))
 	for _, file := range currentQueue.files {
 		if file.Path != path {
@@ -490,6 +591,16 @@ func handleMusicFileRemoved(path string) {
 	updateMusicList(newQueue, playingID)
 }
 
+// handleMusicDirRemoved 子目录被删除或移出时移除其下所有曲目
+func handleMusicDirRemoved(dir string) {
+	musicstateMu.RLock()
+	paths := pathsUnder(trackedMusicFiles, dir)
+	musicstateMu.RUnlock()
+	for _, path := range paths {
+		handleMusicFileRemoved(path)
+	}
+}
+
 // startDailyFullRescanMusic 每天 00:00 执行一次全量重扫
 func startDailyFullRescanMusic(dir string) {
 	for {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// musicSeek 请求跳转到当前曲目的某个位置，value 为秒数或百分比
+type musicSeek struct {
+	value   float64
+	percent bool
+}
+
+// parseMusicSeek 解析 "90"、"1:30"、"1:02:03" 或 "50%"
+func parseMusicSeek(text string) (musicSeek, error) {
+	text = strings.TrimSpace(text)
+	if percent, ok := strings.CutSuffix(text, "%"); ok {
+		value, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil {
+			return musicSeek{}, fmt.Errorf("invalid seek percent %q", text)
+		}
+		return musicSeek{value: value, percent: true}, nil
+	}
+	var seconds float64
+	parts := strings.Split(text, ":")
+	if len(parts) > 3 {
+		return musicSeek{}, fmt.Errorf("invalid seek position %q", text)
+	}
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return musicSeek{}, fmt.Errorf("invalid seek position %q", text)
+		}
+		seconds = seconds*60 + value
+	}
+	return musicSeek{value: seconds}, nil
+}
+
+// requestMusicSeek 把跳转请求交给播放循环，未处理的旧请求会被新请求替换
+func requestMusicSeek(seek musicSeek) error {
+	if math.IsNaN(seek.value) || math.IsInf(seek.value, 0) || seek.value < 0 || seek.percent && seek.value > 100 {
+		return fmt.Errorf("seek position out of range")
+	}
+	for {
+		select {
+		case seekmusic <- seek:
+			return nil
+		default:
+		}
+		select {
+		case <-seekmusic:
+		default:
+		}
+	}
+}
+
+// offset 把请求换算为曲目内的时间，length 为 16 kHz 样本数（0 表示未知）
+func (s musicSeek) offset(length int64) (time.Duration, error) {
+	if !s.percent {
+		return time.Duration(s.value * float64(time.Second)), nil
+	}
+	if length <= 0 {
+		return 0, fmt.Errorf("track duration is unknown")
+	}
+	samples := float64(length) * s.value / 100
+	return time.Duration(samples / playbackSampleRate * float64(time.Second)), nil
+}
+
+// formatPlayTime 把 16 kHz 样本数格式化为 m:ss 或 h:mm:ss
+func formatPlayTime(samples int64) string {
+	total := samples / playbackSampleRate
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// reportMusicPosition 更新状态文字、进度百分比和已播放/总时长
+func reportMusicPosition(state string, file MusicFileInfo, stream *audioStream, playing bool) {
+	position, length := stream.Position(), stream.Length()
+	percent := 0
+	clock := formatPlayTime(position)
+	if length > 0 {
+		percent = int(min(position*100/length, 100))
+		clock += " / " + formatPlayTime(length)
+	}
+	updatePlayStatus(fmt.Sprintf("%s: %s (ID: %04d) [%s]", state, trackDisplayName(file), file.ID, clock), percent, playing)
+	updatePlayPosition(float64(position)/playbackSampleRate, float64(length)/playbackSampleRate)
+	noteMusicPosition(file, float64(position)/playbackSampleRate)
+}
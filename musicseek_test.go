@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMusicSeek(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want musicSeek
+	}{
+		{"90", musicSeek{value: 90}},
+		{"1:30", musicSeek{value: 90}},
+		{"1:02:03.5", musicSeek{value: 3723.5}},
+		{" 50% ", musicSeek{value: 50, percent: true}},
+	} {
+		got, err := parseMusicSeek(tc.text)
+		if err != nil || got != tc.want {
+			t.Errorf("parseMusicSeek(%q) = %+v, %v; want %+v", tc.text, got, err, tc.want)
+		}
+	}
+	for _, text := range []string{"", "abc", "-5", "1:2:3:4", "x%"} {
+		if _, err := parseMusicSeek(text); err == nil {
+			t.Errorf("parseMusicSeek(%q) succeeded", text)
+		}
+	}
+
+	offset, err := musicSeek{value: 25, percent: true}.offset(4 * 60 * playbackSampleRate)
+	if err != nil || offset != time.Minute {
+		t.Fatalf("25%% of 4 minutes = %v, %v", offset, err)
+	}
+	if _, err := (musicSeek{value: 25, percent: true}).offset(0); err == nil {
+		t.Fatal("percent seek with unknown duration succeeded")
+	}
+	if got := formatPlayTime(3723 * playbackSampleRate); got != "1:02:03" {
+		t.Fatalf("formatPlayTime = %q", got)
+	}
+}
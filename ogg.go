@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/thesyncim/gopus"
+	gopusogg "github.com/thesyncim/gopus/container/ogg"
+)
+
+// Ogg files (.ogg, .oga, .opus) carrying Opus or Vorbis. Only the first
+// logical bitstream is played. Sample positions come from page granule
+// positions, so the Opus pre-skip, start offsets and end trimming written
+// by the encoder are honoured, and seeking only needs to scan page headers.
+
+const (
+	oggHeaderSize    = 27
+	oggFlagContinued = 0x01
+	oggFlagEOS       = 0x04
+	oggTailScan      = 64 * 1024
+	// Opus is decoded straight to the playback rate; granule positions
+	// are always 48 kHz.
+	oggOpusRate     = playbackSampleRate
+	oggOpusPreroll  = oggOpusRate * 80 / 1000 // RFC 7845 recommends 80 ms
+	oggOpusMaxFrame = oggOpusRate * 120 / 1000
+)
+
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func oggCRC(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+type oggPage struct {
+	offset   int64 // file offset of the capture pattern
+	size     int64
+	flags    byte
+	granule  int64 // -1 when no packet finishes on the page
+	serial   uint32
+	segments []byte
+	data     []byte
+}
+
+// oggReader splits the first logical bitstream of an Ogg file or stream
+// into packets.
+type oggReader struct {
+	src       io.Reader
+	br        *bufio.Reader
+	offset    int64 // file offset of the next byte in br
+	serial    uint32
+	hasSerial bool
+	page      oggPage
+	hasPage   bool
+	segment   int // next segment of page
+	data      int // next byte of page.data
+	last      int // last segment that finishes a packet, -1 if none
+	partial   []byte
+	spare     []byte
+}
+
+func newOggReader(src io.Reader) *oggReader {
+	return &oggReader{src: src, br: bufio.NewReaderSize(src, 1<<17)}
+}
+
+// seek restarts reading at the page that begins at or after offset. A
+// packet continued from an earlier page is dropped.
+func (r *oggReader) seek(offset int64) error {
+	seeker, ok := r.src.(io.Seeker)
+	if !ok {
+		return errors.New("Ogg source is not seekable")
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r.br.Reset(r.src)
+	r.offset = offset
+	r.hasPage = false
+	r.partial = r.partial[:0]
+	return nil
+}
+
+// streamEnded reports whether the current logical stream has ended.
+func (r *oggReader) streamEnded() bool {
+	return r.hasPage && r.page.flags&oggFlagEOS != 0
+}
+
+// nextStream moves on to the next logical stream of a chained stream, as
+// sent by Icecast at every track change, after the current one has ended.
+func (r *oggReader) nextStream() {
+	r.hasSerial, r.hasPage = false, false
+	r.partial = r.partial[:0]
+}
+
+// readPage reads the next page with a valid checksum, skipping garbage
+// between pages.
+func (r *oggReader) readPage() error {
+	for {
+		header, err := r.br.Peek(oggHeaderSize)
+		if err != nil {
+			return oggReadError(err)
+		}
+		if !bytes.Equal(header[:4], []byte("OggS")) || header[4] != 0 {
+			r.br.Discard(1)
+			r.offset++
+			continue
+		}
+		segmentCount := int(header[26])
+		full, err := r.br.Peek(oggHeaderSize + segmentCount)
+		if err != nil {
+			return oggReadError(err)
+		}
+		size := oggHeaderSize + segmentCount
+		for _, length := range full[oggHeaderSize:] {
+			size += int(length)
+		}
+		full, err = r.br.Peek(size)
+		if err != nil {
+			return oggReadError(err)
+		}
+		crc := oggCRC(0, full[:22])
+		crc = oggCRC(crc, []byte{0, 0, 0, 0})
+		crc = oggCRC(crc, full[26:])
+		if crc != binary.LittleEndian.Uint32(full[22:26]) {
+			r.br.Discard(1)
+			r.offset++
+			continue
+		}
+
+		r.page.offset = r.offset
+		r.page.size = int64(size)
+		r.page.flags = full[5]
+		r.page.granule = int64(binary.LittleEndian.Uint64(full[6:14]))
+		r.page.serial = binary.LittleEndian.Uint32(full[14:18])
+		r.page.segments = append(r.page.segments[:0], full[oggHeaderSize:oggHeaderSize+segmentCount]...)
+		r.page.data = append(r.page.data[:0], full[oggHeaderSize+segmentCount:]...)
+		r.br.Discard(size)
+		r.offset += int64(size)
+		return nil
+	}
+}
+
+// oggReadError reports a page cut short by the end of the data as io.EOF
+// and passes other read errors, such as a dropped connection, through.
+func oggReadError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+// nextPage loads the next page of the stream being read.
+func (r *oggReader) nextPage() error {
+	if r.streamEnded() {
+		return io.EOF
+	}
+	for {
+		if err := r.readPage(); err != nil {
+			return err
+		}
+		if !r.hasSerial {
+			r.serial, r.hasSerial = r.page.serial, true
+		}
+		if r.page.serial == r.serial {
+			break
+		}
+	}
+	r.hasPage = true
+	r.segment, r.data, r.last = 0, 0, -1
+	for i, length := range r.page.segments {
+		if length < 255 {
+			r.last = i
+		}
+	}
+
+	continued := r.page.flags&oggFlagContinued != 0
+	switch {
+	case continued && len(r.partial) == 0:
+		// The start of this packet is on a page we skipped or lost.
+		for r.segment < len(r.page.segments) {
+			length := int(r.page.segments[r.segment])
+			r.segment++
+			r.data += length
+			if length < 255 {
+				break
+			}
+		}
+	case !continued && len(r.partial) > 0:
+		r.partial = r.partial[:0]
+	}
+	return nil
+}
+
+// nextPacket returns the next packet and, when it is the last packet
+// finished on its page, the page granule position (otherwise -1). The
+// packet is valid until the call after next.
+func (r *oggReader) nextPacket() ([]byte, int64, error) {
+	for {
+		if !r.hasPage || r.segment >= len(r.page.segments) {
+			if err := r.nextPage(); err != nil {
+				return nil, -1, err
+			}
+			continue
+		}
+		length := int(r.page.segments[r.segment])
+		if r.data+length > len(r.page.data) {
+			r.segment = len(r.page.segments)
+			continue
+		}
+		r.partial = append(r.partial, r.page.data[r.data:r.data+length]...)
+		r.data += length
+		r.segment++
+		if length == 255 {
+			continue
+		}
+		packet := r.partial
+		r.partial, r.spare = r.spare[:0], packet
+		granule := int64(-1)
+		if r.segment-1 == r.last {
+			granule = r.page.granule
+		}
+		return packet, granule, nil
+	}
+}
+
+// pageDone reports whether every packet of the current page has been read.
+func (r *oggReader) pageDone() bool {
+	return !r.hasPage || r.segment >= len(r.page.segments)
+}
+
+// scanOggPages walks page headers from offset without reading page data.
+// fn receives the page and the offset of the page after it and returns
+// false to stop.
+func scanOggPages(f *os.File, offset int64, serial uint32, fn func(granule, next int64) bool) {
+	header := make([]byte, oggHeaderSize+255)
+	for {
+		n, _ := f.ReadAt(header, offset)
+		if n < oggHeaderSize || !bytes.Equal(header[:4], []byte("OggS")) {
+			return
+		}
+		segmentCount := int(header[26])
+		if n < oggHeaderSize+segmentCount {
+			return
+		}
+		next := offset + int64(oggHeaderSize+segmentCount)
+		for _, length := range header[oggHeaderSize : oggHeaderSize+segmentCount] {
+			next += int64(length)
+		}
+		if binary.LittleEndian.Uint32(header[14:18]) == serial {
+			if !fn(int64(binary.LittleEndian.Uint64(header[6:14])), next) {
+				return
+			}
+		}
+		offset = next
+	}
+}
+
+// lastOggGranule returns the granule position of the last page of the
+// stream, searching backwards from the end of the file.
+func lastOggGranule(f *os.File, serial uint32) (int64, bool) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false
+	}
+	size := info.Size()
+	for window := int64(oggTailScan); ; window *= 4 {
+		start := max(size-window, 0)
+		buf := make([]byte, size-start)
+		n, _ := f.ReadAt(buf, start)
+		buf = buf[:n]
+		for i := bytes.LastIndex(buf, []byte("OggS")); i >= 0; i = bytes.LastIndex(buf[:i], []byte("OggS")) {
+			if i+oggHeaderSize > len(buf) || buf[i+4] != 0 {
+				continue
+			}
+			granule := int64(binary.LittleEndian.Uint64(buf[i+6 : i+14]))
+			if binary.LittleEndian.Uint32(buf[i+14:i+18]) == serial && granule >= 0 {
+				return granule, true
+			}
+		}
+		if start == 0 {
+			return 0, false
+		}
+	}
+}
+
+// oggCodec decodes the audio packets of one Ogg stream to mono PCM.
+type oggCodec interface {
+	DecodePacket(packet []byte) ([]int, error)
+	Reset()
+	SampleRate() int
+}
+
+// oggStream is the decoder of one logical stream, set up from its headers.
+type oggStream struct {
+	codec    oggCodec
+	name     string
+	channels int
+	headers  int // header packets before the audio
+	// sample = (granule - granuleOffset) / granuleScale
+	granuleScale  int64
+	granuleOffset int64
+	preroll       int64 // samples decoded ahead of a seek target
+}
+
+// readOggHeaders reads the header packets at the start of a logical stream
+// and creates the matching decoder.
+func readOggHeaders(r *oggReader) (oggStream, error) {
+	first, _, err := r.nextPacket()
+	if err != nil {
+		return oggStream{}, fmt.Errorf("no Ogg stream found: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(first, []byte("OpusHead")):
+		return readOggOpusHeaders(r, first)
+	case bytes.HasPrefix(first, []byte("\x01vorbis")):
+		return readOggVorbisHeaders(r, first)
+	default:
+		return oggStream{}, errors.New("unsupported codec, only Opus and Vorbis are supported")
+	}
+}
+
+func readOggOpusHeaders(r *oggReader, first []byte) (oggStream, error) {
+	head, err := gopusogg.ParseOpusHead(first)
+	if err != nil {
+		return oggStream{}, err
+	}
+	if head.Channels < 1 || head.Channels > 2 {
+		return oggStream{}, fmt.Errorf("Opus streams with %d channels are not supported", head.Channels)
+	}
+	tags, _, err := r.nextPacket()
+	if err != nil || !bytes.HasPrefix(tags, []byte("OpusTags")) {
+		return oggStream{}, errors.New("missing OpusTags header")
+	}
+	decoder, err := gopus.NewDecoder(gopus.DefaultDecoderConfig(oggOpusRate, int(head.Channels)))
+	if err != nil {
+		return oggStream{}, err
+	}
+	codec := &oggOpusCodec{
+		decoder:  decoder,
+		channels: int(head.Channels),
+		gain:     math.Pow(10, float64(head.OutputGain)/(20*256)),
+		pcm:      make([]int16, oggOpusMaxFrame*int(head.Channels)),
+	}
+	return oggStream{
+		codec:         codec,
+		name:          "Opus",
+		channels:      int(head.Channels),
+		headers:       2,
+		granuleScale:  48000 / oggOpusRate,
+		granuleOffset: int64(head.PreSkip),
+		preroll:       oggOpusPreroll,
+	}, nil
+}
+
+func readOggVorbisHeaders(r *oggReader, first []byte) (oggStream, error) {
+	decoder := &vorbisDecoder{}
+	if err := decoder.readIdentification(first); err != nil {
+		return oggStream{}, err
+	}
+	comment, _, err := r.nextPacket()
+	if err != nil || !bytes.HasPrefix(comment, []byte("\x03vorbis")) {
+		return oggStream{}, errors.New("missing Vorbis comment header")
+	}
+	setup, _, err := r.nextPacket()
+	if err != nil {
+		return oggStream{}, errors.New("missing Vorbis setup header")
+	}
+	if err := decoder.readSetup(setup); err != nil {
+		return oggStream{}, err
+	}
+	return oggStream{
+		codec:        decoder,
+		name:         "Vorbis",
+		channels:     decoder.channels,
+		headers:      3,
+		granuleScale: 1,
+		preroll:      2 * int64(decoder.blocksize[1]),
+	}, nil
+}
+
+type oggSource struct {
+	oggStream
+	path       string
+	f          *os.File
+	reader     *oggReader
+	audioStart int64 // offset of the first page after the headers
+	length     int64
+	pending    []int
+	position   int64 // sample number of pending[0] once anchored
+	anchored   bool
+	fromStart  bool
+	target     int64 // samples before target are dropped
+}
+
+func openOggSource(path string) (*oggSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &oggSource{path: path, f: f, reader: newOggReader(f), fromStart: true}
+	if err := s.open(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open Ogg %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *oggSource) open() error {
+	stream, err := readOggHeaders(s.reader)
+	if err != nil {
+		return err
+	}
+	s.oggStream = stream
+	s.audioStart = s.reader.offset
+	if !s.reader.pageDone() {
+		s.audioStart = s.reader.page.offset
+	}
+	if granule, ok := lastOggGranule(s.f, s.reader.serial); ok {
+		s.length = max(s.granuleSample(granule), 0)
+	}
+	return nil
+}
+
+func (s *oggSource) granuleSample(granule int64) int64 {
+	value := granule - s.granuleOffset
+	if value < 0 {
+		return -((-value + s.granuleScale - 1) / s.granuleScale)
+	}
+	return value / s.granuleScale
+}
+
+func (s *oggSource) ReadBlock() ([]int, error) {
+	for {
+		packet, granule, err := s.reader.nextPacket()
+		if errors.Is(err, io.EOF) {
+			// No granule position followed the last packets: keep them.
+			s.anchored = true
+			if block := s.emit(); len(block) > 0 {
+				return block, nil
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read Ogg %s: %w", s.path, err)
+		}
+		pcm, err := s.codec.DecodePacket(packet)
+		if err != nil {
+			return nil, fmt.Errorf("decode Ogg packet %s: %w", s.path, err)
+		}
+		s.pending = append(s.pending, pcm...)
+		if granule >= 0 {
+			end := s.granuleSample(granule)
+			if !s.anchored {
+				s.anchored = true
+				s.position = end - int64(len(s.pending))
+				if s.fromStart && s.reader.page.flags&oggFlagEOS != 0 {
+					// A stream on a single page: the granule trims the end.
+					s.position = s.granuleSample(0)
+				}
+			}
+			if decoded := s.position + int64(len(s.pending)); end < decoded {
+				s.pending = s.pending[:max(end-s.position, 0)]
+			}
+		}
+		if block := s.emit(); len(block) > 0 {
+			return block, nil
+		}
+	}
+}
+
+// emit hands out the pending samples from the seek target onwards once
+// their position is known.
+func (s *oggSource) emit() []int {
+	if !s.anchored || len(s.pending) == 0 {
+		return nil
+	}
+	if skip := min(max(s.target-s.position, 0), int64(len(s.pending))); skip > 0 {
+		s.pending = s.pending[skip:]
+		s.position += skip
+	}
+	block := s.pending
+	s.pending = nil
+	s.position += int64(len(block))
+	return block
+}
+
+func (s *oggSource) SampleRate() int { return s.codec.SampleRate() }
+func (s *oggSource) Length() int64   { return s.length }
+func (s *oggSource) Close() error    { return s.f.Close() }
+
+// SeekSample finds the last page that ends at least one preroll before the
+// target, resets the decoder there and drops samples up to the target.
+func (s *oggSource) SeekSample(sample int64) error {
+	sample = max(sample, 0)
+	offset := int64(-1)
+	if limit := sample - s.preroll; limit > 0 {
+		scanOggPages(s.f, s.audioStart, s.reader.serial, func(granule, next int64) bool {
+			if granule < 0 {
+				return true
+			}
+			if s.granuleSample(granule) > limit {
+				return false
+			}
+			offset = next
+			return true
+		})
+	}
+
+	s.codec.Reset()
+	s.pending, s.anchored, s.target = nil, false, sample
+	s.fromStart = offset < 0
+	if offset >= 0 {
+		return s.reader.seek(offset)
+	}
+	if err := s.reader.seek(0); err != nil {
+		return err
+	}
+	for range s.headers {
+		if _, _, err := s.reader.nextPacket(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type oggOpusCodec struct {
+	decoder  *gopus.Decoder
+	channels int
+	gain     float64
+	pcm      []int16
+	mono     []int
+}
+
+func (c *oggOpusCodec) DecodePacket(packet []byte) ([]int, error) {
+	if len(packet) == 0 {
+		return nil, nil
+	}
+	n, err := c.decoder.DecodeInt16(packet, c.pcm)
+	if err != nil {
+		return nil, err
+	}
+	c.mono = c.mono[:0]
+	for i := range n {
+		sum := 0
+		for channel := range c.channels {
+			sum += int(c.pcm[i*c.channels+channel])
+		}
+		c.mono = append(c.mono, clampPCM(int(math.Round(float64(sum)*c.gain/float64(c.channels)))))
+	}
+	return c.mono, nil
+}
+
+func (c *oggOpusCodec) Reset()          { c.decoder.Reset() }
+func (c *oggOpusCodec) SampleRate() int { return oggOpusRate }
+
+// oggInfo is what the headers of an Ogg Opus or Vorbis file describe.
+type oggInfo struct {
+	Comments [][2]string
+	Duration float64 // seconds, 0 when unknown
+}
+
+func readOggInfo(f *os.File) (oggInfo, error) {
+	reader := newOggReader(f)
+	first, _, err := reader.nextPacket()
+	if err != nil {
+		return oggInfo{}, err
+	}
+	var rate, preSkip int64
+	var prefix string
+	switch {
+	case bytes.HasPrefix(first, []byte("OpusHead")):
+		head, err := gopusogg.ParseOpusHead(first)
+		if err != nil {
+			return oggInfo{}, err
+		}
+		rate, preSkip, prefix = 48000, int64(head.PreSkip), "OpusTags"
+	case bytes.HasPrefix(first, []byte("\x01vorbis")) && len(first) >= 16:
+		rate, prefix = int64(binary.LittleEndian.Uint32(first[12:16])), "\x03vorbis"
+	default:
+		return oggInfo{}, errors.New("unsupported Ogg codec")
+	}
+
+	var info oggInfo
+	if comment, _, err := reader.nextPacket(); err == nil && bytes.HasPrefix(comment, []byte(prefix)) {
+		info.Comments = parseVorbisComments(comment[len(prefix):])
+	}
+	if granule, ok := lastOggGranule(f, reader.serial); ok && rate > 0 && granule > preSkip {
+		info.Duration = float64(granule-preSkip) / float64(rate)
+	}
+	return info, nil
+}
+
+// parseVorbisComments reads the vendor string and NAME=value pairs shared
+// by Vorbis comment headers and OpusTags.
+func parseVorbisComments(data []byte) [][2]string {
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		length := binary.LittleEndian.Uint32(data)
+		if uint64(length) > uint64(len(data)-4) {
+			return nil, false
+		}
+		field := data[4 : 4+length]
+		data = data[4+length:]
+		return field, true
+	}
+	if _, ok := next(); !ok || len(data) < 4 {
+		return nil
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	var comments [][2]string
+	for range min(count, 1024) {
+		field, ok := next()
+		if !ok {
+			break
+		}
+		if name, value, ok := bytes.Cut(field, []byte("=")); ok {
+			comments = append(comments, [2]string{string(name), string(value)})
+		}
+	}
+	return comments
+}
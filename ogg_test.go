@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thesyncim/gopus"
+	gopusogg "github.com/thesyncim/gopus/container/ogg"
+)
+
+func TestDecodeOggOpus(t *testing.T) {
+	const frames = 75 // 1.5 秒
+	file := encodeTestOpus(t, frames)
+	path := filepath.Join(t.TempDir(), "tone-0001.opus")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := openAudioStream(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	want := int64(frames*960-gopusogg.DefaultPreSkip) / 3
+	if stream.Length() != want {
+		t.Fatalf("length = %d, want %d", stream.Length(), want)
+	}
+	decoded, err := decodeAudioFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(decoded)) != want {
+		t.Fatalf("decoded %d samples, want %d", len(decoded), want)
+	}
+	middle := decoded[8000:12000]
+	if rms := pcmRMS(middle); rms < 0.4*32767/math.Sqrt2*0.7 {
+		t.Fatalf("decoded tone rms = %.0f", rms)
+	}
+
+	// 跳转后的声音应与顺序解码的同一段一致（解码器预滚 80 ms 后已收敛）
+	if err := stream.Seek(750 * 1e6); err != nil {
+		t.Fatal(err)
+	}
+	if stream.Position() != 12000 {
+		t.Fatalf("position after seek = %d", stream.Position())
+	}
+	frame := make([]int, 800)
+	if n, err := stream.Read(frame); err != nil || n != len(frame) {
+		t.Fatalf("read after seek = %d, %v", n, err)
+	}
+	diff := make([]int, len(frame))
+	for i := range frame {
+		diff[i] = frame[i] - decoded[12000+i]
+	}
+	if pcmRMS(diff) > pcmRMS(frame)/10 {
+		t.Fatalf("audio after seek differs: rms %.0f of %.0f", pcmRMS(diff), pcmRMS(frame))
+	}
+}
+
+// encodeTestOpus 生成 20 ms 一帧、440 Hz 正弦波的 48 kHz 立体声 Ogg Opus 文件
+func encodeTestOpus(t *testing.T, frames int) []byte {
+	t.Helper()
+	encoder, err := gopus.NewEncoder(gopus.EncoderConfig{SampleRate: 48000, Channels: 2, Application: gopus.ApplicationAudio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file bytes.Buffer
+	writer, err := gopusogg.NewWriter(&file, 48000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]float32, 960*2)
+	packet := make([]byte, 4000)
+	for frame := range frames {
+		for i := range 960 {
+			value := float32(0.4 * math.Sin(2*math.Pi*440*float64(frame*960+i)/48000))
+			pcm[2*i], pcm[2*i+1] = value, value
+		}
+		n, err := encoder.Encode(pcm, packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.WritePacket(packet[:n], 960); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file.Bytes()
+}
+
+func pcmRMS(samples []int) float64 {
+	var sum float64
+	for _, sample := range samples {
+		sum += float64(sample) * float64(sample)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestOggPageChecksum(t *testing.T) {
+	page := gopusogg.Page{HeaderType: 0x02, GranulePos: 1234, SerialNumber: 99, Segments: []byte{5}, Payload: []byte("hello")}
+	data := page.Encode()
+	got := oggCRC(oggCRC(oggCRC(0, data[:22]), []byte{0, 0, 0, 0}), data[26:])
+	if want := uint32(data[22]) | uint32(data[23])<<8 | uint32(data[24])<<16 | uint32(data[25])<<24; got != want {
+		t.Fatalf("crc = %08x, want %08x", got, want)
+	}
+}
+
+func TestOggFilenames(t *testing.T) {
+	for _, name := range []string{"song-0001.ogg", "song-0002.OPUS", "song-0003.oga"} {
+		if !MusicfilenameRegex.MatchString(name) {
+			t.Errorf("MusicfilenameRegex does not match %q", name)
+		}
+	}
+	for _, name := range []string{"news-0830.ogg", "news-1200.opus"} {
+		if !filenameRegex.MatchString(name) {
+			t.Errorf("filenameRegex does not match %q", name)
+		}
+	}
+}
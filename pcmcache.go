@@ -0,0 +1,279 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// 信标和定时音频的解码缓存：按路径、修改时间和大小缓存解码、重采样后的 16 kHz PCM，
+// 触发时直接发送，不再等待解码。扫描目录时在后台预先解码，目录监听发现文件变化时作废。
+// 缓存以 int16 保存，总大小不超过 PCMCacheMB，按最近使用淘汰。
+
+const (
+	defaultPCMCacheMB = 64
+	pcmWarmQueueSize  = 256
+)
+
+var errPCMTooLarge = errors.New("decoded audio exceeds the PCM cache budget")
+
+type pcmCacheEntry struct {
+	path    string
+	modTime time.Time
+	size    int64
+	pcm     []int16
+	elem    *list.Element
+}
+
+// pcmLoad 是正在解码的文件，同一文件同时请求时等待同一次解码
+type pcmLoad struct {
+	done  chan struct{}
+	entry *pcmCacheEntry
+	err   error
+}
+
+var pcmCache = struct {
+	sync.Mutex
+	entries map[string]*pcmCacheEntry
+	loading map[string]*pcmLoad
+	lru     *list.List // 前端为最近使用
+	bytes   int64
+}{
+	entries: make(map[string]*pcmCacheEntry),
+	loading: make(map[string]*pcmLoad),
+	lru:     list.New(),
+}
+
+var (
+	pcmWarmQueue = make(chan string, pcmWarmQueueSize)
+	pcmWarmOnce  sync.Once
+)
+
+// pcmCacheBudget 返回缓存上限（字节），PCMCacheMB 为 0 时使用默认值，小于 0 时关闭缓存
+func pcmCacheBudget() int64 {
+	confMu.Lock()
+	mb := conf.System.PCMCacheMB
+	confMu.Unlock()
+	if mb == 0 {
+		mb = defaultPCMCacheMB
+	}
+	return int64(max(mb, 0)) << 20
+}
+
+func (e *pcmCacheEntry) bytes() int64 {
+	return int64(len(e.pcm)) * 2
+}
+
+func (e *pcmCacheEntry) matches(info os.FileInfo) bool {
+	return e.modTime.Equal(info.ModTime()) && e.size == info.Size()
+}
+
+// lookupPCMCache 返回已缓存且文件未变化的 PCM，不会触发解码
+func lookupPCMCache(path string) ([]int16, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	pcmCache.Lock()
+	defer pcmCache.Unlock()
+	entry := pcmCache.entries[path]
+	if entry == nil || !entry.matches(info) {
+		return nil, false
+	}
+	pcmCache.lru.MoveToFront(entry.elem)
+	return entry.pcm, true
+}
+
+// cachedPCM 返回文件的 PCM，未缓存时解码并放入缓存。
+// 解码结果超过缓存上限时返回 errPCMTooLarge，调用方应改为边解码边播放。
+func cachedPCM(path string) ([]int16, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	budget := pcmCacheBudget()
+
+	pcmCache.Lock()
+	if entry := pcmCache.entries[path]; entry != nil && entry.matches(info) {
+		pcmCache.lru.MoveToFront(entry.elem)
+		pcmCache.Unlock()
+		return entry.pcm, nil
+	}
+	if load := pcmCache.loading[path]; load != nil {
+		pcmCache.Unlock()
+		<-load.done
+		if load.err != nil {
+			return nil, load.err
+		}
+		return load.entry.pcm, nil
+	}
+	load := &pcmLoad{done: make(chan struct{})}
+	pcmCache.loading[path] = load
+	pcmCache.Unlock()
+
+	var pcm []int16
+	pcm, load.err = decodePCM16(path, budget)
+	if load.err == nil {
+		load.entry = &pcmCacheEntry{path: path, modTime: info.ModTime(), size: info.Size(), pcm: pcm}
+	}
+
+	pcmCache.Lock()
+	delete(pcmCache.loading, path)
+	if load.err == nil {
+		storePCMCache(load.entry, budget)
+	}
+	pcmCache.Unlock()
+	close(load.done)
+
+	if load.err != nil {
+		return nil, load.err
+	}
+	return pcm, nil
+}
+
+// storePCMCache 放入缓存并按最近使用淘汰超出上限的条目，调用方需持有 pcmCache
+func storePCMCache(entry *pcmCacheEntry, budget int64) {
+	if old := pcmCache.entries[entry.path]; old != nil {
+		removePCMCacheEntry(old)
+	}
+	entry.elem = pcmCache.lru.PushFront(entry)
+	pcmCache.entries[entry.path] = entry
+	pcmCache.bytes += entry.bytes()
+	for pcmCache.bytes > budget && pcmCache.lru.Len() > 1 {
+		removePCMCacheEntry(pcmCache.lru.Back().Value.(*pcmCacheEntry))
+	}
+}
+
+func removePCMCacheEntry(entry *pcmCacheEntry) {
+	pcmCache.lru.Remove(entry.elem)
+	delete(pcmCache.entries, entry.path)
+	pcmCache.bytes -= entry.bytes()
+}
+
+// decodePCM16 把整个文件解码为 16 kHz int16，超过 limit 字节时放弃
+func decodePCM16(path string, limit int64) ([]int16, error) {
+	stream, err := openAudioStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if stream.Length()*2 > limit {
+		return nil, errPCMTooLarge
+	}
+
+	pcm := make([]int16, 0, stream.Length())
+	frame := make([]int, opusFrameSamples)
+	for {
+		n, err := stream.Read(frame)
+		for _, sample := range frame[:n] {
+			pcm = append(pcm, int16(min(max(sample, math.MinInt16), math.MaxInt16)))
+		}
+		if int64(len(pcm))*2 > limit {
+			return nil, errPCMTooLarge
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(pcm) == 0 {
+		return nil, fmt.Errorf("audio file contains no samples: %s", path)
+	}
+	return pcm, nil
+}
+
+// invalidatePCMCache 文件被修改、删除或移出时丢弃其缓存
+func invalidatePCMCache(path string) {
+	pcmCache.Lock()
+	if entry := pcmCache.entries[path]; entry != nil {
+		removePCMCacheEntry(entry)
+	}
+	pcmCache.Unlock()
+}
+
+// invalidatePCMCacheDir 子目录被删除或移出时丢弃其下所有文件的缓存
+func invalidatePCMCacheDir(dir string) {
+	pcmCache.Lock()
+	for _, path := range pathsUnder(pcmCache.entries, dir) {
+		removePCMCacheEntry(pcmCache.entries[path])
+	}
+	pcmCache.Unlock()
+}
+
+// warmPCMCache 在后台解码文件放入缓存，多个文件依次解码，避免同时占用 CPU
+func warmPCMCache(path string) {
+	if path == "" || pcmCacheBudget() == 0 {
+		return
+	}
+	pcmWarmOnce.Do(func() { go runPCMWarmer() })
+	select {
+	case pcmWarmQueue <- path:
+	default:
+		log.Printf("⚠️ 预解码队列已满，跳过: %s", path)
+	}
+}
+
+func runPCMWarmer() {
+	for path := range pcmWarmQueue {
+		if _, ok := lookupPCMCache(path); ok {
+			continue
+		}
+		start := time.Now()
+		pcm, err := cachedPCM(path)
+		switch {
+		case errors.Is(err, errPCMTooLarge):
+			log.Printf("ℹ️ 音频超过解码缓存上限，播放时边解码边播放: %s", path)
+		case err != nil:
+			log.Printf("⚠️ 预解码失败 %s: %v", path, err)
+		default:
+			log.Printf("💾 已预解码 %s (%.1f 秒音频，用时 %v)", path, float64(len(pcm))/playbackSampleRate, time.Since(start).Round(time.Millisecond))
+		}
+	}
+}
+
+// openCachedAudio 有缓存时从缓存读取；否则边解码边播放，并在后台解码供下次使用
+func openCachedAudio(path string) (frameReader, error) {
+	if pcm, ok := lookupPCMCache(path); ok {
+		return &pcmReader{pcm: pcm}, nil
+	}
+	warmPCMCache(path)
+	return openAudioStream(path)
+}
+
+// frameReader 是 audioStream 和 pcmReader 共同的按帧读取接口
+type frameReader interface {
+	Read(frame []int) (int, error)
+	Position() int64
+	Length() int64
+	Close() error
+}
+
+// pcmReader 按帧读取缓存中的 PCM，缓存数据只读，可以同时被多个 pcmReader 使用
+type pcmReader struct {
+	pcm      []int16
+	position int
+}
+
+func (r *pcmReader) Read(frame []int) (int, error) {
+	if r.position >= len(r.pcm) {
+		return 0, io.EOF
+	}
+	n := min(len(frame), len(r.pcm)-r.position)
+	for i, sample := range r.pcm[r.position : r.position+n] {
+		frame[i] = int(sample)
+	}
+	r.position += n
+	return n, nil
+}
+
+func (r *pcmReader) Position() int64 { return int64(r.position) }
+func (r *pcmReader) Length() int64   { return int64(len(r.pcm)) }
+func (r *pcmReader) Close() error    { return nil }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPCMCache(t *testing.T) {
+	oldBudget := conf.System.PCMCacheMB
+	conf.System.PCMCacheMB = 1
+	t.Cleanup(func() { conf.System.PCMCacheMB = oldBudget })
+
+	samples := make([]int16, 200000) // 解码后约 400 KB
+	for i := range samples {
+		samples[i] = int16(i % 1000)
+	}
+	paths := []string{writeTestWAV(t, 16000, 1, samples), writeTestWAV(t, 16000, 1, samples), writeTestWAV(t, 16000, 1, samples)}
+	for _, path := range paths {
+		t.Cleanup(func() { invalidatePCMCache(path) })
+	}
+
+	pcm, err := cachedPCM(paths[0])
+	if err != nil || len(pcm) != len(samples) || pcm[999] != 999 {
+		t.Fatalf("cachedPCM = %d samples, %v", len(pcm), err)
+	}
+	reader, err := openCachedAudio(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reader.(*pcmReader); !ok {
+		t.Fatalf("openCachedAudio returned %T, want cached reader", reader)
+	}
+	frame := make([]int, opusFrameSamples)
+	total := 0
+	for {
+		n, err := reader.Read(frame)
+		total += n
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	if total != len(samples) || reader.Position() != reader.Length() {
+		t.Fatalf("read %d samples, position %d of %d", total, reader.Position(), reader.Length())
+	}
+
+	// 超过 1 MB 上限时淘汰最久未使用的文件
+	cachedPCM(paths[1])
+	lookupPCMCache(paths[0])
+	cachedPCM(paths[2])
+	if _, ok := lookupPCMCache(paths[1]); ok {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	if _, ok := lookupPCMCache(paths[0]); !ok {
+		t.Fatal("recently used entry was evicted")
+	}
+
+	// 文件被改写后缓存失效
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(paths[0], later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lookupPCMCache(paths[0]); ok {
+		t.Fatal("stale entry returned after the file changed")
+	}
+
+	conf.System.PCMCacheMB = -1
+	if _, err := cachedPCM(paths[1]); !errors.Is(err, errPCMTooLarge) {
+		t.Fatalf("disabled cache: err = %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Playlist is a named, ordered list of audio files that may live in any
+// folder. The default "folder" playlist is every -NNNN file in MusicFilePath
+// and is selected by an empty ActivePlaylist.
+type Playlist struct {
+	Name  string   `yaml:"Name" json:"name"`
+	Files []string `yaml:"Files" json:"files"`
+}
+
+const (
+	folderPlaylistName = "folder"
+	maxPlaylistEntries = 5000
+)
+
+func validatePlaylistName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("playlist name is required")
+	}
+	if len(name) > 100 {
+		return "", fmt.Errorf("playlist name is too long")
+	}
+	if strings.EqualFold(name, folderPlaylistName) {
+		return "", fmt.Errorf("playlist name %q is reserved", folderPlaylistName)
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 || strings.ContainsAny(name, ",=") {
+		return "", fmt.Errorf("playlist name contains invalid characters")
+	}
+	return name, nil
+}
+
+// savePlaylist creates or replaces a named playlist.
+func savePlaylist(name string, files []string) (Playlist, error) {
+	name, err := validatePlaylistName(name)
+	if err != nil {
+		return Playlist{}, err
+	}
+	if len(files) == 0 {
+		return Playlist{}, fmt.Errorf("playlist has no audio files")
+	}
+	if len(files) > maxPlaylistEntries {
+		return Playlist{}, fmt.Errorf("playlist has more than %d entries", maxPlaylistEntries)
+	}
+	playlist := Playlist{Name: name, Files: append([]string(nil), files...)}
+
+	confMu.Lock()
+	replaced := false
+	for i := range conf.System.Playlists {
+		if conf.System.Playlists[i].Name == name {
+			conf.System.Playlists[i] = playlist
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		conf.System.Playlists = append(conf.System.Playlists, playlist)
+	}
+	active := conf.System.ActivePlaylist == name
+	confMu.Unlock()
+
+	if active {
+		applyActivePlaylist()
+	}
+	return playlist, nil
+}
+
+func deletePlaylist(name string) error {
+	confMu.Lock()
+	found := false
+	next := make([]Playlist, 0, len(conf.System.Playlists))
+	for _, playlist := range conf.System.Playlists {
+		if playlist.Name == name {
+			found = true
+			continue
+		}
+		next = append(next, playlist)
+	}
+	active := found && conf.System.ActivePlaylist == name
+	if found {
+		conf.System.Playlists = next
+		if active {
+			conf.System.ActivePlaylist = ""
+		}
+	}
+	confMu.Unlock()
+	if !found {
+		return fmt.Errorf("playlist not found")
+	}
+	if active {
+		applyActivePlaylist()
+	}
+	return nil
+}
+
+func findPlaylist(name string) (Playlist, bool) {
+	confMu.Lock()
+	defer confMu.Unlock()
+	for _, playlist := range conf.System.Playlists {
+		if playlist.Name == name {
+			return Playlist{Name: playlist.Name, Files: append([]string(nil), playlist.Files...)}, true
+		}
+	}
+	return Playlist{}, false
+}
+
+// renamePlaylistEntries points entries at renamed files (old path -> new
+// path) so that web renames and renumbering keep named playlists intact.
+func renamePlaylistEntries(renamed map[string]string) {
+	confMu.Lock()
+	changed, active := false, false
+	for i := range conf.System.Playlists {
+		playlist := &conf.System.Playlists[i]
+		for j, file := range playlist.Files {
+			if target, ok := renamed[filepath.Clean(file)]; ok {
+				playlist.Files[j] = target
+				changed = true
+				active = active || playlist.Name == conf.System.ActivePlaylist
+			}
+		}
+	}
+	confMu.Unlock()
+	if changed {
+		saveConfig()
+	}
+	if active {
+		applyActivePlaylist()
+	}
+}
+
+// setActivePlaylist switches music playback to name; "" or "folder" selects
+// the default folder playlist.
+func setActivePlaylist(name string) error {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(name, folderPlaylistName) {
+		name = ""
+	}
+	if name != "" {
+		if _, ok := findPlaylist(name); !ok {
+			return fmt.Errorf("playlist not found")
+		}
+	}
+	confMu.Lock()
+	conf.System.ActivePlaylist = name
+	confMu.Unlock()
+
+	applyActivePlaylist()
+	select {
+	case nextmusic <- true:
+	default:
+	}
+	return nil
+}
+
+func activePlaylistName() string {
+	confMu.Lock()
+	defer confMu.Unlock()
+	return conf.System.ActivePlaylist
+}
+
+// playlistSummaries lists the folder playlist followed by the named ones.
+func playlistSummaries() []map[string]any {
+	musicstateMu.Lock()
+	folderCount := len(folderMusicFiles)
+	musicstateMu.Unlock()
+
+	summaries := []map[string]any{{"name": folderPlaylistName, "count": folderCount, "folder": true}}
+	confMu.Lock()
+	for _, playlist := range conf.System.Playlists {
+		summaries = append(summaries, map[string]any{"name": playlist.Name, "count": len(playlist.Files)})
+	}
+	confMu.Unlock()
+	return summaries
+}
+
+// parsePlaylist reads an M3U/M3U8 or PLS playlist. Relative entries are
+// resolved against base; remote URLs and unsupported files are skipped.
+// An empty format is detected from the content.
+func parsePlaylist(data []byte, format, base string) ([]string, error) {
+	entries, err := playlistEntries(data, format)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		path, ok := playlistEntryPath(entry, base)
+		if ok {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("playlist has no local audio files")
+	}
+	return files, nil
+}
+
+// playlistEntries returns the entries of an M3U/M3U8 or PLS playlist in
+// order, as written. An empty format is detected from the content.
+func playlistEntries(data []byte, format string) ([]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+	if format == "" {
+		format = "m3u"
+		if bytes.HasPrefix(bytes.ToLower(bytes.TrimSpace(data)), []byte("[playlist]")) {
+			format = "pls"
+		}
+	}
+
+	var entries []string
+	switch format {
+	case "m3u", "m3u8":
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case "pls":
+		numbered := make(map[int]string)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+			if !ok || len(key) <= 4 || !strings.EqualFold(key[:4], "file") {
+				continue
+			}
+			n, err := strconv.Atoi(key[4:])
+			if err != nil {
+				continue
+			}
+			numbered[n] = strings.TrimSpace(value)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		numbers := make([]int, 0, len(numbered))
+		for n := range numbered {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		for _, n := range numbers {
+			entries = append(entries, numbered[n])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported playlist format %q", format)
+	}
+	return entries, nil
+}
+
+func playlistEntryPath(entry, base string) (string, bool) {
+	if strings.Contains(entry, "://") {
+		parsed, err := url.Parse(entry)
+		if err != nil || parsed.Scheme != "file" {
+			return "", false
+		}
+		entry = parsed.Path
+		// file:///C:/Music/a.mp3 on Windows
+		if len(entry) > 2 && entry[0] == '/' && entry[2] == ':' {
+			entry = entry[1:]
+		}
+	}
+	entry = filepath.FromSlash(strings.ReplaceAll(entry, `\`, "/"))
+	if !isSupportedAudioFile(entry) {
+		return "", false
+	}
+	if !filepath.IsAbs(entry) && !(len(entry) > 1 && entry[1] == ':') && base != "" {
+		entry = filepath.Join(base, entry)
+	}
+	return filepath.Clean(entry), true
+}
+
+// encodePlaylist writes files as M3U8 (default) or PLS and returns the
+// content type to serve it with.
+func encodePlaylist(playlist Playlist, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch strings.ToLower(format) {
+	case "", "m3u", "m3u8":
+		buf.WriteString("#EXTM3U\n")
+		buf.WriteString("#PLAYLIST:" + playlist.Name + "\n")
+		for _, file := range playlist.Files {
+			title := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			fmt.Fprintf(&buf, "#EXTINF:-1,%s\n%s\n", title, file)
+		}
+		return buf.Bytes(), "audio/x-mpegurl; charset=utf-8", nil
+	case "pls":
+		buf.WriteString("[playlist]\n")
+		for i, file := range playlist.Files {
+			title := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			fmt.Fprintf(&buf, "File%d=%s\nTitle%d=%s\nLength%d=-1\n", i+1, file, i+1, title, i+1)
+		}
+		fmt.Fprintf(&buf, "NumberOfEntries=%d\nVersion=2\n", len(playlist.Files))
+		return buf.Bytes(), "audio/x-scpls; charset=utf-8", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported playlist format %q", format)
+	}
+}
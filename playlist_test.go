@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseM3UPlaylist(t *testing.T) {
+	base := filepath.FromSlash("/music")
+	data := "\xef\xbb\xbf#EXTM3U\n#EXTINF:123,Artist - Song\nsong-0001.mp3\n\nsub\\b.flac\r\nhttp://example.com/stream.mp3\nfile:///srv/audio/c.m4a\nnotes.txt\n/abs/d.wav\n"
+	got, err := parsePlaylist([]byte(data), "m3u8", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(base, "song-0001.mp3"),
+		filepath.Join(base, "sub", "b.flac"),
+		filepath.FromSlash("/srv/audio/c.m4a"),
+		filepath.FromSlash("/abs/d.wav"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("files = %q, want %q", got, want)
+	}
+}
+
+func TestParsePLSPlaylistOrdersByNumber(t *testing.T) {
+	data := "[playlist]\nFile2=b.mp3\nTitle2=B\nfile10=c.mp3\nFile1=a.mp3\nNumberOfEntries=3\nVersion=2\n"
+	got, err := parsePlaylist([]byte(data), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.mp3", "b.mp3", "c.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("files = %q, want %q", got, want)
+	}
+}
+
+func TestPlaylistExportRoundTrip(t *testing.T) {
+	playlist := Playlist{Name: "morning", Files: []string{
+		filepath.FromSlash("/music/a.mp3"),
+		filepath.FromSlash("/other/b c.flac"),
+	}}
+	for _, format := range []string{"m3u8", "pls"} {
+		data, _, err := encodePlaylist(playlist, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parsePlaylist(data, format, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, playlist.Files) {
+			t.Fatalf("%s round trip = %q, want %q", format, got, playlist.Files)
+		}
+	}
+	if _, err := parsePlaylist([]byte("#EXTM3U\nhttp://example.com/a.mp3\n"), "m3u", ""); err == nil {
+		t.Fatal("playlist without local files was accepted")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 音乐播放模式
+const (
+	playModeSequential = "sequential" // 按编号顺序循环播放
+	playModeShuffle    = "shuffle"    // 随机播放，一轮内不重复
+	playModeRepeatOne  = "repeat_one" // 单曲循环
+	playModeOnce       = "once"       // 按顺序播放一遍后停止
+
+	maxShuffleHistory = 500
+)
+
+func validPlayMode(mode string) bool {
+	switch mode {
+	case playModeSequential, playModeShuffle, playModeRepeatOne, playModeOnce:
+		return true
+	}
+	return false
+}
+
+func musicPlayMode() string {
+	confMu.Lock()
+	defer confMu.Unlock()
+	if !validPlayMode(conf.System.MusicPlayMode) {
+		return playModeSequential
+	}
+	return conf.System.MusicPlayMode
+}
+
+func setMusicPlayMode(mode string) error {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if !validPlayMode(mode) {
+		return fmt.Errorf("play mode must be sequential, shuffle, repeat_one or once")
+	}
+	confMu.Lock()
+	conf.System.MusicPlayMode = mode
+	confMu.Unlock()
+
+	musicstateMu.Lock()
+	resetShuffle()
+	musicstateMu.Unlock()
+	return nil
+}
+
+// resetShuffle 清空随机播放历史和分类轮播状态，队列变化时调用，调用方需持有 musicstateMu
+func resetShuffle() {
+	currentQueue.history = nil
+	currentQueue.historyPos = -1
+	currentQueue.bag = nil
+	currentQueue.credits = make(map[string]int)
+	currentQueue.lastInCategory = make(map[string]int)
+}
+
+func indexOfMusicID(queue []MusicFileInfo, id int) int {
+	for i, file := range queue {
+		if file.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectNextMusic 按播放模式选出下一首的下标，调用方需持有 musicstateMu。
+// previous 表示用户按了上一首，skipped 表示用户按了下一首（而不是自然播完）。
+// stop 为 true 表示 once 模式下列表已播放完毕。
+func selectNextMusic(queue []MusicFileInfo, previous, skipped bool) (index int, stop bool) {
+	mode := musicPlayMode()
+	defer func() {
+		// 记下各分类播放到哪里，手动切歌后分类轮播从这里继续
+		if index >= 0 {
+			currentQueue.lastInCategory[queue[index].Category] = queue[index].ID
+		}
+	}()
+
+	// 0. Check for manual override
+	if manualNextID != -1 {
+		index = indexOfMusicID(queue, manualNextID)
+		// Reset manual override
+		manualNextID = -1
+		if index >= 0 {
+			if mode == playModeShuffle {
+				pushShuffleHistory(queue[index].ID)
+			}
+			return index, false
+		}
+	}
+
+	switch mode {
+	case playModeRepeatOne:
+		// 自然播完时重复当前曲目，手动切歌仍按顺序
+		if !previous && !skipped {
+			if index = indexOfMusicID(queue, currentPlayingID); index >= 0 {
+				return index, false
+			}
+		}
+	case playModeShuffle:
+		return shuffleMusicIndex(queue, previous), false
+	case playModeSequential:
+		if weights := categoryWeights(queue); weights != nil && !previous {
+			return categoryMusicIndex(queue, weights, true), false
+		}
+	}
+
+	index, wrapped := sequentialMusicIndex(queue, previous)
+	stop = mode == playModeOnce && wrapped && !previous && !skipped && currentPlayingID != -1
+	return index, stop
+}
+
+// sequentialMusicIndex 找到编号上的下一首（或上一首），wrapped 表示回绕到了列表另一端
+func sequentialMusicIndex(queue []MusicFileInfo, previous bool) (index int, wrapped bool) {
+	index = -1
+	// 1. 尝试找到比当前 ID 大的最小 ID（上一首为比当前 ID 小的最大 ID）
+	for i, file := range queue {
+		if currentPlayingID != -1 {
+			if previous && file.ID >= currentPlayingID || !previous && file.ID <= currentPlayingID {
+				continue
+			}
+		}
+		if index == -1 || previous && file.ID > queue[index].ID || !previous && file.ID < queue[index].ID {
+			index = i
+		}
+	}
+	if index != -1 {
+		return index, false
+	}
+
+	// 2. 如果没找到（说明当前 ID 已经是最大(Next)或最小(Prev)），回绕到另一端
+	for i, file := range queue {
+		if index == -1 || previous && file.ID > queue[index].ID || !previous && file.ID < queue[index].ID {
+			index = i
+		}
+	}
+	return index, true
+}
+
+// shuffleMusicIndex 随机选歌：上一首/下一首先在历史中移动，历史走完后
+// 从本轮未播放的曲目中随机抽取，全部播完后开始新一轮。
+func shuffleMusicIndex(queue []MusicFileInfo, previous bool) int {
+	q := &currentQueue
+	if previous {
+		for q.historyPos > 0 {
+			q.historyPos--
+			if index := indexOfMusicID(queue, q.history[q.historyPos]); index >= 0 {
+				return index
+			}
+		}
+		// 没有更早的历史，重播当前曲目
+		if index := indexOfMusicID(queue, currentPlayingID); index >= 0 {
+			return index
+		}
+	}
+
+	for q.historyPos+1 < len(q.history) {
+		q.historyPos++
+		if index := indexOfMusicID(queue, q.history[q.historyPos]); index >= 0 {
+			return index
+		}
+	}
+
+	index := drawShuffle(queue)
+	pushShuffleHistory(queue[index].ID)
+	return index
+}
+
+// drawShuffle 从本轮未播放的曲目中随机抽取一首并移出 bag，全部播完后开始新一轮。
+// 分类权重不同时先按权重选出分类，只在该分类中抽取，分类播完后单独开始新一轮。
+func drawShuffle(queue []MusicFileInfo) int {
+	q := &currentQueue
+	inRound := func(MusicFileInfo) bool { return true }
+	if weights := categoryWeights(queue); weights != nil {
+		category := pickCategory(weights, q.credits)
+		inRound = func(file MusicFileInfo) bool { return file.Category == category }
+	}
+
+	// 去掉已删除的曲目，找出可以抽取的位置
+	var candidates []int
+	bag := q.bag[:0]
+	for _, id := range q.bag {
+		if index := indexOfMusicID(queue, id); index >= 0 {
+			if inRound(queue[index]) {
+				candidates = append(candidates, len(bag))
+			}
+			bag = append(bag, id)
+		}
+	}
+	q.bag = bag
+	if len(candidates) == 0 {
+		var round []int
+		for _, file := range queue {
+			if inRound(file) {
+				round = append(round, file.ID)
+			}
+		}
+		for _, id := range round {
+			// 新一轮的第一首不与刚播完的曲目重复
+			if id != currentPlayingID || len(round) == 1 {
+				candidates = append(candidates, len(q.bag))
+				q.bag = append(q.bag, id)
+			}
+		}
+	}
+
+	pick := candidates[q.rnd.Intn(len(candidates))]
+	id := q.bag[pick]
+	q.bag = append(q.bag[:pick], q.bag[pick+1:]...)
+	return indexOfMusicID(queue, id)
+}
+
+// peekNextMusic 返回当前曲目自然播完后 selectNextMusic 会选中的曲目，用于预加载，
+// 调用方需持有 musicstateMu。随机模式下抽中的曲目记为“前进”方向的历史，
+// 之后切到下一首时会选中同一首，上一首不受影响。
+// 返回 -1 表示不预加载：有待处理的点播，或 once 模式已播到列表末尾。
+func peekNextMusic(queue []MusicFileInfo) int {
+	if manualNextID != -1 || len(queue) == 0 {
+		return -1
+	}
+	mode := musicPlayMode()
+	switch mode {
+	case playModeRepeatOne:
+		if index := indexOfMusicID(queue, currentPlayingID); index >= 0 {
+			return index
+		}
+	case playModeSequential:
+		if weights := categoryWeights(queue); weights != nil {
+			return categoryMusicIndex(queue, weights, false)
+		}
+	case playModeShuffle:
+		q := &currentQueue
+		for q.historyPos+1 < len(q.history) {
+			if index := indexOfMusicID(queue, q.history[q.historyPos+1]); index >= 0 {
+				return index
+			}
+			// 曲目已被删除
+			q.history = append(q.history[:q.historyPos+1], q.history[q.historyPos+2:]...)
+		}
+		index := drawShuffle(queue)
+		q.history = append(q.history, queue[index].ID)
+		return index
+	}
+	index, wrapped := sequentialMusicIndex(queue, false)
+	if mode == playModeOnce && wrapped && currentPlayingID != -1 {
+		return -1
+	}
+	return index
+}
+
+// pushShuffleHistory 把 id 记为当前曲目，丢弃“前进”方向的历史并从本轮待播中移除
+func pushShuffleHistory(id int) {
+	q := &currentQueue
+	q.history = append(q.history[:q.historyPos+1], id)
+	if len(q.history) > maxShuffleHistory {
+		q.history = q.history[len(q.history)-maxShuffleHistory:]
+	}
+	q.historyPos = len(q.history) - 1
+	for i, bagID := range q.bag {
+		if bagID == id {
+			q.bag = append(q.bag[:i], q.bag[i+1:]...)
+			break
+		}
+	}
+}
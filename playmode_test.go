@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func withPlayMode(t *testing.T, mode string, ids ...int) []MusicFileInfo {
+	t.Helper()
+	oldMode, oldQueue, oldPlaying, oldManual := conf.System.MusicPlayMode, currentQueue, currentPlayingID, manualNextID
+	t.Cleanup(func() {
+		conf.System.MusicPlayMode, currentQueue, currentPlayingID, manualNextID = oldMode, oldQueue, oldPlaying, oldManual
+	})
+	conf.System.MusicPlayMode = mode
+	currentQueue = MusicQueue{rnd: rand.New(rand.NewSource(1))}
+	resetShuffle()
+	currentPlayingID, manualNextID = -1, -1
+
+	queue := make([]MusicFileInfo, len(ids))
+	for i, id := range ids {
+		queue[i] = MusicFileInfo{ID: id}
+	}
+	return queue
+}
+
+func playNext(queue []MusicFileInfo, previous, skipped bool) (int, bool) {
+	index, stop := selectNextMusic(queue, previous, skipped)
+	currentPlayingID = queue[index].ID
+	return currentPlayingID, stop
+}
+
+func TestShufflePlaysEachTrackOncePerRound(t *testing.T) {
+	queue := withPlayMode(t, playModeShuffle, 1, 2, 3, 4, 5)
+	var played []int
+	seen := make(map[int]bool)
+	for range queue {
+		id, _ := playNext(queue, false, false)
+		if seen[id] {
+			t.Fatalf("track %d repeated within a round: %v", id, played)
+		}
+		seen[id] = true
+		played = append(played, id)
+	}
+
+	// 上一首沿历史后退，下一首再沿历史前进
+	if id, _ := playNext(queue, true, false); id != played[3] {
+		t.Fatalf("previous = %d, want %d", id, played[3])
+	}
+	if id, _ := playNext(queue, true, false); id != played[2] {
+		t.Fatalf("previous = %d, want %d", id, played[2])
+	}
+	if id, _ := playNext(queue, false, true); id != played[3] {
+		t.Fatalf("next = %d, want %d", id, played[3])
+	}
+	if id, _ := playNext(queue, false, true); id != played[4] {
+		t.Fatalf("next = %d, want %d", id, played[4])
+	}
+	// 新一轮不会立即重复刚播完的曲目
+	if id, _ := playNext(queue, false, false); id == played[4] {
+		t.Fatalf("new round started with the last track %d", id)
+	}
+}
+
+func TestOnceAndRepeatOneModes(t *testing.T) {
+	queue := withPlayMode(t, playModeOnce, 1, 2, 3)
+	for _, want := range []int{1, 2, 3} {
+		if id, stop := playNext(queue, false, false); id != want || stop {
+			t.Fatalf("once: got %d stop=%v, want %d", id, stop, want)
+		}
+	}
+	if id, stop := playNext(queue, false, false); id != 1 || !stop {
+		t.Fatalf("once at end: got %d stop=%v, want 1 stop", id, stop)
+	}
+
+	queue = withPlayMode(t, playModeRepeatOne, 1, 2, 3)
+	playNext(queue, false, false)
+	if id, _ := playNext(queue, false, false); id != 1 {
+		t.Fatalf("repeat_one replayed %d, want 1", id)
+	}
+	if id, _ := playNext(queue, false, true); id != 2 {
+		t.Fatalf("repeat_one next = %d, want 2", id)
+	}
+	if id, _ := playNext(queue, true, false); id != 1 {
+		t.Fatalf("repeat_one previous = %d, want 1", id)
+	}
+}
+
+func TestPeekNextMatchesSelection(t *testing.T) {
+	queue := withPlayMode(t, playModeShuffle, 1, 2, 3, 4, 5, 6)
+	playNext(queue, false, false)
+	playNext(queue, false, false)
+	for i := 0; i < 10; i++ {
+		peeked := queue[peekNextMusic(queue)].ID
+		if again := queue[peekNextMusic(queue)].ID; again != peeked {
+			t.Fatalf("peek changed from %d to %d", peeked, again)
+		}
+		if id, _ := playNext(queue, false, false); id != peeked {
+			t.Fatalf("played %d after peeking %d", id, peeked)
+		}
+	}
+	// 预加载不影响上一首
+	before := currentQueue.history[currentQueue.historyPos-1]
+	peekNextMusic(queue)
+	if id, _ := playNext(queue, true, false); id != before {
+		t.Fatalf("previous after peek = %d, want %d", id, before)
+	}
+
+	queue = withPlayMode(t, playModeOnce, 1, 2)
+	playNext(queue, false, false)
+	if index := peekNextMusic(queue); queue[index].ID != 2 {
+		t.Fatalf("once peek = %d, want 2", queue[index].ID)
+	}
+	playNext(queue, false, false)
+	if index := peekNextMusic(queue); index != -1 {
+		t.Fatalf("once peek at the end = %d, want -1", index)
+	}
+}
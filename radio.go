@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -22,18 +24,43 @@ import (
 	"github.com/hajimehoshi/go-mp3"
 )
 
-// RadioStation is a saved internet radio source. MP3 and AAC-LC HLS streams
-// are decoded inside this process; no external media program is required.
+// RadioStation is a saved internet radio source. MP3, ADTS AAC, Ogg
+// Opus/Vorbis, FLAC and AAC-LC HLS streams are decoded inside this process;
+// no external media program is required.
 type RadioStation struct {
-	ID   string `yaml:"ID" json:"id"`
-	Name string `yaml:"Name" json:"name"`
-	URL  string `yaml:"URL" json:"url"`
+	ID              string `yaml:"ID" json:"id"`
+	Name            string `yaml:"Name" json:"name"`
+	URL             string `yaml:"URL" json:"url"`
+	RadioHLSOptions `yaml:",inline"`
 }
 
+// RadioHLSOptions choose among the variants of a multi-bitrate HLS station.
+// Zero values play the highest bitrate with the default audio rendition.
+type RadioHLSOptions struct {
+	MaxBandwidth   int    `yaml:"MaxBandwidth,omitempty" json:"max_bandwidth,omitempty"`     // highest variant bitrate in kbit/s, 0 for no limit
+	AudioRendition string `yaml:"AudioRendition,omitempty" json:"audio_rendition,omitempty"` // audio LANGUAGE or NAME to prefer
+	AutoDownshift  bool   `yaml:"AutoDownshift,omitempty" json:"auto_downshift,omitempty"`   // switch to a lower variant after repeated stalls
+}
+
+// Causes a radio session is cancelled with. runRadio logs the session as
+// interrupted for errRadioStopped, the operator stopping or changing the
+// station, but not for errRadioSessionEnded, a session that ran its course
+// such as a scheduled program whose window is over.
+var (
+	errRadioStopped      = errors.New("network radio stopped")
+	errRadioSessionEnded = errors.New("network radio session ended")
+)
+
 var radioState = struct {
 	sync.RWMutex
-	cancel context.CancelFunc
-	status string
+	cancel  context.CancelCauseFunc
+	status  string
+	station RadioStation // station being played
+	title   string       // song title announced by the stream, if any
+	variant string       // HLS variant being played, if any
+	hlsCap  int          // HLS bandwidth limit in bit/s after a downshift, 0 for none
+	alert   string       // last watchdog fallback, kept until a station is started
+	alertAt time.Time
 }{status: "stopped"}
 
 func validateRadioURL(rawURL string) (string, error) {
@@ -45,7 +72,9 @@ func validateRadioURL(rawURL string) (string, error) {
 	return parsed.String(), nil
 }
 
-func saveRadioStation(id, name, rawURL string) (RadioStation, error) {
+// saveRadioStation adds a station (empty id) or updates one. A nil hls keeps
+// the HLS options of an existing station.
+func saveRadioStation(id, name, rawURL string, hls *RadioHLSOptions) (RadioStation, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
 		return RadioStation{}, fmt.Errorf("radio station name is required")
@@ -57,12 +86,20 @@ func saveRadioStation(id, name, rawURL string) (RadioStation, error) {
 	if err != nil {
 		return RadioStation{}, err
 	}
+	if hls != nil {
+		if err := validateRadioHLSOptions(hls); err != nil {
+			return RadioStation{}, err
+		}
+	}
 
 	confMu.Lock()
 	defer confMu.Unlock()
 	if id == "" {
 		id = "radio-" + strconv.FormatInt(time.Now().UnixNano(), 36)
 		station := RadioStation{ID: id, Name: name, URL: cleanURL}
+		if hls != nil {
+			station.RadioHLSOptions = *hls
+		}
 		conf.System.RadioStations = append(conf.System.RadioStations, station)
 		return station, nil
 	}
@@ -70,12 +107,26 @@ func saveRadioStation(id, name, rawURL string) (RadioStation, error) {
 		if conf.System.RadioStations[i].ID == id {
 			conf.System.RadioStations[i].Name = name
 			conf.System.RadioStations[i].URL = cleanURL
+			if hls != nil {
+				conf.System.RadioStations[i].RadioHLSOptions = *hls
+			}
 			return conf.System.RadioStations[i], nil
 		}
 	}
 	return RadioStation{}, fmt.Errorf("radio station not found")
 }
 
+func validateRadioHLSOptions(hls *RadioHLSOptions) error {
+	hls.AudioRendition = strings.TrimSpace(hls.AudioRendition)
+	if hls.MaxBandwidth < 0 || hls.MaxBandwidth > 100000 {
+		return fmt.Errorf("radio max bandwidth must be between 0 and 100000 kbit/s")
+	}
+	if len(hls.AudioRendition) > 64 {
+		return fmt.Errorf("radio audio rendition is too long")
+	}
+	return nil
+}
+
 func deleteRadioStation(id string) error {
 	if id == "" {
 		return fmt.Errorf("radio station id is required")
@@ -103,7 +154,7 @@ func deleteRadioStation(id string) error {
 		return fmt.Errorf("radio station not found")
 	}
 	if active {
-		stopRadioProcess()
+		stopRadioProcess(errRadioStopped)
 	}
 	return nil
 }
@@ -134,6 +185,90 @@ func setRadioStatus(status string) {
 	radioState.Unlock()
 }
 
+// currentRadioStatus returns the connection status shown to the user.
+func currentRadioStatus() string {
+	radioState.RLock()
+	defer radioState.RUnlock()
+	return radioState.status
+}
+
+// currentRadioStation returns the station being played.
+func currentRadioStation() RadioStation {
+	radioState.RLock()
+	defer radioState.RUnlock()
+	return radioState.station
+}
+
+// radioVariant returns a description of the HLS variant being played.
+func radioVariant() string {
+	radioState.RLock()
+	defer radioState.RUnlock()
+	return radioState.variant
+}
+
+// radioAlert returns the last watchdog fallback message and its time.
+func radioAlert() (string, time.Time) {
+	radioState.RLock()
+	defer radioState.RUnlock()
+	return radioState.alert, radioState.alertAt
+}
+
+// setRadioAlert records a watchdog fallback and pushes it to the live pages.
+func setRadioAlert(message string) {
+	radioState.Lock()
+	radioState.alert, radioState.alertAt = message, time.Now()
+	station, title := radioState.station.Name, radioState.title
+	radioState.Unlock()
+	liveHub.NotifyRadio(station, title, message)
+}
+
+func setRadioVariant(ctx context.Context, variant string) {
+	if probe := radioProbeFrom(ctx); probe != nil {
+		probe.mu.Lock()
+		probe.report.Variant = variant
+		probe.mu.Unlock()
+		return
+	}
+	radioState.Lock()
+	radioState.variant = variant
+	radioState.Unlock()
+}
+
+// radioTitle returns the song title last announced by the playing stream.
+func radioTitle() string {
+	radioState.RLock()
+	defer radioState.RUnlock()
+	return radioState.title
+}
+
+// setRadioTitle records a song title from ICY StreamTitle metadata or HLS
+// #EXTINF tags and pushes it to the live pages. Titles from a stream whose
+// context has been cancelled are ignored.
+func setRadioTitle(ctx context.Context, title string) {
+	title = strings.TrimSpace(title)
+	if probe := radioProbeFrom(ctx); probe != nil {
+		probe.mu.Lock()
+		probe.report.Title = title
+		probe.mu.Unlock()
+		return
+	}
+	radioState.Lock()
+	if ctx.Err() != nil || title == radioState.title {
+		radioState.Unlock()
+		return
+	}
+	radioState.title = title
+	station, alert := radioState.station.Name, radioState.alert
+	radioState.Unlock()
+
+	if title != "" {
+		log.Printf("network radio now playing: %s", title)
+		setAirlogTitle("radio", station+" - "+title)
+		radioRecord.mark(title, time.Now())
+	}
+	liveHub.NotifyRadio(station, title, alert)
+}
+
 func startRadioFromConfig() {
 	confMu.Lock()
 	activeID := conf.System.RadioActiveID
@@ -148,9 +283,16 @@ func startRadioFromConfig() {
 			saveConfig()
 		}
 	}
+	go runRadioSchedule()
 }
 
 func startRadio(id string) error {
+	return switchRadio(id, errRadioStopped)
+}
+
+// switchRadio starts station id and ends the session playing before it
+// with reason.
+func switchRadio(id string, reason error) error {
 	confMu.Lock()
 	var station RadioStation
 	for _, item := range conf.System.RadioStations {
@@ -168,15 +310,21 @@ func startRadio(id string) error {
 		return err
 	}
 	drainRadioPCM()
+	// A recording belongs to one station.
+	stopRadioRecording()
 
 	radioState.Lock()
 	if radioState.cancel != nil {
-		radioState.cancel()
+		radioState.cancel(reason)
 	}
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancelCause(context.Background())
 	radioState.cancel = cancel
 	radioState.status = "connecting"
+	radioState.station, radioState.title = station, ""
+	radioState.variant, radioState.hlsCap = "", 0
+	radioState.alert = ""
 	radioState.Unlock()
+	liveHub.NotifyRadio(station.Name, "", "")
 
 	confMu.Lock()
 	conf.System.RadioActiveID = station.ID
@@ -190,12 +338,15 @@ func startRadio(id string) error {
 	}
 	saveConfig()
 
-	go runRadio(ctx, station)
+	setAirlogTitle("radio", station.Name)
+	go runRadio(ctx, station, beginAsrun("radio", station.Name, station.URL))
 	return nil
 }
 
-func stopRadio() {
-	stopRadioProcess()
+// stopRadio stops the station and saves it as stopped; reason is
+// errRadioStopped or errRadioSessionEnded.
+func stopRadio(reason error) {
+	stopRadioProcess(reason)
 
 	confMu.Lock()
 	conf.System.RadioPlaying = false
@@ -203,15 +354,19 @@ func stopRadio() {
 	saveConfig()
 }
 
-func stopRadioProcess() {
+func stopRadioProcess(reason error) {
 	radioState.Lock()
 	if radioState.cancel != nil {
-		radioState.cancel()
+		radioState.cancel(reason)
 		radioState.cancel = nil
 	}
 	radioState.status = "stopped"
+	radioState.station, radioState.title = RadioStation{}, ""
+	radioState.variant, radioState.hlsCap = "", 0
 	radioState.Unlock()
+	liveHub.NotifyRadio("", "", "")
 	drainRadioPCM()
+	stopRadioRecording()
 }
 
 func drainRadioPCM() {
@@ -224,9 +379,11 @@ func drainRadioPCM() {
 	}
 }
 
-func switchToLocalMusic() {
+// switchToLocalMusic stops the radio, if it plays, for reason and resumes
+// local music.
+func switchToLocalMusic(reason error) {
 	if isRadioPlaying() {
-		stopRadio()
+		stopRadio(reason)
 	}
 	confMu.Lock()
 	wasPlaying := conf.System.MusicPlaying
@@ -243,33 +400,107 @@ func switchToLocalMusic() {
 	}
 }
 
-func runRadio(ctx context.Context, station RadioStation) {
+func runRadio(ctx context.Context, station RadioStation, onAir *asrunItem) {
+	// One listening session is one as-run entry. It counts as interrupted
+	// when the stream dropped or the operator stopped or changed the
+	// station, like a music track that is skipped.
+	dropped := false
+	defer func() {
+		onAir.finish(dropped || ctx.Err() != nil && !errors.Is(context.Cause(ctx), errRadioSessionEnded))
+	}()
+	failures := 0
 	for {
 		if ctx.Err() != nil {
 			return
 		}
 		setRadioStatus("connecting")
-		err := streamRadio(ctx, station)
+		limits := currentRadioWatchLimits()
+		healthy, err := watchRadio(ctx, station, limits)
 		if ctx.Err() != nil {
 			return
 		}
-		if err != nil {
-			setRadioStatus("reconnecting")
-			log.Printf("network radio %q interrupted: %v; retrying", station.Name, err)
+		dropped = true
+		if healthy {
+			failures = 0
+		}
+		failures++
+		if err == nil {
+			err = io.EOF
+		}
+		if limits.maxFailures > 0 && failures >= limits.maxFailures {
+			radioFallback(station, failures, err, limits.fallbackID)
+			return
 		}
+		delay := radioBackoff(failures)
+		setRadioStatus("reconnecting")
+		log.Printf("network radio %q interrupted: %v; retrying in %v (failure %d)", station.Name, err, delay, failures)
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(3 * time.Second):
+		case <-time.After(delay):
 		}
 	}
 }
 
 func streamRadio(ctx context.Context, station RadioStation) error {
-	if isHLSURL(station.URL) {
-		return streamHLSRadio(ctx, station.URL)
+	return streamRadioURL(ctx, station.URL, 0)
+}
+
+// streamRadioURL plays one URL. Station playlists (PLS, M3U, ASX) are
+// followed to the streams they list; depth counts the playlists followed.
+func streamRadioURL(ctx context.Context, rawURL string, depth int) error {
+	setRadioVariant(ctx, "")
+	resp, err := openRadioStream(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Icecast/SHOUTcast metadata blocks must be removed before the audio
+	// reaches a decoder.
+	var stream io.Reader = resp.Body
+	if metaint := icyMetaint(resp.Header); metaint > 0 {
+		stream = newICYReader(resp.Body, metaint, func(title string) { setRadioTitle(ctx, title) })
+	}
+	if radioProbeFrom(ctx) != nil {
+		stream = radioByteCounter{ctx: ctx, r: stream}
+	}
+
+	// Detect the format from the first bytes, Content-Type and URL; the
+	// buffered reader hands the peeked bytes to the decoder afterwards.
+	// Redirects have been followed, so relative links resolve against the
+	// final URL.
+	body := bufio.NewReaderSize(stream, radioSniffBytes)
+	head, err := body.Peek(radioSniffBytes)
+	if len(head) == 0 && err != nil {
+		return radioReadError(ctx, "radio", err)
+	}
+	finalURL := resp.Request.URL
+	contentType := resp.Header.Get("Content-Type")
+	format := detectRadioFormat(finalURL.String(), contentType, head)
+	log.Printf("network radio stream format: %s (Content-Type %q)", format, contentType)
+	noteRadioStream(ctx, finalURL.String(), format)
+	if format != radioFormatPlaylist && format != radioFormatHLS {
+		// A probe counts the bytes the decoder takes from the buffer.
+		noteRadioBytes(ctx, body.Buffered())
+		defer func() { noteRadioBytes(ctx, -body.Buffered()) }()
+	}
+	switch format {
+	case radioFormatPlaylist:
+		return streamRadioPlaylist(ctx, body, finalURL, depth)
+	case radioFormatHLS:
+		resp.Body.Close()
+		return streamHLSRadio(ctx, finalURL.String())
+	case radioFormatAAC:
+		return streamADTSRadio(ctx, body)
+	case radioFormatOgg:
+		return streamOggRadio(ctx, body)
+	case radioFormatFLAC:
+		return streamFLACRadio(ctx, body)
+	default:
+		noteRadioCodec(ctx, "MP3", 0, mp3FrameChannels(head))
+		return streamMP3Radio(ctx, body)
 	}
-	return streamMP3Radio(ctx, station.URL)
 }
 
 var radioHTTPClient = &http.Client{
@@ -289,27 +520,14 @@ func isHLSURL(rawURL string) bool {
 		strings.Contains(strings.ToLower(u.Query().Get("format")), "m3u8")
 }
 
-func streamMP3Radio(ctx context.Context, rawURL string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("User-Agent", "nrlnanny/embedded-radio")
-	resp, err := radioHTTPClient.Do(req)
+func streamMP3Radio(ctx context.Context, body io.Reader) error {
+	decoder, err := mp3.NewDecoder(body)
 	if err != nil {
-		return fmt.Errorf("open MP3 stream: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("open MP3 stream: HTTP %s", resp.Status)
-	}
-
-	decoder, err := mp3.NewDecoder(resp.Body)
-	if err != nil {
-		return fmt.Errorf("decode MP3 stream: %w", err)
+		return radioReadError(ctx, "MP3", err)
 	}
 	writer := newRadioPCMWriter(ctx, decoder.SampleRate())
 	var playbackOnce sync.Once
+	noteRadioCodec(ctx, "MP3", decoder.SampleRate(), 0)
 
 	// go-mp3 emits signed 16-bit little-endian stereo PCM. Read whole sample
 	// groups so an HTTP read boundary can never split a stereo frame.
@@ -326,36 +544,75 @@ func streamMP3Radio(ctx context.Context, rawURL string) error {
 			if err := writer.Write(mono); err != nil {
 				return err
 			}
-			playbackOnce.Do(func() {
-				setRadioStatus("playing")
-				log.Printf("network radio MP3 playback started: %d Hz stereo -> 16 kHz mono", decoder.SampleRate())
-			})
+			radioPlaybackStarted(ctx, &playbackOnce, "MP3 playback started: %d Hz stereo -> 16 kHz mono", decoder.SampleRate())
 		}
 		if readErr != nil {
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
-			return fmt.Errorf("read MP3 stream: %w", readErr)
+			return radioReadError(ctx, "MP3", readErr)
 		}
 	}
 }
 
+// streamHLSRadio plays an HLS station. For a multivariant playlist the
+// variant and audio rendition are chosen here from the station's HLS
+// options, because gohlslib always takes the highest bitrate; when
+// AutoDownshift is set, repeated stalls move playback to a lower variant.
 func streamHLSRadio(ctx context.Context, rawURL string) error {
+	// A probe uses the defaults rather than the playing station's options.
+	var options RadioHLSOptions
+	probing := radioProbeFrom(ctx) != nil
+	if !probing {
+		options = currentRadioStation().RadioHLSOptions
+	}
+	for {
+		capBits := 0
+		if !probing {
+			radioState.RLock()
+			capBits = radioState.hlsCap
+			radioState.RUnlock()
+		}
+		variant, err := resolveHLSVariant(ctx, rawURL, options, capBits)
+		if err != nil {
+			return radioReadError(ctx, "HLS playlist", err)
+		}
+		setRadioVariant(ctx, variant.label)
+		if variant.label != "" {
+			log.Printf("network radio HLS variant: %s", variant.label)
+		}
+		err = playHLSRadio(ctx, variant.url, options.AutoDownshift && variant.lower > 0)
+		if errors.Is(err, errHLSStalled) {
+			radioState.Lock()
+			radioState.hlsCap = variant.lower
+			radioState.Unlock()
+			log.Printf("network radio HLS keeps stalling at %s; switching to a lower bitrate", variant.label)
+			setRadioStreamStatus(ctx, "connecting")
+			continue
+		}
+		return err
+	}
+}
+
+// playHLSRadio plays one HLS media playlist (or lets gohlslib choose from a
+// multivariant one). With downshift set it gives up with errHLSStalled once
+// the audio has stalled hlsStallLimit times.
+func playHLSRadio(ctx context.Context, rawURL string, downshift bool) error {
 	// gohlslib's default download callbacks log every segment and playlist
 	// refresh. Those are normal HLS activity, not retries, so keep routine
 	// downloads quiet and reserve logs for playback state and real errors.
+	// The same callbacks drive the #EXTINF song titles.
+	titles := newHLSTitleTracker(ctx, func(title string) { setRadioTitle(ctx, title) })
 	c := &gohlslib.Client{
 		URI:                       rawURL,
 		HTTPClient:                radioHTTPClient,
 		OnDownloadPrimaryPlaylist: func(string) {},
-		OnDownloadStreamPlaylist:  func(string) {},
-		OnDownloadSegment:         func(string) {},
+		OnDownloadStreamPlaylist:  titles.playlistDownloaded,
+		OnDownloadSegment:         titles.segmentDownloaded,
 		OnDownloadPart:            func(string) {},
 	}
 	decodeErrors := make(chan error, 1)
 	clientDone := make(chan error, 1)
 	var decoder *waxaac.Decoder
 	var playbackOnce sync.Once
+	var stalls hlsStallCounter
 
 	reportDecodeError := func(err error) {
 		select {
@@ -387,9 +644,11 @@ func streamHLSRadio(ctx context.Context, rawURL string) error {
 				return fmt.Errorf("initialize embedded AAC decoder: %w", err)
 			}
 			log.Printf("network radio HLS track detected: AAC-LC, %d Hz, %d channel(s)", format.Rate, format.Channels)
+			noteRadioCodec(ctx, "AAC", format.Rate, format.Channels)
 			writer := newRadioPCMWriter(ctx, format.Rate)
 			c.OnDataMPEG4Audio(track, func(_ int64, accessUnits [][]byte) {
 				for _, accessUnit := range accessUnits {
+					noteRadioBytes(ctx, len(accessUnit))
 					err := decoder.Decode(accessUnit, func(pcm *audio.Buffer) error {
 						mono := make([]int, pcm.N)
 						for i := range mono {
@@ -402,10 +661,8 @@ func streamHLSRadio(ctx context.Context, rawURL string) error {
 						if err := writer.Write(mono); err != nil {
 							return err
 						}
-						playbackOnce.Do(func() {
-							setRadioStatus("playing")
-							log.Printf("network radio HLS playback started: embedded AAC decoder -> 16 kHz mono")
-						})
+						stalls.audio(time.Now())
+						radioPlaybackStarted(ctx, &playbackOnce, "HLS playback started: embedded AAC decoder -> 16 kHz mono")
 						return nil
 					})
 					if err != nil {
@@ -432,93 +689,75 @@ func streamHLSRadio(ctx context.Context, rawURL string) error {
 	}()
 	go func() { clientDone <- c.Wait2() }()
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-decodeErrors:
-		return err
-	case err := <-clientDone:
-		if err == nil {
-			return io.EOF
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-decodeErrors:
+			return err
+		case err := <-clientDone:
+			if err == nil {
+				return io.EOF
+			}
+			return fmt.Errorf("read HLS stream: %w", err)
+		case now := <-ticker.C:
+			if count, stalled := stalls.check(now); stalled {
+				log.Printf("network radio HLS stalled: no audio for %v (%d stall(s) in %v)", hlsStallTimeout, count, hlsStallWindow)
+				if downshift && count >= hlsStallLimit {
+					return errHLSStalled
+				}
+			}
 		}
-		return fmt.Errorf("read HLS stream: %w", err)
 	}
 }
 
-// radioPCMWriter is a stateful windowed-sinc resampler. Keeping an absolute
-// phase and overlap between decoder blocks avoids clicks and timing drift at
+// radioPCMWriter resamples decoder blocks with a pcmResampler, which keeps
+// the phase and overlap between blocks to avoid clicks and timing drift at
 // MP3/AAC frame boundaries (especially 44.1 kHz -> 16 kHz).
 type radioPCMWriter struct {
 	ctx        context.Context
 	sourceRate int
-	buffer     []int
-	base       int64
-	nextNum    int64
+	resampler  *pcmResampler
 	pending    []int
 }
 
 func newRadioPCMWriter(ctx context.Context, sourceRate int) *radioPCMWriter {
-	return &radioPCMWriter{
+	w := &radioPCMWriter{
 		ctx:        ctx,
 		sourceRate: sourceRate,
-		nextNum:    16 * 16000,
 	}
+	if sourceRate > 0 {
+		w.resampler = newPCMResampler(sourceRate, playbackSampleRate)
+	}
+	return w
 }
 
 func (w *radioPCMWriter) Write(samples []int) error {
-	if w.sourceRate <= 0 {
+	if w.resampler == nil {
 		return fmt.Errorf("invalid radio sample rate: %d", w.sourceRate)
 	}
-	w.buffer = append(w.buffer, samples...)
-	const radius = 16
-	cutoff := 0.47
-	if w.sourceRate > 16000 {
-		cutoff *= 16000.0 / float64(w.sourceRate)
-	}
-
-	for {
-		center := w.nextNum / 16000
-		if center+radius >= w.base+int64(len(w.buffer)) {
-			break
-		}
-		fraction := float64(w.nextNum%16000) / 16000
-		var weighted, weightSum float64
-		for tap := -radius + 1; tap <= radius; tap++ {
-			index := center + int64(tap)
-			if index < w.base {
-				continue
-			}
-			distance := float64(tap) - fraction
-			x := 2 * cutoff * distance
-			sinc := 1.0
-			if x != 0 {
-				sinc = math.Sin(math.Pi*x) / (math.Pi * x)
-			}
-			window := 0.5 * (1 + math.Cos(math.Pi*distance/radius))
-			weight := 2 * cutoff * sinc * window
-			weighted += float64(w.buffer[index-w.base]) * weight
-			weightSum += weight
-		}
-		if weightSum != 0 {
-			w.pending = append(w.pending, clampPCM(int(math.Round(weighted/weightSum))))
-		}
-		w.nextNum += int64(w.sourceRate)
-
-		for len(w.pending) >= opusFrameSamples {
-			frame := append([]int(nil), w.pending[:opusFrameSamples]...)
-			w.pending = w.pending[opusFrameSamples:]
-			select {
-			case radioPCM <- [][]int{frame}:
-			case <-w.ctx.Done():
-				return w.ctx.Err()
-			}
+	if probe := radioProbeFrom(w.ctx); probe != nil {
+		probe.mu.Lock()
+		probe.audio += float64(len(samples)) / float64(w.sourceRate)
+		probe.mu.Unlock()
+		return nil
+	}
+	w.pending = w.resampler.Process(samples, w.pending)
+	sent := 0
+	for len(w.pending)-sent >= opusFrameSamples {
+		frame := append([]int(nil), w.pending[sent:sent+opusFrameSamples]...)
+		sent += opusFrameSamples
+		select {
+		case radioPCM <- [][]int{frame}:
+			now := time.Now()
+			radioWatch.frame(frame, now)
+			radioRecord.write(frame, now)
+		case <-w.ctx.Done():
+			return w.ctx.Err()
 		}
 	}
-
-	keepFrom := w.nextNum/16000 - radius
-	if drop := keepFrom - w.base; drop > 0 {
-		w.buffer = w.buffer[drop:]
-		w.base = keepFrom
-	}
+	w.pending = append(w.pending[:0], w.pending[sent:]...)
 	return nil
 }
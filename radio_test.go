@@ -1,10 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/bluenviron/gohlslib/v2/pkg/playlist"
+	"gopkg.in/yaml.v3"
 )
 
 func TestValidateRadioURLSupportsMP3AndM3U8(t *testing.T) {
@@ -75,6 +88,411 @@ func TestRadioPCMWriterProducesNRLFrames(t *testing.T) {
 	}
 }
 
+func TestDetectRadioFormat(t *testing.T) {
+	adts := []byte{0xff, 0xf1, 0x50, 0x80, 0x02, 0x1f, 0xfc}
+	adtsFrames := append(append(append([]byte(nil), adts...), make([]byte, 16-len(adts))...), adts...)
+	tests := []struct {
+		name        string
+		contentType string
+		head        []byte
+		want        string
+	}{
+		{"ogg bytes win over content type", "audio/mpeg", []byte("OggS\x00\x02"), radioFormatOgg},
+		{"flac", "application/octet-stream", []byte("fLaC\x00\x00\x00\x22"), radioFormatFLAC},
+		{"hls playlist", "text/plain", []byte("#EXTM3U\n#EXT-X-VERSION:3\n"), radioFormatHLS},
+		{"mp3 frame", "", []byte{0xff, 0xfb, 0x90, 0x64, 0, 0, 0, 0}, radioFormatMP3},
+		{"adts frames", "audio/mpeg", adtsFrames, radioFormatAAC},
+		{"mp3 after id3", "audio/aac", append([]byte("ID3\x04\x00\x00\x00\x00\x00\x02\x00\x00"), 0xff, 0xfb, 0x90, 0x64, 0, 0, 0, 0), radioFormatMP3},
+		{"extended m3u of streams", "audio/x-mpegurl", []byte("#EXTM3U\n#EXTINF:-1,Radio\nhttp://a/live\n"), radioFormatPlaylist},
+		{"plain m3u", "text/plain", []byte("http://a/live\r\n"), radioFormatPlaylist},
+		{"pls", "text/plain", []byte("[playlist]\nFile1=http://a/live\n"), radioFormatPlaylist},
+		{"asx", "text/xml", []byte("<?xml version=\"1.0\"?>\n<ASX version=\"3.0\">"), radioFormatPlaylist},
+		{"aac content type", "audio/aacp", []byte("unknown"), radioFormatAAC},
+		{"ogg content type with parameters", "application/ogg; charset=binary", nil, radioFormatOgg},
+		{"default mp3", "", nil, radioFormatMP3},
+	}
+	for _, test := range tests {
+		if got := detectRadioFormat("http://radio.example/live", test.contentType, test.head); got != test.want {
+			t.Errorf("%s: format = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDetectRadioFormatFromURL(t *testing.T) {
+	tests := map[string]string{
+		"http://a/listen.pls":          radioFormatPlaylist,
+		"http://a/live.m3u8?token=1":   radioFormatHLS,
+		"http://a/play?format=m3u8":    radioFormatHLS,
+		"http://a/stream.opus":         radioFormatOgg,
+		"http://a/stream":              radioFormatMP3,
+		"https://a/radio.asx#fragment": radioFormatPlaylist,
+	}
+	for rawURL, want := range tests {
+		if got := detectRadioFormat(rawURL, "application/octet-stream", nil); got != want {
+			t.Errorf("detectRadioFormat(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestParseRadioPlaylist(t *testing.T) {
+	base, _ := url.Parse("https://radio.example/dir/listen.pls")
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"pls", "[playlist]\nNumberOfEntries=2\nFile2=http://b.example/live\nTitle1=Main\nFile1=http://a.example:8000/live\n", []string{"http://a.example:8000/live", "http://b.example/live"}},
+		{"m3u relative", "#EXTM3U\n#EXTINF:-1,Radio\nlive.mp3\n/root.aac\nlive.mp3\n", []string{"https://radio.example/dir/live.mp3", "https://radio.example/root.aac"}},
+		{"asx", `<ASX version="3.0"><Entry><Ref href="mms://a.example/live"/><REF HREF="http://a.example/live?x=1&amp;y=2" /></Entry><ENTRYREF href='more.asx'/></ASX>`, []string{"http://a.example/live?x=1&y=2", "https://radio.example/dir/more.asx"}},
+	}
+	for _, test := range tests {
+		got, err := parseRadioPlaylist([]byte(test.data), base)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: urls = %q, want %q", test.name, got, test.want)
+		}
+	}
+	if _, err := parseRadioPlaylist([]byte("[playlist]\nFile1=rtsp://a/live\n"), base); err == nil {
+		t.Error("playlist without http(s) streams accepted")
+	}
+}
+
+func TestStreamRadioPlaylistFailsOver(t *testing.T) {
+	drainRadioPCM()
+	t.Cleanup(drainRadioPCM)
+	opus := encodeTestOpus(t, 25)
+	var requests []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/station":
+			http.Redirect(w, r, "/listen.pls", http.StatusFound)
+		case "/listen.pls":
+			w.Header().Set("Content-Type", "audio/x-scpls")
+			io.WriteString(w, "[playlist]\nFile1=/offline\nFile2=stream.opus\n")
+		case "/stream.opus":
+			w.Header().Set("Content-Type", "application/ogg")
+			w.Write(opus)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	radioState.Lock()
+	radioState.status = "connecting"
+	radioState.Unlock()
+	t.Cleanup(func() { setRadioStatus("stopped") })
+	errCh := make(chan error, 1)
+	go func() { errCh <- streamRadioURL(context.Background(), server.URL+"/station", 0) }()
+	frames := 0
+	for {
+		select {
+		case <-radioPCM:
+			frames++
+			continue
+		case err := <-errCh:
+			// 播放过的流结束后交回 runRadio 重连，不再尝试后面的地址
+			if err == nil || !strings.Contains(err.Error(), "no Ogg stream found") {
+				t.Fatalf("stream ended with %v", err)
+			}
+		}
+		break
+	}
+	frames += len(radioPCM)
+	if frames == 0 {
+		t.Fatal("no audio from the second playlist entry")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(requests, " "); got != "/station /listen.pls /offline /stream.opus" {
+		t.Fatalf("requests = %s", got)
+	}
+}
+
+const testHLSMaster = `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en-US",DEFAULT=YES,AUTOSELECT=YES,URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Deutsch",LANGUAGE="de",AUTOSELECT=YES,URI="audio/de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=320000,CODECS="mp4a.40.2",AUDIO="aac"
+hi.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="mp4a.40.2"
+lo.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=128000,CODECS="mp4a.40.2"
+mid.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=900000,CODECS="avc1.64001f"
+video.m3u8
+`
+
+func TestPickHLSVariant(t *testing.T) {
+	var master playlist.Multivariant
+	if err := master.Unmarshal([]byte(testHLSMaster)); err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://radio.example/live/master.m3u8")
+	tests := []struct {
+		name    string
+		options RadioHLSOptions
+		capBits int
+		url     string
+		label   string
+		lower   int
+	}{
+		{"highest with default rendition", RadioHLSOptions{}, 0, "https://radio.example/live/audio/en.m3u8", "320 kbps (3/3), English [en-US]", 319999},
+		{"rendition by language", RadioHLSOptions{AudioRendition: "DE"}, 0, "https://radio.example/live/audio/de.m3u8", "320 kbps (3/3), Deutsch [de]", 319999},
+		{"language prefix", RadioHLSOptions{AudioRendition: "en"}, 0, "https://radio.example/live/audio/en.m3u8", "320 kbps (3/3), English [en-US]", 319999},
+		{"max bandwidth", RadioHLSOptions{MaxBandwidth: 200}, 0, "https://radio.example/live/mid.m3u8", "128 kbps (2/3)", 127999},
+		{"downshift limit", RadioHLSOptions{MaxBandwidth: 200}, 127999, "https://radio.example/live/lo.m3u8", "64 kbps (1/3)", 0},
+		{"nothing fits", RadioHLSOptions{MaxBandwidth: 32}, 0, "https://radio.example/live/lo.m3u8", "64 kbps (1/3)", 0},
+	}
+	for _, test := range tests {
+		got, err := pickHLSVariant(&master, base, test.options, test.capBits)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got.url != test.url || got.label != test.label || got.lower != test.lower {
+			t.Errorf("%s: got %+v, want url %s label %q lower %d", test.name, got, test.url, test.label, test.lower)
+		}
+	}
+}
+
+func TestHLSStallCounter(t *testing.T) {
+	var counter hlsStallCounter
+	start := time.Unix(1000, 0)
+	if _, stalled := counter.check(start.Add(time.Minute)); stalled {
+		t.Fatal("stall reported before any audio")
+	}
+	counter.audio(start)
+	if _, stalled := counter.check(start.Add(2 * time.Second)); stalled {
+		t.Fatal("short gap reported as a stall")
+	}
+	if count, stalled := counter.check(start.Add(4 * time.Second)); !stalled || count != 1 {
+		t.Fatalf("first stall = %d, %v", count, stalled)
+	}
+	if _, stalled := counter.check(start.Add(9 * time.Second)); stalled {
+		t.Fatal("one long gap counted twice")
+	}
+	counter.audio(start.Add(10 * time.Second))
+	if count, stalled := counter.check(start.Add(14 * time.Second)); !stalled || count != 2 {
+		t.Fatalf("second stall = %d, %v", count, stalled)
+	}
+	// 超出统计窗口的卡顿不再计数
+	counter.audio(start.Add(5 * time.Minute))
+	if count, stalled := counter.check(start.Add(5*time.Minute + 4*time.Second)); !stalled || count != 1 {
+		t.Fatalf("stall after the window = %d, %v", count, stalled)
+	}
+}
+
+func TestRadioHLSOptionsInConfig(t *testing.T) {
+	station := RadioStation{ID: "radio-1", Name: "News", URL: "https://radio.example/master.m3u8",
+		RadioHLSOptions: RadioHLSOptions{MaxBandwidth: 96, AudioRendition: "en", AutoDownshift: true}}
+	data, err := yaml.Marshal(station)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded RadioStation
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != station || !strings.Contains(string(data), "MaxBandwidth: 96") {
+		t.Fatalf("YAML round trip = %+v from\n%s", decoded, data)
+	}
+	if data, _ := yaml.Marshal(RadioStation{ID: "radio-2"}); strings.Contains(string(data), "AutoDownshift") {
+		t.Fatalf("default HLS options written to the config:\n%s", data)
+	}
+}
+
+// feedRadioWatchdog 以每秒 rate 帧的速度送入 seconds 秒的音频
+func feedRadioWatchdog(w *radioWatchdog, from time.Time, seconds, rate, level int) time.Time {
+	frame := make([]int, opusFrameSamples)
+	for i := range frame {
+		frame[i] = level
+	}
+	now := from
+	for i := 0; i < seconds*rate; i++ {
+		now = from.Add(time.Duration(i) * time.Second / time.Duration(rate))
+		w.frame(frame, now)
+	}
+	return from.Add(time.Duration(seconds) * time.Second)
+}
+
+func TestRadioWatchdog(t *testing.T) {
+	limits := radioWatchLimits{silence: time.Minute, stall: 20 * time.Second}
+	realTime := playbackSampleRate / opusFrameSamples
+	start := time.Unix(1000, 0)
+
+	w := &radioWatchdog{}
+	w.reset(start)
+	if err := w.check(start.Add(10*time.Second), limits); err != nil {
+		t.Fatalf("connecting stream dropped early: %v", err)
+	}
+	if err := w.check(start.Add(20*time.Second), limits); err == nil {
+		t.Fatal("stream without audio not dropped")
+	}
+
+	// 正常出声的流不触发，播放满 1 分钟后视为健康
+	w.reset(start)
+	now := feedRadioWatchdog(w, start, 61, realTime, 1000)
+	if err := w.check(now, limits); err != nil {
+		t.Fatalf("healthy stream dropped: %v", err)
+	}
+	if !w.healthy() {
+		t.Fatal("a minute of audio not reported as healthy")
+	}
+
+	// 供流只有实时一半的速度
+	w.reset(start)
+	now = feedRadioWatchdog(w, start, 31, realTime/2, 1000)
+	if err := w.check(now, limits); err == nil || !strings.Contains(err.Error(), "real time") {
+		t.Fatalf("trickling stream = %v", err)
+	}
+
+	// 持续静音
+	w.reset(start)
+	now = feedRadioWatchdog(w, start, 61, realTime, 10)
+	if err := w.check(now, limits); err == nil || !strings.Contains(err.Error(), "silent") {
+		t.Fatalf("silent stream = %v", err)
+	}
+	if w.healthy() {
+		t.Fatal("silent stream reported as healthy")
+	}
+	if err := w.check(now, radioWatchLimits{}); err != nil {
+		t.Fatalf("disabled checks still fire: %v", err)
+	}
+}
+
+func TestRadioBackoff(t *testing.T) {
+	want := map[int]time.Duration{1: 3 * time.Second, 2: 6 * time.Second, 3: 12 * time.Second, 5: 48 * time.Second, 6: time.Minute, 100: time.Minute}
+	for failures, delay := range want {
+		if got := radioBackoff(failures); got != delay {
+			t.Errorf("radioBackoff(%d) = %v, want %v", failures, got, delay)
+		}
+	}
+}
+
+func TestRadioWatchLimits(t *testing.T) {
+	saved := conf.System
+	defer func() { conf.System = saved }()
+
+	conf.System.RadioSilenceTimeout, conf.System.RadioStallTimeout, conf.System.RadioMaxFailures = 0, 0, 0
+	limits := currentRadioWatchLimits()
+	if limits.silence != time.Minute || limits.stall != 20*time.Second || limits.maxFailures != 5 {
+		t.Fatalf("default limits = %+v", limits)
+	}
+	conf.System.RadioSilenceTimeout, conf.System.RadioStallTimeout, conf.System.RadioMaxFailures = -1, 5, -1
+	conf.System.RadioFallbackID = "radio-2"
+	limits = currentRadioWatchLimits()
+	if limits.silence != 0 || limits.stall != 5*time.Second || limits.maxFailures != 0 || limits.fallbackID != "radio-2" {
+		t.Fatalf("configured limits = %+v", limits)
+	}
+}
+
+func TestParseADTSHeader(t *testing.T) {
+	// AAC-LC，44.1 kHz，立体声，无 CRC，帧长 16 字节
+	header, ok := parseADTSHeader([]byte{0xff, 0xf1, 0x50, 0x80, 0x02, 0x1f, 0xfc})
+	if !ok {
+		t.Fatal("valid ADTS header rejected")
+	}
+	if header.rateIndex != 4 || header.channels != 2 || header.frameLength != 16 || header.headerLength != 7 {
+		t.Fatalf("header = %+v", header)
+	}
+	if asc := header.audioSpecificConfig(); !bytes.Equal(asc, []byte{0x12, 0x10}) {
+		t.Fatalf("AudioSpecificConfig = % x, want 12 10", asc)
+	}
+	if _, ok := parseADTSHeader([]byte{0xff, 0xfb, 0x90, 0x64, 0, 0, 0}); ok {
+		t.Fatal("MP3 frame header accepted as ADTS")
+	}
+}
+
+func TestStreamOggRadioFollowsChainedStreams(t *testing.T) {
+	drainRadioPCM()
+	t.Cleanup(drainRadioPCM)
+	// 两段各 0.5 秒的 Ogg Opus 首尾相接，模拟 Icecast 换曲时的链式流；
+	// 只通过 io.Reader 读取，不能跳转
+	chained := append(encodeTestOpus(t, 25), encodeTestOpus(t, 25)...)
+	body := struct{ io.Reader }{bytes.NewReader(chained)}
+	errCh := make(chan error, 1)
+	go func() { errCh <- streamOggRadio(context.Background(), body) }()
+	samples := 0
+	for {
+		select {
+		case frames := <-radioPCM:
+			samples += len(frames[0])
+			continue
+		case err := <-errCh:
+			if err == nil || !strings.Contains(err.Error(), "no Ogg stream found") {
+				t.Fatalf("stream ended with %v", err)
+			}
+		}
+		break
+	}
+	for len(radioPCM) > 0 {
+		samples += len((<-radioPCM)[0])
+	}
+	// 每段 25 × 20 ms = 8000 个 16 kHz 样本，重采样器留在缓冲中的尾巴不足一帧
+	if want := 2 * 8000; samples < want-2*opusFrameSamples || samples > want {
+		t.Fatalf("decoded %d samples from chained stream, want about %d", samples, want)
+	}
+}
+
+func TestICYReaderStripsMetadata(t *testing.T) {
+	// 每 4 字节音频后插入一个元数据块；长度字节为 0 表示本次没有元数据
+	meta := []byte("StreamTitle='Tom's Diner';StreamUrl='';")
+	meta = append(meta, make([]byte, 48-len(meta))...)
+	var stream []byte
+	stream = append(stream, "abcd"...)
+	stream = append(stream, 3)
+	stream = append(stream, meta...)
+	stream = append(stream, "efgh"...)
+	stream = append(stream, 0)
+	stream = append(stream, "ij"...)
+	var titles []string
+	reader := newICYReader(bytes.NewReader(stream), 4, func(title string) { titles = append(titles, title) })
+	audio, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(audio) != "abcdefghij" {
+		t.Fatalf("audio = %q", audio)
+	}
+	if len(titles) != 1 || titles[0] != "Tom's Diner" {
+		t.Fatalf("titles = %q", titles)
+	}
+}
+
+func TestParseICYStreamTitle(t *testing.T) {
+	if title, ok := parseICYStreamTitle([]byte("StreamTitle='Caf\xe9 Del Mar - Live';")); !ok || title != "Café Del Mar - Live" {
+		t.Fatalf("Latin-1 title = %q, %v", title, ok)
+	}
+	if title, ok := parseICYStreamTitle([]byte("StreamTitle='';\x00\x00")); !ok || title != "" {
+		t.Fatalf("empty title = %q, %v", title, ok)
+	}
+	if _, ok := parseICYStreamTitle([]byte("StreamUrl='x';")); ok {
+		t.Fatal("metadata without StreamTitle reported a title")
+	}
+}
+
+func TestParseEXTINFTitle(t *testing.T) {
+	tests := map[string]string{
+		"Artist - Song": "Artist - Song",
+		`title="Song, Part 2",artist="Artist",url="http://example.com/a"`: "Artist - Song, Part 2",
+		`offset=0 title="Only Title"`:                                     "Only Title",
+		"":                                                                "",
+	}
+	for raw, want := range tests {
+		if got := parseEXTINFTitle(raw); got != want {
+			t.Errorf("parseEXTINFTitle(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
 // TestHLSRadioFixture lets release jobs and field diagnostics validate a live
 // station without baking an unstable third-party URL into the test suite.
 func TestHLSRadioFixture(t *testing.T) {
@@ -119,3 +537,443 @@ func TestHLSRadioFixture(t *testing.T) {
 		}
 	}
 }
+
+func TestRadioProgramWindow(t *testing.T) {
+	loc := time.FixedZone("test", 8*3600)
+	at := func(day, hour, minute int) time.Time { return time.Date(2025, 10, day, hour, minute, 0, 0, loc) } // 2025-10-01 为周三
+
+	weekly := RadioProgram{StationID: "radio-1", Days: []int{3}, Start: "20:00", End: "21:30"}
+	if _, _, ok := weekly.window(at(1, 19, 59)); ok {
+		t.Fatal("window open before its start")
+	}
+	start, end, ok := weekly.window(at(1, 20, 0))
+	if !ok || !start.Equal(at(1, 20, 0)) || !end.Equal(at(1, 21, 30)) {
+		t.Fatalf("Wednesday window = %v-%v, %v", start, end, ok)
+	}
+	if _, _, ok := weekly.window(at(1, 21, 30)); ok {
+		t.Fatal("window still open at its end")
+	}
+	if _, _, ok := weekly.window(at(2, 20, 30)); ok {
+		t.Fatal("window open on Thursday")
+	}
+
+	// 跨午夜的时间段属于开始的那一天
+	overnight := RadioProgram{StationID: "radio-1", Days: []int{3}, Start: "23:00", End: "01:00"}
+	if start, _, ok := overnight.window(at(2, 0, 30)); !ok || !start.Equal(at(1, 23, 0)) {
+		t.Fatalf("overnight window after midnight = %v, %v", start, ok)
+	}
+	if _, _, ok := overnight.window(at(2, 23, 30)); ok {
+		t.Fatal("overnight window open on Thursday")
+	}
+
+	cronProgram := RadioProgram{StationID: "radio-1", Cron: "0 8 * * 1-5", Duration: 30}
+	if start, end, ok := cronProgram.window(at(1, 8, 10)); !ok || !start.Equal(at(1, 8, 0)) || !end.Equal(at(1, 8, 30)) {
+		t.Fatalf("cron window = %v-%v, %v", start, end, ok)
+	}
+	if _, _, ok := cronProgram.window(at(1, 8, 30)); ok {
+		t.Fatal("cron window open after its duration")
+	}
+	if _, _, ok := cronProgram.window(at(4, 8, 10)); ok {
+		t.Fatal("cron window open on Saturday")
+	}
+	cronProgram.Disabled = true
+	if _, _, ok := cronProgram.window(at(1, 8, 10)); ok {
+		t.Fatal("disabled program has a window")
+	}
+
+	// 开始时间比时长更密时取最近一次开始
+	week := 7 * 24 * 60
+	for _, c := range []struct {
+		spec      string
+		now, want time.Time
+	}{
+		{"*/5 * * * *", at(1, 8, 13), at(1, 8, 10)},
+		{"*/5 * * * *", at(1, 8, 10), at(1, 8, 10)},
+		{"* 3 * * *", at(1, 10, 0), at(1, 3, 59)},
+		{"0 8 * * 1", at(1, 8, 0), at(-1, 8, 0)},
+	} {
+		program := RadioProgram{StationID: "radio-1", Cron: c.spec, Duration: week}
+		if start, end, ok := program.window(c.now); !ok || !start.Equal(c.want) || !end.Equal(c.want.AddDate(0, 0, 7)) {
+			t.Errorf("%s at %v: window = %v-%v, %v, want start %v", c.spec, c.now, start, end, ok, c.want)
+		}
+	}
+}
+
+func TestValidateRadioProgram(t *testing.T) {
+	saved := conf.System.RadioStations
+	defer func() { conf.System.RadioStations = saved }()
+	conf.System.RadioStations = []RadioStation{{ID: "radio-1", Name: "News", URL: "https://radio.example/live"}}
+
+	valid := RadioProgram{StationID: "radio-1", Days: []int{5, 1, 5}, Start: "7:30", End: "08:00"}
+	if err := validateRadioProgram(&valid); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(valid.Days, []int{1, 5}) {
+		t.Fatalf("days = %v", valid.Days)
+	}
+	for name, program := range map[string]RadioProgram{
+		"unknown station": {StationID: "radio-2", Start: "07:00", End: "08:00"},
+		"bad time":        {StationID: "radio-1", Start: "24:00", End: "08:00"},
+		"empty window":    {StationID: "radio-1", Start: "08:00", End: "08:00"},
+		"bad weekday":     {StationID: "radio-1", Days: []int{7}, Start: "07:00", End: "08:00"},
+		"bad cron":        {StationID: "radio-1", Cron: "every day", Duration: 30},
+		"no duration":     {StationID: "radio-1", Cron: "0 8 * * *"},
+		"cron and window": {StationID: "radio-1", Cron: "0 8 * * *", Duration: 30, Start: "08:00", End: "09:00"},
+	} {
+		if err := validateRadioProgram(&program); err == nil {
+			t.Errorf("%s: accepted %+v", name, program)
+		}
+	}
+}
+
+func TestCheckRadioSchedule(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	// 电台连接在后台运行，配置读写都要加锁
+	confMu.Lock()
+	saved := conf.System
+	conf.System.RadioStations = []RadioStation{{ID: "radio-1", Name: "Net", URL: server.URL + "/net"}}
+	conf.System.RadioSchedule = []RadioProgram{{ID: "program-1", StationID: "radio-1", Start: "20:00", End: "21:00"}}
+	conf.System.MusicPlaying, conf.System.RadioPlaying = true, false
+	confMu.Unlock()
+	defer func() {
+		stopRadioProcess(errRadioStopped)
+		confMu.Lock()
+		conf.System = saved
+		confMu.Unlock()
+		radioScheduler.run, radioScheduler.started = nil, make(map[string]time.Time)
+	}()
+	musicPlaying := func() bool {
+		confMu.Lock()
+		defer confMu.Unlock()
+		return conf.System.MusicPlaying
+	}
+	day := time.Now()
+	at := func(hour, minute int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	}
+
+	checkRadioSchedule(at(20, 0), false)
+	if !isRadioPlaying() || currentRadioStation().ID != "radio-1" {
+		t.Fatal("program station not started")
+	}
+	if program, end, ok := currentRadioProgram(); !ok || program.ID != "program-1" || !end.Equal(at(21, 0)) {
+		t.Fatalf("current program = %+v until %v, %v", program, end, ok)
+	}
+	checkRadioSchedule(at(21, 0), false)
+	if isRadioPlaying() || !musicPlaying() {
+		t.Fatal("local music not restored after the program")
+	}
+	if _, _, ok := currentRadioProgram(); ok {
+		t.Fatal("program still current after its window")
+	}
+
+	// 同一时间段只处理一次：操作员停掉电台后不再自动开启，结束时也不恢复
+	radioScheduler.started = make(map[string]time.Time)
+	checkRadioSchedule(at(20, 0), false)
+	stopRadio(errRadioStopped)
+	confMu.Lock()
+	conf.System.MusicPlaying = false
+	confMu.Unlock()
+	checkRadioSchedule(at(20, 30), false)
+	if isRadioPlaying() {
+		t.Fatal("program restarted after the operator stopped it")
+	}
+	checkRadioSchedule(at(21, 0), false)
+	if musicPlaying() {
+		t.Fatal("local music restored although the operator changed the source")
+	}
+
+	// 删除的节目不再保留开始记录
+	confMu.Lock()
+	conf.System.RadioSchedule = nil
+	confMu.Unlock()
+	checkRadioSchedule(at(21, 1), false)
+	if len(radioScheduler.started) != 0 {
+		t.Fatalf("started windows of removed programs kept: %v", radioScheduler.started)
+	}
+}
+
+func TestRadioSessionAsrun(t *testing.T) {
+	useTempAsrunDir(t)
+	drainRadioPCM()
+	opus := encodeTestOpus(t, 25)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/ogg")
+		w.Write(opus)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	confMu.Lock()
+	saved := conf.System
+	conf.System.RadioStations = []RadioStation{{ID: "radio-1", Name: "Net", URL: server.URL + "/live"}}
+	conf.System.RadioSchedule = []RadioProgram{{ID: "program-1", StationID: "radio-1", Start: "20:00", End: "21:00"}}
+	conf.System.MusicPlaying, conf.System.RadioPlaying = true, false
+	confMu.Unlock()
+	defer func() {
+		stopRadioProcess(errRadioStopped)
+		drainRadioPCM()
+		confMu.Lock()
+		conf.System = saved
+		confMu.Unlock()
+		radioScheduler.run, radioScheduler.started = nil, make(map[string]time.Time)
+	}()
+	day := time.Now()
+	at := func(hour, minute int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	}
+
+	waitPlaying := func() {
+		t.Helper()
+		for start := time.Now(); currentRadioStatus() != "playing"; time.Sleep(5 * time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("radio status %q, want playing", currentRadioStatus())
+			}
+		}
+	}
+
+	// 节目按时结束不算打断，操作员停止电台算打断
+	checkRadioSchedule(at(20, 0), false)
+	waitPlaying()
+	checkRadioSchedule(at(21, 0), false)
+	if isRadioPlaying() {
+		t.Fatal("program station still playing after its window")
+	}
+	if err := startRadio("radio-1"); err != nil {
+		t.Fatal(err)
+	}
+	waitPlaying()
+	stopRadio(errRadioStopped)
+
+	entries := waitAsrunEntries(t, "radio", 2)
+	if entries[0].Interrupted || !entries[1].Interrupted {
+		t.Fatalf("interrupted flags = %v %v, want false true", entries[0].Interrupted, entries[1].Interrupted)
+	}
+}
+
+func TestRadioRecording(t *testing.T) {
+	dir := t.TempDir()
+	confMu.Lock()
+	saved := conf.System
+	conf.System.RecoderFilePath, conf.System.RadioPlaying = dir, true
+	confMu.Unlock()
+	radioState.Lock()
+	radioState.station, radioState.title = RadioStation{ID: "radio-1", Name: "Sunday Net"}, ""
+	radioState.Unlock()
+	defer func() {
+		stopRadioRecording()
+		confMu.Lock()
+		conf.System = saved
+		confMu.Unlock()
+		radioState.Lock()
+		radioState.station = RadioStation{}
+		radioState.Unlock()
+	}()
+
+	start := time.Now()
+	path, err := startRadioRecording(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := startRadioRecording(time.Time{}); err == nil {
+		t.Fatal("second recording started")
+	}
+	frame := make([]int, opusFrameSamples)
+	for i := range frame {
+		frame[i] = 40000 // 超出 16 位范围时截断
+	}
+	for i := 0; i < 100; i++ { // 2 秒
+		if i == 50 {
+			radioRecord.mark("Artist - Song", start.Add(time.Second))
+		}
+		radioRecord.write(frame, start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+	stopRadioRecording()
+
+	rel, _ := filepath.Rel(dir, path)
+	if want := filepath.Join("radio", start.Format("2006-01-02"), radioRecordFileName("Sunday Net", start)); rel != want {
+		t.Fatalf("recording at %s, want %s", rel, want)
+	}
+	if tm, err := parseTimeFromFilename(filepath.Base(path)); err != nil || tm.Format("150405") != start.Format("150405") {
+		t.Fatalf("start time from %s = %v, %v", filepath.Base(path), tm, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate := binary.LittleEndian.Uint32(data[24:]); rate != playbackSampleRate {
+		t.Fatalf("WAV sample rate = %d", rate)
+	}
+	if size := binary.LittleEndian.Uint32(data[40:]); size != 100*opusFrameSamples*2 {
+		t.Fatalf("WAV data size = %d", size)
+	}
+	if sample := int16(binary.LittleEndian.Uint16(data[44:])); sample != 32767 {
+		t.Fatalf("first sample = %d, want clipped 32767", sample)
+	}
+	timeline, err := readAirlogTimeline(path)
+	if err != nil || len(timeline) != 2 {
+		t.Fatalf("timeline = %+v, %v", timeline, err)
+	}
+	if timeline[1].Offset != 1 || !strings.HasSuffix(timeline[1].Label, "Artist - Song") || !strings.HasSuffix(timeline[0].Label, "Sunday Net") {
+		t.Fatalf("timeline = %+v", timeline)
+	}
+
+	name := "radio/" + filepath.ToSlash(strings.TrimPrefix(rel, "radio"+string(filepath.Separator)))
+	for _, ref := range []string{name, "/recordings/" + name} {
+		if got, err := radioRecordingPath(ref); err != nil || got != path {
+			t.Fatalf("radioRecordingPath(%q) = %q, %v", ref, got, err)
+		}
+	}
+	for _, ref := range []string{"radio/../nrlnanny.yaml", "2025-10-19/BG1ABC_2025-10-19_200000_3s.wav", "radio/missing.wav"} {
+		if _, err := radioRecordingPath(ref); err == nil {
+			t.Fatalf("radioRecordingPath(%q) accepted", ref)
+		}
+	}
+}
+
+func TestParseReplayTime(t *testing.T) {
+	now := time.Date(2025, 10, 19, 20, 30, 0, 0, time.Local)
+	for value, want := range map[string]time.Time{
+		"":                 now,
+		"21:00":            time.Date(2025, 10, 19, 21, 0, 0, 0, time.Local),
+		"08:00":            time.Date(2025, 10, 20, 8, 0, 0, 0, time.Local),
+		"2025-10-26 20:00": time.Date(2025, 10, 26, 20, 0, 0, 0, time.Local),
+	} {
+		if got, err := parseReplayTime(value, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseReplayTime(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseReplayTime("tonight", now); err == nil {
+		t.Error("invalid replay time accepted")
+	}
+}
+
+func TestRadioStationsImportExport(t *testing.T) {
+	confMu.Lock()
+	saved := conf.System.RadioStations
+	conf.System.RadioStations = []RadioStation{
+		{ID: "radio-1", Name: "News", URL: "https://example.com/news.mp3"},
+		{ID: "radio-2", Name: "Jazz", URL: "https://example.com/jazz/index.m3u8", RadioHLSOptions: RadioHLSOptions{MaxBandwidth: 96}},
+	}
+	stations := slices.Clone(conf.System.RadioStations)
+	confMu.Unlock()
+	defer func() {
+		confMu.Lock()
+		conf.System.RadioStations = saved
+		confMu.Unlock()
+	}()
+
+	for _, format := range []string{"json", "m3u", "opml"} {
+		data, _, ext, err := encodeRadioStations(stations, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 导出的文件不指定格式也能读回
+		parsed, err := parseRadioStations(data, "")
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if len(parsed) != 2 || parsed[0].Name != "News" || parsed[1].URL != stations[1].URL {
+			t.Fatalf("%s round trip = %+v", ext, parsed)
+		}
+		if format == "json" && parsed[1].MaxBandwidth != 96 {
+			t.Fatalf("JSON export lost the HLS options: %+v", parsed[1])
+		}
+	}
+
+	opml := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0"><head><title>Stations</title></head><body>
+  <outline text="Talk">
+    <outline type="audio" text="News again" URL="https://example.com/news.mp3"/>
+    <outline type="audio" text="Talk FM" URL=" https://example.com/talk "/>
+    <outline type="link" text="More stations" URL="https://example.com/more.opml"/>
+  </outline>
+  <outline type="audio" text="Talk FM copy" url="https://example.com/talk"/>
+  <outline type="audio" text="Old" URL="mms://example.com/old"/>
+  <outline type="audio" URL="http://music.example.org/live"/>
+</body></opml>`
+	parsed, err := parseRadioStations([]byte(opml), "opml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, skipped := importRadioStations(parsed)
+	// 已收藏的地址、文件内重复的地址和非 http(s) 地址都跳过
+	if len(added) != 2 || skipped != 3 {
+		t.Fatalf("imported %+v, skipped %d", added, skipped)
+	}
+	if added[0].Name != "Talk FM" || added[0].URL != "https://example.com/talk" || added[1].Name != "music.example.org" {
+		t.Fatalf("imported %+v", added)
+	}
+	if added[0].ID == "" || added[0].ID == added[1].ID {
+		t.Fatalf("imported station ids %q and %q", added[0].ID, added[1].ID)
+	}
+	if got, _, _, _ := radioSnapshot(); len(got) != 4 {
+		t.Fatalf("%d stations after import, want 4", len(got))
+	}
+
+	m3u := "#EXTM3U\n#EXTINF:-1 tvg-logo=\"x.png\",Jazz, live\nhttps://example.com/jazz/index.m3u8\nhttps://example.com/new.aac\n"
+	if parsed, err = parseRadioStations([]byte(m3u), "m3u"); err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[0].Name != "Jazz, live" || parsed[1].Name != "" {
+		t.Fatalf("M3U stations = %+v", parsed)
+	}
+	if _, err := parseRadioStations([]byte("#EXTM3U\n"), ""); err == nil {
+		t.Error("empty station list accepted")
+	}
+
+	// 过长的名称在字符边界截断到 100 字节以内
+	added, _ = importRadioStations([]RadioStation{{Name: strings.Repeat("电台", 20), URL: "https://example.com/long"}})
+	if len(added) != 1 || added[0].Name != strings.Repeat("电台", 16)+"电" {
+		t.Fatalf("imported long name %+v", added)
+	}
+}
+
+func TestProbeRadioURL(t *testing.T) {
+	drainRadioPCM()
+	t.Cleanup(drainRadioPCM)
+	opus := encodeTestOpus(t, 25)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/listen.pls":
+			io.WriteString(w, "[playlist]\nFile1=/stream\n")
+		case "/stream":
+			// 像直播流一样发完数据后保持连接
+			w.Header().Set("Content-Type", "application/ogg")
+			w.Write(opus)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	report := probeRadioURL(server.URL+"/listen.pls", time.Second)
+	if report.Error != "" {
+		t.Fatalf("probe failed: %+v", report)
+	}
+	if report.URL != server.URL+"/stream" || report.Format != radioFormatOgg || report.Codec != "Opus" ||
+		report.SampleRate != oggOpusRate || report.Channels != 2 {
+		t.Fatalf("probe report = %+v", report)
+	}
+	// 25 帧 × 20 ms
+	if report.Seconds < 0.4 || report.Seconds > 0.6 || report.Bitrate <= 0 {
+		t.Fatalf("probe decoded %.1f s at %d kbit/s", report.Seconds, report.Bitrate)
+	}
+	if len(radioPCM) > 0 {
+		t.Fatal("probe put audio on air")
+	}
+	if status := currentRadioStatus(); status == "playing" {
+		t.Fatal("probe changed the radio status")
+	}
+
+	report = probeRadioURL(server.URL+"/missing", time.Second)
+	if report.Error == "" || report.Format != "" {
+		t.Fatalf("probe of a missing stream = %+v", report)
+	}
+	if report = probeRadioURL("ftp://example.com/x", time.Second); report.Error == "" {
+		t.Fatal("probe accepted an ftp URL")
+	}
+}
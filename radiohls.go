@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gohlslib/v2/pkg/playlist"
+)
+
+const (
+	// hlsStallTimeout is a gap in decoded HLS audio that counts as a stall.
+	hlsStallTimeout = 3 * time.Second
+	// hlsStallLimit stalls within hlsStallWindow trigger a downshift.
+	hlsStallLimit  = 3
+	hlsStallWindow = 2 * time.Minute
+)
+
+var errHLSStalled = errors.New("HLS stream keeps stalling")
+
+// hlsVariant is the media playlist chosen from an HLS station.
+type hlsVariant struct {
+	url   string
+	label string // shown in the radio status, empty for a plain media playlist
+	lower int    // bandwidth limit in bit/s that selects a lower variant, 0 if none
+}
+
+// resolveHLSVariant fetches an HLS playlist and, when it is a multivariant
+// playlist, picks the variant and audio rendition to play. capBits is a
+// bandwidth limit left by an earlier downshift.
+func resolveHLSVariant(ctx context.Context, rawURL string, options RadioHLSOptions, capBits int) (hlsVariant, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return hlsVariant{}, err
+	}
+	req.Header.Set("User-Agent", "nrlnanny/embedded-radio")
+	resp, err := radioHTTPClient.Do(req)
+	if err != nil {
+		return hlsVariant{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return hlsVariant{}, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return hlsVariant{}, err
+	}
+	parsed, err := playlist.Unmarshal(data)
+	if err != nil {
+		return hlsVariant{}, err
+	}
+	master, ok := parsed.(*playlist.Multivariant)
+	if !ok {
+		return hlsVariant{url: resp.Request.URL.String()}, nil
+	}
+	return pickHLSVariant(master, resp.Request.URL, options, capBits)
+}
+
+// pickHLSVariant chooses the highest-bandwidth AAC variant within the
+// station's MaxBandwidth and the downshift limit, or the lowest one when
+// none fits. If the variant takes its audio from a rendition group, the
+// rendition matching AudioRendition (LANGUAGE or NAME), else the default
+// one, is played on its own.
+func pickHLSVariant(master *playlist.Multivariant, base *url.URL, options RadioHLSOptions, capBits int) (hlsVariant, error) {
+	var candidates []*playlist.MultivariantVariant
+	for _, variant := range master.Variants {
+		if len(variant.Codecs) == 0 || slices.ContainsFunc(variant.Codecs, func(codec string) bool {
+			return strings.HasPrefix(strings.ToLower(codec), "mp4a")
+		}) {
+			candidates = append(candidates, variant)
+		}
+	}
+	if len(candidates) == 0 {
+		return hlsVariant{}, errors.New("HLS stream has no AAC audio variant")
+	}
+	slices.SortStableFunc(candidates, func(a, b *playlist.MultivariantVariant) int { return a.Bandwidth - b.Bandwidth })
+
+	limit := options.MaxBandwidth * 1000
+	if capBits > 0 && (limit == 0 || capBits < limit) {
+		limit = capBits
+	}
+	index := len(candidates) - 1
+	if limit > 0 {
+		index = 0
+		for i, variant := range candidates {
+			if variant.Bandwidth <= limit {
+				index = i
+			}
+		}
+	}
+	chosen := candidates[index]
+
+	result := hlsVariant{label: fmt.Sprintf("%d kbps", (chosen.Bandwidth+500)/1000)}
+	if len(candidates) > 1 {
+		result.label += fmt.Sprintf(" (%d/%d)", index+1, len(candidates))
+	}
+	for i := index - 1; i >= 0; i-- {
+		if candidates[i].Bandwidth < chosen.Bandwidth {
+			result.lower = chosen.Bandwidth - 1
+			break
+		}
+	}
+
+	uri := chosen.URI
+	if rendition := pickHLSRendition(master.Renditions, chosen.Audio, options.AudioRendition); rendition != nil {
+		name := rendition.Name
+		if rendition.Language != "" && !strings.EqualFold(rendition.Language, name) {
+			name += " [" + rendition.Language + "]"
+		}
+		result.label += ", " + name
+		if rendition.URI != nil {
+			uri = *rendition.URI
+		}
+	}
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return hlsVariant{}, err
+	}
+	result.url = base.ResolveReference(ref).String()
+	return result, nil
+}
+
+func pickHLSRendition(renditions []*playlist.MultivariantRendition, group, want string) *playlist.MultivariantRendition {
+	if group == "" {
+		return nil
+	}
+	var matches []*playlist.MultivariantRendition
+	for _, rendition := range renditions {
+		if rendition.Type == playlist.MultivariantRenditionTypeAudio && rendition.GroupID == group {
+			matches = append(matches, rendition)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	if want != "" {
+		for _, rendition := range matches {
+			if strings.EqualFold(rendition.Name, want) || strings.EqualFold(rendition.Language, want) {
+				return rendition
+			}
+		}
+		// "en" also matches "en-US"
+		for _, rendition := range matches {
+			if language, _, _ := strings.Cut(rendition.Language, "-"); strings.EqualFold(language, want) {
+				return rendition
+			}
+		}
+	}
+	for _, rendition := range matches {
+		if rendition.Default {
+			return rendition
+		}
+	}
+	return matches[0]
+}
+
+// hlsStallCounter notices gaps in decoded HLS audio. audio is called from
+// the gohlslib callback, check from the playback loop once a second.
+type hlsStallCounter struct {
+	mu        sync.Mutex
+	lastAudio time.Time
+	stalled   bool
+	stalls    []time.Time
+}
+
+func (c *hlsStallCounter) audio(now time.Time) {
+	c.mu.Lock()
+	c.lastAudio = now
+	c.stalled = false
+	c.mu.Unlock()
+}
+
+// check reports a new stall and how many stalls happened within
+// hlsStallWindow. A gap is counted once, however long it lasts.
+func (c *hlsStallCounter) check(now time.Time) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastAudio.IsZero() || c.stalled || now.Sub(c.lastAudio) < hlsStallTimeout {
+		return len(c.stalls), false
+	}
+	c.stalled = true
+	c.stalls = slices.DeleteFunc(c.stalls, func(at time.Time) bool { return now.Sub(at) > hlsStallWindow })
+	c.stalls = append(c.stalls, now)
+	return len(c.stalls), true
+}
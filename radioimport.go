@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// opmlDocument is the OPML station list used by RadioTime/TuneIn style
+// directories: audio outlines carry the stream in URL and the name in text.
+type opmlDocument struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Body    []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Type     string        `xml:"type,attr,omitempty"`
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	URL      string        `xml:"URL,attr,omitempty"`
+	LowerURL string        `xml:"url,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// encodeRadioStations writes the station list as JSON (default), M3U or
+// OPML and returns the content type and file extension to serve it with.
+// JSON keeps the HLS options; M3U and OPML carry names and URLs only.
+func encodeRadioStations(stations []RadioStation, format string) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "json":
+		if stations == nil {
+			stations = []RadioStation{}
+		}
+		data, err := json.MarshalIndent(stations, "", "  ")
+		if err != nil {
+			return nil, "", "", err
+		}
+		return append(data, '\n'), "application/json; charset=utf-8", "json", nil
+	case "m3u", "m3u8":
+		buf.WriteString("#EXTM3U\n")
+		for _, station := range stations {
+			fmt.Fprintf(&buf, "#EXTINF:-1,%s\n%s\n", strings.ReplaceAll(station.Name, "\n", " "), station.URL)
+		}
+		return buf.Bytes(), "audio/x-mpegurl; charset=utf-8", "m3u", nil
+	case "opml":
+		doc := opmlDocument{Version: "2.0", Title: "nrlnanny radio stations"}
+		for _, station := range stations {
+			doc.Body = append(doc.Body, opmlOutline{Type: "audio", Text: station.Name, URL: station.URL})
+		}
+		buf.WriteString(xml.Header)
+		encoder := xml.NewEncoder(&buf)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(doc); err != nil {
+			return nil, "", "", err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), "text/x-opml; charset=utf-8", "opml", nil
+	default:
+		return nil, "", "", fmt.Errorf("unsupported radio station format %q", format)
+	}
+}
+
+// parseRadioStations reads a station list in JSON (an array of stations, or
+// the GET /api/radio state with its "stations"), M3U or OPML. An empty
+// format is detected from the content. Entries are returned as written;
+// importRadioStations validates them.
+func parseRadioStations(data []byte, format string) ([]RadioStation, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+	if format == "" {
+		switch {
+		case bytes.HasPrefix(data, []byte("[")), bytes.HasPrefix(data, []byte("{")):
+			format = "json"
+		case bytes.HasPrefix(data, []byte("<")):
+			format = "opml"
+		default:
+			format = "m3u"
+		}
+	}
+
+	var stations []RadioStation
+	switch format {
+	case "json":
+		if bytes.HasPrefix(data, []byte("{")) {
+			var state struct {
+				Stations []RadioStation `json:"stations"`
+			}
+			if err := json.Unmarshal(data, &state); err != nil {
+				return nil, fmt.Errorf("invalid radio station JSON: %w", err)
+			}
+			stations = state.Stations
+		} else if err := json.Unmarshal(data, &stations); err != nil {
+			return nil, fmt.Errorf("invalid radio station JSON: %w", err)
+		}
+	case "m3u", "m3u8":
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		name := ""
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "":
+			case strings.HasPrefix(strings.ToUpper(line), "#EXTINF:"):
+				// #EXTINF:-1 tvg-logo="...",Station name
+				if _, title, ok := strings.Cut(line, ","); ok {
+					name = strings.TrimSpace(title)
+				}
+			case strings.HasPrefix(line, "#"):
+			default:
+				stations = append(stations, RadioStation{Name: name, URL: line})
+				name = ""
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case "opml":
+		var doc opmlDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid OPML: %w", err)
+		}
+		var walk func([]opmlOutline)
+		walk = func(outlines []opmlOutline) {
+			for _, outline := range outlines {
+				// Category outlines only group stations; links to further
+				// directory pages are not stations.
+				streamURL := cmp.Or(strings.TrimSpace(outline.URL), strings.TrimSpace(outline.LowerURL))
+				if streamURL != "" && !strings.EqualFold(outline.Type, "link") {
+					stations = append(stations, RadioStation{Name: cmp.Or(outline.Text, outline.Title), URL: streamURL})
+				}
+				walk(outline.Outlines)
+			}
+		}
+		walk(doc.Body)
+	default:
+		return nil, fmt.Errorf("unsupported radio station format %q", format)
+	}
+	if len(stations) == 0 {
+		return nil, fmt.Errorf("no radio stations found")
+	}
+	return stations, nil
+}
+
+// importRadioStations adds the stations whose URL is not saved yet. URLs are
+// compared after validateRadioURL cleans them, so the same stream written
+// twice in a file is added once. Entries without a valid http(s) URL or
+// with invalid HLS options are skipped; a missing name becomes the host.
+func importRadioStations(stations []RadioStation) (added []RadioStation, skipped int) {
+	confMu.Lock()
+	defer confMu.Unlock()
+	saved := make(map[string]bool, len(conf.System.RadioStations))
+	for _, station := range conf.System.RadioStations {
+		saved[station.URL] = true
+	}
+	now := time.Now().UnixNano()
+	for _, station := range stations {
+		cleanURL, err := validateRadioURL(station.URL)
+		if err != nil || saved[cleanURL] || validateRadioHLSOptions(&station.RadioHLSOptions) != nil {
+			skipped++
+			continue
+		}
+		saved[cleanURL] = true
+		name := strings.TrimSpace(station.Name)
+		if name == "" {
+			parsed, _ := url.Parse(cleanURL)
+			name = parsed.Hostname()
+		}
+		if len(name) > 100 {
+			// Cut at a character boundary within the 100 bytes that
+			// saveRadioStation allows.
+			cut := 100
+			for cut > 0 && !utf8.RuneStart(name[cut]) {
+				cut--
+			}
+			name = name[:cut]
+		}
+		station = RadioStation{
+			ID:              "radio-" + strconv.FormatInt(now+int64(len(added)), 36),
+			Name:            name,
+			URL:             cleanURL,
+			RadioHLSOptions: station.RadioHLSOptions,
+		}
+		conf.System.RadioStations = append(conf.System.RadioStations, station)
+		added = append(added, station)
+	}
+	return added, skipped
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bluenviron/gohlslib/v2/pkg/playlist"
+)
+
+// icyReader removes the metadata blocks that an Icecast/SHOUTcast server
+// interleaves with the audio after every metaint bytes when the request
+// carries "Icy-MetaData: 1", and reports each StreamTitle it finds.
+type icyReader struct {
+	r         io.Reader
+	metaint   int
+	remaining int // audio bytes before the next metadata block
+	onTitle   func(string)
+	meta      []byte
+}
+
+func newICYReader(r io.Reader, metaint int, onTitle func(string)) *icyReader {
+	return &icyReader{r: r, metaint: metaint, remaining: metaint, onTitle: onTitle}
+}
+
+func (r *icyReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		var length [1]byte
+		if _, err := io.ReadFull(r.r, length[:]); err != nil {
+			return 0, err
+		}
+		if size := int(length[0]) * 16; size > 0 {
+			r.meta = append(r.meta[:0], make([]byte, size)...)
+			if _, err := io.ReadFull(r.r, r.meta); err != nil {
+				return 0, err
+			}
+			if title, ok := parseICYStreamTitle(r.meta); ok && r.onTitle != nil {
+				r.onTitle(title)
+			}
+		}
+		r.remaining = r.metaint
+	}
+	n, err := r.r.Read(p[:min(len(p), r.remaining)])
+	r.remaining -= n
+	return n, err
+}
+
+// icyMetaint reads the metadata interval from the response headers; zero
+// means the server does not send metadata.
+func icyMetaint(header http.Header) int {
+	metaint, err := strconv.Atoi(strings.TrimSpace(header.Get("Icy-Metaint")))
+	if err != nil || metaint <= 0 {
+		return 0
+	}
+	return metaint
+}
+
+// parseICYStreamTitle extracts StreamTitle from a metadata block such as
+// "StreamTitle='Artist - Song';StreamUrl='http://...';". Titles may contain
+// quotes, so the value ends at the "';" that starts the next field.
+func parseICYStreamTitle(block []byte) (string, bool) {
+	block = bytes.TrimRight(block, "\x00")
+	const key = "StreamTitle='"
+	start := bytes.Index(block, []byte(key))
+	if start < 0 {
+		return "", false
+	}
+	value := block[start+len(key):]
+	if end := bytes.Index(value, []byte("';")); end >= 0 {
+		value = value[:end]
+	} else {
+		value = bytes.TrimSuffix(value, []byte("'"))
+	}
+	return strings.TrimSpace(decodeICYText(value)), true
+}
+
+// decodeICYText returns UTF-8 text as is and treats anything else as
+// Latin-1, which older SHOUTcast servers send.
+func decodeICYText(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// hlsTitleInterval limits how often the media playlist is fetched again
+// for #EXTINF titles; gohlslib refreshes it far more often.
+const hlsTitleInterval = 10 * time.Second
+
+// hlsTitleTracker maps HLS segment URLs to the titles of their #EXTINF
+// tags, so the title changes when gohlslib downloads the segment rather
+// than when the segment first appears in the playlist.
+type hlsTitleTracker struct {
+	ctx     context.Context
+	onTitle func(string)
+
+	mu       sync.Mutex
+	titles   map[string]string
+	fetching bool
+	fetched  time.Time
+}
+
+func newHLSTitleTracker(ctx context.Context, onTitle func(string)) *hlsTitleTracker {
+	return &hlsTitleTracker{ctx: ctx, onTitle: onTitle, titles: make(map[string]string)}
+}
+
+// playlistDownloaded is the gohlslib OnDownloadStreamPlaylist callback.
+func (t *hlsTitleTracker) playlistDownloaded(rawURL string) {
+	t.mu.Lock()
+	if t.fetching || time.Since(t.fetched) < hlsTitleInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.fetching = true
+	t.mu.Unlock()
+
+	go func() {
+		titles, err := fetchHLSTitles(t.ctx, rawURL)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.fetching, t.fetched = false, time.Now()
+		if err == nil {
+			t.titles = titles
+		}
+	}()
+}
+
+// segmentDownloaded is the gohlslib OnDownloadSegment callback.
+func (t *hlsTitleTracker) segmentDownloaded(rawURL string) {
+	t.mu.Lock()
+	title, ok := t.titles[rawURL]
+	t.mu.Unlock()
+	if ok && title != "" {
+		t.onTitle(title)
+	}
+}
+
+func fetchHLSTitles(ctx context.Context, rawURL string) (map[string]string, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "nrlnanny/embedded-radio")
+	resp, err := radioHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var media playlist.Media
+	if err := media.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	titles := make(map[string]string, len(media.Segments))
+	for _, segment := range media.Segments {
+		title := parseEXTINFTitle(segment.Title)
+		if title == "" {
+			continue
+		}
+		if ref, err := url.Parse(segment.URI); err == nil {
+			titles[base.ResolveReference(ref).String()] = title
+		}
+	}
+	return titles, nil
+}
+
+// parseEXTINFTitle turns an #EXTINF title into "Artist - Song". Besides
+// plain text, many radio CDNs put attributes there, for example
+// `title="Song",artist="Artist",url="..."`.
+func parseEXTINFTitle(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, `="`) {
+		return raw
+	}
+	attrs := make(map[string]string)
+	for rest := raw; rest != ""; {
+		eq := strings.Index(rest, `="`)
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(strings.TrimLeft(rest[:eq], ", ")))
+		if i := strings.LastIndexAny(key, " ,"); i >= 0 {
+			key = key[i+1:]
+		}
+		rest = rest[eq+2:]
+		end := strings.Index(rest, `"`)
+		if end < 0 {
+			end = len(rest)
+		}
+		attrs[key] = rest[:end]
+		rest = rest[min(end+1, len(rest)):]
+	}
+	title := strings.TrimSpace(attrs["title"])
+	if artist := strings.TrimSpace(attrs["artist"]); artist != "" && title != "" {
+		return artist + " - " + title
+	}
+	return title
+}
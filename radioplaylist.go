@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// radioPlaylistDepth limits station playlists that point at further
+	// playlists.
+	radioPlaylistDepth = 3
+	// radioPlaylistBytes is the most that is read from a station playlist.
+	radioPlaylistBytes = 1 << 20
+)
+
+// asxRefPattern finds the stream references of an ASX playlist. Real ASX
+// files are often not well-formed XML, so they are not parsed as XML.
+var asxRefPattern = regexp.MustCompile(`(?i)<(?:entry)?ref\b[^>]*?\bhref\s*=\s*["']([^"']+)["']`)
+
+// sniffRadioPlaylist recognises text that is a station playlist (PLS,
+// M3U or ASX) or an HLS playlist rather than audio. It returns "" for
+// anything else.
+func sniffRadioPlaylist(head []byte) string {
+	text := bytes.ToLower(bytes.TrimLeft(head, " \t\r\n"))
+	switch {
+	case bytes.HasPrefix(text, []byte("#extm3u")):
+		// HLS media and master playlists always carry #EXT-X- tags; an
+		// extended M3U of stream links does not.
+		if bytes.Contains(text, []byte("#ext-x-")) {
+			return radioFormatHLS
+		}
+		return radioFormatPlaylist
+	case bytes.HasPrefix(text, []byte("[playlist]")),
+		bytes.HasPrefix(text, []byte("<asx")),
+		bytes.HasPrefix(text, []byte("<?xml")) && bytes.Contains(text, []byte("<asx")),
+		bytes.HasPrefix(text, []byte("http://")), bytes.HasPrefix(text, []byte("https://")):
+		return radioFormatPlaylist
+	}
+	return ""
+}
+
+// parseRadioPlaylist returns the http(s) stream URLs listed in a PLS, M3U
+// or ASX playlist in order, resolved against base.
+func parseRadioPlaylist(data []byte, base *url.URL) ([]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	var entries []string
+	if bytes.Contains(bytes.ToLower(data), []byte("<asx")) {
+		for _, match := range asxRefPattern.FindAllSubmatch(data, -1) {
+			entries = append(entries, html.UnescapeString(string(match[1])))
+		}
+	} else {
+		var err error
+		if entries, err = playlistEntries(data, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	urls := make([]string, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		ref, err := url.Parse(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		streamURL, err := validateRadioURL(base.ResolveReference(ref).String())
+		if err != nil || seen[streamURL] {
+			continue
+		}
+		seen[streamURL] = true
+		urls = append(urls, streamURL)
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("radio playlist lists no http(s) streams")
+	}
+	return urls, nil
+}
+
+// streamRadioPlaylist reads a station playlist and plays the streams it
+// lists, moving on to the next one when a stream cannot be played. Once a
+// stream has played, its error is returned so that runRadio reconnects
+// from the top of the playlist.
+func streamRadioPlaylist(ctx context.Context, body io.Reader, base *url.URL, depth int) error {
+	if depth >= radioPlaylistDepth {
+		return errors.New("radio playlists are nested too deeply")
+	}
+	data, err := io.ReadAll(io.LimitReader(body, radioPlaylistBytes))
+	if err != nil {
+		return radioReadError(ctx, "radio playlist", err)
+	}
+	urls, err := parseRadioPlaylist(data, base)
+	if err != nil {
+		return err
+	}
+	log.Printf("network radio playlist %s lists %d stream(s)", base, len(urls))
+
+	var lastErr error
+	for i, streamURL := range urls {
+		if i > 0 {
+			setRadioStreamStatus(ctx, "connecting")
+			log.Printf("network radio trying next stream in playlist: %s", streamURL)
+		}
+		err := streamRadioURL(ctx, streamURL, depth+1)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if radioStreamPlayed(ctx) {
+			return err
+		}
+		log.Printf("network radio stream %s failed: %v", streamURL, err)
+		lastErr = err
+	}
+	return fmt.Errorf("no stream in the radio playlist could be played: %w", lastErr)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRadioProbeTime = 6 * time.Second
+	maxRadioProbeTime     = 20 * time.Second
+)
+
+// radioProbeSlots limits how many probes run at once.
+var radioProbeSlots = make(chan struct{}, 2)
+
+// radioProbeReport describes a stream checked by probeRadioURL.
+type radioProbeReport struct {
+	URL        string  `json:"url"`              // stream that was decoded, after playlists and redirects
+	Format     string  `json:"format,omitempty"` // mp3, aac, ogg, flac or hls
+	Codec      string  `json:"codec,omitempty"`
+	SampleRate int     `json:"sample_rate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+	Bitrate    int     `json:"bitrate,omitempty"` // kbit/s of compressed audio
+	Variant    string  `json:"variant,omitempty"` // HLS variant
+	Title      string  `json:"title,omitempty"`
+	Seconds    float64 `json:"seconds"` // audio decoded during the probe
+	Error      string  `json:"error,omitempty"`
+}
+
+// radioProbe collects what the stream decoders see when they run for a
+// probe rather than for the air. A context carrying one makes
+// radioPCMWriter drop the audio and keeps the stream from touching the
+// player's status, title, watchdog and recording.
+type radioProbe struct {
+	mu     sync.Mutex
+	report radioProbeReport
+	bytes  int64 // compressed audio bytes consumed
+	audio  float64
+}
+
+type radioProbeKey struct{}
+
+func withRadioProbe(ctx context.Context, probe *radioProbe) context.Context {
+	return context.WithValue(ctx, radioProbeKey{}, probe)
+}
+
+// radioProbeFrom returns the probe of ctx, or nil when the stream is on air.
+func radioProbeFrom(ctx context.Context) *radioProbe {
+	probe, _ := ctx.Value(radioProbeKey{}).(*radioProbe)
+	return probe
+}
+
+// noteRadioStream records the stream URL and format; a playlist entry
+// replaces what was noted for the playlist.
+func noteRadioStream(ctx context.Context, rawURL, format string) {
+	if probe := radioProbeFrom(ctx); probe != nil {
+		probe.mu.Lock()
+		probe.report = radioProbeReport{URL: rawURL, Format: format}
+		probe.bytes, probe.audio = 0, 0
+		probe.mu.Unlock()
+	}
+}
+
+// noteRadioCodec records what a decoder found; zero values keep earlier
+// findings.
+func noteRadioCodec(ctx context.Context, codec string, sampleRate, channels int) {
+	if probe := radioProbeFrom(ctx); probe != nil {
+		probe.mu.Lock()
+		defer probe.mu.Unlock()
+		if codec != "" {
+			probe.report.Codec = codec
+		}
+		if sampleRate > 0 {
+			probe.report.SampleRate = sampleRate
+		}
+		if channels > 0 {
+			probe.report.Channels = channels
+		}
+	}
+}
+
+// noteRadioBytes counts compressed audio for the bitrate.
+func noteRadioBytes(ctx context.Context, n int) {
+	if probe := radioProbeFrom(ctx); probe != nil {
+		probe.mu.Lock()
+		probe.bytes += int64(n)
+		probe.mu.Unlock()
+	}
+}
+
+// setRadioStreamStatus sets the player status unless the stream is probed.
+func setRadioStreamStatus(ctx context.Context, status string) {
+	if radioProbeFrom(ctx) == nil {
+		setRadioStatus(status)
+	}
+}
+
+// radioStreamPlayed reports whether the current connection has produced
+// audio.
+func radioStreamPlayed(ctx context.Context) bool {
+	if probe := radioProbeFrom(ctx); probe != nil {
+		probe.mu.Lock()
+		defer probe.mu.Unlock()
+		return probe.audio > 0
+	}
+	return currentRadioStatus() == "playing"
+}
+
+// radioByteCounter counts the audio bytes a decoder reads from a stream.
+type radioByteCounter struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c radioByteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	noteRadioBytes(c.ctx, n)
+	return n, err
+}
+
+// mp3FrameChannels returns the channel count from the first MPEG audio frame
+// header in head, or 0 if there is none; go-mp3 always decodes to stereo.
+func mp3FrameChannels(head []byte) int {
+	for i := 0; i+4 <= len(head); i++ {
+		if head[i] != 0xff || head[i+1]&0xe0 != 0xe0 || head[i+1]&0x06 == 0 {
+			continue
+		}
+		bitrate, rate := head[i+2]>>4, head[i+2]>>2&0x03
+		if bitrate == 0 || bitrate == 0x0f || rate == 0x03 {
+			continue
+		}
+		if head[i+3]>>6 == 3 {
+			return 1
+		}
+		return 2
+	}
+	return 0
+}
+
+// probeRadioURL plays a URL with the player's own stream handling for up
+// to duration without putting it on air, and reports what it found.
+func probeRadioURL(rawURL string, duration time.Duration) radioProbeReport {
+	cleanURL, err := validateRadioURL(rawURL)
+	if err != nil {
+		return radioProbeReport{URL: rawURL, Error: err.Error()}
+	}
+	if duration <= 0 {
+		duration = defaultRadioProbeTime
+	}
+	duration = min(duration, maxRadioProbeTime)
+	select {
+	case radioProbeSlots <- struct{}{}:
+		defer func() { <-radioProbeSlots }()
+	default:
+		return radioProbeReport{URL: cleanURL, Error: "too many radio probes running"}
+	}
+
+	probe := &radioProbe{report: radioProbeReport{URL: cleanURL}}
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	err = streamRadioURL(withRadioProbe(ctx, probe), cleanURL, 0)
+
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+	report := probe.report
+	report.Seconds = math.Round(probe.audio*10) / 10
+	if probe.audio > 0 {
+		report.Bitrate = int(math.Round(float64(probe.bytes) * 8 / probe.audio / 1000))
+	}
+	switch {
+	case err == nil, errors.Is(err, context.DeadlineExceeded) && probe.audio > 0:
+	case errors.Is(err, context.DeadlineExceeded):
+		report.Error = fmt.Sprintf("no audio decoded within %v", duration)
+	default:
+		report.Error = err.Error()
+	}
+	log.Printf("network radio probe %s: format=%s codec=%s %d Hz %d ch %d kbit/s %.1f s audio %s",
+		cleanURL, report.Format, report.Codec, report.SampleRate, report.Channels, report.Bitrate, report.Seconds, report.Error)
+	return report
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// radioRecordDirPrefix is the subdirectory of RecoderFilePath that holds
+	// radio recordings, and their prefix in /dirs, e.g. "radio/2025-10-19".
+	radioRecordDirPrefix     = "radio/"
+	radioRecordFlushInterval = 10 * time.Second
+	// radioRecordMaxDuration keeps a forgotten recording well below the
+	// 4 GB WAV limit (about 37 hours at 16 kHz).
+	radioRecordMaxDuration = 12 * time.Hour
+)
+
+// radioRecorder writes the decoded 16 kHz radio audio that radioPCMWriter
+// puts on air to a WAV file, with song titles as cue markers like the
+// off-air log.
+type radioRecorder struct {
+	mu        sync.Mutex
+	file      *os.File
+	started   time.Time
+	until     time.Time // zero records until stopped
+	samples   uint32
+	cues      []airlogCue
+	lastFlush time.Time
+}
+
+var radioRecord = &radioRecorder{}
+
+func radioRecordingsRoot() string {
+	confMu.Lock()
+	defer confMu.Unlock()
+	if conf.System.RecoderFilePath == "" {
+		return ""
+	}
+	return filepath.Join(conf.System.RecoderFilePath, strings.TrimSuffix(radioRecordDirPrefix, "/"))
+}
+
+// radioRecordFileName names a recording so that parseTimeFromFilename reads
+// its start time: RADIO_2025-10-19_200000_Station.wav.
+func radioRecordFileName(station string, start time.Time) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '-'
+	}, station)
+	name = strings.Trim(name, "-")
+	if len([]rune(name)) > 40 {
+		name = string([]rune(name)[:40])
+	}
+	if name == "" {
+		name = "radio"
+	}
+	return fmt.Sprintf("RADIO_%s_%s.wav", start.Format("2006-01-02_150405"), name)
+}
+
+// startRadioRecording records the playing station until it is stopped, the
+// station changes or until is reached (zero for no limit).
+func startRadioRecording(until time.Time) (string, error) {
+	if !isRadioPlaying() {
+		return "", fmt.Errorf("network radio is not playing")
+	}
+	station := currentRadioStation()
+	root := radioRecordingsRoot()
+	if root == "" {
+		return "", fmt.Errorf("RecoderFilePath is not configured")
+	}
+	now := time.Now()
+	dir := filepath.Join(root, now.Format("2006-01-02"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	r := radioRecord
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		return "", fmt.Errorf("a radio recording is already running")
+	}
+	path := filepath.Join(dir, radioRecordFileName(station.Name, now))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := binary.Write(file, binary.LittleEndian, radioRecordHeader(0)); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", err
+	}
+	r.file, r.started, r.until = file, now, until
+	r.samples, r.cues, r.lastFlush = 0, nil, now
+	label := station.Name
+	if title := radioTitle(); title != "" {
+		label += " - " + title
+	}
+	r.cues = append(r.cues, airlogCue{label: now.Format("15:04:05") + " " + label})
+	log.Printf("📼 network radio recording started: %s", path)
+	return path, nil
+}
+
+// stopRadioRecording finishes the running recording, if any.
+func stopRadioRecording() {
+	radioRecord.mu.Lock()
+	defer radioRecord.mu.Unlock()
+	radioRecord.close()
+}
+
+// radioRecording returns the file being recorded, when it started and when
+// it stops by itself.
+func radioRecording() (path string, started, until time.Time, ok bool) {
+	radioRecord.mu.Lock()
+	defer radioRecord.mu.Unlock()
+	if radioRecord.file == nil {
+		return "", time.Time{}, time.Time{}, false
+	}
+	return radioRecord.file.Name(), radioRecord.started, radioRecord.until, true
+}
+
+// write appends one frame of 16 kHz audio.
+func (r *radioRecorder) write(frame []int, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if (!r.until.IsZero() && !now.Before(r.until)) || now.Sub(r.started) >= radioRecordMaxDuration {
+		r.close()
+		return
+	}
+	data := make([]byte, len(frame)*2)
+	for i, sample := range frame {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(int16(max(-32768, min(32767, sample)))))
+	}
+	if _, err := r.file.Write(data); err != nil {
+		log.Printf("network radio recording failed: %v", err)
+		r.close()
+		return
+	}
+	r.samples += uint32(len(frame))
+	if now.Sub(r.lastFlush) >= radioRecordFlushInterval {
+		r.lastFlush = now
+		if err := r.writeHeader(0); err != nil {
+			log.Printf("network radio recording header update failed: %v", err)
+		}
+	}
+}
+
+// mark adds a timeline marker, e.g. when the song title changes.
+func (r *radioRecorder) mark(label string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.cues = append(r.cues, airlogCue{sample: r.samples, label: now.Format("15:04:05") + " " + label})
+	}
+}
+
+func (r *radioRecorder) writeHeader(extra uint32) error {
+	header := radioRecordHeader(r.samples * 2)
+	header.FileSize += extra
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	_, err := r.file.WriteAt(buf.Bytes(), 0)
+	return err
+}
+
+// close appends the timeline and closes the file; the caller holds r.mu.
+func (r *radioRecorder) close() {
+	if r.file == nil {
+		return
+	}
+	path := r.file.Name()
+	if r.samples == 0 {
+		r.file.Close()
+		os.Remove(path)
+		log.Printf("network radio recording discarded, no audio: %s", path)
+	} else {
+		timeline := encodeAirlogCues(r.cues)
+		if _, err := r.file.Write(timeline); err != nil {
+			log.Printf("network radio recording timeline failed: %v", err)
+		} else if err := r.writeHeader(uint32(len(timeline))); err != nil {
+			log.Printf("network radio recording header update failed: %v", err)
+		}
+		if err := r.file.Close(); err != nil {
+			log.Printf("network radio recording close failed: %v", err)
+		}
+		log.Printf("📼 network radio recording finished: %s (%d s)", path, r.samples/playbackSampleRate)
+	}
+	r.file, r.cues = nil, nil
+}
+
+// radioRecordHeader is the WAV header of a 16 kHz mono recording.
+func radioRecordHeader(dataSize uint32) WAVHeader {
+	header := createWAVHeader(dataSize)
+	header.SampleRate = playbackSampleRate
+	header.ByteRate = playbackSampleRate * 2
+	header.BlockAlign = 2
+	return header
+}
+
+// radioRecordingPath resolves a recording named as in /dirs and /dir/
+// ("radio/2025-10-19/RADIO_....wav", optionally behind "/recordings/") to
+// its file, refusing anything outside the radio recordings.
+func radioRecordingPath(name string) (string, error) {
+	root := radioRecordingsRoot()
+	if root == "" {
+		return "", fmt.Errorf("RecoderFilePath is not configured")
+	}
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "/"), "recordings/")
+	rel, ok := strings.CutPrefix(name, radioRecordDirPrefix)
+	if !ok || !strings.EqualFold(filepath.Ext(rel), ".wav") || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", fmt.Errorf("not a radio recording: %s", name)
+	}
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", fmt.Errorf("radio recording not found: %s", name)
+	}
+	return path, nil
+}
+
+// radioReplay is a recording waiting to go on air again.
+type radioReplay struct {
+	ID    string    `json:"id"`
+	File  string    `json:"file"`
+	At    time.Time `json:"at"`
+	timer *time.Timer
+}
+
+var radioReplays = struct {
+	sync.Mutex
+	pending []*radioReplay
+}{}
+
+// scheduleRadioReplay puts a recording on air at the given time (now when
+// zero) through the scheduled-audio channel, so it mixes like a scheduled
+// file. Pending replays are kept in memory only.
+func scheduleRadioReplay(name string, at time.Time) (*radioReplay, error) {
+	path, err := radioRecordingPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if !isTimeEnabled() {
+		return nil, fmt.Errorf("scheduled playback (EnableTimePlay) is off")
+	}
+	now := time.Now()
+	if at.Before(now) {
+		at = now
+	}
+	replay := &radioReplay{ID: "replay-" + strconv.FormatInt(now.UnixNano(), 36), File: name, At: at}
+	radioReplays.Lock()
+	defer radioReplays.Unlock()
+	replay.timer = time.AfterFunc(at.Sub(now), func() {
+		radioReplays.Lock()
+		radioReplays.pending = slices.DeleteFunc(radioReplays.pending, func(r *radioReplay) bool { return r == replay })
+		radioReplays.Unlock()
+		log.Printf("📻 network radio replay on air: %s", path)
+		playScheduledAudio(path)
+	})
+	radioReplays.pending = append(radioReplays.pending, replay)
+	log.Printf("network radio replay of %s scheduled for %s", path, at.Format("01-02 15:04:05"))
+	return replay, nil
+}
+
+func cancelRadioReplay(id string) error {
+	radioReplays.Lock()
+	defer radioReplays.Unlock()
+	for i, replay := range radioReplays.pending {
+		if replay.ID == id {
+			if !replay.timer.Stop() {
+				return fmt.Errorf("radio replay already on air")
+			}
+			radioReplays.pending = slices.Delete(radioReplays.pending, i, i+1)
+			return nil
+		}
+	}
+	return fmt.Errorf("radio replay not found")
+}
+
+func pendingRadioReplays() []radioReplay {
+	radioReplays.Lock()
+	defer radioReplays.Unlock()
+	list := make([]radioReplay, 0, len(radioReplays.pending))
+	for _, replay := range radioReplays.pending {
+		list = append(list, radioReplay{ID: replay.ID, File: replay.File, At: replay.At})
+	}
+	return list
+}
+
+// parseReplayTime reads a replay time: empty for now, "HH:MM" for the next
+// time the clock shows it, or "YYYY-MM-DD HH:MM" / RFC 3339.
+func parseReplayTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return now, nil
+	}
+	if minutes, err := parseClock(value); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), 0, minutes, 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	if at, err := time.ParseInLocation("2006-01-02 15:04", value, now.Location()); err == nil {
+		return at, nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid replay time %q, want HH:MM, YYYY-MM-DD HH:MM or RFC 3339", value)
+	}
+	return at, nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// radioScheduleInterval is how often the program schedule is checked.
+const radioScheduleInterval = time.Second
+
+// RadioProgram relays a station at fixed times, either from a cron start
+// time for Duration minutes or in a weekly Start-End window.
+type RadioProgram struct {
+	ID        string `yaml:"ID" json:"id"`
+	Name      string `yaml:"Name,omitempty" json:"name,omitempty"`
+	StationID string `yaml:"StationID" json:"station_id"`
+	Cron      string `yaml:"Cron,omitempty" json:"cron,omitempty"`         // 5-field cron spec of the start time
+	Duration  int    `yaml:"Duration,omitempty" json:"duration,omitempty"` // minutes, with Cron
+	Days      []int  `yaml:"Days,omitempty" json:"days,omitempty"`         // weekdays of Start, 0 = Sunday; empty = every day
+	Start     string `yaml:"Start,omitempty" json:"start,omitempty"`       // HH:MM
+	End       string `yaml:"End,omitempty" json:"end,omitempty"`           // HH:MM, at or before Start = next day
+	Disabled  bool   `yaml:"Disabled,omitempty" json:"disabled,omitempty"`
+	Record    bool   `yaml:"Record,omitempty" json:"record,omitempty"` // record the program to the radio recordings
+}
+
+// window returns the program window that contains now, if any.
+func (p RadioProgram) window(now time.Time) (start, end time.Time, ok bool) {
+	if p.Disabled {
+		return time.Time{}, time.Time{}, false
+	}
+	if p.Cron != "" {
+		schedule, err := cron.ParseStandard(p.Cron)
+		if err != nil || p.Duration <= 0 {
+			return time.Time{}, time.Time{}, false
+		}
+		length := time.Duration(p.Duration) * time.Minute
+		from, to := now.Add(-length), now
+		start = schedule.Next(from)
+		if start.IsZero() || start.After(now) {
+			return time.Time{}, time.Time{}, false
+		}
+		// With starts closer together than Duration, the latest start wins.
+		// Next(t) is at or before now exactly for t before that start, so
+		// bisect down to the minute instead of walking every start.
+		for to.Sub(from) >= time.Minute {
+			middle := from.Add(to.Sub(from) / 2)
+			if next := schedule.Next(middle); !next.IsZero() && !next.After(now) {
+				from, start = middle, next
+			} else {
+				to = middle
+			}
+		}
+		return start, start.Add(length), true
+	}
+
+	from, err := parseClock(p.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	to, err := parseClock(p.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	// A window that crosses midnight may have started yesterday.
+	for offset := 0; offset >= -1; offset-- {
+		day := time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, now.Location())
+		if len(p.Days) > 0 && !slices.Contains(p.Days, int(day.Weekday())) {
+			continue
+		}
+		start = time.Date(day.Year(), day.Month(), day.Day(), 0, from, 0, 0, day.Location())
+		end = time.Date(day.Year(), day.Month(), day.Day(), 0, to, 0, 0, day.Location())
+		if to <= from {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !now.Before(start) && now.Before(end) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(value string) (int, error) {
+	hours, minutes, ok := strings.Cut(strings.TrimSpace(value), ":")
+	h, errH := strconv.Atoi(hours)
+	m, errM := strconv.Atoi(minutes)
+	if !ok || errH != nil || errM != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	return h*60 + m, nil
+}
+
+func validateRadioProgram(p *RadioProgram) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Cron = strings.TrimSpace(p.Cron)
+	if len(p.Name) > 100 {
+		return fmt.Errorf("radio program name is too long")
+	}
+	if findRadioStation(p.StationID).ID == "" {
+		return fmt.Errorf("radio station not found")
+	}
+	if p.Cron != "" {
+		if p.Start != "" || p.End != "" || len(p.Days) > 0 {
+			return fmt.Errorf("radio program needs either a cron spec or a weekday window, not both")
+		}
+		if _, err := cron.ParseStandard(p.Cron); err != nil {
+			return fmt.Errorf("invalid radio program cron spec: %w", err)
+		}
+		if p.Duration <= 0 || p.Duration > 7*24*60 {
+			return fmt.Errorf("radio program duration must be between 1 and %d minutes", 7*24*60)
+		}
+		return nil
+	}
+	p.Duration = 0
+	from, err := parseClock(p.Start)
+	if err != nil {
+		return fmt.Errorf("radio program start: %w", err)
+	}
+	to, err := parseClock(p.End)
+	if err != nil {
+		return fmt.Errorf("radio program end: %w", err)
+	}
+	if from == to {
+		return fmt.Errorf("radio program start and end must differ")
+	}
+	for _, day := range p.Days {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("radio program weekdays must be 0 (Sunday) to 6")
+		}
+	}
+	slices.Sort(p.Days)
+	p.Days = slices.Compact(p.Days)
+	return nil
+}
+
+func findRadioStation(id string) RadioStation {
+	confMu.Lock()
+	defer confMu.Unlock()
+	for _, station := range conf.System.RadioStations {
+		if station.ID == id {
+			return station
+		}
+	}
+	return RadioStation{}
+}
+
+// saveRadioProgram adds a program when its ID is empty and replaces the
+// program with that ID otherwise.
+func saveRadioProgram(program RadioProgram) (RadioProgram, error) {
+	if err := validateRadioProgram(&program); err != nil {
+		return RadioProgram{}, err
+	}
+	confMu.Lock()
+	defer confMu.Unlock()
+	if program.ID == "" {
+		program.ID = "program-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+		conf.System.RadioSchedule = append(conf.System.RadioSchedule, program)
+		return program, nil
+	}
+	for i := range conf.System.RadioSchedule {
+		if conf.System.RadioSchedule[i].ID == program.ID {
+			conf.System.RadioSchedule[i] = program
+			return program, nil
+		}
+	}
+	return RadioProgram{}, fmt.Errorf("radio program not found")
+}
+
+func deleteRadioProgram(id string) error {
+	confMu.Lock()
+	defer confMu.Unlock()
+	for i, program := range conf.System.RadioSchedule {
+		if program.ID == id {
+			conf.System.RadioSchedule = slices.Delete(conf.System.RadioSchedule, i, i+1)
+			return nil
+		}
+	}
+	return fmt.Errorf("radio program not found")
+}
+
+func radioSchedulePrograms() []RadioProgram {
+	confMu.Lock()
+	defer confMu.Unlock()
+	return slices.Clone(conf.System.RadioSchedule)
+}
+
+// radioProgramRun is a program window that the scheduler has started.
+type radioProgramRun struct {
+	program    RadioProgram
+	start, end time.Time
+	previousID string // station that played before the program, "" for local music
+}
+
+var radioScheduler = struct {
+	sync.Mutex
+	run     *radioProgramRun
+	started map[string]time.Time // program ID -> start of the last window acted on
+}{started: make(map[string]time.Time)}
+
+// currentRadioProgram returns the program window being relayed, if any.
+func currentRadioProgram() (RadioProgram, time.Time, bool) {
+	radioScheduler.Lock()
+	defer radioScheduler.Unlock()
+	if radioScheduler.run == nil {
+		return RadioProgram{}, time.Time{}, false
+	}
+	return radioScheduler.run.program, radioScheduler.run.end, true
+}
+
+// runRadioSchedule starts and stops scheduled programs. It runs after the
+// saved station has been restored, so a program that was on air before a
+// restart is recognised as the scheduler's own.
+func runRadioSchedule() {
+	checkRadioSchedule(time.Now(), true)
+	ticker := time.NewTicker(radioScheduleInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		checkRadioSchedule(now, false)
+	}
+}
+
+// checkRadioSchedule ends the running program when its window is over and
+// starts the first program in the schedule whose window has begun. Each
+// window is acted on once, so a station the operator stops or changes
+// during a program stays that way; at the end the previous station or local
+// music is restored only if the program's station is still on air. While
+// the program plays, the mixer treats it like any radio station: beacons,
+// scheduled files and announcements play over it and an emergency alert
+// mutes it.
+func checkRadioSchedule(now time.Time, initial bool) {
+	programs := radioSchedulePrograms()
+	radioScheduler.Lock()
+	defer radioScheduler.Unlock()
+	for id := range radioScheduler.started {
+		if !slices.ContainsFunc(programs, func(p RadioProgram) bool { return p.ID == id }) {
+			delete(radioScheduler.started, id)
+		}
+	}
+
+	var ended *radioProgramRun
+	if run := radioScheduler.run; run != nil {
+		index := slices.IndexFunc(programs, func(p RadioProgram) bool { return p.ID == run.program.ID })
+		current := false
+		if index >= 0 {
+			start, _, ok := programs[index].window(now)
+			current = ok && start.Equal(run.start)
+		}
+		if current {
+			return
+		}
+		ended, radioScheduler.run = run, nil
+		if ended.program.Record {
+			stopRadioRecording()
+		}
+	}
+
+	var next *radioProgramRun
+	for _, program := range programs {
+		start, end, ok := program.window(now)
+		if ok && !radioScheduler.started[program.ID].Equal(start) {
+			radioScheduler.started[program.ID] = start
+			next = &radioProgramRun{program: program, start: start, end: end}
+			break
+		}
+	}
+	if next == nil {
+		if ended != nil {
+			endRadioProgram(ended)
+		}
+		return
+	}
+
+	playingID := ""
+	if isRadioPlaying() {
+		playingID = currentRadioStation().ID
+	}
+	next.previousID = playingID
+	switch {
+	case ended != nil && playingID == ended.program.StationID:
+		// Back-to-back programs: go straight to the next one and restore
+		// what played before the first one afterwards.
+		next.previousID = ended.previousID
+	case ended != nil:
+		endRadioProgram(ended)
+		ended = nil
+	case initial && playingID == next.program.StationID:
+		// After a restart mid-program the station comes back from the saved
+		// config; it is the program's own.
+		next.previousID = ""
+	}
+	if playingID != next.program.StationID {
+		// Right after a program the station playing is its own, and its
+		// session ended normally.
+		reason := errRadioStopped
+		if ended != nil {
+			reason = errRadioSessionEnded
+		}
+		if err := switchRadio(next.program.StationID, reason); err != nil {
+			log.Printf("network radio program %q could not start: %v", radioProgramLabel(next.program), err)
+			if ended != nil {
+				endRadioProgram(ended)
+			}
+			return
+		}
+	}
+	radioScheduler.run = next
+	log.Printf("📻 network radio program %q on air until %s", radioProgramLabel(next.program), next.end.Format("01-02 15:04"))
+	if next.program.Record {
+		if _, err := startRadioRecording(next.end); err != nil {
+			log.Printf("network radio program %q recording failed: %v", radioProgramLabel(next.program), err)
+		}
+	}
+}
+
+func endRadioProgram(run *radioProgramRun) {
+	label := radioProgramLabel(run.program)
+	if !isRadioPlaying() || currentRadioStation().ID != run.program.StationID {
+		log.Printf("network radio program %q ended; the operator changed the source, leaving it as is", label)
+		return
+	}
+	if run.previousID == run.program.StationID {
+		log.Printf("network radio program %q ended; the station was already playing before it, leaving it on", label)
+		return
+	}
+	if run.previousID != "" {
+		if err := switchRadio(run.previousID, errRadioSessionEnded); err == nil {
+			log.Printf("📻 network radio program %q ended; back to the previous station", label)
+			return
+		}
+	}
+	switchToLocalMusic(errRadioSessionEnded)
+	log.Printf("📻 network radio program %q ended; back to local music", label)
+}
+
+func radioProgramLabel(program RadioProgram) string {
+	if program.Name != "" {
+		return program.Name
+	}
+	if station := findRadioStation(program.StationID); station.Name != "" {
+		return station.Name
+	}
+	return program.ID
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/colespringer/waxflow/audio"
+	waxaac "github.com/colespringer/waxflow/codec/aac"
+	"github.com/mewkiz/flac"
+)
+
+// Stream formats recognised on a plain HTTP (Icecast/Shoutcast) radio URL.
+const (
+	radioFormatMP3  = "mp3"
+	radioFormatAAC  = "aac"
+	radioFormatOgg  = "ogg"
+	radioFormatFLAC = "flac"
+	radioFormatHLS  = "hls"
+	// radioFormatPlaylist is a PLS, M3U or ASX file listing streams.
+	radioFormatPlaylist = "playlist"
+)
+
+// radioSniffBytes is how much of a stream is inspected to detect its format.
+const radioSniffBytes = 4096
+
+// detectRadioFormat identifies a radio stream from its first bytes and falls
+// back to the Content-Type header, then to the URL, when the bytes are not
+// conclusive. Many servers send a generic or wrong Content-Type, so the bytes
+// win.
+func detectRadioFormat(rawURL, contentType string, head []byte) string {
+	if format := sniffRadioFormat(head); format != "" {
+		return format
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	switch mediaType {
+	case "audio/aac", "audio/aacp", "audio/x-aac", "audio/adts":
+		return radioFormatAAC
+	case "audio/ogg", "application/ogg", "audio/opus", "audio/vorbis", "audio/x-ogg":
+		return radioFormatOgg
+	case "audio/flac", "audio/x-flac":
+		return radioFormatFLAC
+	case "application/vnd.apple.mpegurl":
+		return radioFormatHLS
+	case "audio/x-mpegurl", "audio/mpegurl", "application/x-mpegurl", "audio/x-scpls",
+		"application/pls+xml", "video/x-ms-asf", "video/x-ms-asx", "audio/x-ms-wax":
+		return radioFormatPlaylist
+	}
+	if isHLSURL(rawURL) {
+		return radioFormatHLS
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		switch strings.ToLower(path.Ext(u.Path)) {
+		case ".pls", ".m3u", ".asx":
+			return radioFormatPlaylist
+		case ".aac":
+			return radioFormatAAC
+		case ".ogg", ".oga", ".opus":
+			return radioFormatOgg
+		case ".flac":
+			return radioFormatFLAC
+		}
+	}
+	return radioFormatMP3
+}
+
+func sniffRadioFormat(head []byte) string {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	if format := sniffRadioPlaylist(head); format != "" {
+		return format
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return radioFormatOgg
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return radioFormatFLAC
+	}
+	// An ID3 tag may precede MP3 or ADTS frames; look past it when it fits.
+	if len(head) >= 10 && bytes.HasPrefix(head, []byte("ID3")) {
+		size := int(head[6]&0x7f)<<21 | int(head[7]&0x7f)<<14 | int(head[8]&0x7f)<<7 | int(head[9]&0x7f)
+		if 10+size >= len(head) {
+			return radioFormatMP3
+		}
+		head = head[10+size:]
+	}
+	for i := 0; i+7 <= len(head); i++ {
+		if head[i] != 0xff || head[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		header, ok := parseADTSHeader(head[i:])
+		if !ok {
+			if head[i+1]&0x06 != 0 {
+				return radioFormatMP3 // MPEG audio layer I-III
+			}
+			continue
+		}
+		// A lone sync word is common inside MP3 data, so require the next
+		// ADTS frame to start where this one ends.
+		next := i + header.frameLength
+		if next+7 > len(head) {
+			return radioFormatAAC
+		}
+		if _, ok := parseADTSHeader(head[next:]); ok {
+			return radioFormatAAC
+		}
+	}
+	return ""
+}
+
+// openRadioStream requests a radio URL, asking Icecast/SHOUTcast servers for
+// interleaved song titles. The caller closes the body.
+func openRadioStream(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "nrlnanny/embedded-radio")
+	req.Header.Set("Icy-MetaData", "1")
+	resp, err := radioHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("open radio stream: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("open radio stream: HTTP %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// radioPlaybackStarted marks the station as playing once per connection.
+func radioPlaybackStarted(ctx context.Context, once *sync.Once, format string, args ...any) {
+	if radioProbeFrom(ctx) != nil {
+		return
+	}
+	once.Do(func() {
+		setRadioStatus("playing")
+		log.Printf("network radio "+format, args...)
+	})
+}
+
+// radioReadError keeps a cancelled context from being reported as a
+// stream failure.
+func radioReadError(ctx context.Context, what string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("read %s stream: %w", what, err)
+}
+
+// adtsHeader is the fixed and variable part of an ADTS frame header.
+type adtsHeader struct {
+	profile      int // AAC object type - 1
+	rateIndex    int
+	channels     int
+	frameLength  int // header included
+	headerLength int
+}
+
+var adtsSampleRates = [...]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+func parseADTSHeader(b []byte) (adtsHeader, bool) {
+	if len(b) < 7 || b[0] != 0xff || b[1]&0xf6 != 0xf0 {
+		return adtsHeader{}, false
+	}
+	h := adtsHeader{
+		profile:      int(b[2] >> 6),
+		rateIndex:    int(b[2]>>2) & 0x0f,
+		channels:     int(b[2]&0x01)<<2 | int(b[3]>>6),
+		frameLength:  int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5,
+		headerLength: 7,
+	}
+	if b[1]&0x01 == 0 {
+		h.headerLength = 9 // CRC follows the header
+	}
+	if h.rateIndex >= len(adtsSampleRates) || h.frameLength <= h.headerLength {
+		return adtsHeader{}, false
+	}
+	return h, true
+}
+
+// audioSpecificConfig builds the two-byte MPEG-4 AudioSpecificConfig that
+// the ADTS header stands for.
+func (h adtsHeader) audioSpecificConfig() []byte {
+	objectType := h.profile + 1
+	return []byte{
+		byte(objectType<<3 | h.rateIndex>>1),
+		byte((h.rateIndex&1)<<7 | h.channels<<3),
+	}
+}
+
+// streamADTSRadio decodes a raw ADTS AAC stream. The decoder is created from
+// the first frame header and rebuilt if the server switches format.
+func streamADTSRadio(ctx context.Context, r *bufio.Reader) error {
+	var decoder *waxaac.Decoder
+	var writer *radioPCMWriter
+	var config []byte
+	var playbackOnce sync.Once
+	defer func() {
+		if decoder != nil {
+			decoder.Release()
+		}
+	}()
+
+	frame := make([]byte, 1<<13)
+	skipped := 0
+	for {
+		head, err := r.Peek(7)
+		if err != nil {
+			return radioReadError(ctx, "AAC", err)
+		}
+		header, ok := parseADTSHeader(head)
+		if !ok {
+			r.Discard(1)
+			if skipped++; skipped > 1<<16 {
+				return errors.New("read AAC stream: no ADTS frames found")
+			}
+			continue
+		}
+		skipped = 0
+		if _, err := io.ReadFull(r, frame[:header.frameLength]); err != nil {
+			return radioReadError(ctx, "AAC", err)
+		}
+
+		if asc := header.audioSpecificConfig(); !bytes.Equal(asc, config) {
+			if header.channels == 0 {
+				return errors.New("unsupported AAC stream: channel layout in program config element")
+			}
+			cfg, err := waxaac.ParseASC(asc)
+			if err != nil {
+				return fmt.Errorf("unsupported AAC stream configuration: %w", err)
+			}
+			format, err := cfg.Format()
+			if err != nil {
+				return err
+			}
+			next, err := waxaac.NewDecoder(cfg, format)
+			if err != nil {
+				return fmt.Errorf("initialize embedded AAC decoder: %w", err)
+			}
+			if decoder != nil {
+				decoder.Release()
+			}
+			decoder, config = next, asc
+			writer = newRadioPCMWriter(ctx, format.Rate)
+			log.Printf("network radio ADTS stream detected: AAC, %d Hz, %d channel(s)", format.Rate, format.Channels)
+			noteRadioCodec(ctx, "AAC", format.Rate, format.Channels)
+		}
+
+		err = decoder.Decode(frame[header.headerLength:header.frameLength], func(pcm *audio.Buffer) error {
+			if err := writer.Write(downmixFloatPCM(pcm)); err != nil {
+				return err
+			}
+			radioPlaybackStarted(ctx, &playbackOnce, "AAC playback started: embedded AAC decoder -> 16 kHz mono")
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("decode AAC stream: %w", err)
+		}
+	}
+}
+
+// streamOggRadio decodes an Ogg Opus or Ogg Vorbis stream. Icecast starts a
+// new logical stream (with new headers) at every track change, so the
+// decoder is set up again whenever a stream ends.
+func streamOggRadio(ctx context.Context, r io.Reader) error {
+	reader := newOggReader(r)
+	var playbackOnce sync.Once
+	for {
+		stream, err := readOggHeaders(reader)
+		if err != nil {
+			return radioReadError(ctx, "Ogg", err)
+		}
+		writer := newRadioPCMWriter(ctx, stream.codec.SampleRate())
+		noteRadioCodec(ctx, stream.name, stream.codec.SampleRate(), stream.channels)
+		for {
+			packet, _, err := reader.nextPacket()
+			if errors.Is(err, io.EOF) && reader.streamEnded() {
+				break
+			}
+			if err != nil {
+				return radioReadError(ctx, "Ogg", err)
+			}
+			mono, err := stream.codec.DecodePacket(packet)
+			if err != nil {
+				return fmt.Errorf("decode Ogg %s stream: %w", stream.name, err)
+			}
+			if err := writer.Write(mono); err != nil {
+				return err
+			}
+			if len(mono) > 0 {
+				radioPlaybackStarted(ctx, &playbackOnce, "Ogg %s playback started: %d Hz -> 16 kHz mono", stream.name, stream.codec.SampleRate())
+			}
+		}
+		reader.nextStream()
+	}
+}
+
+// streamFLACRadio decodes a native FLAC stream.
+func streamFLACRadio(ctx context.Context, r io.Reader) error {
+	stream, err := flac.New(r)
+	if err != nil {
+		return radioReadError(ctx, "FLAC", err)
+	}
+	info := stream.Info
+	if info == nil || info.SampleRate == 0 || info.NChannels == 0 || info.BitsPerSample == 0 {
+		return errors.New("read FLAC stream: invalid stream header")
+	}
+	writer := newRadioPCMWriter(ctx, int(info.SampleRate))
+	var playbackOnce sync.Once
+	noteRadioCodec(ctx, "FLAC", int(info.SampleRate), int(info.NChannels))
+	for {
+		frame, err := stream.ParseNext()
+		if err != nil {
+			return radioReadError(ctx, "FLAC", err)
+		}
+		if err := writer.Write(downmixFLACFrame(frame, int(info.BitsPerSample))); err != nil {
+			return err
+		}
+		radioPlaybackStarted(ctx, &playbackOnce, "FLAC playback started: %d Hz, %d channel(s) -> 16 kHz mono", info.SampleRate, info.NChannels)
+	}
+}
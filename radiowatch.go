@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRadioSilenceTimeout = 60 // seconds
+	defaultRadioStallTimeout   = 20 // seconds
+	defaultRadioMaxFailures    = 5
+
+	// radioSilencePeak is the peak level below which a frame counts as
+	// silence (about -54 dBFS).
+	radioSilencePeak = 64
+	// Decoded audio is checked over radioThroughputWindow; a stream that
+	// delivers less than radioMinThroughput of real time is stalling even
+	// if it never stops completely.
+	radioThroughputWindow = 30 * time.Second
+	radioMinThroughput    = 0.7
+	// radioHealthyAfter of audible playback resets the failure count.
+	radioHealthyAfter = time.Minute
+
+	radioBackoffBase = 3 * time.Second
+	radioBackoffMax  = time.Minute
+)
+
+// radioWatchLimits are the watchdog settings from the configuration; a zero
+// duration disables a check and maxFailures 0 reconnects forever.
+type radioWatchLimits struct {
+	silence     time.Duration
+	stall       time.Duration
+	maxFailures int
+	fallbackID  string
+}
+
+func currentRadioWatchLimits() radioWatchLimits {
+	confMu.Lock()
+	defer confMu.Unlock()
+	seconds := func(value, fallback int) time.Duration {
+		switch {
+		case value < 0:
+			return 0
+		case value == 0:
+			value = fallback
+		}
+		return time.Duration(value) * time.Second
+	}
+	limits := radioWatchLimits{
+		silence:     seconds(conf.System.RadioSilenceTimeout, defaultRadioSilenceTimeout),
+		stall:       seconds(conf.System.RadioStallTimeout, defaultRadioStallTimeout),
+		maxFailures: conf.System.RadioMaxFailures,
+		fallbackID:  conf.System.RadioFallbackID,
+	}
+	switch {
+	case limits.maxFailures < 0:
+		limits.maxFailures = 0
+	case limits.maxFailures == 0:
+		limits.maxFailures = defaultRadioMaxFailures
+	}
+	return limits
+}
+
+// radioWatchdog follows the frames that radioPCMWriter puts on air for the
+// current connection.
+type radioWatchdog struct {
+	mu           sync.Mutex
+	start        time.Time
+	lastFrame    time.Time
+	lastSound    time.Time
+	windowStart  time.Time // zero until the first frame
+	windowFrames int
+}
+
+var radioWatch = &radioWatchdog{}
+
+func (w *radioWatchdog) reset(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.start, w.lastFrame, w.lastSound = now, now, now
+	w.windowStart, w.windowFrames = time.Time{}, 0
+}
+
+func (w *radioWatchdog) frame(samples []int, now time.Time) {
+	peak := 0
+	for _, sample := range samples {
+		peak = max(peak, absInt(sample))
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastFrame = now
+	if peak >= radioSilencePeak {
+		w.lastSound = now
+	}
+	if w.windowStart.IsZero() {
+		w.windowStart = now
+	}
+	w.windowFrames++
+}
+
+// check returns why the connection should be dropped, or nil.
+func (w *radioWatchdog) check(now time.Time, limits radioWatchLimits) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if limits.stall > 0 {
+		if idle := now.Sub(w.lastFrame); idle >= limits.stall {
+			return fmt.Errorf("no audio from the stream for %v", idle.Round(time.Second))
+		}
+		if elapsed := now.Sub(w.windowStart); !w.windowStart.IsZero() && elapsed >= radioThroughputWindow {
+			throughput := float64(w.windowFrames*opusFrameSamples) / playbackSampleRate / elapsed.Seconds()
+			w.windowStart, w.windowFrames = now, 0
+			if throughput < radioMinThroughput {
+				return fmt.Errorf("stream delivers only %.0f%% of real time", throughput*100)
+			}
+		}
+	}
+	if limits.silence > 0 {
+		if quiet := now.Sub(w.lastSound); quiet >= limits.silence {
+			return fmt.Errorf("stream has been silent for %v", quiet.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// healthy reports whether the connection played audible audio long enough
+// to forget earlier failures.
+func (w *radioWatchdog) healthy() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastSound.Sub(w.start) >= radioHealthyAfter
+}
+
+// watchRadio runs streamRadio and drops the connection when the watchdog
+// sees a stall, a trickle or a long silence. It reports whether the
+// connection was healthy and why it ended.
+func watchRadio(ctx context.Context, station RadioStation, limits radioWatchLimits) (bool, error) {
+	streamCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	radioWatch.reset(time.Now())
+	done := make(chan error, 1)
+	go func() { done <- streamRadio(streamCtx, station) }()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if cause := context.Cause(streamCtx); ctx.Err() == nil && cause != nil {
+				err = cause
+			}
+			return radioWatch.healthy(), err
+		case now := <-ticker.C:
+			if reason := radioWatch.check(now, limits); reason != nil {
+				log.Printf("network radio %q watchdog: %v; reconnecting", station.Name, reason)
+				cancel(reason)
+			}
+		}
+	}
+}
+
+// radioBackoff is the delay before reconnect attempt n (1-based).
+func radioBackoff(failures int) time.Duration {
+	delay := radioBackoffBase
+	for i := 1; i < failures && delay < radioBackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, radioBackoffMax)
+}
+
+// radioFallback gives up on a station after too many failures and switches
+// to the fallback station, or back to local music when there is none or it
+// is the station that failed.
+func radioFallback(failed RadioStation, failures int, err error, fallbackID string) {
+	message := fmt.Sprintf("network radio %q failed %d times in a row (%v)", failed.Name, failures, err)
+	switched := false
+	if fallbackID != "" && fallbackID != failed.ID {
+		if startErr := startRadio(fallbackID); startErr == nil {
+			message += fmt.Sprintf("; switched to fallback station %q", currentRadioStation().Name)
+			switched = true
+		} else {
+			message += fmt.Sprintf("; fallback station unavailable (%v)", startErr)
+		}
+	}
+	if !switched {
+		switchToLocalMusic(errRadioStopped)
+		message += "; switched back to local music"
+	}
+	log.Printf("⚠️ %s", message)
+	setRadioAlert(message)
+}
@@ -23,13 +23,6 @@ func ReadMP3() {
 
 // 辅助函数：保存 PCM 数据为 WAV 文件
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // BytesToInt16 converts a []byte slice (representing 16-bit PCM samples)
 // into a []int16 slice. It assumes LittleEndian byte order.
 func BytesToInt16(byteData []byte) ([]int16, error) {
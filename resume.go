@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 断电或重启后从上次的曲目和位置继续播放。播放状态定期写入单独的状态文件，
+// 不改写 nrlnanny.yaml。
+
+const (
+	defaultStateFile   = "nrlnanny.state.json"
+	resumeSaveInterval = 5 * time.Second
+)
+
+// musicResumeState 是写入状态文件的播放进度和队列状态
+type musicResumeState struct {
+	Playlist string  `json:"playlist"` // 播放列表名称，"" 为 folder 列表
+	Path     string  `json:"path"`     // 当前曲目文件
+	ID       int     `json:"id"`
+	Position float64 `json:"position"` // 已播放秒数
+	Mode     string  `json:"mode"`
+
+	// 随机播放历史（不含当前曲目）和本轮待播，以及分类轮播状态
+	History        []int          `json:"history,omitempty"`
+	Bag            []int          `json:"bag,omitempty"`
+	Credits        map[string]int `json:"credits,omitempty"`
+	LastInCategory map[string]int `json:"last_in_category,omitempty"`
+
+	SavedAt time.Time `json:"saved_at"`
+}
+
+var (
+	resumeMu       sync.Mutex
+	resumePath     string  // 正在播放的曲目，由 reportMusicPosition 更新
+	resumeID       int     // 正在播放的曲目ID
+	resumePosition float64 // 正在播放的位置（秒）
+	resumeSeekPath string  // 启动恢复后第一首需要跳转的曲目
+	resumeSeekTo   float64 // 启动恢复后需要跳转到的位置（秒）
+)
+
+// stateFilePath 返回状态文件路径，未配置时放在配置文件旁边
+func stateFilePath() string {
+	confMu.Lock()
+	defer confMu.Unlock()
+	if conf.System.StateFile != "" {
+		return conf.System.StateFile
+	}
+	if confPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(confPath), defaultStateFile)
+}
+
+// noteMusicPosition 记下当前曲目和播放位置，供定期保存
+func noteMusicPosition(file MusicFileInfo, seconds float64) {
+	resumeMu.Lock()
+	resumePath, resumeID, resumePosition = file.Path, file.ID, seconds
+	resumeMu.Unlock()
+}
+
+// takeResumeSeek 返回启动恢复时 path 需要跳转到的位置，只生效一次
+func takeResumeSeek(path string) (time.Duration, bool) {
+	resumeMu.Lock()
+	defer resumeMu.Unlock()
+	if resumeSeekPath == "" {
+		return 0, false
+	}
+	matched := resumeSeekPath == path
+	seconds := resumeSeekTo
+	resumeSeekPath, resumeSeekTo = "", 0
+	if !matched || seconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// snapshotMusicResume 收集当前的播放状态，还没有播放过曲目时返回 false
+func snapshotMusicResume() (musicResumeState, bool) {
+	resumeMu.Lock()
+	state := musicResumeState{Path: resumePath, ID: resumeID, Position: resumePosition}
+	resumeMu.Unlock()
+	if state.Path == "" {
+		return state, false
+	}
+	state.Playlist = activePlaylistName()
+	state.Mode = musicPlayMode()
+
+	musicstateMu.RLock()
+	q := &currentQueue
+	if q.historyPos > 0 {
+		state.History = slices.Clone(q.history[:q.historyPos])
+	}
+	state.Bag = slices.Clone(q.bag)
+	state.Credits = maps.Clone(q.credits)
+	state.LastInCategory = maps.Clone(q.lastInCategory)
+	musicstateMu.RUnlock()
+	return state, true
+}
+
+// saveMusicResume 先写临时文件再改名，断电时不会留下写了一半的状态文件
+func saveMusicResume(path string, state musicResumeState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadMusicResume(path string) (musicResumeState, error) {
+	var state musicResumeState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// restoreMusicResume 在首次扫描之后恢复上次的播放模式、曲目和位置。
+// 播放列表已经切换或曲目已不存在时从头播放。
+func restoreMusicResume() {
+	path := stateFilePath()
+	if path == "" {
+		return
+	}
+	state, err := loadMusicResume(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ 读取播放状态失败 %s: %v", path, err)
+		}
+		return
+	}
+	if state.Playlist != activePlaylistName() {
+		log.Printf("ℹ️ 播放列表已切换，不恢复上次的播放位置")
+		return
+	}
+	if validPlayMode(state.Mode) {
+		confMu.Lock()
+		conf.System.MusicPlayMode = state.Mode
+		confMu.Unlock()
+	}
+
+	musicstateMu.Lock()
+	queue := currentQueue.files
+	index := slices.IndexFunc(queue, func(file MusicFileInfo) bool { return file.Path == state.Path })
+	if index < 0 {
+		musicstateMu.Unlock()
+		log.Printf("ℹ️ 上次播放的曲目已不存在: %s", state.Path)
+		return
+	}
+	missing := func(id int) bool { return indexOfMusicID(queue, id) < 0 }
+	q := &currentQueue
+	q.history = slices.DeleteFunc(state.History, missing)
+	q.historyPos = len(q.history) - 1
+	q.bag = slices.DeleteFunc(state.Bag, missing)
+	if state.Credits != nil {
+		q.credits = state.Credits
+	}
+	if state.LastInCategory != nil {
+		q.lastInCategory = state.LastInCategory
+	}
+	// 作为点播选中，随机模式下会接在恢复的历史之后
+	manualNextID = queue[index].ID
+	file := queue[index]
+	musicstateMu.Unlock()
+
+	resumeMu.Lock()
+	resumeSeekPath, resumeSeekTo = file.Path, state.Position
+	resumeMu.Unlock()
+	log.Printf("⏯ 恢复上次播放: %s (ID: %04d) %s", trackDisplayName(file), file.ID, formatPlayTime(int64(state.Position*playbackSampleRate)))
+}
+
+// runMusicResumeSaver 定期把播放状态写入状态文件，状态没有变化时不写
+func runMusicResumeSaver() {
+	ticker := time.NewTicker(resumeSaveInterval)
+	defer ticker.Stop()
+	var last musicResumeState
+	for range ticker.C {
+		state, ok := snapshotMusicResume()
+		if !ok || reflect.DeepEqual(state, last) {
+			continue
+		}
+		path := stateFilePath()
+		if path == "" {
+			continue
+		}
+		last = state
+		state.SavedAt = time.Now()
+		if err := saveMusicResume(path, state); err != nil {
+			log.Printf("⚠️ 保存播放状态失败 %s: %v", path, err)
+		}
+	}
+}
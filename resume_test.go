@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMusicResumeRoundTrip(t *testing.T) {
+	oldStateFile, oldActive := conf.System.StateFile, conf.System.ActivePlaylist
+	t.Cleanup(func() {
+		conf.System.StateFile, conf.System.ActivePlaylist = oldStateFile, oldActive
+		noteMusicPosition(MusicFileInfo{}, 0)
+	})
+	conf.System.StateFile = filepath.Join(t.TempDir(), "state.json")
+	conf.System.ActivePlaylist = ""
+
+	queue := withPlayMode(t, playModeShuffle, 1, 2, 3, 4, 5)
+	for i := range queue {
+		queue[i].Path = filepath.Join("music", fmt.Sprintf("song-%04d.mp3", queue[i].ID))
+	}
+	currentQueue.files = queue
+	var played []int
+	for range 3 {
+		id, _ := playNext(queue, false, false)
+		played = append(played, id)
+	}
+	current := queue[indexOfMusicID(queue, played[2])]
+	noteMusicPosition(current, 42.5)
+	bag := slices.Clone(currentQueue.bag)
+
+	state, ok := snapshotMusicResume()
+	if !ok {
+		t.Fatal("no state to save")
+	}
+	if err := saveMusicResume(stateFilePath(), state); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟重启：清空播放状态后从文件恢复
+	conf.System.MusicPlayMode = playModeSequential
+	resetShuffle()
+	currentPlayingID, manualNextID = -1, -1
+	restoreMusicResume()
+
+	if mode := musicPlayMode(); mode != playModeShuffle {
+		t.Fatalf("restored mode = %s", mode)
+	}
+	if id, _ := playNext(queue, false, false); id != current.ID {
+		t.Fatalf("resumed track = %d, want %d", id, current.ID)
+	}
+	if offset, ok := takeResumeSeek(current.Path); !ok || offset != 42500*time.Millisecond {
+		t.Fatalf("resume seek = %v, %v", offset, ok)
+	}
+	if _, ok := takeResumeSeek(current.Path); ok {
+		t.Fatal("resume seek applied twice")
+	}
+	if !slices.Equal(currentQueue.history, played) || !slices.Equal(currentQueue.bag, bag) {
+		t.Fatalf("history %v bag %v, want %v %v", currentQueue.history, currentQueue.bag, played, bag)
+	}
+	if id, _ := playNext(queue, true, false); id != played[1] {
+		t.Fatalf("previous after resume = %d, want %d", id, played[1])
+	}
+}
@@ -1,19 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sync"
 	"time"
-
-	"github.com/fsnotify/fsnotify"
 )
 
 var (
-	filenameRegex = regexp.MustCompile(`(?i)-(\d{2})(\d{2})\.(wav|mp3|flac)$`)
+	filenameRegex = regexp.MustCompile(`(?i)-(\d{2})(\d{2})\.(wav|mp3|flac|ogg|oga|opus)$`)
 )
 
 type AudioFileInfo struct {
@@ -142,6 +142,7 @@ func fullRescan(dir string) {
 		})
 
 		scheduledTasks[file.Path] = timer
+		warmPCMCache(file.Path)
 
 		log.Printf("⏰ Scheduled (full): %s for %s (%v)",
 			filepath.Base(file.Path),
@@ -153,53 +154,15 @@ func fullRescan(dir string) {
 	updateScheduleList(trackedFiles)
 }
 
-// watchFilesIncremental 增量监听文件变化
+// watchFilesIncremental 增量监听定时音频目录及其子目录的变化
 func watchFilesIncremental(dir string) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal("❌ 无法创建 watcher:", err)
-	}
-	defer watcher.Close()
-
-	if err := watcher.Add(dir); err != nil {
-		log.Printf("❌ 无法监听目录 %s: %v", dir, err)
-		return
-	}
-
-	log.Printf("👀 开始增量监听目录: %s", dir)
-
-	for {
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
-			}
-
-			path := event.Name
-			if !isSupportedAudioFile(path) {
-				continue
-			}
-
-			switch {
-
-			case event.Has(fsnotify.Create):
-				handleFileAdded(path)
-			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
-				handleFileRemoved(path)
-			}
-
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Println("⚠️ 监听错误:", err)
-		}
-	}
+	watchTree(dir, handleFileAdded, handleFileRemoved, handleDirRemoved)
 }
 
 // handleFileAdded 处理新增文件（只处理今天未来的）
 func handleFileAdded(path string) {
 	log.Printf("🟢 文件新增: %s", path)
+	invalidatePCMCache(path)
 	if !isTimeEnabled() {
 		return
 	}
@@ -230,8 +193,11 @@ func handleFileAdded(path string) {
 	stateMu.Lock()
 	defer stateMu.Unlock()
 
-	// 记录到跟踪列表
+	// 记录到跟踪列表；同一文件重复上报时先取消旧任务
 	trackedFiles[path] = fileInfo
+	if timer, exists := scheduledTasks[path]; exists {
+		timer.Stop()
+	}
 
 	// 设置定时器
 	duration := playTime.Sub(now)
@@ -243,6 +209,7 @@ func handleFileAdded(path string) {
 	})
 
 	scheduledTasks[path] = timer
+	warmPCMCache(path)
 
 	log.Printf("⏰ Scheduled (add): %s for %s (%v from now)",
 		filepath.Base(path),
@@ -261,6 +228,7 @@ func handleFileRemoved(path string) {
 
 	// 从 tracked 中移除
 	delete(trackedFiles, path)
+	invalidatePCMCache(path)
 
 	// 停止定时器
 	if timer, exists := scheduledTasks[path]; exists {
@@ -271,6 +239,17 @@ func handleFileRemoved(path string) {
 	updateScheduleList(trackedFiles)
 }
 
+// handleDirRemoved 子目录被删除或移出时取消其下所有定时任务
+func handleDirRemoved(dir string) {
+	stateMu.RLock()
+	paths := append(pathsUnder(trackedFiles, dir), pathsUnder(scheduledTasks, dir)...)
+	stateMu.RUnlock()
+	for _, path := range paths {
+		handleFileRemoved(path)
+	}
+	invalidatePCMCacheDir(dir)
+}
+
 // startDailyFullRescan 每天 00:00 执行一次全量重扫
 func startDailyFullRescan(dir string) {
 	for {
@@ -301,20 +280,35 @@ func clearTimeSchedules() {
 }
 
 func playScheduledAudio(path string) {
-	pcm, err := decodeAudioFile(path)
+	stream, err := openCachedAudio(path)
 	if err != nil {
 		log.Printf("❌ 无法解码定时音频 %s: %v", path, err)
 		return
 	}
-	for i := 0; i < len(pcm); i += opusFrameSamples {
+	defer stream.Close()
+	setAirlogTitle("scheduled", filepath.Base(path))
+	onAir := beginAsrun("scheduled", filepath.Base(path), path)
+	length := stream.Length()
+	for {
 		if !isTimeEnabled() {
+			onAir.finish(true)
 			return
 		}
-		end := min(i+opusFrameSamples, len(pcm))
 		chunk := make([]int, opusFrameSamples)
-		copy(chunk, pcm[i:end])
+		n, err := stream.Read(chunk)
+		if n == 0 {
+			failed := err != nil && !errors.Is(err, io.EOF)
+			if failed {
+				log.Printf("❌ 解码定时音频出错 %s: %v", path, err)
+			}
+			onAir.finish(failed)
+			return
+		}
 		timePCM <- [][]int{chunk}
-		percent := end * 100 / len(pcm)
+		percent := 0
+		if length > 0 {
+			percent = int(min(stream.Position()*100/length, 100))
+		}
 		updatePlayStatus(fmt.Sprintf("Scheduled Play: %s [%d%%]", path, percent), percent, true)
 	}
 }
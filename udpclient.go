@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 //var userlist = make(map[string]userinfo, 1000) //key 用户id
@@ -152,11 +153,11 @@ func NRL21parser(nrl *NRL21packet) {
 			if err != nil {
 				return
 			}
-			switchToLocalMusic()
+			switchToLocalMusic(errRadioStopped)
 			PlayMusicByID(id)
 		case "AT+PAUSE":
 			if isRadioPlaying() {
-				stopRadio()
+				stopRadio(errRadioStopped)
 				break
 			}
 			select {
@@ -164,17 +165,26 @@ func NRL21parser(nrl *NRL21packet) {
 			default:
 			}
 		case "AT+NEXT":
-			switchToLocalMusic()
+			switchToLocalMusic(errRadioStopped)
 			select {
 			case nextmusic <- true:
 			default:
 			}
 		case "AT+PREW":
-			switchToLocalMusic()
+			switchToLocalMusic(errRadioStopped)
 			select {
 			case lastmusic <- true:
 			default:
 			}
+		case "AT+SEEK":
+			// 秒数、m:ss 或百分比，例如 AT+SEEK=90、AT+SEEK=1:30、AT+SEEK=50%
+			seek, err := parseMusicSeek(value)
+			if err == nil {
+				err = requestMusicSeek(seek)
+			}
+			if err != nil {
+				log.Printf("AT+SEEK failed: %v", err)
+			}
 
 		case "AT+DUCK_SCALE":
 			value, err := strconv.Atoi(value)
@@ -245,12 +255,51 @@ func NRL21parser(nrl *NRL21packet) {
 				log.Printf("invalid %s value: %s", command, value)
 			}
 
+		case "AT+ANNOUNCE":
+			// "1" speaks the configured template; any other value is used
+			// as the template itself.
+			template := value
+			if template == "1" {
+				template = ""
+			}
+			if err := playAnnouncement(template); err != nil {
+				log.Printf("AT+ANNOUNCE failed: %v", err)
+			}
+
+		case "AT+EMERGENCY":
+			if value != "?" {
+				if err := handleEmergencyAT(value); err != nil {
+					log.Printf("AT+EMERGENCY failed: %v", err)
+				}
+			}
+
+		case "AT+PLAYLIST":
+			// "?" only reports the active playlist; "FOLDER" selects the
+			// default -NNNN folder playlist.
+			if value != "?" {
+				switchToLocalMusic(errRadioStopped)
+				if err := setActivePlaylist(value); err != nil {
+					log.Printf("AT+PLAYLIST failed: %v", err)
+				} else {
+					saveConfig()
+				}
+			}
+
+		case "AT+PLAY_MODE":
+			if value != "?" {
+				if err := setMusicPlayMode(value); err != nil {
+					log.Printf("AT+PLAY_MODE failed: %v", err)
+				} else {
+					saveConfig()
+				}
+			}
+
 		case "AT+RADIO_PLAY":
 			if err := startRadio(value); err != nil {
 				log.Printf("AT+RADIO_PLAY failed: %v", err)
 			}
 		case "AT+RADIO_STOP":
-			stopRadio()
+			stopRadio(errRadioStopped)
 		case "AT+RADIO_LIST", "AT+RADIO_STATUS":
 			includeRadioList = command == "AT+RADIO_LIST"
 		case "AT+RADIO_ADD":
@@ -259,7 +308,7 @@ func NRL21parser(nrl *NRL21packet) {
 				log.Printf("AT+RADIO_ADD expects name,url")
 				break
 			}
-			if _, err := saveRadioStation("", parts[0], parts[1]); err != nil {
+			if _, err := saveRadioStation("", parts[0], parts[1], nil); err != nil {
 				log.Printf("AT+RADIO_ADD failed: %v", err)
 			} else {
 				saveConfig()
@@ -288,12 +337,29 @@ func NRL21parser(nrl *NRL21packet) {
 		if isSendOpusEnabled() {
 			opus = "ON"
 		}
+		playlist := activePlaylistName()
+		if playlist == "" {
+			playlist = strings.ToUpper(folderPlaylistName)
+		}
+		emergency := "OFF"
+		if isEmergencyActive() {
+			emergency = "ON"
+		}
 		stations, activeID, radioPlaying, radioStatus := radioSnapshot()
 		radioOn := "OFF"
 		if radioPlaying {
 			radioOn = "ON"
 		}
-		response := []string{"AT+PLAY_ID=1", "AT+PREW=1", "AT+NEXT=1", "AT+PAUSE=1", "AT+VOLUME=" + volume, "AT+DUCK_MIC=" + duckmic, "AT+DUCK_MUSIC=" + duckmusic, "AT+DUCK_SCALE=" + duckscale, "AT+OPUS=" + opus, "AT+RADIO_PLAY=<ID>", "AT+RADIO_STOP=1", "AT+RADIO_LIST=1", "AT+RADIO=" + radioOn + "," + activeID + "," + strings.ToUpper(radioStatus), fmt.Sprintf("AT+RADIO_COUNT=%d", len(stations))}
+		response := []string{"AT+PLAY_ID=1", "AT+PREW=1", "AT+NEXT=1", "AT+PAUSE=1", "AT+SEEK=<SECONDS|M:SS|N%>", "AT+VOLUME=" + volume, "AT+DUCK_MIC=" + duckmic, "AT+DUCK_MUSIC=" + duckmusic, "AT+DUCK_SCALE=" + duckscale, "AT+OPUS=" + opus, "AT+PLAYLIST=" + playlist, "AT+PLAY_MODE=" + strings.ToUpper(musicPlayMode()), "AT+ANNOUNCE=1", "AT+EMERGENCY=" + emergency, "AT+RADIO_PLAY=<ID>", "AT+RADIO_STOP=1", "AT+RADIO_LIST=1", "AT+RADIO=" + radioOn + "," + activeID + "," + strings.ToUpper(radioStatus), fmt.Sprintf("AT+RADIO_COUNT=%d", len(stations))}
+		if title := radioTitle(); radioPlaying && title != "" {
+			// 歌名可能很长，截断到 120 字节以内且不拆开 UTF-8 字符
+			title = strings.NewReplacer("\r", " ", "\n", " ").Replace(title)
+			for len(title) > 120 {
+				_, size := utf8.DecodeLastRuneInString(title)
+				title = title[:len(title)-size]
+			}
+			response = append(response, "AT+RADIO_TITLE="+title)
+		}
 		if includeRadioList {
 			responseSize := 0
 			for _, line := range response {
@@ -378,9 +444,8 @@ func PlayAndSaveVoice(nrl *NRL21packet, pcm []int16) {
 
 	//log.Println("play voice", nrl.CallSign, nrl.SSID)
 
-	if streamReader != nil {
-		streamReader.WriteChunk(chunkBytes)
-	}
+	monitorRX(pcm)
+	meterFeedInt16("rx", pcm)
 
 	if isRecordingEnabled() {
 		recorder.ProcessPCMData(chunkBytes)
@@ -11,6 +11,8 @@ var (
 	cronState      = ""
 	progressState  = 0
 	isPlayingState = false
+	elapsedState   = 0.0 // 当前曲目已播放秒数
+	durationState  = 0.0 // 当前曲目总时长（秒），0 表示未知
 )
 
 var recordMicEnabled uint32 = 0
@@ -201,6 +203,28 @@ func updatePlayStatus(text string, percent int, playing bool) {
 	displayMu.Unlock()
 }
 
+func playStatus() (string, int, bool) {
+	displayMu.Lock()
+	defer displayMu.Unlock()
+	return statusState, progressState, isPlayingState
+}
+
+// restorePlayStatus 在状态仍是 shown 时恢复之前的状态，期间被其他播放更新过则保留
+func restorePlayStatus(shown, text string, percent int, playing bool) {
+	displayMu.Lock()
+	defer displayMu.Unlock()
+	if statusState == shown {
+		statusState, progressState, isPlayingState = text, percent, playing
+	}
+}
+
+func updatePlayPosition(elapsed, duration float64) {
+	displayMu.Lock()
+	elapsedState = elapsed
+	durationState = duration
+	displayMu.Unlock()
+}
+
 func updateCronInfo(info string) {
 	displayMu.Lock()
 	cronState = info
@@ -0,0 +1,1145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"slices"
+)
+
+// Vorbis I audio decoder following the Xiph.Org specification: codebooks,
+// floor types 0 and 1, residue types 0-2, channel coupling and the inverse
+// MDCT with overlap-add. Channels are downmixed to mono 16-bit PCM.
+
+const maxVorbisCodebookValues = 1 << 22
+
+var errVorbisSetup = errors.New("invalid Vorbis setup header")
+
+// vorbisBitReader reads a packet least significant bit first. Reading past
+// the end sets eop and returns zeros, which the decoder treats as the end
+// of the data in the packet.
+type vorbisBitReader struct {
+	data []byte
+	pos  int
+	bit  uint
+	eop  bool
+}
+
+func (b *vorbisBitReader) read(n int) uint32 {
+	var value uint32
+	for i := 0; i < n; {
+		if b.pos >= len(b.data) {
+			b.eop = true
+			return 0
+		}
+		take := min(8-int(b.bit), n-i)
+		value |= uint32(b.data[b.pos]>>b.bit&(1<<take-1)) << i
+		i += take
+		b.bit += uint(take)
+		if b.bit == 8 {
+			b.bit = 0
+			b.pos++
+		}
+	}
+	return value
+}
+
+func (b *vorbisBitReader) flag() bool { return b.read(1) == 1 }
+
+// vorbisILog is the number of bits needed to store x.
+func vorbisILog(x int) int {
+	if x <= 0 {
+		return 0
+	}
+	return bits.Len(uint(x))
+}
+
+func vorbisFloat32(x uint32) float32 {
+	mantissa := float64(x & 0x1fffff)
+	if x&0x80000000 != 0 {
+		mantissa = -mantissa
+	}
+	return float32(math.Ldexp(mantissa, int(x&0x7fe00000>>21)-788))
+}
+
+// vorbisLookup1Values is the largest r with r^dimensions <= entries.
+func vorbisLookup1Values(entries, dimensions int) int {
+	r := int(math.Floor(math.Pow(float64(entries), 1/float64(dimensions))))
+	power := func(r int) float64 { return math.Pow(float64(r), float64(dimensions)) }
+	for power(r+1) <= float64(entries) {
+		r++
+	}
+	for r > 0 && power(r) > float64(entries) {
+		r--
+	}
+	return r
+}
+
+type vorbisCodebook struct {
+	dimensions int
+	entries    int
+	tree       [][2]int32 // >0 child node, <0 leaf -(entry+1), 0 empty
+	single     int        // the only used entry, or -1
+	singleLen  int
+	values     []float32 // entries*dimensions, nil without a lookup table
+}
+
+func (d *vorbisDecoder) readCodebook(br *vorbisBitReader) (vorbisCodebook, error) {
+	if br.read(24) != 0x564342 {
+		return vorbisCodebook{}, fmt.Errorf("%w: bad codebook sync", errVorbisSetup)
+	}
+	book := vorbisCodebook{dimensions: int(br.read(16)), entries: int(br.read(24)), single: -1}
+	if book.dimensions == 0 || book.entries == 0 {
+		return book, fmt.Errorf("%w: empty codebook", errVorbisSetup)
+	}
+	lengths := make([]uint8, book.entries)
+	if !br.flag() {
+		sparse := br.flag()
+		for i := range lengths {
+			if !sparse || br.flag() {
+				lengths[i] = uint8(br.read(5) + 1)
+			}
+		}
+	} else {
+		length := int(br.read(5) + 1)
+		for entry := 0; entry < book.entries; length++ {
+			count := int(br.read(vorbisILog(book.entries - entry)))
+			if entry+count > book.entries || length > 32 {
+				return book, fmt.Errorf("%w: bad codeword lengths", errVorbisSetup)
+			}
+			for i := range count {
+				lengths[entry+i] = uint8(length)
+			}
+			entry += count
+		}
+	}
+	if err := book.buildTree(lengths); err != nil {
+		return book, err
+	}
+
+	switch lookup := br.read(4); lookup {
+	case 0:
+	case 1, 2:
+		minimum := vorbisFloat32(br.read(32))
+		delta := vorbisFloat32(br.read(32))
+		valueBits := int(br.read(4) + 1)
+		sequence := br.flag()
+		count := book.entries * book.dimensions
+		if lookup == 1 {
+			count = vorbisLookup1Values(book.entries, book.dimensions)
+		}
+		if book.entries*book.dimensions > maxVorbisCodebookValues {
+			return book, fmt.Errorf("%w: codebook too large", errVorbisSetup)
+		}
+		multiplicands := make([]float32, count)
+		for i := range multiplicands {
+			multiplicands[i] = float32(br.read(valueBits))
+		}
+		book.values = make([]float32, book.entries*book.dimensions)
+		for entry := range book.entries {
+			last := float32(0)
+			divisor := 1
+			for i := range book.dimensions {
+				index := entry*book.dimensions + i
+				if lookup == 1 {
+					index = entry / divisor % count
+					divisor *= count
+				}
+				value := multiplicands[index]*delta + minimum + last
+				book.values[entry*book.dimensions+i] = value
+				if sequence {
+					last = value
+				}
+			}
+		}
+	default:
+		return book, fmt.Errorf("%w: codebook lookup type %d", errVorbisSetup, lookup)
+	}
+	if br.eop {
+		return book, fmt.Errorf("%w: truncated codebook", errVorbisSetup)
+	}
+	return book, nil
+}
+
+// buildTree assigns codewords in entry order, each taking the lowest free
+// codeword of its length, and builds the decoding tree.
+func (c *vorbisCodebook) buildTree(lengths []uint8) error {
+	used := 0
+	for entry, length := range lengths {
+		if length > 0 {
+			used++
+			c.single, c.singleLen = entry, int(length)
+		}
+	}
+	if used != 1 {
+		c.single = -1
+	}
+	if used <= 1 {
+		return nil
+	}
+
+	var available [33]uint32
+	c.tree = [][2]int32{{}}
+	first := true
+	for entry, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		var code uint32
+		if first {
+			first = false
+			for i := 1; i <= int(length); i++ {
+				available[i] = 1 << (32 - i)
+			}
+		} else {
+			z := int(length)
+			for z > 0 && available[z] == 0 {
+				z--
+			}
+			if z == 0 {
+				return fmt.Errorf("%w: overspecified codebook", errVorbisSetup)
+			}
+			code = available[z]
+			available[z] = 0
+			for y := int(length); y > z; y-- {
+				available[y] = code + 1<<(32-y)
+			}
+		}
+
+		node := 0
+		for i := range int(length) {
+			bit := code >> (31 - i) & 1
+			if i == int(length)-1 {
+				c.tree[node][bit] = -int32(entry + 1)
+				break
+			}
+			next := c.tree[node][bit]
+			if next < 0 {
+				return fmt.Errorf("%w: codeword is a prefix of another", errVorbisSetup)
+			}
+			if next == 0 {
+				next = int32(len(c.tree))
+				c.tree[node][bit] = next
+				c.tree = append(c.tree, [2]int32{})
+			}
+			node = int(next)
+		}
+	}
+	return nil
+}
+
+// decodeScalar reads one codeword and returns its entry, or -1 at the end
+// of the packet or on an unused codeword.
+func (c *vorbisCodebook) decodeScalar(br *vorbisBitReader) int {
+	if c.single >= 0 {
+		br.read(c.singleLen)
+		if br.eop {
+			return -1
+		}
+		return c.single
+	}
+	if c.tree == nil {
+		return -1
+	}
+	node := int32(0)
+	for {
+		next := c.tree[node][br.read(1)]
+		if br.eop || next == 0 {
+			return -1
+		}
+		if next < 0 {
+			return int(-next - 1)
+		}
+		node = next
+	}
+}
+
+func (c *vorbisCodebook) decodeVector(br *vorbisBitReader) []float32 {
+	entry := c.decodeScalar(br)
+	if entry < 0 || c.values == nil {
+		return nil
+	}
+	return c.values[entry*c.dimensions : (entry+1)*c.dimensions]
+}
+
+// vorbisFloor decodes the spectral envelope of one channel into curve
+// (blocksize/2 values) and reports false when the channel is unused.
+type vorbisFloor interface {
+	decode(d *vorbisDecoder, br *vorbisBitReader, curve []float32) bool
+}
+
+type vorbisFloor0 struct {
+	order           int
+	rate            int
+	barkMapSize     int
+	amplitudeBits   int
+	amplitudeOffset int
+	books           []int
+	maps            map[int][]int
+}
+
+func vorbisBark(x float64) float64 {
+	return 13.1*math.Atan(.00074*x) + 2.24*math.Atan(.0000000185*x*x) + .0001*x
+}
+
+func (f *vorbisFloor0) decode(d *vorbisDecoder, br *vorbisBitReader, curve []float32) bool {
+	amplitude := int(br.read(f.amplitudeBits))
+	if amplitude == 0 || br.eop {
+		return false
+	}
+	bookNumber := int(br.read(vorbisILog(len(f.books))))
+	if bookNumber >= len(f.books) {
+		return false
+	}
+	book := &d.codebooks[f.books[bookNumber]]
+	coefficients := make([]float64, 0, f.order+book.dimensions)
+	last := 0.0
+	for len(coefficients) < f.order {
+		vector := book.decodeVector(br)
+		if vector == nil {
+			return false
+		}
+		for _, value := range vector {
+			coefficients = append(coefficients, float64(value)+last)
+		}
+		last = coefficients[len(coefficients)-1]
+	}
+	for i := range coefficients {
+		coefficients[i] = math.Cos(coefficients[i])
+	}
+
+	n := len(curve)
+	barkMap := f.maps[n]
+	if barkMap == nil {
+		barkMap = make([]int, n+1)
+		scale := float64(f.barkMapSize) / vorbisBark(.5*float64(f.rate))
+		for i := range n {
+			barkMap[i] = min(f.barkMapSize-1, int(math.Floor(vorbisBark(float64(f.rate*i)/float64(2*n))*scale)))
+		}
+		barkMap[n] = -1
+		f.maps[n] = barkMap
+	}
+	for i := 0; i < n; {
+		omega := math.Pi * float64(barkMap[i]) / float64(f.barkMapSize)
+		cosOmega := math.Cos(omega)
+		var p, q float64
+		if f.order%2 == 1 {
+			p, q = 1-cosOmega*cosOmega, .25
+		} else {
+			p, q = (1-cosOmega)/2, (1+cosOmega)/2
+		}
+		for j := 0; j < f.order; j++ {
+			term := 4 * (coefficients[j] - cosOmega) * (coefficients[j] - cosOmega)
+			if j%2 == 1 {
+				p *= term
+			} else {
+				q *= term
+			}
+		}
+		maxAmplitude := float64(int(1)<<f.amplitudeBits - 1)
+		value := float32(math.Exp(.11512925 * (float64(amplitude)*float64(f.amplitudeOffset)/(maxAmplitude*math.Sqrt(p+q)) - float64(f.amplitudeOffset))))
+		for mapped := barkMap[i]; i < n && barkMap[i] == mapped; i++ {
+			curve[i] = value
+		}
+	}
+	return true
+}
+
+type vorbisFloor1 struct {
+	partitionClass  []int
+	classDimensions []int
+	classSubclasses []int
+	classMasterbook []int
+	subclassBooks   [][]int
+	multiplier      int
+	xList           []int
+	low, high       []int // neighbours of each x in list order
+	order           []int // indices of xList in ascending x
+	y               []int
+	finalY          []int
+	step2           []bool
+	line            []int
+}
+
+var vorbisFloor1Ranges = [4]int{256, 128, 86, 64}
+
+// vorbisInverseDB is the floor1 amplitude table of the specification, a
+// geometric series from 1.0649863e-07 to 1.
+var vorbisInverseDB = func() (table [256]float32) {
+	for i := range table {
+		table[i] = float32(math.Pow(1.0649863e-07, float64(255-i)/255))
+	}
+	return table
+}()
+
+func (d *vorbisDecoder) readFloor1(br *vorbisBitReader) (*vorbisFloor1, error) {
+	f := &vorbisFloor1{partitionClass: make([]int, br.read(5))}
+	maxClass := -1
+	for i := range f.partitionClass {
+		f.partitionClass[i] = int(br.read(4))
+		maxClass = max(maxClass, f.partitionClass[i])
+	}
+	for range maxClass + 1 {
+		dimensions := int(br.read(3) + 1)
+		subclasses := int(br.read(2))
+		master := -1
+		if subclasses > 0 {
+			master = int(br.read(8))
+			if master >= len(d.codebooks) {
+				return nil, fmt.Errorf("%w: floor1 masterbook", errVorbisSetup)
+			}
+		}
+		books := make([]int, 1<<subclasses)
+		for j := range books {
+			books[j] = int(br.read(8)) - 1
+			if books[j] >= len(d.codebooks) {
+				return nil, fmt.Errorf("%w: floor1 subclass book", errVorbisSetup)
+			}
+		}
+		f.classDimensions = append(f.classDimensions, dimensions)
+		f.classSubclasses = append(f.classSubclasses, subclasses)
+		f.classMasterbook = append(f.classMasterbook, master)
+		f.subclassBooks = append(f.subclassBooks, books)
+	}
+	f.multiplier = int(br.read(2) + 1)
+	rangeBits := int(br.read(4))
+	f.xList = []int{0, 1 << rangeBits}
+	for _, class := range f.partitionClass {
+		for range f.classDimensions[class] {
+			f.xList = append(f.xList, int(br.read(rangeBits)))
+		}
+	}
+	if len(f.xList) > 65 {
+		return nil, fmt.Errorf("%w: too many floor1 points", errVorbisSetup)
+	}
+
+	f.low = make([]int, len(f.xList))
+	f.high = make([]int, len(f.xList))
+	for i := 2; i < len(f.xList); i++ {
+		low, high := -1, -1
+		for j := range i {
+			if f.xList[j] == f.xList[i] {
+				return nil, fmt.Errorf("%w: duplicate floor1 point", errVorbisSetup)
+			}
+			if f.xList[j] < f.xList[i] && (low < 0 || f.xList[j] > f.xList[low]) {
+				low = j
+			}
+			if f.xList[j] > f.xList[i] && (high < 0 || f.xList[j] < f.xList[high]) {
+				high = j
+			}
+		}
+		f.low[i], f.high[i] = low, high
+	}
+	f.order = make([]int, len(f.xList))
+	for i := range f.order {
+		f.order[i] = i
+	}
+	slices.SortFunc(f.order, func(a, b int) int { return f.xList[a] - f.xList[b] })
+	f.y = make([]int, len(f.xList))
+	f.finalY = make([]int, len(f.xList))
+	f.step2 = make([]bool, len(f.xList))
+	return f, nil
+}
+
+func vorbisRenderPoint(x0, y0, x1, y1, x int) int {
+	dy := y1 - y0
+	adx := x1 - x0
+	offset := absInt(dy) * (x - x0) / adx
+	if dy < 0 {
+		return y0 - offset
+	}
+	return y0 + offset
+}
+
+func vorbisRenderLine(x0, y0, x1, y1 int, line []int) {
+	dy := y1 - y0
+	adx := x1 - x0
+	base := dy / adx
+	ady := absInt(dy) - absInt(base)*adx
+	step := base + 1
+	if dy < 0 {
+		step = base - 1
+	}
+	y, err := y0, 0
+	if x0 < len(line) {
+		line[x0] = y
+	}
+	for x := x0 + 1; x < min(x1, len(line)); x++ {
+		err += ady
+		if err >= adx {
+			err -= adx
+			y += step
+		} else {
+			y += base
+		}
+		line[x] = y
+	}
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (f *vorbisFloor1) decode(d *vorbisDecoder, br *vorbisBitReader, curve []float32) bool {
+	if !br.flag() {
+		return false
+	}
+	valueRange := vorbisFloor1Ranges[f.multiplier-1]
+	yBits := vorbisILog(valueRange - 1)
+	f.y[0] = int(br.read(yBits))
+	f.y[1] = int(br.read(yBits))
+	offset := 2
+	for _, class := range f.partitionClass {
+		dimensions := f.classDimensions[class]
+		subclassBits := f.classSubclasses[class]
+		mask := 1<<subclassBits - 1
+		classValue := 0
+		if subclassBits > 0 {
+			classValue = d.codebooks[f.classMasterbook[class]].decodeScalar(br)
+		}
+		for j := range dimensions {
+			book := f.subclassBooks[class][classValue&mask]
+			classValue >>= subclassBits
+			f.y[offset+j] = 0
+			if book >= 0 {
+				f.y[offset+j] = d.codebooks[book].decodeScalar(br)
+			}
+		}
+		offset += dimensions
+	}
+	if br.eop {
+		return false
+	}
+
+	// Amplitude value synthesis.
+	f.step2[0], f.step2[1] = true, true
+	f.finalY[0], f.finalY[1] = f.y[0], f.y[1]
+	for i := 2; i < len(f.xList); i++ {
+		low, high := f.low[i], f.high[i]
+		predicted := vorbisRenderPoint(f.xList[low], f.finalY[low], f.xList[high], f.finalY[high], f.xList[i])
+		value := f.y[i]
+		highRoom := valueRange - predicted
+		lowRoom := predicted
+		room := 2 * min(highRoom, lowRoom)
+		if value == 0 {
+			f.step2[i] = false
+			f.finalY[i] = predicted
+			continue
+		}
+		f.step2[low], f.step2[high], f.step2[i] = true, true, true
+		switch {
+		case value >= room && highRoom > lowRoom:
+			f.finalY[i] = value - lowRoom + predicted
+		case value >= room:
+			f.finalY[i] = predicted - value + highRoom - 1
+		case value%2 == 1:
+			f.finalY[i] = predicted - (value+1)/2
+		default:
+			f.finalY[i] = predicted + value/2
+		}
+	}
+
+	// Curve synthesis.
+	n := len(curve)
+	if cap(f.line) < n {
+		f.line = make([]int, n)
+	}
+	line := f.line[:n]
+	lx, ly := 0, f.finalY[f.order[0]]*f.multiplier
+	hx, hy := 0, 0
+	for _, i := range f.order[1:] {
+		if !f.step2[i] {
+			continue
+		}
+		hx, hy = f.xList[i], f.finalY[i]*f.multiplier
+		if lx < n {
+			vorbisRenderLine(lx, ly, hx, hy, line)
+		}
+		lx, ly = hx, hy
+	}
+	if hx < n {
+		vorbisRenderLine(hx, hy, n, hy, line)
+	}
+	for i, value := range line {
+		curve[i] = vorbisInverseDB[min(max(value, 0), 255)]
+	}
+	return true
+}
+
+type vorbisResidue struct {
+	kind            int
+	begin, end      int
+	partitionSize   int
+	classifications int
+	classbook       int
+	books           [][8]int // per classification and pass, -1 unused
+	classes         [][]int
+	interleaved     []float32
+}
+
+func (d *vorbisDecoder) readResidue(br *vorbisBitReader, kind int) (*vorbisResidue, error) {
+	r := &vorbisResidue{
+		kind:            kind,
+		begin:           int(br.read(24)),
+		end:             int(br.read(24)),
+		partitionSize:   int(br.read(24) + 1),
+		classifications: int(br.read(6) + 1),
+		classbook:       int(br.read(8)),
+	}
+	if r.classbook >= len(d.codebooks) || d.codebooks[r.classbook].dimensions == 0 {
+		return nil, fmt.Errorf("%w: residue classbook", errVorbisSetup)
+	}
+	cascade := make([]int, r.classifications)
+	for i := range cascade {
+		low := int(br.read(3))
+		high := 0
+		if br.flag() {
+			high = int(br.read(5))
+		}
+		cascade[i] = high<<3 | low
+	}
+	r.books = make([][8]int, r.classifications)
+	for i := range r.books {
+		for pass := range 8 {
+			r.books[i][pass] = -1
+			if cascade[i]&(1<<pass) != 0 {
+				book := int(br.read(8))
+				if book >= len(d.codebooks) || d.codebooks[book].values == nil {
+					return nil, fmt.Errorf("%w: residue book", errVorbisSetup)
+				}
+				r.books[i][pass] = book
+			}
+		}
+	}
+	return r, nil
+}
+
+// decode adds the residue of the channels in vectors (each n long);
+// channels marked in skip are not coded in the packet.
+func (r *vorbisResidue) decode(d *vorbisDecoder, br *vorbisBitReader, vectors [][]float32, skip []bool, n int) {
+	if r.kind != 2 {
+		r.decodeVectors(d, br, vectors, skip, n, r.kind)
+		return
+	}
+	if !slices.Contains(skip, false) {
+		return
+	}
+	channels := len(vectors)
+	if cap(r.interleaved) < n*channels {
+		r.interleaved = make([]float32, n*channels)
+	}
+	flat := r.interleaved[:n*channels]
+	clear(flat)
+	r.decodeVectors(d, br, [][]float32{flat}, []bool{false}, n*channels, 1)
+	for i := range n {
+		for j, vector := range vectors {
+			vector[i] = flat[i*channels+j]
+		}
+	}
+}
+
+func (r *vorbisResidue) decodeVectors(d *vorbisDecoder, br *vorbisBitReader, vectors [][]float32, skip []bool, n, kind int) {
+	classbook := &d.codebooks[r.classbook]
+	begin, end := min(r.begin, n), min(r.end, n)
+	if end <= begin {
+		return
+	}
+	partitions := (end - begin) / r.partitionSize
+	perWord := classbook.dimensions
+	for len(r.classes) < len(vectors) {
+		r.classes = append(r.classes, nil)
+	}
+	for j := range vectors {
+		if cap(r.classes[j]) < partitions+perWord {
+			r.classes[j] = make([]int, partitions+perWord)
+		}
+		r.classes[j] = r.classes[j][:partitions+perWord]
+	}
+
+	for pass := range 8 {
+		for partition := 0; partition < partitions; {
+			if pass == 0 {
+				for j := range vectors {
+					if skip[j] {
+						continue
+					}
+					word := classbook.decodeScalar(br)
+					if word < 0 {
+						return
+					}
+					for i := perWord - 1; i >= 0; i-- {
+						r.classes[j][partition+i] = word % r.classifications
+						word /= r.classifications
+					}
+				}
+			}
+			for i := 0; i < perWord && partition < partitions; i, partition = i+1, partition+1 {
+				for j, vector := range vectors {
+					if skip[j] {
+						continue
+					}
+					book := r.books[r.classes[j][partition]][pass]
+					if book < 0 {
+						continue
+					}
+					offset := begin + partition*r.partitionSize
+					if !decodeVorbisPartition(&d.codebooks[book], br, vector[offset:offset+r.partitionSize], kind) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+func decodeVorbisPartition(book *vorbisCodebook, br *vorbisBitReader, out []float32, kind int) bool {
+	if kind == 0 {
+		step := len(out) / book.dimensions
+		for i := range step {
+			vector := book.decodeVector(br)
+			if vector == nil {
+				return false
+			}
+			for j, value := range vector {
+				out[i+j*step] += value
+			}
+		}
+		return true
+	}
+	for i := 0; i < len(out); {
+		vector := book.decodeVector(br)
+		if vector == nil {
+			return false
+		}
+		for _, value := range vector {
+			if i >= len(out) {
+				break
+			}
+			out[i] += value
+			i++
+		}
+	}
+	return true
+}
+
+type vorbisMapping struct {
+	magnitude, angle []int
+	mux              []int
+	submapFloor      []int
+	submapResidue    []int
+}
+
+type vorbisMode struct {
+	long    bool
+	mapping int
+}
+
+// vorbisIMDCT computes y[n] = sum_k x[k] cos(2pi/N (n + 1/2 + N/4)(k + 1/2))
+// for a block of N outputs through a DCT-IV built on an N/4 point FFT.
+type vorbisIMDCT struct {
+	n         int
+	pre, post []complex128
+	twiddles  []complex128
+	reverse   []int
+	buffer    []complex128
+	dct       []float64
+}
+
+func newVorbisIMDCT(n int) *vorbisIMDCT {
+	m := n / 2
+	l := n / 4
+	t := &vorbisIMDCT{
+		n:        n,
+		pre:      make([]complex128, l),
+		post:     make([]complex128, l),
+		twiddles: make([]complex128, l/2),
+		reverse:  make([]int, l),
+		buffer:   make([]complex128, l),
+		dct:      make([]float64, m),
+	}
+	for j := range l {
+		t.pre[j] = cmplx.Exp(complex(0, -math.Pi*float64(j)/float64(m)))
+		t.post[j] = cmplx.Exp(complex(0, -math.Pi*(float64(j)+.25)/float64(m)))
+	}
+	for k := range t.twiddles {
+		t.twiddles[k] = cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(l)))
+	}
+	shift := bits.LeadingZeros(uint(l)) + 1
+	for i := range l {
+		t.reverse[i] = int(bits.Reverse(uint(i)) >> shift)
+	}
+	return t
+}
+
+// fft transforms buffer in place (forward, unnormalised).
+func (t *vorbisIMDCT) fft() {
+	l := len(t.buffer)
+	for i, j := range t.reverse {
+		if i < j {
+			t.buffer[i], t.buffer[j] = t.buffer[j], t.buffer[i]
+		}
+	}
+	for size := 2; size <= l; size <<= 1 {
+		half := size / 2
+		stride := l / size
+		for start := 0; start < l; start += size {
+			for k := range half {
+				w := t.twiddles[k*stride] * t.buffer[start+k+half]
+				t.buffer[start+k+half] = t.buffer[start+k] - w
+				t.buffer[start+k] += w
+			}
+		}
+	}
+}
+
+// transform writes the N outputs for the N/2 coefficients in x.
+func (t *vorbisIMDCT) transform(x []float32, y []float32) {
+	m := t.n / 2
+	l := t.n / 4
+	for j := range l {
+		t.buffer[j] = complex(float64(x[2*j]), float64(x[m-1-2*j])) * t.pre[j]
+	}
+	t.fft()
+	for p := range l {
+		s := t.buffer[p] * t.post[p]
+		t.dct[2*p] = real(s)
+		t.dct[m-1-2*p] = -imag(s)
+	}
+	for i := range m / 2 {
+		y[i] = float32(t.dct[i+m/2])
+	}
+	for i := m / 2; i < 3*m/2; i++ {
+		y[i] = float32(-t.dct[3*m/2-1-i])
+	}
+	for i := 3 * m / 2; i < 2*m; i++ {
+		y[i] = float32(-t.dct[i-3*m/2])
+	}
+}
+
+type vorbisDecoder struct {
+	channels  int
+	rate      int
+	blocksize [2]int
+	codebooks []vorbisCodebook
+	floors    []vorbisFloor
+	residues  []*vorbisResidue
+	mappings  []vorbisMapping
+	modes     []vorbisMode
+	imdct     [2]*vorbisIMDCT
+	slopes    [2][]float32 // rising window half for each block size
+
+	curves    [][]float32
+	spectra   [][]float32
+	blocks    [][]float32
+	previous  [][]float32 // right half of the last block, windowed
+	prevN     int         // 0 before the first block
+	unused    []bool
+	noResidue []bool
+	mono      []int
+}
+
+func (d *vorbisDecoder) readIdentification(packet []byte) error {
+	if len(packet) < 30 || !bytes.HasPrefix(packet, []byte("\x01vorbis")) {
+		return errors.New("invalid Vorbis identification header")
+	}
+	if version := binary.LittleEndian.Uint32(packet[7:11]); version != 0 {
+		return fmt.Errorf("unsupported Vorbis version %d", version)
+	}
+	d.channels = int(packet[11])
+	d.rate = int(binary.LittleEndian.Uint32(packet[12:16]))
+	d.blocksize = [2]int{1 << (packet[28] & 15), 1 << (packet[28] >> 4)}
+	if d.channels == 0 || d.rate == 0 || d.blocksize[0] < 64 || d.blocksize[0] > d.blocksize[1] || d.blocksize[1] > 8192 || packet[29]&1 == 0 {
+		return errors.New("invalid Vorbis identification header")
+	}
+	for i, n := range d.blocksize {
+		d.imdct[i] = newVorbisIMDCT(n)
+		d.slopes[i] = make([]float32, n/2)
+		for j := range d.slopes[i] {
+			s := math.Sin((float64(j) + .5) / float64(n/2) * math.Pi / 2)
+			d.slopes[i][j] = float32(math.Sin(math.Pi / 2 * s * s))
+		}
+	}
+	for range d.channels {
+		d.curves = append(d.curves, make([]float32, d.blocksize[1]/2))
+		d.spectra = append(d.spectra, make([]float32, d.blocksize[1]/2))
+		d.blocks = append(d.blocks, make([]float32, d.blocksize[1]))
+		d.previous = append(d.previous, make([]float32, d.blocksize[1]/2))
+	}
+	d.unused = make([]bool, d.channels)
+	d.noResidue = make([]bool, d.channels)
+	return nil
+}
+
+func (d *vorbisDecoder) readSetup(packet []byte) error {
+	if !bytes.HasPrefix(packet, []byte("\x05vorbis")) {
+		return errors.New("invalid Vorbis setup header")
+	}
+	br := &vorbisBitReader{data: packet[7:]}
+
+	for range br.read(8) + 1 {
+		book, err := d.readCodebook(br)
+		if err != nil {
+			return err
+		}
+		d.codebooks = append(d.codebooks, book)
+	}
+	for range br.read(6) + 1 {
+		if br.read(16) != 0 {
+			return fmt.Errorf("%w: time domain transform", errVorbisSetup)
+		}
+	}
+
+	for range br.read(6) + 1 {
+		switch kind := br.read(16); kind {
+		case 0:
+			f := &vorbisFloor0{
+				order:           int(br.read(8)),
+				rate:            int(br.read(16)),
+				barkMapSize:     int(br.read(16)),
+				amplitudeBits:   int(br.read(6)),
+				amplitudeOffset: int(br.read(8)),
+				maps:            make(map[int][]int),
+			}
+			for range br.read(4) + 1 {
+				book := int(br.read(8))
+				if book >= len(d.codebooks) {
+					return fmt.Errorf("%w: floor0 book", errVorbisSetup)
+				}
+				f.books = append(f.books, book)
+			}
+			if f.rate == 0 || f.barkMapSize == 0 || f.order == 0 {
+				return fmt.Errorf("%w: floor0", errVorbisSetup)
+			}
+			d.floors = append(d.floors, f)
+		case 1:
+			f, err := d.readFloor1(br)
+			if err != nil {
+				return err
+			}
+			d.floors = append(d.floors, f)
+		default:
+			return fmt.Errorf("%w: floor type %d", errVorbisSetup, kind)
+		}
+	}
+
+	for range br.read(6) + 1 {
+		kind := int(br.read(16))
+		if kind > 2 {
+			return fmt.Errorf("%w: residue type %d", errVorbisSetup, kind)
+		}
+		r, err := d.readResidue(br, kind)
+		if err != nil {
+			return err
+		}
+		d.residues = append(d.residues, r)
+	}
+
+	for range br.read(6) + 1 {
+		if br.read(16) != 0 {
+			return fmt.Errorf("%w: mapping type", errVorbisSetup)
+		}
+		submaps := 1
+		if br.flag() {
+			submaps = int(br.read(4) + 1)
+		}
+		var m vorbisMapping
+		if br.flag() {
+			channelBits := vorbisILog(d.channels - 1)
+			for range br.read(8) + 1 {
+				magnitude, angle := int(br.read(channelBits)), int(br.read(channelBits))
+				if magnitude == angle || magnitude >= d.channels || angle >= d.channels {
+					return fmt.Errorf("%w: channel coupling", errVorbisSetup)
+				}
+				m.magnitude = append(m.magnitude, magnitude)
+				m.angle = append(m.angle, angle)
+			}
+		}
+		if br.read(2) != 0 {
+			return fmt.Errorf("%w: mapping reserved bits", errVorbisSetup)
+		}
+		m.mux = make([]int, d.channels)
+		if submaps > 1 {
+			for i := range m.mux {
+				m.mux[i] = int(br.read(4))
+				if m.mux[i] >= submaps {
+					return fmt.Errorf("%w: mapping mux", errVorbisSetup)
+				}
+			}
+		}
+		for range submaps {
+			br.read(8)
+			floor, residue := int(br.read(8)), int(br.read(8))
+			if floor >= len(d.floors) || residue >= len(d.residues) {
+				return fmt.Errorf("%w: mapping submap", errVorbisSetup)
+			}
+			m.submapFloor = append(m.submapFloor, floor)
+			m.submapResidue = append(m.submapResidue, residue)
+		}
+		d.mappings = append(d.mappings, m)
+	}
+
+	for range br.read(6) + 1 {
+		mode := vorbisMode{long: br.flag()}
+		if br.read(16) != 0 || br.read(16) != 0 {
+			return fmt.Errorf("%w: mode window or transform type", errVorbisSetup)
+		}
+		mode.mapping = int(br.read(8))
+		if mode.mapping >= len(d.mappings) {
+			return fmt.Errorf("%w: mode mapping", errVorbisSetup)
+		}
+		d.modes = append(d.modes, mode)
+	}
+	if !br.flag() || br.eop {
+		return fmt.Errorf("%w: missing framing bit", errVorbisSetup)
+	}
+	return nil
+}
+
+func (d *vorbisDecoder) SampleRate() int { return d.rate }
+
+// Reset forgets the previous block, as at the start of the stream.
+func (d *vorbisDecoder) Reset() { d.prevN = 0 }
+
+// DecodePacket decodes one audio packet and returns the samples finished
+// by it: none for the first packet, then the overlap of the previous and
+// the current block. Packets that cannot be decoded return no samples.
+func (d *vorbisDecoder) DecodePacket(packet []byte) ([]int, error) {
+	br := &vorbisBitReader{data: packet}
+	if br.flag() || br.eop {
+		return nil, nil
+	}
+	modeNumber := int(br.read(vorbisILog(len(d.modes) - 1)))
+	if br.eop || modeNumber >= len(d.modes) {
+		return nil, nil
+	}
+	mode := d.modes[modeNumber]
+	n := d.blocksize[0]
+	previousLong, nextLong := false, false
+	if mode.long {
+		n = d.blocksize[1]
+		previousLong, nextLong = br.flag(), br.flag()
+		if br.eop {
+			return nil, nil
+		}
+	}
+	half := n / 2
+	mapping := &d.mappings[mode.mapping]
+
+	for ch := range d.channels {
+		floor := d.floors[mapping.submapFloor[mapping.mux[ch]]]
+		d.unused[ch] = !floor.decode(d, br, d.curves[ch][:half])
+		d.noResidue[ch] = d.unused[ch]
+		clear(d.spectra[ch][:half])
+	}
+	for i := range mapping.magnitude {
+		magnitude, angle := mapping.magnitude[i], mapping.angle[i]
+		if !d.noResidue[magnitude] || !d.noResidue[angle] {
+			d.noResidue[magnitude], d.noResidue[angle] = false, false
+		}
+	}
+	for submap, residue := range mapping.submapResidue {
+		var vectors [][]float32
+		var skip []bool
+		for ch := range d.channels {
+			if mapping.mux[ch] == submap {
+				vectors = append(vectors, d.spectra[ch][:half])
+				skip = append(skip, d.noResidue[ch])
+			}
+		}
+		d.residues[residue].decode(d, br, vectors, skip, half)
+	}
+	for i := len(mapping.magnitude) - 1; i >= 0; i-- {
+		magnitudes, angles := d.spectra[mapping.magnitude[i]], d.spectra[mapping.angle[i]]
+		for j := range half {
+			m, a := magnitudes[j], angles[j]
+			switch {
+			case m > 0 && a > 0:
+				magnitudes[j], angles[j] = m, m-a
+			case m > 0:
+				magnitudes[j], angles[j] = m+a, m
+			case a > 0:
+				magnitudes[j], angles[j] = m, m+a
+			default:
+				magnitudes[j], angles[j] = m-a, m
+			}
+		}
+	}
+
+	long := 0
+	if mode.long {
+		long = 1
+	}
+	leftStart, leftN := 0, half
+	rightStart, rightN := half, half
+	if mode.long && !previousLong {
+		leftN = d.blocksize[0] / 2
+		leftStart = n/4 - leftN/2
+	}
+	if mode.long && !nextLong {
+		rightN = d.blocksize[0] / 2
+		rightStart = n*3/4 - rightN/2
+	}
+	leftSlope, rightSlope := d.slopes[long], d.slopes[long]
+	if leftN != half {
+		leftSlope = d.slopes[0]
+	}
+	if rightN != half {
+		rightSlope = d.slopes[0]
+	}
+
+	for ch := range d.channels {
+		block := d.blocks[ch][:n]
+		if d.unused[ch] {
+			clear(block)
+			continue
+		}
+		spectrum := d.spectra[ch][:half]
+		for j, value := range d.curves[ch][:half] {
+			spectrum[j] *= value
+		}
+		d.imdct[long].transform(spectrum, block)
+		for i := range block {
+			switch {
+			case i < leftStart || i >= rightStart+rightN:
+				block[i] = 0
+			case i < leftStart+leftN:
+				block[i] *= leftSlope[i-leftStart]
+			case i >= rightStart:
+				block[i] *= rightSlope[rightN-1-(i-rightStart)]
+			}
+		}
+	}
+
+	// Overlap-add from the centre of the previous block to the centre of
+	// this one.
+	d.mono = d.mono[:0]
+	if d.prevN > 0 {
+		count := d.prevN/4 + n/4
+		offset := d.prevN/4 - n/4
+		scale := 32767 / float32(d.channels)
+		for t := range count {
+			var sum float32
+			for ch := range d.channels {
+				if t < d.prevN/2 {
+					sum += d.previous[ch][t]
+				}
+				if j := t - offset; j >= 0 && j < half {
+					sum += d.blocks[ch][j]
+				}
+			}
+			d.mono = append(d.mono, clampPCM(int(math.Round(float64(sum*scale)))))
+		}
+	}
+	for ch := range d.channels {
+		copy(d.previous[ch], d.blocks[ch][half:n])
+	}
+	d.prevN = n
+	return d.mono, nil
+}
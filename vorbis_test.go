@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gopusogg "github.com/thesyncim/gopus/container/ogg"
+)
+
+func TestVorbisIMDCTMatchesDefinition(t *testing.T) {
+	for _, n := range []int{64, 256, 2048} {
+		x := make([]float32, n/2)
+		for k := range x {
+			x[k] = float32(math.Sin(float64(k*k)*0.37) + 0.1*float64(k%5))
+		}
+		y := make([]float32, n)
+		newVorbisIMDCT(n).transform(x, y)
+		for i := range n {
+			var want float64
+			for k := range n / 2 {
+				want += float64(x[k]) * math.Cos(2*math.Pi/float64(n)*(float64(i)+.5+float64(n)/4)*(float64(k)+.5))
+			}
+			if math.Abs(float64(y[i])-want) > 1e-3*float64(n) {
+				t.Fatalf("n=%d y[%d] = %f, want %f", n, i, y[i], want)
+			}
+		}
+	}
+}
+
+func TestVorbisCodewordAssignment(t *testing.T) {
+	// Example from the specification: lengths 2 4 4 4 4 2 3 3.
+	var book vorbisCodebook
+	if err := book.buildTree([]uint8{2, 4, 4, 4, 4, 2, 3, 3}); err != nil {
+		t.Fatal(err)
+	}
+	codewords := []string{"00", "0100", "0101", "0110", "0111", "10", "110", "111"}
+	for entry, codeword := range codewords {
+		var w vorbisBitWriter
+		for _, c := range codeword {
+			w.write(uint32(c-'0'), 1)
+		}
+		if got := book.decodeScalar(&vorbisBitReader{data: w.data}); got != entry {
+			t.Errorf("codeword %s decoded as %d, want %d", codeword, got, entry)
+		}
+	}
+	if err := book.buildTree([]uint8{1, 1, 1}); err == nil {
+		t.Error("overspecified codebook accepted")
+	}
+}
+
+func TestVorbisHelpers(t *testing.T) {
+	if got := vorbisFloat32(vorbisPackFloat(-3, -2)); got != -0.75 {
+		t.Errorf("float32 unpack = %f", got)
+	}
+	for _, c := range [][3]int{{16, 2, 4}, {17, 2, 4}, {15, 2, 3}, {4096, 1, 4096}, {27, 3, 3}, {1, 4, 1}} {
+		if got := vorbisLookup1Values(c[0], c[1]); got != c[2] {
+			t.Errorf("lookup1Values(%d, %d) = %d, want %d", c[0], c[1], got, c[2])
+		}
+	}
+	if vorbisInverseDB[0] != 1.0649863e-07 || vorbisInverseDB[255] != 1 || math.Abs(float64(vorbisInverseDB[1])-1.1341951e-07) > 1e-13 {
+		t.Errorf("inverse dB table = %g %g %g", vorbisInverseDB[0], vorbisInverseDB[1], vorbisInverseDB[255])
+	}
+}
+
+// TestDecodeOggVorbis encodes a known signal with a plain forward MDCT into
+// a mono Vorbis stream mixing short and long blocks and checks the decoder
+// reconstructs it, trims the end and seeks to exact samples.
+func TestDecodeOggVorbis(t *testing.T) {
+	const rate = 8000
+	long := []bool{false, false, false, false, true, true, true, false, false, true, false, false, false, false, false, false}
+	for range 2 {
+		long = append(long, long[:16]...)
+	}
+	sizes := make([]int, len(long))
+	for i, isLong := range long {
+		sizes[i] = 256
+		if isLong {
+			sizes[i] = 2048
+		}
+	}
+	total := 0
+	for i := 1; i < len(sizes); i++ {
+		total += sizes[i-1]/4 + sizes[i]/4
+	}
+	signal := func(i int) float64 {
+		if i < 0 || i >= total {
+			return 0
+		}
+		x := float64(i) / rate
+		return 0.3*math.Sin(2*math.Pi*440*x) + 0.2*math.Sin(2*math.Pi*1234*x+1)
+	}
+	const trimmed = 37
+
+	path, title := writeTestVorbis(t, rate, sizes, signal, total-trimmed)
+	if title != "Test Tone" {
+		t.Fatalf("comment title = %q", title)
+	}
+	source, err := openOggSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if source.SampleRate() != rate || source.Length() != int64(total-trimmed) {
+		t.Fatalf("rate %d length %d, want %d %d", source.SampleRate(), source.Length(), rate, total-trimmed)
+	}
+	decoded := readAllBlocks(t, source)
+	if len(decoded) != total-trimmed {
+		t.Fatalf("decoded %d samples, want %d", len(decoded), total-trimmed)
+	}
+	var worst, sumSquares float64
+	for i, sample := range decoded {
+		diff := math.Abs(float64(sample) - signal(i)*32767)
+		worst = max(worst, diff)
+		sumSquares += diff * diff
+	}
+	if rms := math.Sqrt(sumSquares / float64(len(decoded))); worst > 600 || rms > 150 {
+		t.Fatalf("reconstruction error max %.0f rms %.0f", worst, rms)
+	}
+
+	for _, target := range []int{0, 100, 5000, len(decoded) - 10} {
+		if err := source.SeekSample(int64(target)); err != nil {
+			t.Fatal(err)
+		}
+		rest := readAllBlocks(t, source)
+		if len(rest) != len(decoded)-target {
+			t.Fatalf("after seeking to %d read %d samples, want %d", target, len(rest), len(decoded)-target)
+		}
+		for i, sample := range rest {
+			if sample != decoded[target+i] {
+				t.Fatalf("after seeking to %d sample %d = %d, want %d", target, i, sample, decoded[target+i])
+			}
+		}
+	}
+}
+
+// TestDecodeLibvorbisStereo decodes a stereo file written by libVorbis
+// (floor 1, residue 2, coupled channels) and compares the downmix with the
+// reference decode in testdata/README.md.
+func TestDecodeLibvorbisStereo(t *testing.T) {
+	const step = 16
+	reference, err := os.ReadFile(filepath.Join("testdata", "stereo_every16.s16"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := openOggSource(filepath.Join("testdata", "stereo.ogg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if source.SampleRate() != 44100 || source.Length() != 72384 {
+		t.Fatalf("rate %d length %d, want 44100 72384", source.SampleRate(), source.Length())
+	}
+	decoded := readAllBlocks(t, source)
+	if len(decoded) != 72384 || len(reference) != (len(decoded)+step-1)/step*2 {
+		t.Fatalf("decoded %d samples, reference %d bytes", len(decoded), len(reference))
+	}
+	for i := 0; i < len(decoded); i += step {
+		want := int(int16(binary.LittleEndian.Uint16(reference[i/step*2:])))
+		if diff := decoded[i] - want; diff < -2 || diff > 2 {
+			t.Fatalf("sample %d = %d, want %d", i, decoded[i], want)
+		}
+	}
+
+	if err := source.SeekSample(30000); err != nil {
+		t.Fatal(err)
+	}
+	rest := readAllBlocks(t, source)
+	if len(rest) != len(decoded)-30000 {
+		t.Fatalf("after seeking read %d samples, want %d", len(rest), len(decoded)-30000)
+	}
+	for i, sample := range rest {
+		if sample != decoded[30000+i] {
+			t.Fatalf("after seeking sample %d = %d, want %d", i, sample, decoded[30000+i])
+		}
+	}
+}
+
+func readAllBlocks(t *testing.T, source audioSource) []int {
+	t.Helper()
+	var pcm []int
+	for {
+		block, err := source.ReadBlock()
+		if errors.Is(err, io.EOF) {
+			return pcm
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcm = append(pcm, block...)
+	}
+}
+
+type vorbisBitWriter struct {
+	data []byte
+	bit  uint
+}
+
+func (w *vorbisBitWriter) write(value uint32, n int) {
+	for i := range n {
+		if w.bit == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(value>>i&1) << w.bit
+		w.bit = (w.bit + 1) % 8
+	}
+}
+
+func vorbisPackFloat(mantissa, exponent int) uint32 {
+	var sign uint32
+	if mantissa < 0 {
+		sign, mantissa = 0x80000000, -mantissa
+	}
+	return sign | uint32(exponent+788)<<21 | uint32(mantissa)
+}
+
+// writeTestVorbis writes a mono Ogg Vorbis file whose residue codebook
+// holds values from -2 to 2 in steps of 1/4096 and whose floor is flat at
+// 1.0, so the coefficients are the MDCT of the signal.
+func writeTestVorbis(t *testing.T, rate int, sizes []int, signal func(int) float64, granule int) (string, string) {
+	t.Helper()
+	const valueBits = 14
+	const entries = 1 << valueBits
+
+	identification := []byte("\x01vorbis")
+	identification = binary.LittleEndian.AppendUint32(identification, 0)
+	identification = append(identification, 1)
+	identification = binary.LittleEndian.AppendUint32(identification, uint32(rate))
+	identification = append(identification, make([]byte, 12)...)
+	identification = append(identification, 11<<4|8, 1)
+
+	comment := []byte("\x03vorbis")
+	for _, field := range []string{"test", "TITLE=Test Tone"} {
+		comment = binary.LittleEndian.AppendUint32(comment, uint32(len(field)))
+		comment = append(comment, field...)
+		if field == "test" {
+			comment = binary.LittleEndian.AppendUint32(comment, 1)
+		}
+	}
+	comment = append(comment, 1)
+
+	var w vorbisBitWriter
+	w.write(1, 8) // two codebooks
+	// Book 0: residue values.
+	w.write(0x564342, 24)
+	w.write(1, 16)
+	w.write(entries, 24)
+	w.write(0, 1)
+	w.write(0, 1)
+	for range entries {
+		w.write(valueBits-1, 5)
+	}
+	w.write(1, 4)
+	w.write(vorbisPackFloat(-2, 0), 32)
+	w.write(vorbisPackFloat(1, -12), 32)
+	w.write(valueBits-1, 4)
+	w.write(0, 1)
+	for i := range entries {
+		w.write(uint32(i), valueBits)
+	}
+	// Book 1: residue classifications, a single class.
+	w.write(0x564342, 24)
+	w.write(1, 16)
+	w.write(2, 24)
+	w.write(0, 1)
+	w.write(0, 1)
+	w.write(0, 5)
+	w.write(0, 5)
+	w.write(0, 4)
+
+	w.write(0, 6) // time domain transforms
+	w.write(0, 16)
+	w.write(0, 6) // one floor1 without partitions
+	w.write(1, 16)
+	w.write(0, 5)
+	w.write(0, 2)
+	w.write(10, 4)
+	w.write(0, 6) // one residue of type 1
+	w.write(1, 16)
+	w.write(0, 24)
+	w.write(1024, 24)
+	w.write(7, 24)
+	w.write(0, 6)
+	w.write(1, 8)
+	w.write(1, 3)
+	w.write(0, 1)
+	w.write(0, 8)
+	w.write(0, 6) // one mapping
+	w.write(0, 16)
+	w.write(0, 1)
+	w.write(0, 1)
+	w.write(0, 2)
+	w.write(0, 8)
+	w.write(0, 8)
+	w.write(0, 8)
+	w.write(1, 6) // short and long modes
+	for mode := range 2 {
+		w.write(uint32(mode), 1)
+		w.write(0, 16)
+		w.write(0, 16)
+		w.write(0, 8)
+	}
+	w.write(1, 1)
+	setup := append([]byte("\x05vorbis"), w.data...)
+
+	// Block j is centred where its output ends, so output sample i is
+	// signal sample i.
+	slope := func(size, j int) float64 {
+		s := math.Sin((float64(j) + .5) / float64(size/2) * math.Pi / 2)
+		return math.Sin(math.Pi / 2 * s * s)
+	}
+	var packets [][]byte
+	var granules []int
+	center, position := 0, 0
+	for j, n := range sizes {
+		if j > 0 {
+			center += sizes[j-1]/4 + n/4
+			position += sizes[j-1]/4 + n/4
+		}
+		previousLong := j > 0 && sizes[j-1] == n
+		nextLong := j+1 < len(sizes) && sizes[j+1] == n
+		if j == 0 {
+			previousLong = true
+		}
+		if j+1 == len(sizes) {
+			nextLong = true
+		}
+		window := make([]float64, n)
+		leftStart, leftN, rightStart, rightN := 0, n/2, n/2, n/2
+		if n == 2048 && !previousLong {
+			leftN = 128
+			leftStart = n/4 - leftN/2
+		}
+		if n == 2048 && !nextLong {
+			rightN = 128
+			rightStart = n*3/4 - rightN/2
+		}
+		for i := range window {
+			switch {
+			case i < leftStart || i >= rightStart+rightN:
+			case i < leftStart+leftN:
+				window[i] = slope(leftN*2, i-leftStart)
+			case i >= rightStart:
+				window[i] = slope(rightN*2, rightN-1-(i-rightStart))
+			default:
+				window[i] = 1
+			}
+		}
+
+		var p vorbisBitWriter
+		p.write(0, 1)
+		if n == 2048 {
+			p.write(1, 1)
+			p.write(boolBit(previousLong), 1)
+			p.write(boolBit(nextLong), 1)
+		} else {
+			p.write(0, 1)
+		}
+		p.write(1, 1) // floor1 at full scale
+		p.write(255, 8)
+		p.write(255, 8)
+		start := center - n/2
+		for partition := range n / 2 / 8 {
+			p.write(0, 1)
+			for k := partition * 8; k < partition*8+8; k++ {
+				var sum float64
+				for i := range n {
+					sum += window[i] * signal(start+i) * math.Cos(2*math.Pi/float64(n)*(float64(i)+.5+float64(n)/4)*(float64(k)+.5))
+				}
+				coefficient := sum * 4 / float64(n) // libvorbis forward MDCT scale
+				index := min(max(int(math.Round((coefficient+2)*4096)), 0), entries-1)
+				for bit := valueBits - 1; bit >= 0; bit-- {
+					p.write(uint32(index>>bit&1), 1)
+				}
+			}
+		}
+		packets = append(packets, p.data)
+		granules = append(granules, position)
+	}
+
+	var file bytes.Buffer
+	sequence := uint32(0)
+	writePage := func(packets [][]byte, flags byte, granule int64) {
+		page := gopusogg.Page{HeaderType: flags, GranulePos: uint64(granule), SerialNumber: 7, PageSequence: sequence}
+		sequence++
+		for _, packet := range packets {
+			page.Segments = append(page.Segments, gopusogg.BuildSegmentTable(len(packet))...)
+			page.Payload = append(page.Payload, packet...)
+		}
+		file.Write(page.Encode())
+	}
+	writePage([][]byte{identification}, 0x02, 0)
+	// The setup header is split across pages to exercise continuation.
+	headers := append(append([]byte(nil), comment...), setup...)
+	segments := append(gopusogg.BuildSegmentTable(len(comment)), gopusogg.BuildSegmentTable(len(setup))...)
+	for flags := byte(0); len(segments) > 0; flags = 0x01 {
+		count := min(len(segments), 100)
+		size := 0
+		for _, length := range segments[:count] {
+			size += int(length)
+		}
+		granule := int64(-1)
+		if count == len(segments) {
+			granule = 0
+		}
+		page := gopusogg.Page{HeaderType: flags, GranulePos: uint64(granule), SerialNumber: 7, PageSequence: sequence, Segments: segments[:count], Payload: headers[:size]}
+		sequence++
+		file.Write(page.Encode())
+		segments, headers = segments[count:], headers[size:]
+	}
+	for i := 0; i < len(packets); i += 6 {
+		end := min(i+6, len(packets))
+		flags, pageGranule := byte(0), int64(granules[end-1])
+		if end == len(packets) {
+			flags, pageGranule = 0x04, int64(granule)
+		}
+		writePage(packets[i:end], flags, pageGranule)
+	}
+
+	path := filepath.Join(t.TempDir(), "tone-0001.ogg")
+	if err := os.WriteFile(path, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	trackMeta, _, err := readOggMeta(f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, trackMeta.Title
+}
+
+func boolBit(value bool) uint32 {
+	if value {
+		return 1
+	}
+	return 0
+}
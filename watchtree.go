@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchTree 递归监听 dir 及其所有子目录，之后新建或移入的子目录也会自动加入监听。
+// 音频文件新增交给 onAdd，删除或移出交给 onRemove；整个子目录移入时补报其中已有的文件，
+// 子目录被删除或移出时交给 onRemoveDir 清理其下跟踪的文件。以 "." 开头的子目录不监听。
+func watchTree(dir string, onAdd, onRemove, onRemoveDir func(path string)) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal("❌ 无法创建 watcher:", err)
+	}
+	defer watcher.Close()
+
+	if err := addWatchTree(watcher, dir, nil); err != nil {
+		log.Printf("❌ 无法监听目录 %s: %v", dir, err)
+		return
+	}
+
+	log.Printf("👀 开始增量监听目录(含子目录): %s", dir)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			path := event.Name
+			switch {
+			case event.Has(fsnotify.Create):
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					if strings.HasPrefix(info.Name(), ".") {
+						continue
+					}
+					log.Printf("📁 新增子目录: %s", path)
+					if err := addWatchTree(watcher, path, onAdd); err != nil {
+						log.Printf("⚠️ 无法监听子目录 %s: %v", path, err)
+					}
+				} else if isSupportedAudioFile(path) {
+					onAdd(path)
+				}
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				if isSupportedAudioFile(path) {
+					onRemove(path)
+					continue
+				}
+				// 可能是子目录被删除或移出；移出的目录改名后不再属于这里，取消监听
+				watcher.Remove(path)
+				onRemoveDir(path)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("⚠️ 监听错误:", err)
+		}
+	}
+}
+
+// addWatchTree 监听 root 及其下所有子目录；onFile 不为 nil 时对其中已有的音频文件调用
+func addWatchTree(watcher *fsnotify.Watcher, root string, onFile func(path string)) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				if path == root {
+					return err
+				}
+				log.Printf("⚠️ 无法监听子目录 %s: %v", path, err)
+			}
+			return nil
+		}
+		if onFile != nil && isSupportedAudioFile(path) {
+			onFile(path)
+		}
+		return nil
+	})
+}
+
+// pathsUnder 返回 paths 中位于目录 dir 之下的路径
+func pathsUnder[T any](paths map[string]T, dir string) []string {
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	var matched []string
+	for path := range paths {
+		if strings.HasPrefix(filepath.Clean(path), prefix) {
+			matched = append(matched, path)
+		}
+	}
+	return matched
+}